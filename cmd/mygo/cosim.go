@@ -0,0 +1,385 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/template"
+
+	"mygo/internal/frontend"
+	"mygo/internal/ir"
+)
+
+// hardwareMainName is what the co-simulation calls the program's main
+// function, which the hardware runs instead.
+const hardwareMainName = "mygoHardwareMain"
+
+// designHasSoftware reports whether any goroutine is marked //mygo:software,
+// which makes the simulation a co-simulation.
+func designHasSoftware(design *ir.Design) bool {
+	if design == nil {
+		return false
+	}
+	for _, module := range design.Modules {
+		for _, proc := range module.Processes {
+			if proc.Software != nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type cosimPort struct {
+	Name  string
+	ID    int
+	Input bool
+	Mask  string
+}
+
+type cosimChannel struct {
+	Var      string
+	ElemType string
+	Depth    int
+}
+
+type cosimStream struct {
+	Name       string
+	Var        string
+	ToHardware bool
+	Data       int
+	Valid      int
+	Ready      int
+	Width      int
+}
+
+type cosimGoroutine struct {
+	Function string
+	Start    int
+	Args     []string
+}
+
+// cosimData feeds the bridge and driver templates. Ports are numbered by
+// their position in the top-level module.
+type cosimData struct {
+	CXXFlags    string
+	LDFlags     string
+	MaxCycles   int
+	ResetCycles int
+	Clk         int
+	Rst         int
+	Done        int
+	Ports       []cosimPort
+	Channels    []cosimChannel
+	Streams     []cosimStream
+	Goroutines  []cosimGoroutine
+}
+
+func newCosimData(module *ir.Module, maxCycles, resetCycles int) (*cosimData, error) {
+	data := &cosimData{MaxCycles: maxCycles, ResetCycles: resetCycles}
+	ids := make(map[string]int, len(module.Ports))
+	for idx, port := range module.Ports {
+		if port.Type.Width > 64 {
+			return nil, fmt.Errorf("port %s is %d bits wide; co-simulation carries at most 64 bits per port", port.Name, port.Type.Width)
+		}
+		ids[port.Name] = idx
+		data.Ports = append(data.Ports, cosimPort{
+			Name:  port.Name,
+			ID:    idx,
+			Input: port.Direction == ir.Input,
+			Mask:  portMask(port.Type.Width),
+		})
+	}
+	data.Clk, data.Rst, data.Done = ids["clk"], ids["rst"], ids["done"]
+
+	streamed := make(map[*ir.Channel]bool)
+	for _, stream := range module.Streams {
+		streamed[stream.Channel] = true
+		data.Streams = append(data.Streams, cosimStream{
+			Name:       stream.Name,
+			Var:        cosimChannelVar(stream.Channel),
+			ToHardware: stream.Direction == ir.Input,
+			Data:       ids[stream.PortName("data")],
+			Valid:      ids[stream.PortName("valid")],
+			Ready:      ids[stream.PortName("ready")],
+			Width:      stream.Channel.Type.Width,
+		})
+	}
+	declared := make(map[*ir.Channel]bool)
+	for _, proc := range module.Processes {
+		sw := proc.Software
+		if sw == nil {
+			continue
+		}
+		g := cosimGoroutine{Function: sw.Function, Start: ids[ir.SoftwareStartPort(proc)]}
+		for i, ch := range sw.Channels {
+			g.Args = append(g.Args, cosimChannelVar(ch))
+			if declared[ch] {
+				continue
+			}
+			declared[ch] = true
+			depth := ch.Depth
+			if streamed[ch] {
+				// The stream holds one value in flight; the hardware side
+				// keeps any FIFO.
+				depth = 0
+			}
+			data.Channels = append(data.Channels, cosimChannel{Var: cosimChannelVar(ch), ElemType: sw.ElemTypes[i], Depth: depth})
+		}
+		data.Goroutines = append(data.Goroutines, g)
+	}
+	return data, nil
+}
+
+// portMask keeps the bits a port of the given width holds, since Verilator
+// stores narrow ports in wider C integers.
+func portMask(width int) string {
+	if width >= 64 {
+		return "0xffffffffffffffff"
+	}
+	return fmt.Sprintf("%#x", uint64(1)<<width-1)
+}
+
+func cosimChannelVar(ch *ir.Channel) string {
+	var b strings.Builder
+	for _, r := range ch.Name {
+		if r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune('_')
+		}
+	}
+	return "mygoCosimChan_" + b.String()
+}
+
+func renderCosimTemplate(name string, data *cosimData) ([]byte, error) {
+	src, err := readTemplateFile(name)
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := template.New(name).Funcs(template.FuncMap{"join": strings.Join}).Parse(string(src))
+	if err != nil {
+		return nil, fmt.Errorf("parse template %s: %w", name, err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("render template %s: %w", name, err)
+	}
+	return buf.Bytes(), nil
+}
+
+// rewriteHardwareMain renames the program's main function so the generated
+// driver can provide its own.
+func rewriteHardwareMain(filename string, src []byte) ([]byte, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, filename, src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	for _, decl := range file.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok && fn.Recv == nil && fn.Name.Name == "main" {
+			fn.Name.Name = hardwareMainName
+		}
+	}
+	var buf bytes.Buffer
+	if err := format.Node(&buf, fset, file); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// cosimSources lists the Go files of the main package, which the
+// co-simulation rebuilds around the Verilated design. IR inputs carry no Go
+// sources to rebuild.
+func cosimSources(inputs []string) ([]string, error) {
+	for _, input := range inputs {
+		switch filepath.Ext(input) {
+		case ".ir", ".json":
+			return nil, fmt.Errorf("software goroutines need the Go sources of the main package to co-simulate; %s is IR", input)
+		}
+	}
+	return frontend.MainPackageFiles(frontend.LoadConfig{Sources: inputs})
+}
+
+// runCosim builds the design as a Verilator library, links it through a cgo
+// bridge into a Go program holding the software goroutines, and runs it.
+func runCosim(design *ir.Design, sources []string, mainPath string, auxPaths []string, expectPath string, maxCycles, resetCycles int, tempRoot string, keepArtifacts bool) error {
+	if maxCycles <= 0 {
+		return fmt.Errorf("co-simulation requires --sim-max-cycles > 0 (got %d)", maxCycles)
+	}
+	if resetCycles < 0 {
+		return fmt.Errorf("co-simulation requires --sim-reset-cycles >= 0 (got %d)", resetCycles)
+	}
+	data, err := newCosimData(design.TopLevel, maxCycles, resetCycles)
+	if err != nil {
+		return err
+	}
+	verilatorPath, err := exec.LookPath("verilator")
+	if err != nil {
+		return fmt.Errorf("resolve verilator: %w", err)
+	}
+	goPath, err := exec.LookPath("go")
+	if err != nil {
+		return fmt.Errorf("resolve go toolchain: %w", err)
+	}
+
+	tempDir, err := os.MkdirTemp(tempRoot, ".mygo-cosim-*")
+	if err != nil {
+		return fmt.Errorf("create co-simulation temp dir: %w", err)
+	}
+	if !keepArtifacts {
+		defer os.RemoveAll(tempDir)
+	}
+
+	buildDir := filepath.Join(tempDir, "verilator")
+	objDir := filepath.Join(buildDir, "obj_dir")
+	args := []string{
+		"--cc", "--build",
+		"--sv",
+		"--Mdir", objDir,
+		"--top-module", "main",
+	}
+	args = append(args, mainPath)
+	args = append(args, auxPaths...)
+	if err := runVerilator(verilatorPath, buildDir, args); err != nil {
+		return err
+	}
+	rootOut, err := exec.Command(verilatorPath, "--getenv", "VERILATOR_ROOT").Output()
+	if err != nil {
+		return fmt.Errorf("query VERILATOR_ROOT: %w", err)
+	}
+	include := filepath.Join(strings.TrimSpace(string(rootOut)), "include")
+	archives, err := verilatorArchives(objDir)
+	if err != nil {
+		return err
+	}
+	data.CXXFlags = strings.Join([]string{
+		"-std=c++17",
+		"-I" + objDir, "-I" + include, "-I" + filepath.Join(include, "vltstd"),
+		"-DVM_COVERAGE=0", "-DVM_SC=0", "-DVM_TRACE=0", "-DVM_TRACE_FST=0", "-DVM_TRACE_VCD=0",
+	}, " ")
+	data.LDFlags = strings.Join(append(archives, "-lstdc++", "-lpthread", "-latomic", "-lm"), " ")
+
+	generated, err := renderCosimDriver(data)
+	if err != nil {
+		return err
+	}
+	overlayDir := filepath.Join(tempDir, "cosim")
+	overlayPath, pkgDir, err := writeCosimOverlay(overlayDir, sources, generated)
+	if err != nil {
+		return err
+	}
+	binPath := filepath.Join(overlayDir, "mygo_cosim")
+	build := exec.Command(goPath, "build", "-overlay", overlayPath, "-o", binPath, ".")
+	build.Dir = pkgDir
+	build.Stdout = os.Stderr
+	build.Stderr = os.Stderr
+	build.Env = append(os.Environ(), "CGO_ENABLED=1")
+	if err := build.Run(); err != nil {
+		return fmt.Errorf("co-simulation build failed: %w", err)
+	}
+	return runSimulationBinary(binPath, expectPath)
+}
+
+// renderCosimDriver renders the generated driver and C++ bridge, keyed by the
+// file name each takes in the main package.
+func renderCosimDriver(data *cosimData) (map[string][]byte, error) {
+	files := make(map[string][]byte)
+	for name, tmpl := range map[string]string{
+		"mygo_cosim_main.go": "cosim_main.go.tmpl",
+		"mygo_bridge.cpp":    "cosim_bridge.cpp.tmpl",
+	} {
+		out, err := renderCosimTemplate(tmpl, data)
+		if err != nil {
+			return nil, err
+		}
+		if filepath.Ext(name) == ".go" {
+			if out, err = format.Source(out); err != nil {
+				return nil, fmt.Errorf("format %s: %w", name, err)
+			}
+		}
+		files[name] = out
+	}
+	return files, nil
+}
+
+// writeCosimOverlay lays out the driver program as a go build overlay on the
+// user's main package: its sources with main renamed, plus the generated
+// files. The build runs in the package's own directory, so the program keeps
+// its module path, go directive and other packages. The replacement files go
+// in dir; it returns the overlay file and the package directory.
+func writeCosimOverlay(dir string, sources []string, generated map[string][]byte) (string, string, error) {
+	if len(sources) == 0 {
+		return "", "", fmt.Errorf("co-simulation needs the sources of the main package")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", "", fmt.Errorf("create co-simulation overlay: %w", err)
+	}
+	pkgDir, err := filepath.Abs(filepath.Dir(sources[0]))
+	if err != nil {
+		return "", "", err
+	}
+	files := make(map[string][]byte)
+	for _, source := range sources {
+		src, err := os.ReadFile(source)
+		if err != nil {
+			return "", "", err
+		}
+		rewritten, err := rewriteHardwareMain(source, src)
+		if err != nil {
+			return "", "", fmt.Errorf("rewrite %s: %w", source, err)
+		}
+		files[filepath.Base(source)] = rewritten
+	}
+	maps.Copy(files, generated)
+	overlay := struct{ Replace map[string]string }{Replace: make(map[string]string)}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, content, 0o644); err != nil {
+			return "", "", fmt.Errorf("write %s: %w", name, err)
+		}
+		overlay.Replace[filepath.Join(pkgDir, name)] = path
+	}
+	encoded, err := json.Marshal(overlay)
+	if err != nil {
+		return "", "", err
+	}
+	overlayPath := filepath.Join(dir, "overlay.json")
+	if err := os.WriteFile(overlayPath, encoded, 0o644); err != nil {
+		return "", "", fmt.Errorf("write co-simulation overlay: %w", err)
+	}
+	return overlayPath, pkgDir, nil
+}
+
+// verilatorArchives returns the model and runtime archives a Verilator build
+// leaves in objDir, model first so the linker resolves it against the runtime.
+// Older Verilator releases leave the runtime as loose objects.
+func verilatorArchives(objDir string) ([]string, error) {
+	var model, runtime []string
+	for _, pattern := range []string{"libVmain.a", "Vmain__ALL.a", "libverilated.a"} {
+		matches, _ := filepath.Glob(filepath.Join(objDir, pattern))
+		if strings.Contains(pattern, "verilated") {
+			runtime = append(runtime, matches...)
+		} else {
+			model = append(model, matches...)
+		}
+	}
+	if len(runtime) == 0 {
+		objects, _ := filepath.Glob(filepath.Join(objDir, "verilated*.o"))
+		runtime = objects
+	}
+	if len(model) == 0 || len(runtime) == 0 {
+		return nil, fmt.Errorf("verilator build in %s left no model or runtime archive", objDir)
+	}
+	return slices.Concat(model[:1], runtime), nil
+}
@@ -2,6 +2,8 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
@@ -11,20 +13,13 @@ import (
 	"sort"
 	"strings"
 
-	"golang.org/x/tools/go/packages"
-	"golang.org/x/tools/go/ssa"
-
-	"mygo/internal/backend"
+	"mygo/compiler"
 	"mygo/internal/diag"
 	"mygo/internal/frontend"
 	"mygo/internal/ir"
-	"mygo/internal/mlir"
-	"mygo/internal/passes"
 	"mygo/internal/validate"
 )
 
-var emitVerilog = backend.EmitVerilog
-
 func main() {
 	if err := run(os.Args[1:]); err != nil {
 		fmt.Fprintln(os.Stderr, err)
@@ -55,7 +50,7 @@ func runCompile(args []string) error {
 	fs := flag.NewFlagSet("compile", flag.ContinueOnError)
 	fs.SetOutput(os.Stderr)
 
-	emit := fs.String("emit", "mlir", "output format (ssa|ir|mlir|verilog)")
+	emit := fs.String("emit", "mlir", "output format (ssa|ir|ir-json|mlir|verilog)")
 	output := fs.String("o", "", "output file path (stdout when omitted, except verilog)")
 	target := fs.String("target", "main", "target function or module")
 	diagFormat := fs.String("diag-format", "text", "diagnostic output format (text|json)")
@@ -64,73 +59,107 @@ func runCompile(args []string) error {
 	circtLowering := fs.String("circt-lowering-options", "", "comma-separated circt-opt --lowering-options string (optional)")
 	circtMLIR := fs.String("circt-mlir", "", "path to dump the MLIR handed to CIRCT (optional)")
 	fifoSrc := fs.String("fifo-src", "", "path to FIFO implementation source (required when channels are present)")
+	stripAsserts := fs.Bool("strip-asserts", false, "drop assertions lowered from panics (for synthesis builds)")
+	floatMode := fs.String("float-mode", "ieee", "float32 unit mode (ieee|ftz); ftz flushes subnormals to zero")
+	verifyIR := fs.Bool("verify-ir", false, "check IR invariants before the first pass and after every pass")
 	if err := fs.Parse(args); err != nil {
 		return err
 	}
 	_ = target
+	if _, err := ir.ParseFloatMode(*floatMode); err != nil {
+		return err
+	}
 
 	if fs.NArg() == 0 {
 		fs.Usage()
-		return fmt.Errorf("compile command requires at least one Go source file")
+		return fmt.Errorf("compile command requires at least one Go source file or a .ir or .json IR file")
 	}
 
 	inputs := fs.Args()
-	tempRoot := artifactTempRoot(inputs)
-	result, err := prepareProgram(inputs, *diagFormat)
+	emitStage, ok := emitStages[*emit]
+	if !ok {
+		return fmt.Errorf("unknown emit format: %s", *emit)
+	}
+	if emitStage == compiler.EmitVerilog && (*output == "" || *output == "-") {
+		return fmt.Errorf("verilog emission requires -o when auxiliary FIFO sources are generated")
+	}
+	cfg := compiler.Config{
+		Sources:      inputs,
+		Emit:         emitStage,
+		StripAsserts: *stripAsserts,
+		FloatMode:    *floatMode,
+		VerifyIR:     *verifyIR,
+		Backend: compiler.BackendConfig{
+			CIRCTOptPath:    *circtOpt,
+			PassPipeline:    *circtPipeline,
+			LoweringOptions: *circtLowering,
+			FIFOSource:      *fifoSrc,
+			DumpMLIRPath:    *circtMLIR,
+			TempDir:         artifactTempRoot(inputs),
+			VerilogName:     filepath.Base(*output),
+		},
+	}
+	art, err := compiler.Compile(context.Background(), cfg)
+	diag.Print(os.Stderr, *diagFormat, art.Diagnostics)
+	if errors.Is(err, compiler.ErrNoFIFOSource) {
+		return fmt.Errorf("verilog emission requires --fifo-src when design contains buffered channels")
+	}
 	if err != nil {
 		return err
 	}
 
-	if *emit == "ssa" {
-		return emitSSAProgram(result.program, *output)
+	switch emitStage {
+	case compiler.EmitSSA:
+		return writeOutput(*output, art.SSA)
+	case compiler.EmitIR:
+		return writeOutput(*output, art.IR)
+	case compiler.EmitIRJSON:
+		return writeOutput(*output, art.IRJSON)
+	case compiler.EmitMLIR:
+		return writeOutput(*output, art.MLIR)
 	}
-
-	if err := validateProgram(result); err != nil {
+	if err := writeOutput(*output, art.Verilog); err != nil {
 		return err
 	}
-
-	design, err := ir.BuildDesign(result.program, result.reporter)
+	auxPaths, err := writeAuxFiles(filepath.Dir(*output), art.AuxFiles)
 	if err != nil {
 		return err
 	}
-
-	if err := runDefaultPasses(design, result.reporter); err != nil {
-		return err
+	if len(auxPaths) > 0 {
+		fmt.Fprintf(os.Stderr, "additional sources written: %s\n", strings.Join(auxPaths, ", "))
 	}
-	hasChannels := designHasChannels(design)
+	return nil
+}
 
-	switch *emit {
-	case "ir":
-		return emitIRDesign(design, *output)
-	case "mlir":
-		return mlir.Emit(design, *output)
-	case "verilog":
-		if *output == "" || *output == "-" {
-			return fmt.Errorf("verilog emission requires -o when auxiliary FIFO sources are generated")
-		}
-		if hasChannels && *fifoSrc == "" {
-			return fmt.Errorf("verilog emission requires --fifo-src when design contains channels")
-		}
-		opts := backend.Options{
-			CIRCTOptPath:    *circtOpt,
-			PassPipeline:    *circtPipeline,
-			LoweringOptions: *circtLowering,
-			DumpMLIRPath:    *circtMLIR,
-			TempRoot:        tempRoot,
-			FIFOSource:      *fifoSrc,
-		}
-		res, err := emitVerilog(design, *output, opts)
-		if err != nil {
-			return err
+// emitStages maps the -emit values to the compiler stage each prints.
+var emitStages = map[string]compiler.Emit{
+	"ssa":     compiler.EmitSSA,
+	"ir":      compiler.EmitIR,
+	"ir-json": compiler.EmitIRJSON,
+	"mlir":    compiler.EmitMLIR,
+	"verilog": compiler.EmitVerilog,
+}
+
+// writeAuxFiles writes the FIFO sources next to the Verilog output and
+// returns their paths in a stable order.
+func writeAuxFiles(dir string, files map[string][]byte) ([]string, error) {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	paths := make([]string, 0, len(names))
+	for _, name := range names {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return nil, err
 		}
-		if len(res.AuxPaths) > 0 {
-			fmt.Fprintf(os.Stderr, "additional sources written: %s\n", strings.Join(res.AuxPaths, ", "))
+		if err := os.WriteFile(path, files[name], 0o644); err != nil {
+			return nil, err
 		}
-		return nil
-	default:
-		return fmt.Errorf("unknown emit format: %s", *emit)
+		paths = append(paths, path)
 	}
-
+	return paths, nil
 }
 
 func printGlobalUsage() {
@@ -138,7 +167,7 @@ func printGlobalUsage() {
 	fmt.Fprintf(os.Stderr, "Usage:\n")
 	fmt.Fprintf(os.Stderr, "  mygo <command> [options]\n\n")
 	fmt.Fprintf(os.Stderr, "Commands:\n")
-	fmt.Fprintf(os.Stderr, "  compile    Compile Go source to SSA, IR, MLIR, or Verilog\n")
+	fmt.Fprintf(os.Stderr, "  compile    Compile Go source or textual IR to SSA, IR, MLIR, or Verilog\n")
 	fmt.Fprintf(os.Stderr, "  sim        Compile to Verilog and run a simulator\n")
 	fmt.Fprintf(os.Stderr, "  lint       Run validation-only checks (e.g. concurrency rules)\n")
 }
@@ -158,13 +187,13 @@ func runLint(args []string) error {
 		return fmt.Errorf("lint requires at least one Go source file")
 	}
 
-	result, err := prepareProgram(fs.Args(), *diagFormat)
+	prog, err := frontend.Prepare(frontend.LoadConfig{Sources: fs.Args()}, diag.NewReporter(os.Stderr, *diagFormat))
 	if err != nil {
 		return err
 	}
 
 	if *concurrency {
-		if err := validateProgram(result); err != nil {
+		if err := validate.CheckProgram(prog.SSA, prog.SSAPackages, prog.Packages, prog.Reporter); err != nil {
 			return err
 		}
 	}
@@ -172,60 +201,6 @@ func runLint(args []string) error {
 	return nil
 }
 
-type frontendResult struct {
-	reporter *diag.Reporter
-	program  *ssa.Program
-	ssaPkgs  []*ssa.Package
-	pkgs     []*packages.Package
-}
-
-func prepareProgram(sources []string, diagFormat string) (*frontendResult, error) {
-	reporter := diag.NewReporter(os.Stderr, diagFormat)
-	cfg := frontend.LoadConfig{Sources: sources}
-	pkgs, _, err := frontend.LoadPackages(cfg, reporter)
-	if err != nil {
-		return nil, err
-	}
-	if reporter.HasErrors() {
-		return nil, fmt.Errorf("errors reported while loading packages")
-	}
-	prog, ssaPkgs, err := frontend.BuildSSA(pkgs, reporter)
-	if err != nil {
-		return nil, err
-	}
-	if reporter.HasErrors() {
-		return nil, fmt.Errorf("errors reported during SSA construction")
-	}
-	return &frontendResult{
-		reporter: reporter,
-		program:  prog,
-		ssaPkgs:  ssaPkgs,
-		pkgs:     pkgs,
-	}, nil
-}
-
-func runDefaultPasses(design *ir.Design, reporter *diag.Reporter) error {
-	passMgr := passes.NewManager()
-	passMgr.Add(passes.NewWidthInference(reporter))
-	if err := passMgr.Run(design); err != nil {
-		return err
-	}
-	if reporter != nil && reporter.HasErrors() {
-		return fmt.Errorf("analysis passes reported errors")
-	}
-	return nil
-}
-
-func validateProgram(result *frontendResult) error {
-	if result == nil || result.program == nil {
-		return fmt.Errorf("no program available for validation")
-	}
-	if err := validate.CheckProgram(result.program, result.ssaPkgs, result.pkgs, result.reporter); err != nil {
-		return err
-	}
-	return nil
-}
-
 func runSim(args []string) error {
 	fs := flag.NewFlagSet("sim", flag.ContinueOnError)
 	fs.SetOutput(os.Stderr)
@@ -243,12 +218,18 @@ func runSim(args []string) error {
 	fifoSrc := fs.String("fifo-src", "", "path to FIFO implementation source (required when channels are present)")
 	simMaxCycles := fs.Int("sim-max-cycles", 16, "maximum clock cycles to run when using the default Verilator simulator")
 	simResetCycles := fs.Int("sim-reset-cycles", 2, "number of initial cycles to hold reset asserted for the default simulator")
+	stripAsserts := fs.Bool("strip-asserts", false, "drop assertions lowered from panics before simulation")
+	floatMode := fs.String("float-mode", "ieee", "float32 unit mode (ieee|ftz); ftz flushes subnormals to zero")
+	verifyIR := fs.Bool("verify-ir", false, "check IR invariants before the first pass and after every pass")
 	if err := fs.Parse(args); err != nil {
 		return err
 	}
 	if fs.NArg() == 0 {
 		fs.Usage()
-		return fmt.Errorf("sim requires at least one Go source file")
+		return fmt.Errorf("sim requires at least one Go source file or a .ir or .json IR file")
+	}
+	if _, err := ir.ParseFloatMode(*floatMode); err != nil {
+		return err
 	}
 
 	inputs := fs.Args()
@@ -261,67 +242,71 @@ func runSim(args []string) error {
 		}
 	}
 
-	result, err := prepareProgram(inputs, *diagFormat)
-	if err != nil {
-		return err
-	}
-
-	if err := validateProgram(result); err != nil {
-		return err
-	}
-
-	design, err := ir.BuildDesign(result.program, result.reporter)
-	if err != nil {
-		return err
-	}
-
-	if err := runDefaultPasses(design, result.reporter); err != nil {
-		return err
-	}
-
-	hasChannels := designHasChannels(design)
 	tempRoot := artifactTempRoot(inputs)
-
-	var tempDir string
-	if *verilogOut == "" {
-		var err error
-		tempDir, err = os.MkdirTemp(tempRoot, ".mygo-sim-*")
+	svPath := *verilogOut
+	if svPath == "" {
+		tempDir, err := os.MkdirTemp(tempRoot, ".mygo-sim-*")
 		if err != nil {
 			return err
 		}
 		if !*keepArtifacts {
 			defer os.RemoveAll(tempDir)
 		}
+		svPath = filepath.Join(tempDir, "design.sv")
 	}
 
-	svPath := *verilogOut
-	if svPath == "" {
-		svPath = filepath.Join(tempDir, "design.sv")
-	} else if err := os.MkdirAll(filepath.Dir(svPath), 0o755); err != nil {
+	// The IR JSON hands the optimised design back for the co-simulation,
+	// which needs its ports and software processes.
+	art, err := compiler.Compile(context.Background(), compiler.Config{
+		Sources:      inputs,
+		Emit:         compiler.EmitVerilog | compiler.EmitIRJSON,
+		StripAsserts: *stripAsserts,
+		FloatMode:    *floatMode,
+		VerifyIR:     *verifyIR,
+		Backend: compiler.BackendConfig{
+			CIRCTOptPath:    *circtOpt,
+			PassPipeline:    *circtPipeline,
+			LoweringOptions: *circtLowering,
+			FIFOSource:      *fifoSrc,
+			DumpMLIRPath:    *circtMLIR,
+			TempDir:         tempRoot,
+			VerilogName:     filepath.Base(svPath),
+		},
+	})
+	diag.Print(os.Stderr, *diagFormat, art.Diagnostics)
+	if errors.Is(err, compiler.ErrNoFIFOSource) {
+		return fmt.Errorf("simulation requires --fifo-src when design contains buffered channels")
+	}
+	if err != nil {
 		return err
 	}
-
-	opts := backend.Options{
-		CIRCTOptPath:    *circtOpt,
-		PassPipeline:    *circtPipeline,
-		LoweringOptions: *circtLowering,
-		DumpMLIRPath:    *circtMLIR,
-		KeepTemps:       *keepArtifacts,
-		TempRoot:        tempRoot,
-		FIFOSource:      *fifoSrc,
+	design, err := ir.DecodeJSON(strings.NewReader(art.IRJSON))
+	if err != nil {
+		return err
 	}
-
-	if hasChannels && *fifoSrc == "" {
-		return fmt.Errorf("simulation requires --fifo-src when design contains channels")
+	cosim := designHasSoftware(design)
+	if cosim && *simulator != "" {
+		return fmt.Errorf("software goroutines need the built-in co-simulator; drop --simulator")
 	}
 
-	res, err := emitVerilog(design, svPath, opts)
+	if err := os.MkdirAll(filepath.Dir(svPath), 0o755); err != nil {
+		return err
+	}
+	if err := writeOutput(svPath, art.Verilog); err != nil {
+		return err
+	}
+	auxFiles, err := writeAuxFiles(filepath.Dir(svPath), art.AuxFiles)
 	if err != nil {
 		return err
 	}
-	svPath = res.MainPath
-	auxFiles := append([]string{}, res.AuxPaths...)
 
+	if cosim {
+		sources, err := cosimSources(inputs)
+		if err != nil {
+			return err
+		}
+		return runCosim(design, sources, svPath, auxFiles, *expectPath, *simMaxCycles, *simResetCycles, tempRoot, *keepArtifacts)
+	}
 	if *simulator == "" {
 		return runBuiltinVerilator(svPath, auxFiles, *expectPath, *simMaxCycles, *simResetCycles, tempRoot, *keepArtifacts)
 	}
@@ -366,21 +351,6 @@ func parseSimArgs(raw string) []string {
 	return result
 }
 
-func designHasChannels(design *ir.Design) bool {
-	if design == nil {
-		return false
-	}
-	for _, module := range design.Modules {
-		if module == nil {
-			continue
-		}
-		if len(module.Channels) > 0 {
-			return true
-		}
-	}
-	return false
-}
-
 func defaultSimExpectPath(input string) string {
 	if input == "" {
 		return ""
@@ -475,10 +445,6 @@ func runBuiltinVerilator(mainPath string, auxPaths []string, expectPath string,
 	if err := os.WriteFile(driverPath, []byte(driver), 0o644); err != nil {
 		return fmt.Errorf("write verilator driver: %w", err)
 	}
-	if _, err := installXargsShim(buildDir); err != nil {
-		return err
-	}
-
 	objDir := filepath.Join(buildDir, "obj_dir")
 	args := []string{
 		"--cc", "--exe", "--build",
@@ -491,6 +457,21 @@ func runBuiltinVerilator(mainPath string, auxPaths []string, expectPath string,
 	args = append(args, auxPaths...)
 	args = append(args, driverPath)
 
+	if err := runVerilator(verilatorPath, buildDir, args); err != nil {
+		return err
+	}
+	return runSimulationBinary(filepath.Join(objDir, "mygo_sim"), expectPath)
+}
+
+// runVerilator runs a Verilator build from buildDir, which also receives the
+// xargs shim the generated makefiles rely on.
+func runVerilator(verilatorPath, buildDir string, args []string) error {
+	if err := os.MkdirAll(buildDir, 0o755); err != nil {
+		return fmt.Errorf("create verilator build dir: %w", err)
+	}
+	if _, err := installXargsShim(buildDir); err != nil {
+		return err
+	}
 	cmd := exec.Command(verilatorPath, args...)
 	cmd.Stdout = os.Stderr
 	cmd.Stderr = os.Stderr
@@ -498,8 +479,12 @@ func runBuiltinVerilator(mainPath string, auxPaths []string, expectPath string,
 	if err := cmd.Run(); err != nil {
 		return fmt.Errorf("verilator build failed: %w", err)
 	}
+	return nil
+}
 
-	simPath := filepath.Join(objDir, "mygo_sim")
+// runSimulationBinary runs a built simulator and checks its stdout against
+// expectPath when one is given.
+func runSimulationBinary(simPath, expectPath string) error {
 	simCmd := exec.Command(simPath)
 	var stdoutBuf bytes.Buffer
 	if expectPath != "" {
@@ -551,60 +536,13 @@ func prependPathToEnv(dir string) []string {
 	return env
 }
 
-func emitSSAProgram(prog *ssa.Program, outputPath string) error {
-	return withOutputWriter(outputPath, func(w io.Writer) error {
-		pkgs := sortedSSAPackages(prog)
-		if len(pkgs) == 0 {
-			return fmt.Errorf("no SSA packages available to emit")
-		}
-		for i, pkg := range pkgs {
-			if i > 0 {
-				fmt.Fprintln(w)
-			}
-			if _, err := pkg.WriteTo(w); err != nil {
-				return err
-			}
-		}
-		return nil
-	})
-}
-
-func emitIRDesign(design *ir.Design, outputPath string) error {
-	if design == nil {
-		return fmt.Errorf("no IR design available to emit")
-	}
-	return withOutputWriter(outputPath, func(w io.Writer) error {
-		ir.Dump(design, w)
-		return nil
-	})
-}
-
-func sortedSSAPackages(prog *ssa.Program) []*ssa.Package {
-	if prog == nil {
-		return nil
-	}
-	all := prog.AllPackages()
-	pkgs := make([]*ssa.Package, 0, len(all))
-	for _, pkg := range all {
-		if pkg == nil {
-			continue
-		}
-		pkgs = append(pkgs, pkg)
-	}
-	sort.Slice(pkgs, func(i, j int) bool {
-		return packageSortKey(pkgs[i]) < packageSortKey(pkgs[j])
+// writeOutput writes an artifact to path, or to stdout when path is empty
+// or "-".
+func writeOutput(path, text string) error {
+	return withOutputWriter(path, func(w io.Writer) error {
+		_, err := io.WriteString(w, text)
+		return err
 	})
-	return pkgs
-}
-
-func packageSortKey(pkg *ssa.Package) string {
-	if pkg == nil {
-		return ""
-	}
-	if pkg.Pkg != nil {
-		return pkg.Pkg.Path()
-	}
-	return pkg.String()
 }
 
 func withOutputWriter(path string, fn func(io.Writer) error) error {
@@ -2,8 +2,12 @@ package main
 
 import (
 	"fmt"
+	"go/parser"
+	"go/token"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"sort"
 	"strings"
 	"testing"
 
@@ -147,27 +151,84 @@ func TestPrependPathToEnv(t *testing.T) {
 	}
 }
 
-func TestDesignHasChannels(t *testing.T) {
+func TestRewriteHardwareMain(t *testing.T) {
 	t.Parallel()
-	channel := &ir.Channel{Name: "ch", Type: &ir.SignalType{Width: 32}}
-	cases := []struct {
-		name   string
-		design *ir.Design
-		want   bool
-	}{
-		{name: "nil design", design: nil, want: false},
-		{name: "module without channels", design: &ir.Design{Modules: []*ir.Module{{Name: "foo"}}}, want: false},
-		{name: "module with empty entry", design: &ir.Design{Modules: []*ir.Module{nil}}, want: false},
-		{name: "module with channel", design: &ir.Design{Modules: []*ir.Module{{Name: "foo", Channels: map[string]*ir.Channel{"ch": channel}}}}, want: true},
+	src := "package main\n\ntype T struct{}\n\nfunc (T) main() {}\n\nfunc main() {\n\tgo work()\n}\n\nfunc work() {}\n"
+	out, err := rewriteHardwareMain("main.go", []byte(src))
+	if err != nil {
+		t.Fatalf("rewriteHardwareMain: %v", err)
 	}
-	for _, tc := range cases {
-		tc := tc
-		t.Run(tc.name, func(t *testing.T) {
-			t.Parallel()
-			if got := designHasChannels(tc.design); got != tc.want {
-				t.Fatalf("designHasChannels(%s)=%t, want %t", tc.name, got, tc.want)
-			}
-		})
+	text := string(out)
+	if !strings.Contains(text, "func mygoHardwareMain() {") || !strings.Contains(text, "func (T) main() {}") {
+		t.Fatalf("expected only the package-level main to be renamed, got:\n%s", text)
+	}
+}
+
+func TestCosimTemplatesRender(t *testing.T) {
+	t.Parallel()
+	bit := &ir.SignalType{Width: 1}
+	word := &ir.SignalType{Width: 16, Signed: true}
+	raw := &ir.Channel{Name: "t0", Type: word}
+	local := &ir.Channel{Name: "t3", Type: word, Depth: 2}
+	stimulus := &ir.Process{Name: "stimulus", Software: &ir.SoftwareBinding{
+		Function:  "stimulus",
+		Channels:  []*ir.Channel{raw, local},
+		Params:    []string{"out", "log"},
+		ElemTypes: []string{"int16", "int16"},
+	}}
+	stream := &ir.Stream{Name: "stimulus_out", Channel: raw, Software: stimulus, Direction: ir.Input}
+	module := &ir.Module{
+		Name: "main",
+		Ports: []ir.Port{
+			{Name: "clk", Direction: ir.Input, Type: bit},
+			{Name: "rst", Direction: ir.Input, Type: bit},
+			{Name: "done", Direction: ir.Output, Type: bit},
+			{Name: "stimulus_start", Direction: ir.Output, Type: bit},
+			{Name: "stimulus_out_data", Direction: ir.Input, Type: word},
+			{Name: "stimulus_out_valid", Direction: ir.Input, Type: bit},
+			{Name: "stimulus_out_ready", Direction: ir.Output, Type: bit},
+		},
+		Processes: []*ir.Process{stimulus},
+		Streams:   []*ir.Stream{stream},
+	}
+	data, err := newCosimData(module, 32, 2)
+	if err != nil {
+		t.Fatalf("newCosimData: %v", err)
+	}
+
+	driver, err := renderCosimTemplate("cosim_main.go.tmpl", data)
+	if err != nil {
+		t.Fatalf("render driver: %v", err)
+	}
+	if _, err := parser.ParseFile(token.NewFileSet(), "mygo_cosim_main.go", driver, 0); err != nil {
+		t.Fatalf("driver does not parse: %v\n%s", err, driver)
+	}
+	for _, want := range []string{
+		"mygoCosimChan_t0 := make(chan int16, 0)",
+		"mygoCosimChan_t3 := make(chan int16, 2)",
+		"data: 4, valid: 5, ready: 6, width: 16",
+		"stimulus(mygoCosimChan_t0, mygoCosimChan_t3)",
+	} {
+		if !strings.Contains(string(driver), want) {
+			t.Fatalf("expected driver to contain %q:\n%s", want, driver)
+		}
+	}
+
+	if strings.Contains(string(driver), `"time"`) {
+		t.Fatalf("the driver must not depend on wall-clock time:\n%s", driver)
+	}
+
+	bridge, err := renderCosimTemplate("cosim_bridge.cpp.tmpl", data)
+	if err != nil {
+		t.Fatalf("render bridge: %v", err)
+	}
+	for _, want := range []string{
+		"top->stimulus_out_data = value & 0xffffULL;",
+		"return top->stimulus_out_ready;",
+	} {
+		if !strings.Contains(string(bridge), want) {
+			t.Fatalf("expected bridge to contain %q:\n%s", want, bridge)
+		}
 	}
 }
 
@@ -191,3 +252,85 @@ func pathValue(env []string) string {
 	}
 	return ""
 }
+
+func TestCosimOverlayBuildsSplitProgram(t *testing.T) {
+	goPath, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go toolchain not available")
+	}
+	root := t.TempDir()
+	files := map[string]string{
+		// range over a function needs go 1.23, newer than the old cosim module.
+		"go.mod":          "module example.com/split\n\ngo 1.23\n",
+		"lib/lib.go":      "package lib\n\nfunc Upto(n int) func(func(int) bool) {\n\treturn func(yield func(int) bool) {\n\t\tfor i := range n {\n\t\t\tif !yield(i) {\n\t\t\t\treturn\n\t\t\t}\n\t\t}\n\t}\n}\n",
+		"cmd/app/main.go": "package main\n\nimport \"example.com/split/lib\"\n\nfunc main() {\n\tsum := 0\n\tfor v := range lib.Upto(4) {\n\t\tsum += v\n\t}\n\tprintln(\"sum\", sum)\n}\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+	// A stand-in for the generated driver, which needs Verilator.
+	generated := map[string][]byte{
+		"mygo_cosim_main.go": []byte("package main\n\nfunc main() { " + hardwareMainName + "() }\n"),
+	}
+	overlayDir := filepath.Join(t.TempDir(), "cosim")
+	overlayPath, pkgDir, err := writeCosimOverlay(overlayDir, []string{filepath.Join(root, "cmd", "app", "main.go")}, generated)
+	if err != nil {
+		t.Fatalf("writeCosimOverlay: %v", err)
+	}
+	if pkgDir != filepath.Join(root, "cmd", "app") {
+		t.Fatalf("expected the build to run in the main package, got %s", pkgDir)
+	}
+	binPath := filepath.Join(overlayDir, "app")
+	build := exec.Command(goPath, "build", "-overlay", overlayPath, "-o", binPath, ".")
+	build.Dir = pkgDir
+	build.Env = append(os.Environ(), "CGO_ENABLED=0", "GOFLAGS=")
+	if out, err := build.CombinedOutput(); err != nil {
+		t.Fatalf("build with overlay failed: %v\n%s", err, out)
+	}
+	out, err := exec.Command(binPath).CombinedOutput()
+	if err != nil || !strings.Contains(string(out), "sum 6") {
+		t.Fatalf("expected the renamed main to run, got %v: %s", err, out)
+	}
+	if src, _ := os.ReadFile(filepath.Join(root, "cmd", "app", "main.go")); !strings.Contains(string(src), "func main()") {
+		t.Fatalf("the user's source must stay untouched")
+	}
+}
+
+func TestCosimSources(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go toolchain not available")
+	}
+	root := t.TempDir()
+	files := map[string]string{
+		"go.mod":          "module example.com/sources\n\ngo 1.22\n",
+		"main.go":         "package main\n\nfunc main() { helper() }\n",
+		"helper_linux.go": "package main\n\nfunc helper() {}\n",
+		"helper_other.go": "//go:build !linux\n\npackage main\n\nfunc helper() {}\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0o644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+	sources, err := cosimSources([]string{filepath.Join(root, "main.go")})
+	if err != nil {
+		t.Fatalf("cosimSources: %v", err)
+	}
+	var names []string
+	for _, source := range sources {
+		names = append(names, filepath.Base(source))
+	}
+	sort.Strings(names)
+	if got := strings.Join(names, " "); got != "helper_linux.go main.go" {
+		t.Fatalf("expected the linux files of the main package, got %s", got)
+	}
+	if _, err := cosimSources([]string{filepath.Join(root, "main.ir")}); err == nil || !strings.Contains(err.Error(), "is IR") {
+		t.Fatalf("expected IR input to be rejected, got %v", err)
+	}
+}
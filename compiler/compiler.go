@@ -0,0 +1,362 @@
+// Package compiler is the embeddable form of mygo compile. Compile runs the
+// whole pipeline, from Go sources or IR to SystemVerilog, and returns every
+// artifact and diagnostic in memory instead of writing files or stderr.
+//
+// Compile keeps no state between calls, so several may run at once.
+package compiler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"go/token"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"mygo/internal/backend"
+	"mygo/internal/diag"
+	"mygo/internal/frontend"
+	"mygo/internal/ir"
+	"mygo/internal/mlir"
+	"mygo/internal/passes"
+	"mygo/internal/validate"
+)
+
+// Emit is a set of artifacts for Compile to produce.
+type Emit uint
+
+const (
+	// EmitSSA prints the go/ssa form of the sources.
+	EmitSSA Emit = 1 << iota
+	// EmitIR prints the IR after the default passes, as -emit=ir does.
+	EmitIR
+	// EmitIRJSON encodes the same IR as JSON, as -emit=ir-json does.
+	EmitIRJSON
+	// EmitMLIR prints the MLIR handed to CIRCT.
+	EmitMLIR
+	// EmitVerilog runs circt-opt and returns the SystemVerilog with the
+	// FIFO sources it needs.
+	EmitVerilog
+)
+
+// Severity and Diagnostic describe one message reported while compiling.
+type (
+	Severity   = diag.Severity
+	Diagnostic = diag.Diagnostic
+)
+
+const (
+	Info    = diag.Info
+	Warning = diag.Warning
+	Error   = diag.Error
+)
+
+// ErrNoFIFOSource is returned when Verilog is requested for a design with
+// buffered channels and BackendConfig.FIFOSource is empty.
+var ErrNoFIFOSource = errors.New("compiler: the design has buffered channels but no FIFO source was given")
+
+// Config describes one compilation.
+type Config struct {
+	// Sources lists the Go files of the main package, or a single .ir or
+	// .json file written by EmitIR or EmitIRJSON.
+	Sources []string
+	// Overlays maps file paths to contents that replace, or add to, the
+	// files on disk. Relative paths are taken from the working directory.
+	Overlays map[string][]byte
+	// Target names the entry function. Only "main", the default, is
+	// supported.
+	Target string
+	// Emit selects the artifacts to return. Zero means EmitMLIR.
+	Emit Emit
+	// StripAsserts drops the checks lowered from panics.
+	StripAsserts bool
+	// FloatMode is "ieee", the default, or "ftz".
+	FloatMode string
+	// VerifyIR checks the IR before and after every pass.
+	VerifyIR bool
+	// GoCache and GoModCache set GOCACHE and GOMODCACHE for loading the
+	// Go sources. Empty keeps the caller's Go environment.
+	GoCache    string
+	GoModCache string
+	// Backend configures circt-opt for EmitVerilog.
+	Backend BackendConfig
+}
+
+// BackendConfig configures the CIRCT run behind EmitVerilog.
+type BackendConfig struct {
+	// CIRCTOptPath is the circt-opt binary; empty looks it up on PATH.
+	CIRCTOptPath string
+	// PassPipeline is an optional --pass-pipeline run before export.
+	PassPipeline string
+	// LoweringOptions is the comma-separated --lowering-options string.
+	LoweringOptions string
+	// FIFOSource is the FIFO implementation, a file or a directory. It is
+	// required when the design has buffered channels.
+	FIFOSource string
+	// DumpMLIRPath, when set, receives the MLIR circt-opt exported from.
+	DumpMLIRPath string
+	// TempDir holds the scratch directories; empty means os.TempDir.
+	TempDir string
+	// VerilogName is the file name the Verilog is generated under, which
+	// names the FIFO files after it. It defaults to design.sv.
+	VerilogName string
+}
+
+// Artifacts holds what Compile produced. Only the artifacts selected by
+// Config.Emit are set.
+type Artifacts struct {
+	SSA     string
+	IR      string
+	IRJSON  string
+	MLIR    string
+	Verilog string
+	// AuxFiles holds the FIFO sources the Verilog needs, keyed by their
+	// slash-separated path relative to the directory of the Verilog file.
+	AuxFiles map[string][]byte
+	// Diagnostics lists every message reported, in order.
+	Diagnostics []Diagnostic
+}
+
+// Compile runs the pipeline described by cfg. The returned Artifacts are
+// never nil; when Compile fails they still carry the diagnostics that
+// explain why. Cancelling ctx stops package loading and circt-opt.
+func Compile(ctx context.Context, cfg Config) (*Artifacts, error) {
+	art := &Artifacts{}
+	reporter := diag.NewReporter(io.Discard, "text")
+	err := compile(ctx, cfg, reporter, art)
+	art.Diagnostics = reporter.Diagnostics()
+	return art, err
+}
+
+func compile(ctx context.Context, cfg Config, reporter *diag.Reporter, art *Artifacts) error {
+	if len(cfg.Sources) == 0 {
+		return fmt.Errorf("compiler: no sources")
+	}
+	if cfg.Target != "" && cfg.Target != "main" {
+		return fmt.Errorf("compiler: target %q is not supported; only main is", cfg.Target)
+	}
+	emit := cfg.Emit
+	if emit == 0 {
+		emit = EmitMLIR
+	}
+	mode, err := ir.ParseFloatMode(cfg.FloatMode)
+	if err != nil {
+		return err
+	}
+	overlay, err := absOverlay(cfg.Overlays)
+	if err != nil {
+		return err
+	}
+
+	var design *ir.Design
+	if isIRInput(cfg.Sources) {
+		if emit&EmitSSA != 0 {
+			return fmt.Errorf("compiler: SSA needs Go sources, not IR")
+		}
+		if design, err = loadIR(cfg.Sources, overlay); err != nil {
+			return err
+		}
+	} else {
+		prog, err := frontend.Prepare(frontend.LoadConfig{
+			Sources:    cfg.Sources,
+			Overlay:    overlay,
+			Context:    ctx,
+			GoCache:    cfg.GoCache,
+			GoModCache: cfg.GoModCache,
+		}, reporter)
+		if err != nil {
+			return err
+		}
+		if emit&EmitSSA != 0 {
+			var buf strings.Builder
+			if err := frontend.WriteSSA(&buf, prog.SSA); err != nil {
+				return err
+			}
+			art.SSA = buf.String()
+		}
+		if emit&^EmitSSA == 0 {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := validate.CheckProgram(prog.SSA, prog.SSAPackages, prog.Packages, reporter); err != nil {
+			return err
+		}
+		if design, err = ir.BuildDesign(prog.SSA, prog.Packages, reporter); err != nil {
+			return err
+		}
+	}
+	design.FloatMode = mode
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := passes.RunDefault(design, reporter, passes.DefaultOptions{StripAssertions: cfg.StripAsserts, Verify: cfg.VerifyIR}); err != nil {
+		return err
+	}
+
+	if emit&EmitIR != 0 {
+		var buf strings.Builder
+		ir.Dump(design, &buf)
+		art.IR = buf.String()
+	}
+	if emit&EmitIRJSON != 0 {
+		var buf strings.Builder
+		if err := ir.EncodeJSON(&buf, design); err != nil {
+			return err
+		}
+		art.IRJSON = buf.String()
+	}
+	if emit&EmitMLIR != 0 {
+		var buf strings.Builder
+		if err := mlir.Write(&buf, design); err != nil {
+			return err
+		}
+		art.MLIR = buf.String()
+	}
+	if emit&EmitVerilog != 0 {
+		return emitVerilog(ctx, design, cfg.Backend, reporter, art)
+	}
+	return nil
+}
+
+// emitVerilog runs the backend in a scratch directory and reads back the
+// Verilog and FIFO files it wrote.
+func emitVerilog(ctx context.Context, design *ir.Design, bc BackendConfig, reporter *diag.Reporter, art *Artifacts) error {
+	if backend.NeedsFIFOSource(design) && bc.FIFOSource == "" {
+		return ErrNoFIFOSource
+	}
+	dir, err := os.MkdirTemp(bc.TempDir, ".mygo-verilog-*")
+	if err != nil {
+		return fmt.Errorf("compiler: create output dir: %w", err)
+	}
+	defer os.RemoveAll(dir)
+	name := bc.VerilogName
+	if name == "" {
+		name = "design.sv"
+	}
+
+	var toolOutput bytes.Buffer
+	res, err := backend.EmitVerilogContext(ctx, design, filepath.Join(dir, filepath.Base(name)), backend.Options{
+		CIRCTOptPath:    bc.CIRCTOptPath,
+		PassPipeline:    bc.PassPipeline,
+		LoweringOptions: bc.LoweringOptions,
+		DumpMLIRPath:    bc.DumpMLIRPath,
+		TempRoot:        bc.TempDir,
+		FIFOSource:      bc.FIFOSource,
+		Reporter:        reporter,
+		Stderr:          &toolOutput,
+	})
+	reportToolOutput(reporter, toolOutput.String())
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(res.MainPath)
+	if err != nil {
+		return fmt.Errorf("compiler: read verilog: %w", err)
+	}
+	art.Verilog = string(data)
+	for _, path := range res.AuxPaths {
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return fmt.Errorf("compiler: locate %s: %w", path, err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("compiler: read %s: %w", rel, err)
+		}
+		if art.AuxFiles == nil {
+			art.AuxFiles = make(map[string][]byte)
+		}
+		art.AuxFiles[filepath.ToSlash(rel)] = data
+	}
+	return nil
+}
+
+// reportToolOutput turns the circt-opt output that points at no Go source
+// into diagnostics without a position.
+func reportToolOutput(reporter *diag.Reporter, out string) {
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimRight(line, "\r")
+		msg := "circt-opt: " + line
+		switch {
+		case line == "":
+		case strings.Contains(line, ": error: "):
+			reporter.Error(token.NoPos, msg)
+		case strings.Contains(line, ": warning: "):
+			reporter.Warning(token.NoPos, msg)
+		default:
+			reporter.Info(token.NoPos, msg)
+		}
+	}
+}
+
+// absOverlay keys overlay by absolute path, as go/packages expects.
+func absOverlay(overlay map[string][]byte) (map[string][]byte, error) {
+	if len(overlay) == 0 {
+		return nil, nil
+	}
+	out := make(map[string][]byte, len(overlay))
+	for path, data := range overlay {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return nil, fmt.Errorf("compiler: overlay %s: %w", path, err)
+		}
+		out[abs] = data
+	}
+	return out, nil
+}
+
+// isIRInput reports whether the sources are IR written by EmitIR or
+// EmitIRJSON rather than Go.
+func isIRInput(sources []string) bool {
+	for _, source := range sources {
+		switch filepath.Ext(source) {
+		case ".ir", ".json":
+			return true
+		}
+	}
+	return false
+}
+
+// loadIR reads a single textual IR file, or IR JSON when the file ends in
+// .json, from the overlay or the disk. Errors carry the file name, and for
+// textual IR the line and column.
+func loadIR(sources []string, overlay map[string][]byte) (*ir.Design, error) {
+	if len(sources) != 1 {
+		return nil, fmt.Errorf("IR is compiled one file at a time; got %d inputs", len(sources))
+	}
+	path := sources[0]
+	var r io.Reader
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	if data, ok := overlay[abs]; ok {
+		r = bytes.NewReader(data)
+	} else {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+	if filepath.Ext(path) == ".json" {
+		design, err := ir.DecodeJSON(r)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return design, nil
+	}
+	design, err := ir.Parse(r)
+	if err != nil {
+		return nil, fmt.Errorf("%s:%w", path, err)
+	}
+	return design, nil
+}
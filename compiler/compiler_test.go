@@ -0,0 +1,239 @@
+package compiler
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const counterProgram = `package main
+
+func main() {
+	x := uint8(1)
+	for i := 0; i < 4; i++ {
+		x = x + uint8(i)
+	}
+	print(x)
+}
+`
+
+const mapProgram = `package main
+
+func main() {
+	m := make(map[int]int)
+	m[0] = 1
+	_ = m[0]
+}
+`
+
+const arbiterProgram = `package main
+
+func producer(out chan<- uint32, v uint32) {
+	out <- v
+}
+
+func main() {
+	//mygo:arbiter priority
+	ch := make(chan uint32, 2)
+	go producer(ch, 1)
+	go producer(ch, 2)
+	_ = <-ch + <-ch
+}
+`
+
+// writeProgram lays out a one-file main module and returns main.go's path.
+func writeProgram(t *testing.T, src string) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module prog\n\ngo 1.25\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "main.go")
+	if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestCompileReturnsArtifacts(t *testing.T) {
+	path := writeProgram(t, counterProgram)
+	art, err := Compile(context.Background(), Config{
+		Sources: []string{path},
+		Emit:    EmitSSA | EmitIR | EmitIRJSON | EmitMLIR,
+	})
+	if err != nil {
+		t.Fatalf("compile failed: %v\n%v", err, art.Diagnostics)
+	}
+	if !strings.Contains(art.SSA, "package prog:") {
+		t.Fatalf("SSA missing package:\n%s", art.SSA)
+	}
+	if !strings.Contains(art.IR, "module main") {
+		t.Fatalf("IR missing module:\n%s", art.IR)
+	}
+	if !strings.Contains(art.IRJSON, `"version": 1`) {
+		t.Fatalf("IR JSON missing version:\n%s", art.IRJSON)
+	}
+	if !strings.Contains(art.MLIR, "hw.module @main") {
+		t.Fatalf("MLIR missing module:\n%s", art.MLIR)
+	}
+	// Source file names are relative to the main package, so the output
+	// does not depend on where the sources are.
+	if !strings.Contains(art.MLIR, `loc("main.go":`) || strings.Contains(art.MLIR, filepath.Dir(path)) {
+		t.Fatalf("MLIR locations should name main.go relative to its package:\n%s", art.MLIR)
+	}
+	if !strings.Contains(art.IRJSON, `"file": "main.go"`) || strings.Contains(art.IRJSON, filepath.Dir(path)) {
+		t.Fatalf("IR JSON positions should name main.go relative to its package:\n%s", art.IRJSON)
+	}
+	if art.Verilog != "" {
+		t.Fatalf("verilog emitted without EmitVerilog")
+	}
+}
+
+func TestCompileLeavesWorkingDirectoryAlone(t *testing.T) {
+	path := writeProgram(t, counterProgram)
+	cwd := t.TempDir()
+	t.Chdir(cwd)
+	if art, err := Compile(context.Background(), Config{Sources: []string{path}}); err != nil {
+		t.Fatalf("compile failed: %v\n%v", err, art.Diagnostics)
+	}
+	entries, err := os.ReadDir(cwd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("compile wrote %d entries into the working directory, first %s", len(entries), entries[0].Name())
+	}
+}
+
+func TestCompileLoadsForLinuxAmd64(t *testing.T) {
+	t.Setenv("GOOS", "windows")
+	t.Setenv("GOARCH", "arm64")
+	path := writeProgram(t, "package main\n\nfunc main() {\n\tprint(width)\n}\n")
+	extra := "package main\n\nconst width = uint8(64)\n"
+	if err := os.WriteFile(filepath.Join(filepath.Dir(path), "width_linux_amd64.go"), []byte(extra), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if art, err := Compile(context.Background(), Config{Sources: []string{path}}); err != nil {
+		t.Fatalf("compile failed: %v\n%v", err, art.Diagnostics)
+	}
+}
+
+func TestCompileCompilesIROverlay(t *testing.T) {
+	path := writeProgram(t, counterProgram)
+	first, err := Compile(context.Background(), Config{Sources: []string{path}, Emit: EmitIRJSON | EmitMLIR})
+	if err != nil {
+		t.Fatalf("compile failed: %v", err)
+	}
+	irPath := filepath.Join(t.TempDir(), "main.json")
+	second, err := Compile(context.Background(), Config{
+		Sources:  []string{irPath},
+		Overlays: map[string][]byte{irPath: []byte(first.IRJSON)},
+	})
+	if err != nil {
+		t.Fatalf("compile of IR failed: %v", err)
+	}
+	if second.MLIR != first.MLIR {
+		t.Fatalf("MLIR from IR differs\nwant:\n%s\ngot:\n%s", first.MLIR, second.MLIR)
+	}
+	if _, err := Compile(context.Background(), Config{Sources: []string{irPath}, Emit: EmitSSA}); err == nil {
+		t.Fatalf("expected EmitSSA of IR to fail")
+	}
+}
+
+func TestCompileReportsDiagnostics(t *testing.T) {
+	path := writeProgram(t, counterProgram)
+	art, err := Compile(context.Background(), Config{
+		Sources:  []string{path},
+		Overlays: map[string][]byte{path: []byte(mapProgram)},
+	})
+	if err == nil {
+		t.Fatalf("expected map program to fail")
+	}
+	var found bool
+	for _, d := range art.Diagnostics {
+		if d.Severity == Error && d.Position.IsValid() && strings.Contains(d.Message, "map") {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("expected a positioned map error, got %v", art.Diagnostics)
+	}
+}
+
+func TestCompileReadsDirectivesFromOverlay(t *testing.T) {
+	path := writeProgram(t, counterProgram)
+	art, err := Compile(context.Background(), Config{
+		Sources:  []string{path},
+		Overlays: map[string][]byte{path: []byte(arbiterProgram)},
+		Emit:     EmitIR,
+	})
+	if err != nil {
+		t.Fatalf("compile failed: %v\n%v", err, art.Diagnostics)
+	}
+	if !strings.Contains(art.IR, "arbiter=priority") {
+		t.Fatalf("expected the overlay's //mygo:arbiter directive to apply:\n%s", art.IR)
+	}
+}
+
+func TestCompileIsSafeConcurrently(t *testing.T) {
+	good := writeProgram(t, counterProgram)
+	bad := writeProgram(t, mapProgram)
+	want, err := Compile(context.Background(), Config{Sources: []string{good}})
+	if err != nil {
+		t.Fatalf("compile failed: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan string, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if i%2 == 1 {
+				art, err := Compile(context.Background(), Config{Sources: []string{bad}})
+				if err == nil || len(art.Diagnostics) == 0 {
+					errs <- "map program compiled without diagnostics"
+				}
+				return
+			}
+			art, err := Compile(context.Background(), Config{Sources: []string{good}})
+			if err != nil {
+				errs <- err.Error()
+			} else if art.MLIR != want.MLIR || len(art.Diagnostics) != len(want.Diagnostics) {
+				errs <- "concurrent compile produced different output"
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for msg := range errs {
+		t.Error(msg)
+	}
+}
+
+func TestCompileRequiresFIFOSource(t *testing.T) {
+	path := writeProgram(t, `package main
+
+func source(out chan<- int32) {
+	out <- 1
+}
+
+func drain(in <-chan int32) {
+	v := <-in
+	_ = v
+}
+
+func main() {
+	ch := make(chan int32, 2)
+	go source(ch)
+	go drain(ch)
+}
+`)
+	_, err := Compile(context.Background(), Config{Sources: []string{path}, Emit: EmitVerilog})
+	if err != ErrNoFIFOSource {
+		t.Fatalf("expected ErrNoFIFOSource, got %v", err)
+	}
+}
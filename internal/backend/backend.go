@@ -2,32 +2,25 @@ package backend
 
 import (
 	"bytes"
+	"context"
+	_ "embed"
 	"fmt"
 	"io"
 	"io/fs"
 	"os"
 	"os/exec"
 	"path/filepath"
-	"runtime"
 	"sort"
 	"strings"
-	"sync"
 	"text/template"
 
+	"mygo/internal/diag"
 	"mygo/internal/ir"
 	"mygo/internal/mlir"
 )
 
-var (
-	runPipeline = runCirctPipeline
-	runExport   = runCirctExportVerilog
-)
-
-var (
-	fifoWrapperTemplateOnce sync.Once
-	fifoWrapperTemplate     *template.Template
-	fifoWrapperTemplateErr  error
-)
+//go:embed templates/fifo_wrapper.svtmpl
+var fifoWrapperSource string
 
 // Options configures how the CIRCT backend is invoked.
 type Options struct {
@@ -51,6 +44,18 @@ type Options struct {
 	// FIFOSource points to a user-provided FIFO implementation that will be
 	// copied next to the emitted Verilog when channels are present.
 	FIFOSource string
+	// Reporter, when set, receives the circt-opt diagnostics that point into
+	// the design's Go sources, at their Go position. Other circt-opt output
+	// goes to Stderr.
+	Reporter *diag.Reporter
+	// Stderr receives the circt-opt output the reporter does not take. It
+	// defaults to os.Stderr.
+	Stderr io.Writer
+
+	// runPipeline and runExport stand in for the circt-opt invocations in
+	// tests; nil runs circt-opt.
+	runPipeline func(ctx context.Context, binary, pipeline, inputPath, outputPath string, stderr io.Writer) error
+	runExport   func(ctx context.Context, binary, pipeline, loweringOptions, inputPath, mlirOutputPath, verilogOutputPath string, stderr io.Writer) error
 }
 
 // Result lists the artifacts produced during Verilog emission.
@@ -65,6 +70,12 @@ type Result struct {
 // When FIFOs are present, auxiliary files are produced as well and returned via
 // Result.AuxPaths.
 func EmitVerilog(design *ir.Design, outputPath string, opts Options) (Result, error) {
+	return EmitVerilogContext(context.Background(), design, outputPath, opts)
+}
+
+// EmitVerilogContext is EmitVerilog with a context that stops circt-opt
+// when it is done.
+func EmitVerilogContext(ctx context.Context, design *ir.Design, outputPath string, opts Options) (Result, error) {
 	if design == nil {
 		return Result{}, fmt.Errorf("backend: design is nil")
 	}
@@ -73,6 +84,16 @@ func EmitVerilog(design *ir.Design, outputPath string, opts Options) (Result, er
 	}
 
 	fifoInfos := collectFifoDescriptors(design)
+	if len(fifoInfos) > 0 && opts.FIFOSource == "" {
+		return Result{}, fmt.Errorf("backend: fifo source required when channels are present")
+	}
+	runPipeline, runExport := opts.runPipeline, opts.runExport
+	if runPipeline == nil {
+		runPipeline = runCirctPipeline
+	}
+	if runExport == nil {
+		runExport = runCirctExportVerilog
+	}
 
 	optPath, err := resolveBinary(opts.CIRCTOptPath, "circt-opt")
 	if err != nil {
@@ -92,16 +113,22 @@ func EmitVerilog(design *ir.Design, outputPath string, opts Options) (Result, er
 		return Result{}, fmt.Errorf("backend: emit mlir: %w", err)
 	}
 
+	passthrough := opts.Stderr
+	if passthrough == nil {
+		passthrough = os.Stderr
+	}
+	stderr := newCirctDiagnostics(passthrough, design, opts.Reporter)
+	defer stderr.Close()
 	currentInput := mlirPath
 	if opts.PassPipeline != "" {
 		pipelineOutput := filepath.Join(tempDir, "design.pipeline.mlir")
-		if err := runPipeline(optPath, opts.PassPipeline, currentInput, pipelineOutput); err != nil {
+		if err := runPipeline(ctx, optPath, opts.PassPipeline, currentInput, pipelineOutput, stderr); err != nil {
 			return Result{}, err
 		}
 		currentInput = pipelineOutput
 	}
 	exportOutput := filepath.Join(tempDir, "design.export.mlir")
-	if err := runExport(optPath, "", opts.LoweringOptions, currentInput, exportOutput, outputPath); err != nil {
+	if err := runExport(ctx, optPath, "", opts.LoweringOptions, currentInput, exportOutput, outputPath, stderr); err != nil {
 		return Result{}, err
 	}
 	currentInput = exportOutput
@@ -126,7 +153,7 @@ func EmitVerilog(design *ir.Design, outputPath string, opts Options) (Result, er
 	return res, nil
 }
 
-func runCirctExportVerilog(binary, pipeline, loweringOptions, inputPath, mlirOutputPath, verilogOutputPath string) error {
+func runCirctExportVerilog(ctx context.Context, binary, pipeline, loweringOptions, inputPath, mlirOutputPath, verilogOutputPath string, stderr io.Writer) error {
 	args := []string{inputPath, "-o", mlirOutputPath}
 	if loweringOptions != "" {
 		args = append(args, "--test-apply-lowering-options=options="+loweringOptions)
@@ -135,8 +162,8 @@ func runCirctExportVerilog(binary, pipeline, loweringOptions, inputPath, mlirOut
 	if pipeline != "" {
 		args = append(args, "--pass-pipeline="+pipeline)
 	}
-	cmd := exec.Command(binary, args...)
-	cmd.Stderr = os.Stderr
+	cmd := exec.CommandContext(ctx, binary, args...)
+	cmd.Stderr = stderr
 
 	if err := os.MkdirAll(filepath.Dir(mlirOutputPath), 0o755); err != nil {
 		return fmt.Errorf("backend: create circt-opt output dir: %w", err)
@@ -157,16 +184,24 @@ func runCirctExportVerilog(binary, pipeline, loweringOptions, inputPath, mlirOut
 	return nil
 }
 
-func runCirctPipeline(binary, pipeline, inputPath, outputPath string) error {
+// runCirctPipeline runs pipeline over inputPath. circt-opt's stderr goes to
+// stderr, which maps diagnostics at Go locations back to the sources.
+func runCirctPipeline(ctx context.Context, binary, pipeline, inputPath, outputPath string, stderr io.Writer) error {
 	args := []string{inputPath, "-o", outputPath, "--pass-pipeline=" + pipeline}
-	cmd := exec.Command(binary, args...)
-	cmd.Stderr = os.Stderr
+	cmd := exec.CommandContext(ctx, binary, args...)
+	cmd.Stderr = stderr
 	if err := cmd.Run(); err != nil {
 		return fmt.Errorf("backend: circt-opt --pass-pipeline failed: %w", err)
 	}
 	return nil
 }
 
+// NeedsFIFOSource reports whether the design has a buffered channel, whose
+// FIFO needs Options.FIFOSource.
+func NeedsFIFOSource(design *ir.Design) bool {
+	return len(collectFifoDescriptors(design)) > 0
+}
+
 func resolveBinary(explicit, fallback string) (string, error) {
 	if explicit != "" {
 		if _, err := os.Stat(explicit); err != nil {
@@ -182,9 +217,10 @@ func resolveBinary(explicit, fallback string) (string, error) {
 }
 
 type fifoDescriptor struct {
-	name  string
-	width int
-	depth int
+	name    string
+	width   int
+	depth   int
+	counted bool
 }
 
 func collectFifoDescriptors(design *ir.Design) []fifoDescriptor {
@@ -192,12 +228,13 @@ func collectFifoDescriptors(design *ir.Design) []fifoDescriptor {
 	if design == nil {
 		return nil
 	}
+	counted := design.CountedChannels()
 	for _, module := range design.Modules {
 		if module == nil {
 			continue
 		}
 		for _, ch := range module.Channels {
-			if ch == nil {
+			if ch == nil || ch.Unbuffered() {
 				continue
 			}
 			width := signalWidth(ch.Type)
@@ -206,14 +243,15 @@ func collectFifoDescriptors(design *ir.Design) []fifoDescriptor {
 				depth = 1
 			}
 			elem := signalTypeString(ch.Type)
-			name := fifoModuleName(elem, depth)
+			name := fifoModuleName(elem, depth, counted[ch])
 			if _, ok := seen[name]; ok {
 				continue
 			}
 			seen[name] = fifoDescriptor{
-				name:  name,
-				width: width,
-				depth: depth,
+				name:    name,
+				width:   width,
+				depth:   depth,
+				counted: counted[ch],
 			}
 		}
 	}
@@ -259,9 +297,19 @@ func stripAndWriteFifos(mainPath string, fifos []fifoDescriptor, fifoSource stri
 
 func removeModuleBlock(content, moduleName string) (string, bool) {
 	marker := "module " + moduleName
-	start := strings.Index(content, marker)
-	if start == -1 {
-		return content, false
+	start := -1
+	for from := 0; ; {
+		idx := strings.Index(content[from:], marker)
+		if idx == -1 {
+			return content, false
+		}
+		idx += from
+		// Skip longer names such as the _count variant of the same FIFO.
+		if end := idx + len(marker); end == len(content) || !isIdentByte(content[end]) {
+			start = idx
+			break
+		}
+		from = idx + len(marker)
 	}
 	tail := content[start:]
 	endIdx := strings.Index(tail, "endmodule")
@@ -278,8 +326,14 @@ func removeModuleBlock(content, moduleName string) (string, bool) {
 	return content[:start] + content[end:], true
 }
 
-func fifoModuleName(elemType string, depth int) string {
-	return fmt.Sprintf("mygo_fifo_%s_d%d", sanitize(elemType), depth)
+// fifoModuleName matches the FIFO names of the MLIR emitter, including the
+// _count suffix on FIFOs that expose their occupancy.
+func fifoModuleName(elemType string, depth int, counted bool) string {
+	name := fmt.Sprintf("mygo_fifo_%s_d%d", sanitize(elemType), depth)
+	if counted {
+		name += "_count"
+	}
+	return name
 }
 
 func copyFifoSources(mainPath string, fifos []fifoDescriptor, fifoSource string) ([]string, error) {
@@ -389,10 +443,12 @@ func appendFifoWrappers(path string, fifos []fifoDescriptor) error {
 	}
 	for _, fifo := range fifos {
 		data := fifoWrapperData{
-			Name:      fifo.name,
-			Width:     fifo.width,
-			Depth:     fifo.depth,
-			DataRange: fifoDataRange(fifo.width),
+			Name:       fifo.name,
+			Width:      fifo.width,
+			Depth:      fifo.depth,
+			DataRange:  fifoDataRange(fifo.width),
+			Counted:    fifo.counted,
+			CountRange: fifoDataRange(ir.FIFOCountWidth(fifo.depth)),
 		}
 		if err := tmpl.Execute(file, data); err != nil {
 			return fmt.Errorf("backend: render fifo wrapper: %w", err)
@@ -404,6 +460,10 @@ func appendFifoWrappers(path string, fifos []fifoDescriptor) error {
 	return nil
 }
 
+func isIdentByte(c byte) bool {
+	return c == '_' || c == '$' || (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
 func fifoDataRange(width int) string {
 	if width <= 1 {
 		return ""
@@ -438,24 +498,18 @@ func sanitize(name string) string {
 }
 
 type fifoWrapperData struct {
-	Name      string
-	Width     int
-	Depth     int
-	DataRange string
+	Name       string
+	Width      int
+	Depth      int
+	DataRange  string
+	Counted    bool
+	CountRange string
 }
 
 func loadFifoWrapperTemplate() (*template.Template, error) {
-	fifoWrapperTemplateOnce.Do(func() {
-		_, srcFile, _, ok := runtime.Caller(0)
-		if !ok {
-			fifoWrapperTemplateErr = fmt.Errorf("backend: determine fifo wrapper template path")
-			return
-		}
-		tmplPath := filepath.Join(filepath.Dir(srcFile), "templates", "fifo_wrapper.svtmpl")
-		fifoWrapperTemplate, fifoWrapperTemplateErr = template.ParseFiles(tmplPath)
-	})
-	if fifoWrapperTemplateErr != nil {
-		return nil, fifoWrapperTemplateErr
+	tmpl, err := template.New("fifo_wrapper.svtmpl").Parse(fifoWrapperSource)
+	if err != nil {
+		return nil, fmt.Errorf("backend: parse fifo wrapper template: %w", err)
 	}
-	return fifoWrapperTemplate, nil
+	return tmpl, nil
 }
@@ -1,12 +1,17 @@
 package backend
 
 import (
+	"bytes"
+	"context"
 	"fmt"
+	"go/token"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
 
+	"mygo/internal/diag"
 	"mygo/internal/ir"
 )
 
@@ -15,7 +20,7 @@ func TestEmitVerilogRunsExportVerilog(t *testing.T) {
 	tmp := t.TempDir()
 
 	opt := touchFakeBinary(t, tmp)
-	stubRunExport(t, func(binary, pipeline, loweringOptions, inputPath, mlirOutputPath, verilogOutputPath string) error {
+	runExport := func(_ context.Context, binary, pipeline, loweringOptions, inputPath, mlirOutputPath, verilogOutputPath string, stderr io.Writer) error {
 		if binary != opt {
 			return fmt.Errorf("unexpected binary %s", binary)
 		}
@@ -26,10 +31,10 @@ func TestEmitVerilogRunsExportVerilog(t *testing.T) {
 			return err
 		}
 		return os.WriteFile(verilogOutputPath, []byte("// circt-opt export\n"), 0o644)
-	})
+	}
 
 	out := filepath.Join(tmp, "out.sv")
-	opts := Options{CIRCTOptPath: opt}
+	opts := Options{CIRCTOptPath: opt, runExport: runExport}
 	res, err := EmitVerilog(design, out, opts)
 	if err != nil {
 		t.Fatalf("EmitVerilog failed: %v", err)
@@ -55,7 +60,7 @@ func TestEmitVerilogRunsOptWhenPipelineProvided(t *testing.T) {
 	tmp := t.TempDir()
 
 	opt := touchFakeBinary(t, tmp)
-	stubRunPipeline(t, func(binary, pipeline, inputPath, outputPath string) error {
+	runPipeline := func(_ context.Context, binary, pipeline, inputPath, outputPath string, stderr io.Writer) error {
 		if binary != opt {
 			return fmt.Errorf("unexpected binary %s", binary)
 		}
@@ -68,18 +73,20 @@ func TestEmitVerilogRunsOptWhenPipelineProvided(t *testing.T) {
 		}
 		prefixed := append([]byte("// pipeline:"+pipeline+"\n"), content...)
 		return os.WriteFile(outputPath, prefixed, 0o644)
-	})
-	stubRunExport(t, func(binary, pipeline, loweringOptions, inputPath, mlirOutputPath, verilogOutputPath string) error {
+	}
+	runExport := func(_ context.Context, binary, pipeline, loweringOptions, inputPath, mlirOutputPath, verilogOutputPath string, stderr io.Writer) error {
 		if err := copyFile(inputPath, mlirOutputPath); err != nil {
 			return err
 		}
 		return copyFile(inputPath, verilogOutputPath)
-	})
+	}
 
 	out := filepath.Join(tmp, "out.sv")
 	opts := Options{
 		CIRCTOptPath: opt,
 		PassPipeline: "pipeline-test",
+		runExport:    runExport,
+		runPipeline:  runPipeline,
 	}
 	if _, err := EmitVerilog(design, out, opts); err != nil {
 		t.Fatalf("EmitVerilog failed: %v", err)
@@ -101,24 +108,26 @@ func TestEmitVerilogDumpsFinalMLIR(t *testing.T) {
 	opt := touchFakeBinary(t, tmp)
 	dumpPath := filepath.Join(tmp, "mlir", "final.mlir")
 	out := filepath.Join(tmp, "out.sv")
-	stubRunPipeline(t, func(binary, pipeline, inputPath, outputPath string) error {
+	runPipeline := func(_ context.Context, binary, pipeline, inputPath, outputPath string, stderr io.Writer) error {
 		content, err := os.ReadFile(inputPath)
 		if err != nil {
 			return err
 		}
 		prefixed := append([]byte("// opt:pipeline-test\n"), content...)
 		return os.WriteFile(outputPath, prefixed, 0o644)
-	})
-	stubRunExport(t, func(binary, pipeline, loweringOptions, inputPath, mlirOutputPath, verilogOutputPath string) error {
+	}
+	runExport := func(_ context.Context, binary, pipeline, loweringOptions, inputPath, mlirOutputPath, verilogOutputPath string, stderr io.Writer) error {
 		if err := copyFile(inputPath, mlirOutputPath); err != nil {
 			return err
 		}
 		return copyFile(inputPath, verilogOutputPath)
-	})
+	}
 	opts := Options{
 		CIRCTOptPath: opt,
 		PassPipeline: "pipeline-test",
 		DumpMLIRPath: dumpPath,
+		runExport:    runExport,
+		runPipeline:  runPipeline,
 	}
 	if _, err := EmitVerilog(design, out, opts); err != nil {
 		t.Fatalf("EmitVerilog failed: %v", err)
@@ -146,12 +155,12 @@ func TestEmitVerilogEmitsAuxiliaryFifoFile(t *testing.T) {
 	design := testDesignWithChannel()
 	tmp := t.TempDir()
 	opt := touchFakeBinary(t, tmp)
-	stubRunExport(t, func(binary, pipeline, loweringOptions, inputPath, mlirOutputPath, verilogOutputPath string) error {
+	runExport := func(_ context.Context, binary, pipeline, loweringOptions, inputPath, mlirOutputPath, verilogOutputPath string, stderr io.Writer) error {
 		if err := copyFile(inputPath, mlirOutputPath); err != nil {
 			return err
 		}
 		return os.WriteFile(verilogOutputPath, []byte(readBackendTestdata(t, "design_inline_fifo.sv")), 0o644)
-	})
+	}
 	fifoSrc := filepath.Join(tmp, "fifo_impl.sv")
 	fifoBody := readBackendTestdata(t, "fifo_impl_external_stub.sv")
 	if err := os.WriteFile(fifoSrc, []byte(fifoBody), 0o644); err != nil {
@@ -161,6 +170,7 @@ func TestEmitVerilogEmitsAuxiliaryFifoFile(t *testing.T) {
 	res, err := EmitVerilog(design, out, Options{
 		CIRCTOptPath: opt,
 		FIFOSource:   fifoSrc,
+		runExport:    runExport,
 	})
 	if err != nil {
 		t.Fatalf("EmitVerilog failed: %v", err)
@@ -195,12 +205,12 @@ func TestEmitVerilogGeneratesFifoWrappers(t *testing.T) {
 	design := testDesignWithChannel()
 	tmp := t.TempDir()
 	opt := touchFakeBinary(t, tmp)
-	stubRunExport(t, func(binary, pipeline, loweringOptions, inputPath, mlirOutputPath, verilogOutputPath string) error {
+	runExport := func(_ context.Context, binary, pipeline, loweringOptions, inputPath, mlirOutputPath, verilogOutputPath string, stderr io.Writer) error {
 		if err := copyFile(inputPath, mlirOutputPath); err != nil {
 			return err
 		}
 		return os.WriteFile(verilogOutputPath, []byte(readBackendTestdata(t, "design_inline_fifo.sv")), 0o644)
-	})
+	}
 	fifoSrc := filepath.Join(tmp, "fifo_impl_template_parametric.sv")
 	if err := os.WriteFile(fifoSrc, []byte(readBackendTestdata(t, "fifo_impl_template_parametric.sv")), 0o644); err != nil {
 		t.Fatalf("write fifo template: %v", err)
@@ -209,6 +219,7 @@ func TestEmitVerilogGeneratesFifoWrappers(t *testing.T) {
 	res, err := EmitVerilog(design, out, Options{
 		CIRCTOptPath: opt,
 		FIFOSource:   fifoSrc,
+		runExport:    runExport,
 	})
 	if err != nil {
 		t.Fatalf("EmitVerilog failed: %v", err)
@@ -227,18 +238,76 @@ func TestEmitVerilogGeneratesFifoWrappers(t *testing.T) {
 	if !strings.Contains(text, "module mygo_fifo_i32_d1") {
 		t.Fatalf("expected fifo wrapper to be generated:\n%s", text)
 	}
+	if strings.Contains(text, "output wire count") || strings.Contains(text, ".count(count)") {
+		t.Fatalf("expected a FIFO nobody reads with len to have no count port:\n%s", text)
+	}
+}
+
+func TestEmitVerilogWrapsCountedFifos(t *testing.T) {
+	design := testDesignWithChannel()
+	ch := design.TopLevel.Channels["t0"]
+	design.TopLevel.Channels["t1"] = &ir.Channel{Name: "t1", Type: ch.Type, Depth: ch.Depth}
+	dest := &ir.Signal{Name: "n", Type: ch.CountType(), Kind: ir.Wire}
+	design.TopLevel.Processes = []*ir.Process{{
+		Name:   "main",
+		Blocks: []*ir.BasicBlock{{Label: "entry", Ops: []ir.Operation{&ir.LenOperation{Channel: ch, Dest: dest}}}},
+	}}
+	tmp := t.TempDir()
+	opt := touchFakeBinary(t, tmp)
+	runExport := func(_ context.Context, binary, pipeline, loweringOptions, inputPath, mlirOutputPath, verilogOutputPath string, stderr io.Writer) error {
+		if err := copyFile(inputPath, mlirOutputPath); err != nil {
+			return err
+		}
+		verilog := "module main();\nendmodule\nmodule mygo_fifo_i32_d1_count();\nendmodule\nmodule mygo_fifo_i32_d1();\nendmodule\n"
+		return os.WriteFile(verilogOutputPath, []byte(verilog), 0o644)
+	}
+	fifoSrc := filepath.Join(tmp, "fifo_impl_template_parametric.sv")
+	if err := os.WriteFile(fifoSrc, []byte(readBackendTestdata(t, "fifo_impl_template_parametric.sv")), 0o644); err != nil {
+		t.Fatalf("write fifo template: %v", err)
+	}
+	out := filepath.Join(tmp, "design.sv")
+	res, err := EmitVerilog(design, out, Options{
+		CIRCTOptPath: opt,
+		FIFOSource:   fifoSrc,
+		runExport:    runExport,
+	})
+	if err != nil {
+		t.Fatalf("EmitVerilog failed: %v", err)
+	}
+	main, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("read design: %v", err)
+	}
+	if strings.Contains(string(main), "mygo_fifo") {
+		t.Fatalf("expected both FIFO stubs to be stripped:\n%s", main)
+	}
+	data, err := os.ReadFile(res.AuxPaths[0])
+	if err != nil {
+		t.Fatalf("read aux: %v", err)
+	}
+	text := string(data)
+	counted := text[strings.Index(text, "module mygo_fifo_i32_d1_count("):]
+	counted = counted[:strings.Index(counted, "endmodule")]
+	if !strings.Contains(counted, "output wire count") || !strings.Contains(counted, ".count(count)") {
+		t.Fatalf("expected the FIFO read with len to export count:\n%s", text)
+	}
+	plain := text[strings.Index(text, "module mygo_fifo_i32_d1("):]
+	plain = plain[:strings.Index(plain, "endmodule")]
+	if strings.Contains(plain, "count") {
+		t.Fatalf("expected the other FIFO to keep the old port list:\n%s", text)
+	}
 }
 
 func TestEmitVerilogStripsAnnotatedFifoModules(t *testing.T) {
 	design := testDesignWithChannel()
 	tmp := t.TempDir()
 	opt := touchFakeBinary(t, tmp)
-	stubRunExport(t, func(binary, pipeline, loweringOptions, inputPath, mlirOutputPath, verilogOutputPath string) error {
+	runExport := func(_ context.Context, binary, pipeline, loweringOptions, inputPath, mlirOutputPath, verilogOutputPath string, stderr io.Writer) error {
 		if err := copyFile(inputPath, mlirOutputPath); err != nil {
 			return err
 		}
 		return os.WriteFile(verilogOutputPath, []byte(readBackendTestdata(t, "design_fifo_with_attrs.sv")), 0o644)
-	})
+	}
 	fifoSrc := filepath.Join(tmp, "fifo_impl.sv")
 	if err := os.WriteFile(fifoSrc, []byte(readBackendTestdata(t, "fifo_impl_concrete.sv")), 0o644); err != nil {
 		t.Fatalf("write fifo impl: %v", err)
@@ -247,6 +316,7 @@ func TestEmitVerilogStripsAnnotatedFifoModules(t *testing.T) {
 	if _, err := EmitVerilog(design, out, Options{
 		CIRCTOptPath: opt,
 		FIFOSource:   fifoSrc,
+		runExport:    runExport,
 	}); err != nil {
 		t.Fatalf("EmitVerilog failed: %v", err)
 	}
@@ -267,12 +337,12 @@ func TestEmitVerilogCopiesFifoDirectory(t *testing.T) {
 	design := testDesignWithChannel()
 	tmp := t.TempDir()
 	opt := touchFakeBinary(t, tmp)
-	stubRunExport(t, func(binary, pipeline, loweringOptions, inputPath, mlirOutputPath, verilogOutputPath string) error {
+	runExport := func(_ context.Context, binary, pipeline, loweringOptions, inputPath, mlirOutputPath, verilogOutputPath string, stderr io.Writer) error {
 		if err := copyFile(inputPath, mlirOutputPath); err != nil {
 			return err
 		}
 		return os.WriteFile(verilogOutputPath, []byte(readBackendTestdata(t, "design_inline_fifo.sv")), 0o644)
-	})
+	}
 	srcDir := filepath.Join(tmp, "fifo_lib")
 	if err := os.MkdirAll(srcDir, 0o755); err != nil {
 		t.Fatalf("mkdir fifo dir: %v", err)
@@ -292,6 +362,7 @@ func TestEmitVerilogCopiesFifoDirectory(t *testing.T) {
 	res, err := EmitVerilog(design, out, Options{
 		CIRCTOptPath: opt,
 		FIFOSource:   srcDir,
+		runExport:    runExport,
 	})
 	if err != nil {
 		t.Fatalf("EmitVerilog failed: %v", err)
@@ -313,19 +384,49 @@ func TestEmitVerilogErrorsWithoutFifoSource(t *testing.T) {
 	design := testDesignWithChannel()
 	tmp := t.TempDir()
 	opt := touchFakeBinary(t, tmp)
-	stubRunExport(t, func(binary, pipeline, loweringOptions, inputPath, mlirOutputPath, verilogOutputPath string) error {
+	runExport := func(_ context.Context, binary, pipeline, loweringOptions, inputPath, mlirOutputPath, verilogOutputPath string, stderr io.Writer) error {
 		if err := copyFile(inputPath, mlirOutputPath); err != nil {
 			return err
 		}
 		return os.WriteFile(verilogOutputPath, []byte(readBackendTestdata(t, "design_inline_fifo.sv")), 0o644)
-	})
+	}
 	out := filepath.Join(tmp, "design.sv")
-	_, err := EmitVerilog(design, out, Options{CIRCTOptPath: opt})
+	_, err := EmitVerilog(design, out, Options{CIRCTOptPath: opt, runExport: runExport})
 	if err == nil || !strings.Contains(err.Error(), "fifo source") {
 		t.Fatalf("expected fifo source error, got %v", err)
 	}
 }
 
+func TestEmitVerilogReportsCirctErrorsAtGoPositions(t *testing.T) {
+	design := testDesign()
+	design.Fset = token.NewFileSet()
+	design.Fset.AddFile("/src/main.go", -1, 60).SetLines([]int{0, 20, 40})
+	design.Root = "/src"
+	tmp := t.TempDir()
+
+	opt := touchFakeBinary(t, tmp)
+	runPipeline := func(_ context.Context, binary, pipeline, inputPath, outputPath string, stderr io.Writer) error {
+		fmt.Fprint(stderr, "main.go:2:5: error: 'comb.add' op operand types differ\n")
+		fmt.Fprint(stderr, "design.mlir:7:3: note: see current operation\n")
+		return fmt.Errorf("circt-opt failed")
+	}
+
+	var out bytes.Buffer
+	reporter := diag.NewReporter(&out, "text")
+	reporter.SetFileSet(design.Fset)
+	opts := Options{CIRCTOptPath: opt, PassPipeline: "any", Reporter: reporter, runPipeline: runPipeline}
+	if _, err := EmitVerilog(design, filepath.Join(tmp, "out.sv"), opts); err == nil {
+		t.Fatalf("expected the pipeline failure to be returned")
+	}
+	want := "/src/main.go:2:5: error: circt-opt: 'comb.add' op operand types differ\n"
+	if out.String() != want {
+		t.Fatalf("expected only the Go-located diagnostic to be reported, got:\n%s", out.String())
+	}
+	if !reporter.HasErrors() {
+		t.Fatalf("expected the reporter to count the error")
+	}
+}
+
 func testDesign() *ir.Design {
 	mod := &ir.Module{
 		Name: "main",
@@ -361,20 +462,6 @@ func testDesignWithChannel() *ir.Design {
 	}
 }
 
-func stubRunPipeline(t *testing.T, fn func(binary, pipeline, inputPath, outputPath string) error) {
-	t.Helper()
-	prev := runPipeline
-	runPipeline = fn
-	t.Cleanup(func() { runPipeline = prev })
-}
-
-func stubRunExport(t *testing.T, fn func(binary, pipeline, loweringOptions, inputPath, mlirOutputPath, verilogOutputPath string) error) {
-	t.Helper()
-	prev := runExport
-	runExport = fn
-	t.Cleanup(func() { runExport = prev })
-}
-
 func touchFakeBinary(t *testing.T, dir string) string {
 	t.Helper()
 	path := filepath.Join(dir, "circt-opt")
@@ -402,3 +489,28 @@ func readBackendTestdata(t *testing.T, name string) string {
 	}
 	return string(data)
 }
+func TestNeedsFIFOSource(t *testing.T) {
+	t.Parallel()
+	channel := &ir.Channel{Name: "ch", Type: &ir.SignalType{Width: 32}, Depth: 4}
+	unbuffered := &ir.Channel{Name: "sync", Type: &ir.SignalType{Width: 32}}
+	cases := []struct {
+		name   string
+		design *ir.Design
+		want   bool
+	}{
+		{name: "nil design", design: nil, want: false},
+		{name: "module without channels", design: &ir.Design{Modules: []*ir.Module{{Name: "foo"}}}, want: false},
+		{name: "module with empty entry", design: &ir.Design{Modules: []*ir.Module{nil}}, want: false},
+		{name: "module with channel", design: &ir.Design{Modules: []*ir.Module{{Name: "foo", Channels: map[string]*ir.Channel{"ch": channel}}}}, want: true},
+		{name: "module with unbuffered channel", design: &ir.Design{Modules: []*ir.Module{{Name: "foo", Channels: map[string]*ir.Channel{"sync": unbuffered}}}}, want: false},
+	}
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			if got := NeedsFIFOSource(tc.design); got != tc.want {
+				t.Fatalf("NeedsFIFOSource(%s)=%t, want %t", tc.name, got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package backend
+
+import (
+	"bytes"
+	"go/token"
+	"io"
+	"regexp"
+	"strconv"
+
+	"mygo/internal/diag"
+	"mygo/internal/ir"
+)
+
+// circtDiagPattern matches the file:line:col: severity: message lines MLIR
+// prints for a diagnostic.
+var circtDiagPattern = regexp.MustCompile(`^(.+):(\d+):(\d+): (error|warning|note|remark): (.*)$`)
+
+// circtDiagnostics is the stderr of circt-opt. A diagnostic whose location
+// falls in one of the design's Go files, through the loc() the MLIR emitter
+// attaches, is reported at that Go position through the reporter. Every
+// other line, including the source excerpt MLIR prints under a diagnostic,
+// passes through to out unchanged.
+type circtDiagnostics struct {
+	out      io.Writer
+	reporter *diag.Reporter
+	files    map[string]*token.File
+	line     []byte
+}
+
+// newCirctDiagnostics keys the design's files by the name the emitter puts
+// in their locations.
+func newCirctDiagnostics(out io.Writer, design *ir.Design, reporter *diag.Reporter) *circtDiagnostics {
+	d := &circtDiagnostics{out: out, reporter: reporter, files: make(map[string]*token.File)}
+	if design.Fset != nil {
+		design.Fset.Iterate(func(f *token.File) bool {
+			d.files[design.SourceName(f.Name())] = f
+			return true
+		})
+	}
+	return d
+}
+
+func (d *circtDiagnostics) Write(p []byte) (int, error) {
+	for _, b := range p {
+		d.line = append(d.line, b)
+		if b == '\n' {
+			d.flush()
+		}
+	}
+	return len(p), nil
+}
+
+// Close passes on a last line that has no newline.
+func (d *circtDiagnostics) Close() error {
+	if len(d.line) > 0 {
+		d.flush()
+	}
+	return nil
+}
+
+func (d *circtDiagnostics) flush() {
+	line := d.line
+	d.line = nil
+	if pos, sev, msg, ok := d.parse(bytes.TrimRight(line, "\r\n")); ok {
+		msg = "circt-opt: " + msg
+		switch sev {
+		case "error":
+			d.reporter.Error(pos, msg)
+		case "warning":
+			d.reporter.Warning(pos, msg)
+		default:
+			d.reporter.Info(pos, msg)
+		}
+		return
+	}
+	d.out.Write(line)
+}
+
+// parse maps a diagnostic line to its Go position.
+func (d *circtDiagnostics) parse(line []byte) (token.Pos, string, string, bool) {
+	if d.reporter == nil {
+		return token.NoPos, "", "", false
+	}
+	m := circtDiagPattern.FindSubmatch(line)
+	if m == nil {
+		return token.NoPos, "", "", false
+	}
+	file := d.files[string(m[1])]
+	lineNo, _ := strconv.Atoi(string(m[2]))
+	col, _ := strconv.Atoi(string(m[3]))
+	if file == nil || lineNo < 1 || lineNo > file.LineCount() {
+		return token.NoPos, "", "", false
+	}
+	pos := file.LineStart(lineNo)
+	if col > 1 && int(pos)+col-1 <= file.Base()+file.Size() {
+		pos += token.Pos(col - 1)
+	}
+	return pos, string(m[4]), string(m[5]), true
+}
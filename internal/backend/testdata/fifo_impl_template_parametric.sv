@@ -2,7 +2,8 @@
 // mygo:fifo_template
 module mygo_fifo #(
   parameter integer WIDTH = 32,
-  parameter integer DEPTH = 1
+  parameter integer DEPTH = 1,
+  parameter integer COUNT_BITS = 1
 ) (
   input wire clk,
   input wire rst,
@@ -11,6 +12,7 @@ module mygo_fifo #(
   inout wire in_ready,
   inout wire [WIDTH-1:0] out_data,
   inout wire out_valid,
-  inout wire out_ready
+  inout wire out_ready,
+  output wire [COUNT_BITS-1:0] count
 );
 endmodule
@@ -16,6 +16,32 @@ const (
 	Error
 )
 
+func (s Severity) String() string {
+	switch s {
+	case Info:
+		return "info"
+	case Warning:
+		return "warning"
+	}
+	return "error"
+}
+
+// Diagnostic is one reported message. Position is invalid when the message
+// has no source location.
+type Diagnostic struct {
+	Severity Severity
+	Position token.Position
+	Message  string
+}
+
+// String renders the diagnostic the way the text reporter prints it.
+func (d Diagnostic) String() string {
+	if d.Position.IsValid() {
+		return fmt.Sprintf("%s:%d:%d: %s: %s", d.Position.Filename, d.Position.Line, d.Position.Column, d.Severity, d.Message)
+	}
+	return fmt.Sprintf("%s: %s", d.Severity, d.Message)
+}
+
 // Reporter collects and prints diagnostics in either text or JSON format.
 // For Phase 1 we only implement a lightweight text reporter.
 type Reporter struct {
@@ -23,6 +49,7 @@ type Reporter struct {
 	format   string
 	fset     *token.FileSet
 	errCount int
+	diags    []Diagnostic
 }
 
 // NewReporter creates a reporter that writes to out using the given format.
@@ -74,28 +101,32 @@ func (r *Reporter) HasErrors() bool {
 	return r.errCount > 0
 }
 
-func (r *Reporter) report(sev Severity, pos token.Pos, msg string) {
-	if r.format != "text" {
-		// Only text output is implemented for now.
+// Diagnostics returns every message reported so far, in order.
+func (r *Reporter) Diagnostics() []Diagnostic {
+	return append([]Diagnostic(nil), r.diags...)
+}
+
+// Print writes diags to out in format, as a reporter would have printed
+// them while they were being reported.
+func Print(out io.Writer, format string, diags []Diagnostic) {
+	r := NewReporter(out, format)
+	for _, d := range diags {
+		r.print(d)
 	}
+}
 
-	location := ""
+func (r *Reporter) report(sev Severity, pos token.Pos, msg string) {
+	d := Diagnostic{Severity: sev, Message: msg}
 	if pos != token.NoPos && r.fset != nil {
-		p := r.fset.Position(pos)
-		if p.IsValid() {
-			location = fmt.Sprintf("%s:%d:%d: ", p.Filename, p.Line, p.Column)
-		}
+		d.Position = r.fset.Position(pos)
 	}
+	r.diags = append(r.diags, d)
+	r.print(d)
+}
 
-	var prefix string
-	switch sev {
-	case Info:
-		prefix = "info"
-	case Warning:
-		prefix = "warning"
-	default:
-		prefix = "error"
+func (r *Reporter) print(d Diagnostic) {
+	if r.format != "text" {
+		// Only text output is implemented for now.
 	}
-
-	fmt.Fprintf(r.out, "%s%s: %s\n", location, prefix, msg)
+	fmt.Fprintln(r.out, d.String())
 }
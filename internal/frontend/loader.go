@@ -1,6 +1,7 @@
 package frontend
 
 import (
+	"context"
 	"fmt"
 	"go/token"
 	"os"
@@ -18,6 +19,15 @@ import (
 type LoadConfig struct {
 	Sources   []string
 	BuildTags []string
+	// Overlay maps absolute file paths to contents that replace, or add
+	// to, the files on disk.
+	Overlay map[string][]byte
+	// Context cancels the underlying go list run when done.
+	Context context.Context
+	// GoCache and GoModCache override GOCACHE and GOMODCACHE for go list.
+	// Empty keeps the values of the environment.
+	GoCache    string
+	GoModCache string
 }
 
 // LoadPackages loads the requested source files using LLGo's enhanced loader
@@ -29,36 +39,8 @@ func LoadPackages(cfg LoadConfig, reporter *diag.Reporter) ([]*gopackages.Packag
 	}
 
 	fset := token.NewFileSet()
-	buildFlags := buildTagFlag(cfg.BuildTags)
-
-	dir := workingDir(cfg.Sources[0])
-	if dir != "" {
-		if absDir, err := filepath.Abs(dir); err == nil {
-			dir = absDir
-		}
-	}
-
-	goCache, goModCache := localCacheDirs()
-	env := append(os.Environ(),
-		"GOOS=linux",
-		"GOARCH=amd64",
-		"GOCACHE="+goCache,
-		"GOMODCACHE="+goModCache,
-	)
-
-	loadCfg := &gopackages.Config{
-		Mode:  gopackages.NeedName | gopackages.NeedSyntax | gopackages.NeedFiles | gopackages.NeedCompiledGoFiles | gopackages.NeedTypes | gopackages.NeedTypesInfo | gopackages.NeedImports | gopackages.NeedDeps | gopackages.NeedModule | gopackages.NeedTypesSizes,
-		Fset:  fset,
-		Env:   env,
-		Tests: false,
-	}
-	if dir != "" {
-		loadCfg.Dir = dir
-	}
-
-	if len(buildFlags) > 0 {
-		loadCfg.BuildFlags = buildFlags
-	}
+	loadCfg := goListConfig(cfg, gopackages.NeedName|gopackages.NeedSyntax|gopackages.NeedFiles|gopackages.NeedCompiledGoFiles|gopackages.NeedTypes|gopackages.NeedTypesInfo|gopackages.NeedImports|gopackages.NeedDeps|gopackages.NeedModule|gopackages.NeedTypesSizes)
+	loadCfg.Fset = fset
 
 	pkgs, err := gopackages.Load(loadCfg, ".")
 	if err != nil {
@@ -82,6 +64,62 @@ func LoadPackages(cfg LoadConfig, reporter *diag.Reporter) ([]*gopackages.Packag
 	return pkgs, fset, nil
 }
 
+// MainPackageFiles lists the Go files of the main package the sources name,
+// chosen the way LoadPackages chooses them but without type-checking.
+func MainPackageFiles(cfg LoadConfig) ([]string, error) {
+	if len(cfg.Sources) == 0 {
+		return nil, fmt.Errorf("no source files were provided")
+	}
+	pkgs, err := gopackages.Load(goListConfig(cfg, gopackages.NeedName|gopackages.NeedFiles), ".")
+	if err != nil {
+		return nil, err
+	}
+	for _, pkg := range pkgs {
+		if pkg.Name == "main" {
+			return pkg.GoFiles, nil
+		}
+	}
+	return nil, fmt.Errorf("no main package among the sources")
+}
+
+// goListConfig returns the go list configuration shared by every load: the
+// directory of the first source, the linux/amd64 target the hardware is
+// compiled for, and the caches, overlay and build tags of cfg.
+func goListConfig(cfg LoadConfig, mode gopackages.LoadMode) *gopackages.Config {
+	dir := workingDir(cfg.Sources[0])
+	if dir != "" {
+		if absDir, err := filepath.Abs(dir); err == nil {
+			dir = absDir
+		}
+	}
+
+	env := append(os.Environ(),
+		"GOOS=linux",
+		"GOARCH=amd64",
+	)
+	if cfg.GoCache != "" {
+		env = append(env, "GOCACHE="+cfg.GoCache)
+	}
+	if cfg.GoModCache != "" {
+		env = append(env, "GOMODCACHE="+cfg.GoModCache)
+	}
+
+	loadCfg := &gopackages.Config{
+		Mode:    mode,
+		Env:     env,
+		Tests:   false,
+		Overlay: cfg.Overlay,
+		Context: cfg.Context,
+	}
+	if dir != "" {
+		loadCfg.Dir = dir
+	}
+	if buildFlags := buildTagFlag(cfg.BuildTags); len(buildFlags) > 0 {
+		loadCfg.BuildFlags = buildFlags
+	}
+	return loadCfg
+}
+
 func buildTagFlag(tags []string) []string {
 	if len(tags) == 0 {
 		return nil
@@ -103,16 +141,3 @@ func workingDir(sample string) string {
 	}
 	return dir
 }
-
-func localCacheDirs() (string, string) {
-	cwd, err := os.Getwd()
-	if err != nil {
-		cwd = "."
-	}
-	root := filepath.Join(cwd, ".cache")
-	goCache := filepath.Join(root, "go-build")
-	goModCache := filepath.Join(root, "gomod")
-	_ = os.MkdirAll(goCache, 0o755)
-	_ = os.MkdirAll(goModCache, 0o755)
-	return goCache, goModCache
-}
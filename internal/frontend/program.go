@@ -0,0 +1,90 @@
+package frontend
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"golang.org/x/tools/go/packages"
+	"golang.org/x/tools/go/ssa"
+
+	"mygo/internal/diag"
+)
+
+// Program is a loaded package together with its SSA form.
+type Program struct {
+	Reporter    *diag.Reporter
+	SSA         *ssa.Program
+	SSAPackages []*ssa.Package
+	Packages    []*packages.Package
+}
+
+// Prepare loads the sources in cfg and builds their SSA, reporting problems
+// through reporter.
+func Prepare(cfg LoadConfig, reporter *diag.Reporter) (*Program, error) {
+	pkgs, _, err := LoadPackages(cfg, reporter)
+	if err != nil {
+		return nil, err
+	}
+	if reporter.HasErrors() {
+		return nil, fmt.Errorf("errors reported while loading packages")
+	}
+	prog, ssaPkgs, err := BuildSSA(pkgs, reporter)
+	if err != nil {
+		return nil, err
+	}
+	if reporter.HasErrors() {
+		return nil, fmt.Errorf("errors reported during SSA construction")
+	}
+	return &Program{
+		Reporter:    reporter,
+		SSA:         prog,
+		SSAPackages: ssaPkgs,
+		Packages:    pkgs,
+	}, nil
+}
+
+// WriteSSA prints every package of prog, sorted by import path.
+func WriteSSA(w io.Writer, prog *ssa.Program) error {
+	pkgs := sortedSSAPackages(prog)
+	if len(pkgs) == 0 {
+		return fmt.Errorf("no SSA packages available to emit")
+	}
+	for i, pkg := range pkgs {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		if _, err := pkg.WriteTo(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sortedSSAPackages(prog *ssa.Program) []*ssa.Package {
+	if prog == nil {
+		return nil
+	}
+	all := prog.AllPackages()
+	pkgs := make([]*ssa.Package, 0, len(all))
+	for _, pkg := range all {
+		if pkg == nil {
+			continue
+		}
+		pkgs = append(pkgs, pkg)
+	}
+	sort.Slice(pkgs, func(i, j int) bool {
+		return packageSortKey(pkgs[i]) < packageSortKey(pkgs[j])
+	})
+	return pkgs
+}
+
+func packageSortKey(pkg *ssa.Package) string {
+	if pkg == nil {
+		return ""
+	}
+	if pkg.Pkg != nil {
+		return pkg.Pkg.Path()
+	}
+	return pkg.String()
+}
@@ -0,0 +1,385 @@
+package ir
+
+import (
+	"slices"
+	"sort"
+)
+
+// DomTree is the dominator tree of a process, rooted at its entry block,
+// Blocks[0]. Blocks the entry cannot reach are not in the tree.
+type DomTree struct {
+	order    []*BasicBlock
+	idom     map[*BasicBlock]*BasicBlock
+	children map[*BasicBlock][]*BasicBlock
+	// pre and post number the tree walk so Dominates is a range check.
+	pre  map[*BasicBlock]int
+	post map[*BasicBlock]int
+}
+
+// ComputeDominators builds the dominator tree of proc with the iterative
+// algorithm of Cooper, Harvey and Kennedy.
+func ComputeDominators(proc *Process) *DomTree {
+	dt := &DomTree{
+		idom:     make(map[*BasicBlock]*BasicBlock),
+		children: make(map[*BasicBlock][]*BasicBlock),
+		pre:      make(map[*BasicBlock]int),
+		post:     make(map[*BasicBlock]int),
+	}
+	if len(proc.Blocks) == 0 {
+		return dt
+	}
+	dt.order = reversePostorder(proc.Blocks[0])
+	index := make(map[*BasicBlock]int, len(dt.order))
+	for idx, block := range dt.order {
+		index[block] = idx
+	}
+	entry := dt.order[0]
+	dt.idom[entry] = entry
+	intersect := func(a, b *BasicBlock) *BasicBlock {
+		for a != b {
+			for index[a] > index[b] {
+				a = dt.idom[a]
+			}
+			for index[b] > index[a] {
+				b = dt.idom[b]
+			}
+		}
+		return a
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, block := range dt.order[1:] {
+			var idom *BasicBlock
+			for _, pred := range block.Predecessors {
+				if dt.idom[pred] == nil {
+					continue
+				}
+				if idom == nil {
+					idom = pred
+				} else {
+					idom = intersect(pred, idom)
+				}
+			}
+			if dt.idom[block] != idom {
+				dt.idom[block] = idom
+				changed = true
+			}
+		}
+	}
+	delete(dt.idom, entry)
+	for _, block := range dt.order[1:] {
+		parent := dt.idom[block]
+		dt.children[parent] = append(dt.children[parent], block)
+	}
+	counter := 0
+	var walk func(*BasicBlock)
+	walk = func(block *BasicBlock) {
+		dt.pre[block] = counter
+		counter++
+		for _, child := range dt.children[block] {
+			walk(child)
+		}
+		dt.post[block] = counter
+	}
+	walk(entry)
+	return dt
+}
+
+// reversePostorder lists the blocks reachable from entry so that every block
+// comes before its successors, back edges aside.
+func reversePostorder(entry *BasicBlock) []*BasicBlock {
+	var post []*BasicBlock
+	seen := map[*BasicBlock]bool{entry: true}
+	var visit func(*BasicBlock)
+	visit = func(block *BasicBlock) {
+		for _, succ := range block.Successors {
+			if !seen[succ] {
+				seen[succ] = true
+				visit(succ)
+			}
+		}
+		post = append(post, block)
+	}
+	visit(entry)
+	for i, j := 0, len(post)-1; i < j; i, j = i+1, j-1 {
+		post[i], post[j] = post[j], post[i]
+	}
+	return post
+}
+
+// Order returns the reachable blocks in reverse postorder, entry first.
+func (dt *DomTree) Order() []*BasicBlock {
+	return dt.order
+}
+
+// Reachable reports whether the entry block reaches block.
+func (dt *DomTree) Reachable(block *BasicBlock) bool {
+	_, ok := dt.pre[block]
+	return ok
+}
+
+// Idom returns the immediate dominator of block, or nil for the entry and
+// unreachable blocks.
+func (dt *DomTree) Idom(block *BasicBlock) *BasicBlock {
+	return dt.idom[block]
+}
+
+// Children returns the blocks block immediately dominates.
+func (dt *DomTree) Children(block *BasicBlock) []*BasicBlock {
+	return dt.children[block]
+}
+
+// Dominates reports whether every path from the entry to b runs through a.
+// A block dominates itself.
+func (dt *DomTree) Dominates(a, b *BasicBlock) bool {
+	if !dt.Reachable(a) || !dt.Reachable(b) {
+		return false
+	}
+	return dt.pre[a] <= dt.pre[b] && dt.post[b] <= dt.post[a]
+}
+
+// Loop is a natural loop: a header that dominates the sources of its back
+// edges, and every block that reaches one of them without passing the
+// header.
+type Loop struct {
+	Header *BasicBlock
+	// Blocks holds the header first, then the body in reverse postorder.
+	Blocks   []*BasicBlock
+	Parent   *Loop
+	Children []*Loop
+}
+
+// Contains reports whether block is part of the loop or a loop nested in it.
+func (l *Loop) Contains(block *BasicBlock) bool {
+	return slices.Contains(l.Blocks, block)
+}
+
+// Depth is 1 for an outermost loop and one more for each enclosing loop.
+func (l *Loop) Depth() int {
+	depth := 0
+	for ; l != nil; l = l.Parent {
+		depth++
+	}
+	return depth
+}
+
+// LoopNest holds the natural loops of a process. Cycles entered other than
+// through a dominating header, which only goto can produce, are not loops.
+type LoopNest struct {
+	// Loops lists the outermost loops in the order of their headers.
+	Loops     []*Loop
+	innermost map[*BasicBlock]*Loop
+}
+
+// ComputeLoops finds the natural loops of the process dom was built for. Back
+// edges to the same header share one loop.
+func ComputeLoops(dom *DomTree) *LoopNest {
+	nest := &LoopNest{innermost: make(map[*BasicBlock]*Loop)}
+	var loops []*Loop
+	for _, header := range dom.Order() {
+		backEdge := false
+		inside := map[*BasicBlock]bool{header: true}
+		for _, pred := range header.Predecessors {
+			if !dom.Dominates(header, pred) {
+				continue
+			}
+			backEdge = true
+			work := []*BasicBlock{pred}
+			for len(work) > 0 {
+				block := work[len(work)-1]
+				work = work[:len(work)-1]
+				if inside[block] || !dom.Reachable(block) {
+					continue
+				}
+				inside[block] = true
+				work = append(work, block.Predecessors...)
+			}
+		}
+		if !backEdge {
+			continue
+		}
+		loop := &Loop{Header: header, Blocks: []*BasicBlock{header}}
+		for _, block := range dom.Order() {
+			if inside[block] && block != header {
+				loop.Blocks = append(loop.Blocks, block)
+			}
+		}
+		loops = append(loops, loop)
+	}
+	// A loop's parent is the smallest other loop that holds its header. Loops
+	// are visited from the largest so parents are linked first.
+	sort.SliceStable(loops, func(i, j int) bool {
+		return len(loops[i].Blocks) > len(loops[j].Blocks)
+	})
+	for idx, loop := range loops {
+		for _, outer := range loops[:idx] {
+			if outer.Contains(loop.Header) && (loop.Parent == nil || len(outer.Blocks) < len(loop.Parent.Blocks)) {
+				loop.Parent = outer
+			}
+		}
+		for _, block := range loop.Blocks {
+			nest.innermost[block] = loop
+		}
+	}
+	index := make(map[*BasicBlock]int)
+	for idx, block := range dom.Order() {
+		index[block] = idx
+	}
+	byHeader := func(list []*Loop) {
+		sort.Slice(list, func(i, j int) bool {
+			return index[list[i].Header] < index[list[j].Header]
+		})
+	}
+	for _, loop := range loops {
+		if loop.Parent == nil {
+			nest.Loops = append(nest.Loops, loop)
+		} else {
+			loop.Parent.Children = append(loop.Parent.Children, loop)
+		}
+	}
+	byHeader(nest.Loops)
+	for _, loop := range loops {
+		byHeader(loop.Children)
+	}
+	return nest
+}
+
+// LoopOf returns the innermost loop holding block, or nil.
+func (n *LoopNest) LoopOf(block *BasicBlock) *Loop {
+	return n.innermost[block]
+}
+
+// Liveness records which signals of a process are live on entry to and exit
+// from each block: some path from there reads the signal before driving it
+// again. Constants are never live. A phi reads its incoming value at the end
+// of the matching predecessor, so the value is live out of that predecessor
+// only.
+type Liveness struct {
+	in  map[*BasicBlock]map[*Signal]bool
+	out map[*BasicBlock]map[*Signal]bool
+}
+
+// ComputeLiveness solves the backward dataflow problem for proc.
+func ComputeLiveness(proc *Process) *Liveness {
+	live := &Liveness{
+		in:  make(map[*BasicBlock]map[*Signal]bool),
+		out: make(map[*BasicBlock]map[*Signal]bool),
+	}
+	uses := make(map[*BasicBlock]map[*Signal]bool)
+	defs := make(map[*BasicBlock]map[*Signal]bool)
+	// phiUses[pred] holds the values phis in pred's successors read from it.
+	phiUses := make(map[*BasicBlock]map[*Signal]bool)
+	read := func(set map[*BasicBlock]map[*Signal]bool, block *BasicBlock, sig *Signal) {
+		if sig == nil || sig.Kind == Const {
+			return
+		}
+		if set[block] == nil {
+			set[block] = make(map[*Signal]bool)
+		}
+		set[block][sig] = true
+	}
+	for _, block := range proc.Blocks {
+		defs[block] = make(map[*Signal]bool)
+		for _, op := range block.Ops {
+			if phi, ok := op.(*PhiOperation); ok {
+				for _, in := range phi.Incomings {
+					read(phiUses, in.Block, in.Value)
+				}
+			} else {
+				for _, sig := range OperationOperands(op) {
+					if !defs[block][sig] {
+						read(uses, block, sig)
+					}
+				}
+			}
+			if dest := OperationDest(op); dest != nil {
+				defs[block][dest] = true
+			}
+		}
+		if br, ok := block.Terminator.(*BranchTerminator); ok && !defs[block][br.Cond] {
+			read(uses, block, br.Cond)
+		}
+	}
+
+	order := reversePostorderAll(proc)
+	for changed := true; changed; {
+		changed = false
+		for idx := len(order) - 1; idx >= 0; idx-- {
+			block := order[idx]
+			out := make(map[*Signal]bool)
+			for sig := range phiUses[block] {
+				out[sig] = true
+			}
+			for _, succ := range block.Successors {
+				for sig := range live.in[succ] {
+					out[sig] = true
+				}
+			}
+			in := make(map[*Signal]bool)
+			for sig := range uses[block] {
+				in[sig] = true
+			}
+			for sig := range out {
+				if !defs[block][sig] {
+					in[sig] = true
+				}
+			}
+			if len(in) != len(live.in[block]) || len(out) != len(live.out[block]) {
+				changed = true
+			}
+			live.in[block] = in
+			live.out[block] = out
+		}
+	}
+	return live
+}
+
+// reversePostorderAll orders every block of proc, appending the blocks the
+// entry does not reach.
+func reversePostorderAll(proc *Process) []*BasicBlock {
+	if len(proc.Blocks) == 0 {
+		return nil
+	}
+	order := reversePostorder(proc.Blocks[0])
+	seen := make(map[*BasicBlock]bool, len(order))
+	for _, block := range order {
+		seen[block] = true
+	}
+	for _, block := range proc.Blocks {
+		if !seen[block] {
+			order = append(order, block)
+		}
+	}
+	return order
+}
+
+// LiveIn returns the signals live on entry to block, ordered by name.
+func (l *Liveness) LiveIn(block *BasicBlock) []*Signal {
+	return sortedSignals(l.in[block])
+}
+
+// LiveOut returns the signals live on exit from block, ordered by name.
+func (l *Liveness) LiveOut(block *BasicBlock) []*Signal {
+	return sortedSignals(l.out[block])
+}
+
+// IsLiveIn reports whether sig is live on entry to block.
+func (l *Liveness) IsLiveIn(block *BasicBlock, sig *Signal) bool {
+	return l.in[block][sig]
+}
+
+// IsLiveOut reports whether sig is live on exit from block.
+func (l *Liveness) IsLiveOut(block *BasicBlock, sig *Signal) bool {
+	return l.out[block][sig]
+}
+
+func sortedSignals(set map[*Signal]bool) []*Signal {
+	sigs := make([]*Signal, 0, len(set))
+	for sig := range set {
+		sigs = append(sigs, sig)
+	}
+	sort.Slice(sigs, func(i, j int) bool {
+		return sigs[i].Name < sigs[j].Name
+	})
+	return sigs
+}
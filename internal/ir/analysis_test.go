@@ -0,0 +1,151 @@
+package ir
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+const nestedLoopIR = `
+module main
+  ports:
+    in  clk 1bu
+    in  rst 1bu
+  signals:
+    i        wire  8bu
+    i2       wire  8bu
+    j        wire  8bu
+    j2       wire  8bu
+    more     wire  1bu
+    again    wire  1bu
+    one      const 8bu = 1
+    ten      const 8bu = 10
+    zero     const 8bu = 0
+  process 0 main (stage=0, sequential)
+    block entry
+      jump outer
+    block outer
+      i := phi[entry:zero, latch:i2]
+      more := cmp(i <u ten)
+      br more ? inner : exit
+    block inner
+      j := phi[outer:zero, inner:j2]
+      j2 := j + one
+      again := cmp(j2 <u i)
+      br again ? inner : latch
+    block latch
+      i2 := i + one
+      jump outer
+    block exit
+      print "i=" %d(i) "\n"
+      return
+`
+
+func parseAnalysisProcess(t *testing.T) (*Process, map[string]*BasicBlock, map[string]*Signal) {
+	t.Helper()
+	design, err := Parse(strings.NewReader(nestedLoopIR))
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	proc := design.TopLevel.Processes[0]
+	blocks := make(map[string]*BasicBlock)
+	for _, block := range proc.Blocks {
+		blocks[block.Label] = block
+	}
+	return proc, blocks, design.TopLevel.Signals
+}
+
+func TestDominatorsAndLoops(t *testing.T) {
+	proc, b, _ := parseAnalysisProcess(t)
+	dom := ComputeDominators(proc)
+	if dom.Idom(b["inner"]) != b["outer"] || dom.Idom(b["latch"]) != b["inner"] || dom.Idom(b["exit"]) != b["outer"] {
+		t.Fatalf("unexpected immediate dominators")
+	}
+	if !dom.Dominates(b["outer"], b["latch"]) || dom.Dominates(b["inner"], b["exit"]) || !dom.Dominates(b["exit"], b["exit"]) {
+		t.Fatalf("unexpected dominance")
+	}
+
+	loops := ComputeLoops(dom)
+	if len(loops.Loops) != 1 {
+		t.Fatalf("expected one outermost loop, got %d", len(loops.Loops))
+	}
+	outer := loops.Loops[0]
+	if outer.Header != b["outer"] || len(outer.Blocks) != 3 || len(outer.Children) != 1 {
+		t.Fatalf("unexpected outer loop: header %s, %d blocks, %d children", outer.Header.Label, len(outer.Blocks), len(outer.Children))
+	}
+	inner := loops.LoopOf(b["inner"])
+	if inner != outer.Children[0] || inner.Parent != outer || inner.Depth() != 2 || len(inner.Blocks) != 1 {
+		t.Fatalf("expected inner to be a self loop nested in outer")
+	}
+	if loops.LoopOf(b["latch"]) != outer || loops.LoopOf(b["exit"]) != nil {
+		t.Fatalf("unexpected innermost loops")
+	}
+}
+
+func TestLivenessAndUseDef(t *testing.T) {
+	proc, b, sigs := parseAnalysisProcess(t)
+	live := ComputeLiveness(proc)
+	names := func(list []*Signal) string {
+		var parts []string
+		for _, sig := range list {
+			parts = append(parts, sig.Name)
+		}
+		return strings.Join(parts, ",")
+	}
+	cases := []struct {
+		got, want string
+	}{
+		{names(live.LiveIn(b["outer"])), ""},
+		{names(live.LiveIn(b["inner"])), "i"},
+		{names(live.LiveOut(b["inner"])), "i,j2"},
+		{names(live.LiveOut(b["latch"])), "i2"},
+		{names(live.LiveIn(b["exit"])), "i"},
+	}
+	for idx, tc := range cases {
+		if tc.got != tc.want {
+			t.Fatalf("case %d: expected live set %q, got %q", idx, tc.want, tc.got)
+		}
+	}
+	if live.IsLiveOut(b["entry"], sigs["zero"]) {
+		t.Fatalf("constants are never live")
+	}
+
+	ud := ComputeUseDef(proc)
+	if defs := ud.Defs(sigs["i"]); len(defs) != 1 || defs[0].Block != b["outer"] {
+		t.Fatalf("expected i to be driven once in outer, got %v", defs)
+	}
+	uses := ud.Uses(sigs["i"])
+	var blocks []string
+	for _, use := range uses {
+		blocks = append(blocks, use.Block.Label)
+	}
+	if got := strings.Join(blocks, ","); got != "outer,inner,latch,exit" {
+		t.Fatalf("unexpected uses of i: %s", got)
+	}
+	if uses := ud.Uses(sigs["more"]); len(uses) != 1 || uses[0].Op != nil {
+		t.Fatalf("expected more to be read by the branch only")
+	}
+	if got := ud.Signals(); len(got) == 0 || !slices.Contains(got, sigs["i"]) || !slices.Contains(got, sigs["more"]) {
+		t.Fatalf("expected Signals to list every signal touched, got %s", names(got))
+	}
+}
+
+func TestReplaceOperandsCoversEveryOperand(t *testing.T) {
+	proc, _, sigs := parseAnalysisProcess(t)
+	for _, from := range []*Signal{sigs["i"], sigs["j2"], sigs["one"]} {
+		to := &Signal{Name: from.Name + "_new", Type: from.Type.Clone(), Kind: Wire}
+		for _, block := range proc.Blocks {
+			for _, op := range block.Ops {
+				dest := OperationDest(op)
+				want := len(OperationOperands(op))
+				ReplaceOperands(op, from, to)
+				if got := OperationOperands(op); slices.Contains(got, from) || len(got) != want {
+					t.Fatalf("block %s: %T still reads %s after ReplaceOperands", block.Label, op, from.Name)
+				}
+				if OperationDest(op) != dest {
+					t.Fatalf("block %s: ReplaceOperands changed the destination of %T", block.Label, op)
+				}
+			}
+		}
+	}
+}
@@ -5,16 +5,22 @@ import (
 	"go/constant"
 	"go/token"
 	"go/types"
+	"math"
+	"path/filepath"
 	"sort"
 	"strings"
 
+	"golang.org/x/tools/go/packages"
 	"golang.org/x/tools/go/ssa"
 
 	"mygo/internal/diag"
+	"mygo/internal/ssainfo"
 )
 
 // BuildDesign converts the SSA program into the hardware IR described in README.
-func BuildDesign(prog *ssa.Program, reporter *diag.Reporter) (*Design, error) {
+// pkgs are the loaded packages prog was built from; their syntax trees supply
+// the //mygo: directives.
+func BuildDesign(prog *ssa.Program, pkgs []*packages.Package, reporter *diag.Reporter) (*Design, error) {
 	mainPkg := findMainPackage(prog)
 	if mainPkg == nil {
 		return nil, fmt.Errorf("no main package found")
@@ -27,14 +33,35 @@ func BuildDesign(prog *ssa.Program, reporter *diag.Reporter) (*Design, error) {
 
 	builder := &builder{
 		reporter:      reporter,
+		fset:          prog.Fset,
 		signals:       make(map[ssa.Value]*Signal),
 		processes:     make(map[*ssa.Function]*Process),
 		channels:      make(map[ssa.Value]*Channel),
 		paramSignals:  make(map[*ssa.Parameter]*Signal),
 		paramChannels: make(map[*ssa.Parameter]*Channel),
+		formals:       make(map[*Channel]*Channel),
+		waitGroups:    make(map[ssa.Value]*WaitGroup),
+		chanArrays:    make(map[ssa.Value][]*Channel),
+		components:    make(map[ssa.Value]*Component),
+		paramComps:    make(map[*ssa.Parameter]*Component),
+		fieldComps:    make(map[*Signal]*Component),
+		mutexes:       make(map[ssa.Value]*Mutex),
+		paramMutexes:  make(map[*ssa.Parameter]*Mutex),
+		deferred:      make(map[*ssa.Function][]*Mutex),
+		splits:        make(map[*BasicBlock]*BasicBlock),
+		spawns:        make(map[*ssa.Function][]*Process),
+		directives:    indexDirectives(prog.Fset, pkgs),
 		channelUsage:  make(map[*Channel]int),
+		enums:         make(map[*types.Named]*EnumType),
+		procNames:     make(map[string]bool),
+		funcNames:     make(map[string]bool),
 		nextStage:     1,
 	}
+	for _, member := range mainPkg.Members {
+		if fn, ok := member.(*ssa.Function); ok {
+			builder.funcNames[fn.Name()] = true
+		}
+	}
 
 	module := builder.buildModule(mainFn)
 	if reporter.HasErrors() {
@@ -44,20 +71,43 @@ func BuildDesign(prog *ssa.Program, reporter *diag.Reporter) (*Design, error) {
 	design := &Design{
 		Modules:  []*Module{module},
 		TopLevel: module,
+		Fset:     prog.Fset,
+		Root:     filepath.Dir(prog.Fset.Position(mainFn.Pos()).Filename),
 	}
+	BuildHierarchy(design)
+	ClassifySensitivity(design)
 
 	return design, nil
 }
 
 type builder struct {
 	reporter      *diag.Reporter
+	fset          *token.FileSet
 	module        *Module
 	signals       map[ssa.Value]*Signal
 	processes     map[*ssa.Function]*Process
 	channels      map[ssa.Value]*Channel
 	paramSignals  map[*ssa.Parameter]*Signal
 	paramChannels map[*ssa.Parameter]*Channel
+	formals       map[*Channel]*Channel
+	waitGroups    map[ssa.Value]*WaitGroup
+	chanArrays    map[ssa.Value][]*Channel
+	components    map[ssa.Value]*Component
+	paramComps    map[*ssa.Parameter]*Component
+	fieldComps    map[*Signal]*Component
+	fieldValues   map[*Signal]*Signal
+	mutexes       map[ssa.Value]*Mutex
+	paramMutexes  map[*ssa.Parameter]*Mutex
+	deferred      map[*ssa.Function][]*Mutex
+	splits        map[*BasicBlock]*BasicBlock
+	inlining      []*inlineFrame
+	exit          *processExit
+	spawns        map[*ssa.Function][]*Process
+	directives    map[string]map[int][]string
 	channelUsage  map[*Channel]int
+	enums         map[*types.Named]*EnumType
+	procNames     map[string]bool
+	funcNames     map[string]bool
 	nextStage     int
 	blocks        map[*ssa.BasicBlock]*BasicBlock
 	tempID        int
@@ -65,11 +115,14 @@ type builder struct {
 
 func (b *builder) buildModule(fn *ssa.Function) *Module {
 	mod := &Module{
-		Name:     fn.Name(),
-		Ports:    defaultPorts(),
-		Signals:  make(map[string]*Signal),
-		Channels: make(map[string]*Channel),
-		Source:   fn.Pos(),
+		Name:       fn.Name(),
+		Ports:      defaultPorts(),
+		Signals:    make(map[string]*Signal),
+		Channels:   make(map[string]*Channel),
+		WaitGroups: make(map[string]*WaitGroup),
+		Components: make(map[string]*Component),
+		Mutexes:    make(map[string]*Mutex),
+		Source:     fn.Pos(),
 	}
 	b.module = mod
 	entry := b.buildProcess(fn)
@@ -78,6 +131,7 @@ func (b *builder) buildModule(fn *ssa.Function) *Module {
 	}
 	b.finalizeProcessStages()
 	b.finalizeChannelOccupancy()
+	b.collectStreams()
 
 	return mod
 }
@@ -87,45 +141,354 @@ func (b *builder) buildProcess(fn *ssa.Function) *Process {
 		return proc
 	}
 	proc := &Process{
-		Name:        fn.Name(),
+		Name:        b.processName(fn.Name()),
 		Sensitivity: Sequential,
 		Stage:       -1,
+		Source:      fn.Pos(),
 	}
 	b.processes[fn] = proc
+	b.translateProcess(fn, proc)
+	return proc
+}
+
+// processForSpawn returns the process started by a go statement. Every go
+// statement runs its own goroutine, so each one gets its own copy of the
+// function, bound to that statement's receiver. Channel arguments become the
+// process's ChanParams, which the go statement binds, and scalar arguments
+// are read from its Params, so the spawner drives them through ports;
+// BuildHierarchy merges the copies that come out the same. The values it
+// returns land in its Results. A method process is named after the component
+// it runs on. Software goroutines are only recorded, see softwareProcess.
+func (b *builder) processForSpawn(fn *ssa.Function, args []ssa.Value, pos token.Pos) *Process {
+	if ssainfo.IsSoftware(fn) {
+		return b.softwareProcess(fn, args)
+	}
+	comp := b.receiverComponent(fn, args)
+	spawned := b.spawns[fn]
+	name := fn.Name()
+	if comp != nil {
+		name = comp.Name + "_" + fn.Name()
+	}
+	proc := &Process{
+		Name:        b.processName(name),
+		Sensitivity: Sequential,
+		Stage:       -1,
+		Source:      fn.Pos(),
+	}
+	if comp != nil {
+		b.claimComponent(proc, comp, pos)
+	}
+	if len(spawned) == 0 {
+		b.processes[fn] = proc
+	} else {
+		b.forgetFunction(fn)
+	}
+	for idx, param := range fn.Params {
+		if idx >= len(args) || !isChannelType(param.Type()) {
+			continue
+		}
+		if ch := b.channelForValueSilent(args[idx]); ch != nil {
+			formal := &Channel{
+				Name:   b.channelName(param.Name()),
+				Type:   ch.Type,
+				Depth:  ch.Depth,
+				Source: param.Pos(),
+			}
+			b.formals[formal] = b.actual(ch)
+			b.paramChannels[param] = formal
+			proc.ChanParams = append(proc.ChanParams, formal)
+		}
+	}
+	b.bindCallArguments(fn, args)
+	for idx, param := range fn.Params {
+		if idx < len(args) && b.spawnArg(param, args[idx]) != nil {
+			sig := b.newAnonymousSignal(param.Name(), b.signalType(param.Type()), param.Pos())
+			b.paramSignals[param] = sig
+			proc.Params = append(proc.Params, sig)
+			proc.ParamNames = append(proc.ParamNames, param.Name())
+		}
+	}
+	results := fn.Signature.Results()
+	for idx := 0; idx < results.Len(); idx++ {
+		name := results.At(idx).Name()
+		if name == "" {
+			name = "result"
+		}
+		proc.Results = append(proc.Results, b.newAnonymousSignal(name, b.signalType(results.At(idx).Type()), fn.Pos()))
+	}
+	b.translateProcess(fn, proc)
+	b.spawns[fn] = append(spawned, proc)
+	return proc
+}
+
+// spawnArg returns the signal a go statement passes for param, or nil when
+// arg is not a scalar value: channels, wait groups, mutexes and components
+// bind to the callee directly, and a pointer makes its variable shared.
+func (b *builder) spawnArg(param *ssa.Parameter, arg ssa.Value) *Signal {
+	if isChannelType(param.Type()) {
+		return nil
+	}
+	if _, ok := b.components[arg]; ok {
+		return nil
+	}
+	if _, ok := b.waitGroups[arg]; ok {
+		return nil
+	}
+	if _, ok := arg.Type().(*types.Pointer); ok || b.mutexForValue(arg) != nil {
+		return nil
+	}
+	return b.signalForValue(arg)
+}
+
+// processName returns name, or name with the lowest numeric suffix that is
+// neither a process nor a function of the main package yet, so the second
+// go worker(...) does not take the name of a function called worker_1.
+func (b *builder) processName(name string) string {
+	unique := name
+	for n := 1; b.procNames[unique] || unique != name && b.funcNames[unique]; n++ {
+		unique = fmt.Sprintf("%s_%d", name, n)
+	}
+	b.procNames[unique] = true
+	return unique
+}
+
+// channelName returns name, or name with the lowest numeric suffix that no
+// channel of the module has. Each go statement translates its function
+// again, so the channels the copies make would otherwise share a name.
+func (b *builder) channelName(name string) string {
+	unique := name
+	for n := 1; b.module.Channels[unique] != nil; n++ {
+		unique = fmt.Sprintf("%s_%d", name, n)
+	}
+	return unique
+}
+
+// actual returns the channel of the module that ch, a channel param of the
+// process being translated or a channel of its own, stands for.
+func (b *builder) actual(ch *Channel) *Channel {
+	if bound, ok := b.formals[ch]; ok {
+		return bound
+	}
+	return ch
+}
+
+func (b *builder) channelBinding(fn *ssa.Function, args []ssa.Value) []*Channel {
+	var binding []*Channel
+	for i, param := range fn.Params {
+		if i < len(args) && isChannelType(param.Type()) {
+			var ch *Channel
+			if arg := b.channelForValueSilent(args[i]); arg != nil {
+				ch = b.actual(arg)
+			}
+			binding = append(binding, ch)
+		}
+	}
+	return binding
+}
+
+// receiverComponent returns the component a method call runs on, or nil when
+// fn is not a method of a component.
+func (b *builder) receiverComponent(fn *ssa.Function, args []ssa.Value) *Component {
+	if fn.Signature.Recv() == nil || len(args) == 0 {
+		return nil
+	}
+	return b.components[args[0]]
+}
+
+// forgetFunction drops the values bound while translating fn so it can be
+// translated again as a separate process.
+func (b *builder) forgetFunction(fn *ssa.Function) {
+	forget := func(v ssa.Value) {
+		delete(b.signals, v)
+		delete(b.channels, v)
+		delete(b.waitGroups, v)
+		delete(b.chanArrays, v)
+		delete(b.components, v)
+		delete(b.mutexes, v)
+	}
+	for _, param := range fn.Params {
+		forget(param)
+		delete(b.paramSignals, param)
+		delete(b.paramChannels, param)
+		delete(b.paramComps, param)
+		delete(b.paramMutexes, param)
+	}
+	delete(b.deferred, fn)
+	var operands []*ssa.Value
+	for _, block := range fn.Blocks {
+		for _, instr := range block.Instrs {
+			if v, ok := instr.(ssa.Value); ok {
+				forget(v)
+			}
+			for _, op := range instr.Operands(operands[:0]) {
+				if c, ok := (*op).(*ssa.Const); ok {
+					forget(c)
+				}
+			}
+		}
+	}
+}
+
+func (b *builder) translateProcess(fn *ssa.Function, proc *Process) {
 	b.module.Processes = append(b.module.Processes, proc)
+	var exit *processExit
+	if len(proc.Results) > 0 {
+		exit = &processExit{
+			block:   &BasicBlock{Label: "exit"},
+			returns: make([][]PhiIncoming, len(proc.Results)),
+		}
+	}
+	outer := b.exit
+	b.exit = exit
+	b.translateBlocks(proc, fn)
+	b.exit = outer
+	if exit != nil {
+		b.finishExit(proc, exit)
+	}
+	b.retargetPhis(proc)
+	b.orderBlocks(proc)
+	uniqueLabels(proc)
+}
+
+// processExit collects the returns of a spawned function that has results.
+// Every return jumps to block, where one phi per result merges the values
+// the returns carry into the process's Results.
+type processExit struct {
+	block   *BasicBlock
+	preds   []*BasicBlock
+	returns [][]PhiIncoming
+}
+
+// finishExit appends the exit block to proc and drives each result from the
+// returns. A function that never returns has nothing to expose, so its
+// process keeps no results.
+func (b *builder) finishExit(proc *Process, exit *processExit) {
+	if len(exit.preds) == 0 {
+		for _, result := range proc.Results {
+			delete(b.module.Signals, result.Name)
+		}
+		proc.Results = nil
+		return
+	}
+	proc.Blocks = append(proc.Blocks, exit.block)
+	for _, pred := range exit.preds {
+		linkBlocks(pred, exit.block)
+	}
+	for idx, result := range proc.Results {
+		exit.block.Ops = append(exit.block.Ops, &PhiOperation{
+			Dest:      result,
+			Incomings: exit.returns[idx],
+		})
+	}
+	exit.block.Terminator = &ReturnTerminator{}
+}
+
+// uniqueLabels numbers repeated block labels. go/ssa reuses comments such as
+// "if.then" for every if statement, and the textual IR refers to blocks by
+// label.
+func uniqueLabels(proc *Process) {
+	seen := make(map[string]int)
+	for _, block := range proc.Blocks {
+		seen[block.Label]++
+	}
+	used := make(map[string]bool)
+	for _, block := range proc.Blocks {
+		if seen[block.Label] == 1 {
+			used[block.Label] = true
+		}
+	}
+	for _, block := range proc.Blocks {
+		if seen[block.Label] == 1 {
+			continue
+		}
+		base := block.Label
+		for n := 1; ; n++ {
+			label := fmt.Sprintf("%s.%d", base, n)
+			if !used[label] {
+				block.Label = label
+				used[label] = true
+				break
+			}
+		}
+	}
+}
+
+// translateBlocks appends the blocks of fn to proc and returns the block that
+// control enters first.
+func (b *builder) translateBlocks(proc *Process, fn *ssa.Function) *BasicBlock {
 	b.bindFunctionParams(fn)
 
 	prevBlocks := b.blocks
 	b.blocks = make(map[*ssa.BasicBlock]*BasicBlock)
 	defer func() { b.blocks = prevBlocks }()
 
+	prefix := ""
+	if len(b.inlining) > 0 {
+		prefix = fn.Name() + "."
+	}
 	ordered := make([]*ssa.BasicBlock, 0, len(fn.Blocks))
 	for _, block := range fn.Blocks {
-		if block == nil {
+		if block == nil || block == fn.Recover {
 			continue
 		}
-		bb := &BasicBlock{Label: blockComment(block)}
+		bb := &BasicBlock{Label: prefix + blockComment(block)}
 		b.blocks[block] = bb
 		proc.Blocks = append(proc.Blocks, bb)
 		ordered = append(ordered, block)
 	}
 
+	for _, loop := range ssainfo.FindLoops(fn) {
+		if bb := b.blocks[loop.Header]; bb != nil {
+			bb.LoopHeader = true
+			bb.TripCount = loop.TripCount
+		}
+	}
+
 	for _, block := range ordered {
 		b.translateBlock(proc, block)
 	}
 	b.connectBlocks(ordered)
-	b.orderBlocks(proc)
-	return proc
+	if len(ordered) == 0 {
+		return nil
+	}
+	return b.blocks[ordered[0]]
+}
+
+// retargetPhis points phi incomings at the block that actually ends each
+// predecessor. A block containing an inlined method call is split, so control
+// reaches its successors from the continuation block rather than its entry.
+func (b *builder) retargetPhis(proc *Process) {
+	for _, block := range proc.Blocks {
+		for _, op := range block.Ops {
+			phi, ok := op.(*PhiOperation)
+			if !ok {
+				continue
+			}
+			for i, in := range phi.Incomings {
+				phi.Incomings[i].Block = b.blockExit(in.Block)
+			}
+		}
+	}
+}
+
+// blockExit returns the block that ends the straight-line code starting at bb.
+func (b *builder) blockExit(bb *BasicBlock) *BasicBlock {
+	if exit, ok := b.splits[bb]; ok {
+		return exit
+	}
+	return bb
 }
 
 func (b *builder) translateBlock(proc *Process, block *ssa.BasicBlock) {
 	if block == nil {
 		return
 	}
-	bb := b.blocks[block]
-	if bb == nil {
+	entry := b.blocks[block]
+	if entry == nil {
 		return
 	}
+	bb := entry
+	b.fieldValues = make(map[*Signal]*Signal)
 	for _, instr := range block.Instrs {
 		switch v := instr.(type) {
 		case *ssa.Phi:
@@ -135,11 +498,22 @@ func (b *builder) translateBlock(proc *Process, block *ssa.BasicBlock) {
 		case *ssa.Jump:
 			b.handleJump(block, bb)
 		case *ssa.Return:
-			b.handleReturn(bb)
+			b.handleReturn(bb, v)
+		case *ssa.Panic:
+			b.handlePanic(block, bb, v)
+		case *ssa.Call:
+			if cont := b.inlineComponentCall(proc, bb, v); cont != nil {
+				bb = cont
+				continue
+			}
+			b.translateInstr(proc, bb, instr)
 		default:
 			b.translateInstr(proc, bb, instr)
 		}
 	}
+	if bb != entry {
+		b.splits[entry] = bb
+	}
 }
 
 func (b *builder) connectBlocks(blocks []*ssa.BasicBlock) {
@@ -151,6 +525,7 @@ func (b *builder) connectBlocks(blocks []*ssa.BasicBlock) {
 		if src == nil {
 			continue
 		}
+		src = b.blockExit(src)
 		for _, succ := range block.Succs {
 			if succ == nil {
 				continue
@@ -194,7 +569,7 @@ func (b *builder) finalizeChannelOccupancy() {
 		if occ < 0 {
 			occ = 0
 		}
-		if ch.Depth > 0 && occ > ch.Depth {
+		if occ > ch.Depth {
 			occ = ch.Depth
 		}
 		ch.Occupancy = occ
@@ -302,19 +677,180 @@ func (b *builder) handleJump(block *ssa.BasicBlock, bb *BasicBlock) {
 	bb.Terminator = &JumpTerminator{Target: target}
 }
 
-func (b *builder) handleReturn(bb *BasicBlock) {
+func (b *builder) handleReturn(bb *BasicBlock, ret *ssa.Return) {
 	if bb == nil {
 		return
 	}
+	if n := len(b.inlining); n > 0 {
+		frame := b.inlining[n-1]
+		var value *Signal
+		if len(ret.Results) == 1 {
+			value = b.signalForValue(ret.Results[0])
+		}
+		frame.returns = append(frame.returns, PhiIncoming{Block: bb, Value: value})
+		bb.Terminator = &JumpTerminator{Target: frame.cont}
+		return
+	}
+	if exit := b.exit; exit != nil {
+		for idx, result := range ret.Results {
+			if idx < len(exit.returns) {
+				exit.returns[idx] = append(exit.returns[idx], PhiIncoming{Block: bb, Value: b.signalForValue(result)})
+			}
+		}
+		exit.preds = append(exit.preds, bb)
+		bb.Terminator = &JumpTerminator{Target: exit.block}
+		return
+	}
 	bb.Terminator = &ReturnTerminator{}
 }
 
+func (b *builder) handlePanic(block *ssa.BasicBlock, bb *BasicBlock, stmt *ssa.Panic) {
+	if bb == nil || stmt == nil {
+		return
+	}
+	bb.Ops = append(bb.Ops, &AssertOperation{
+		Cond:     b.panicGuard(block, bb, stmt.Pos()),
+		Message:  panicMessage(stmt.X),
+		Location: b.positionString(stmt.Pos()),
+		Source:   stmt.Pos(),
+	})
+	bb.Terminator = &ReturnTerminator{}
+}
+
+// panicGuard returns the predicate under which control reaches block: the OR,
+// over every incoming edge, of the predecessor's own predicate ANDed with the
+// branch condition that selects the edge. Back edges are skipped, so a block
+// inside a loop is guarded by how the loop is entered and the branches taken
+// within one iteration. A nil result means the panic is reached
+// unconditionally.
+func (b *builder) panicGuard(block *ssa.BasicBlock, bb *BasicBlock, pos token.Pos) *Signal {
+	guards := make(map[*ssa.BasicBlock]*Signal)
+	done := make(map[*ssa.BasicBlock]bool)
+	var reach func(cur *ssa.BasicBlock) *Signal
+	reach = func(cur *ssa.BasicBlock) *Signal {
+		if done[cur] {
+			return guards[cur]
+		}
+		done[cur] = true
+		var guard *Signal
+		always := false
+		for _, pred := range cur.Preds {
+			if pred == nil || cur.Dominates(pred) {
+				continue
+			}
+			edge := b.andPredicates(bb, reach(pred), b.edgeCondition(pred, cur, bb, pos), pos)
+			if edge == nil {
+				always = true
+				break
+			}
+			guard = b.orPredicates(bb, guard, edge, pos)
+		}
+		if always {
+			guard = nil
+		}
+		guards[cur] = guard
+		return guard
+	}
+	return reach(block)
+}
+
+// edgeCondition returns the branch condition that sends control from pred to
+// succ, or nil when pred always continues to succ.
+func (b *builder) edgeCondition(pred, succ *ssa.BasicBlock, bb *BasicBlock, pos token.Pos) *Signal {
+	if len(pred.Instrs) == 0 || len(pred.Succs) != 2 || pred.Succs[0] == pred.Succs[1] {
+		return nil
+	}
+	ifInstr, ok := pred.Instrs[len(pred.Instrs)-1].(*ssa.If)
+	if !ok {
+		return nil
+	}
+	cond := b.signalForValue(ifInstr.Cond)
+	if cond == nil {
+		return nil
+	}
+	if pred.Succs[1] == succ {
+		cond = b.invertPredicate(bb, cond, pos)
+	}
+	return cond
+}
+
+func (b *builder) invertPredicate(bb *BasicBlock, cond *Signal, pos token.Pos) *Signal {
+	falseSig := &Signal{
+		Name:   b.newConstName(),
+		Type:   &SignalType{Width: 1},
+		Kind:   Const,
+		Value:  false,
+		Source: pos,
+	}
+	b.module.Signals[falseSig.Name] = falseSig
+	dest := b.newAnonymousSignal("not", &SignalType{Width: 1}, pos)
+	bb.Ops = append(bb.Ops, &CompareOperation{
+		Predicate: CompareEQ,
+		Dest:      dest,
+		Left:      cond,
+		Right:     falseSig,
+	})
+	return dest
+}
+
+func (b *builder) andPredicates(bb *BasicBlock, acc, cond *Signal, pos token.Pos) *Signal {
+	if acc == nil {
+		return cond
+	}
+	if cond == nil {
+		return acc
+	}
+	dest := b.newAnonymousSignal("guard", &SignalType{Width: 1}, pos)
+	bb.Ops = append(bb.Ops, &BinOperation{
+		Op:    And,
+		Dest:  dest,
+		Left:  acc,
+		Right: cond,
+	})
+	return dest
+}
+
+func (b *builder) orPredicates(bb *BasicBlock, acc, cond *Signal, pos token.Pos) *Signal {
+	if acc == nil {
+		return cond
+	}
+	dest := b.newAnonymousSignal("guard", &SignalType{Width: 1}, pos)
+	bb.Ops = append(bb.Ops, &BinOperation{
+		Op:    Or,
+		Dest:  dest,
+		Left:  acc,
+		Right: cond,
+	})
+	return dest
+}
+
+func (b *builder) positionString(pos token.Pos) string {
+	if b.fset == nil || pos == token.NoPos {
+		return ""
+	}
+	p := b.fset.Position(pos)
+	if !p.IsValid() {
+		return ""
+	}
+	return fmt.Sprintf("%s:%d:%d", filepath.Base(p.Filename), p.Line, p.Column)
+}
+
+func panicMessage(v ssa.Value) string {
+	if mi, ok := v.(*ssa.MakeInterface); ok {
+		v = mi.X
+	}
+	if c, ok := v.(*ssa.Const); ok && c.Value != nil && c.Value.Kind() == constant.String {
+		return constant.StringVal(c.Value)
+	}
+	return "panic"
+}
+
 func (b *builder) handlePhi(block *ssa.BasicBlock, bb *BasicBlock, phi *ssa.Phi) {
 	if bb == nil || phi == nil {
 		return
 	}
 	dest := b.ensureValueSignal(phi)
-	dest.Type = signalType(phi.Type())
+	dest.Type = b.signalType(phi.Type())
 	incomings := make([]PhiIncoming, 0, len(phi.Edges))
 	for idx, edge := range phi.Edges {
 		var pred *BasicBlock
@@ -347,9 +883,13 @@ func (b *builder) handleBinOp(bb *BasicBlock, op *ssa.BinOp) {
 	if left == nil || right == nil {
 		return
 	}
+	if isFloatType(op.X.Type()) {
+		b.handleFloatBinOp(bb, op, left, right)
+		return
+	}
 	if pred, ok := translateCompareOp(op.Op, isSignedType(op.X.Type())); ok {
 		dest := b.ensureValueSignal(op)
-		dest.Type = signalType(op.Type())
+		dest.Type = b.signalType(op.Type())
 		bb.Ops = append(bb.Ops, &CompareOperation{
 			Predicate: pred,
 			Dest:      dest,
@@ -367,9 +907,9 @@ func (b *builder) handleBinOp(bb *BasicBlock, op *ssa.BinOp) {
 		return
 	}
 	dest := b.ensureValueSignal(op)
-	dest.Type = signalType(op.Type())
+	dest.Type = b.signalType(op.Type())
 	if isShiftBinOp(bin) {
-		leftType := signalType(op.X.Type())
+		leftType := b.signalType(op.X.Type())
 		if leftType != nil && (left.Type == nil || !left.Type.Equal(leftType)) {
 			left.Type = leftType
 		}
@@ -396,7 +936,17 @@ func (b *builder) handleUnOp(proc *Process, bb *BasicBlock, op *ssa.UnOp) {
 	}
 	switch op.Op {
 	case token.MUL:
+		if isChannelType(op.Type()) {
+			// Channel loads resolve through lookupChannel.
+			return
+		}
 		ptr := b.signalForValue(op.X)
+		if _, ok := b.fieldComps[ptr]; ok {
+			ptr = b.readField(proc, ptr, op.Pos())
+		}
+		if ptr != nil && ptr.Kind == Shared {
+			ptr = b.readShared(ptr)
+		}
 		if ptr != nil {
 			b.signals[op] = ptr
 		}
@@ -408,11 +958,15 @@ func (b *builder) handleUnOp(proc *Process, bb *BasicBlock, op *ssa.UnOp) {
 			return
 		}
 		dest := b.ensureValueSignal(op)
-		dest.Type = signalType(op.Type())
+		dest.Type = b.signalType(op.Type())
 		bb.Ops = append(bb.Ops, &NotOperation{
 			Dest:  dest,
 			Value: value,
 		})
+	case token.SUB:
+		if isFloatType(op.Type()) {
+			b.handleFloatNeg(bb, op)
+		}
 	default:
 		// TODO: support unary negation and bitwise complement as needed.
 	}
@@ -474,12 +1028,23 @@ func (b *builder) translateInstr(proc *Process, bb *BasicBlock, instr ssa.Instru
 	case *ssa.Alloc:
 		b.handleAlloc(v)
 	case *ssa.Store:
+		if slots, idx, ok := b.channelSlot(v.Addr); ok {
+			slots[idx] = b.channelForValue(v.Val)
+			return
+		}
 		dest := b.signalForValue(v.Addr)
 		val := b.signalForValue(v.Val)
 		if dest == nil || val == nil {
 			return
 		}
+		if _, ok := b.fieldComps[dest]; ok {
+			b.writeField(proc, bb, dest, val, v.Pos())
+			return
+		}
 		bb.Ops = append(bb.Ops, &AssignOperation{Dest: dest, Value: val})
+		if dest.Kind == Shared {
+			b.fieldValues[dest] = val
+		}
 	case *ssa.BinOp:
 		b.handleBinOp(bb, v)
 	case *ssa.UnOp:
@@ -489,19 +1054,26 @@ func (b *builder) translateInstr(proc *Process, bb *BasicBlock, instr ssa.Instru
 		if source == nil {
 			return
 		}
+		if b.handleFloatConvert(bb, v, source) {
+			return
+		}
 		dest := b.ensureValueSignal(v)
-		dest.Type = signalType(v.Type())
+		dest.Type = b.signalType(v.Type())
 		bb.Ops = append(bb.Ops, &ConvertOperation{
 			Dest:  dest,
 			Value: source,
 		})
 	case *ssa.ChangeType:
+		if isChannelType(v.Type()) {
+			// Channel conversions resolve through lookupChannel.
+			return
+		}
 		source := b.signalForValue(v.X)
 		if source != nil {
 			b.signals[v] = source
 		}
 	case *ssa.MakeChan:
-		b.handleMakeChan(v)
+		b.handleMakeChan(proc, v)
 	case *ssa.Send:
 		b.handleSend(proc, bb, v)
 	case *ssa.DebugRef:
@@ -510,8 +1082,25 @@ func (b *builder) translateInstr(proc *Process, bb *BasicBlock, instr ssa.Instru
 		if b.handleFmtPrint(proc, bb, v) {
 			return
 		}
+		if b.handleChannelBuiltin(bb, v) {
+			return
+		}
+		b.handleWaitGroupCall(bb, &v.Call)
+		b.handleMutexCall(proc, bb, &v.Call)
+	case *ssa.Defer:
+		switch {
+		case ssainfo.MutexMethod(&v.Call) == "Unlock":
+			b.deferUnlock(v.Parent(), &v.Call)
+		case ssainfo.WaitGroupMethod(&v.Call) != "Done":
+			b.reporter.Warning(v.Pos(), "defer is only supported for WaitGroup.Done and Mutex.Unlock")
+		}
+	case *ssa.RunDefers:
+		// Deferred WaitGroup.Done is implied by process completion.
+		b.runDefers(bb, v.Parent())
 	case *ssa.Go:
 		b.handleGo(proc, bb, v)
+	case *ssa.FieldAddr:
+		b.handleFieldAddr(v)
 	case *ssa.IndexAddr:
 		// Used for fmt.Printf variadic handling – ignore for now.
 	case *ssa.MakeInterface:
@@ -532,11 +1121,33 @@ func (b *builder) handleAlloc(a *ssa.Alloc) {
 		b.reporter.Warning(a.Pos(), "allocation without pointer type encountered")
 		return
 	}
+	if ssainfo.IsWaitGroupPointer(ptrType) {
+		wg := &WaitGroup{
+			Name:   b.allocName(a),
+			Source: a.Pos(),
+		}
+		b.module.WaitGroups[wg.Name] = wg
+		b.waitGroups[a] = wg
+		return
+	}
 	elem := ptrType.Elem()
+	if arr, ok := elem.Underlying().(*types.Array); ok && isChannelType(arr.Elem()) {
+		b.chanArrays[a] = make([]*Channel, arr.Len())
+		return
+	}
+	if ssainfo.IsMutexPointer(ptrType) {
+		b.newMutex(a, b.allocName(a), a.Pos())
+		return
+	}
+	if ssainfo.IsComponentPointer(ptrType) {
+		named := types.Unalias(elem).(*types.Named)
+		b.newComponent(a, named, named.Underlying().(*types.Struct))
+		return
+	}
 	name := b.allocName(a)
 	sig := &Signal{
 		Name:   name,
-		Type:   signalType(elem),
+		Type:   b.signalType(elem),
 		Kind:   Reg,
 		Source: a.Pos(),
 	}
@@ -560,10 +1171,21 @@ func (b *builder) bindFunctionParams(fn *ssa.Function) {
 			b.signals[param] = sig
 			continue
 		}
+		if comp, ok := b.paramComps[param]; ok {
+			b.components[param] = comp
+			continue
+		}
+		if mu, ok := b.paramMutexes[param]; ok {
+			b.mutexes[param] = mu
+			continue
+		}
+		if ssainfo.IsWaitGroupPointer(param.Type()) || ssainfo.IsComponentPointer(param.Type()) || ssainfo.IsMutexPointer(param.Type()) {
+			continue
+		}
 		if isChannelType(param.Type()) {
 			ch := &Channel{
 				Name:   b.uniqueName(param.Name()),
-				Type:   channelElemType(param.Type()),
+				Type:   b.channelElemType(param.Type()),
 				Depth:  1,
 				Source: param.Pos(),
 			}
@@ -574,7 +1196,7 @@ func (b *builder) bindFunctionParams(fn *ssa.Function) {
 		}
 		sig := &Signal{
 			Name:   defaultName(param.Name(), b.uniqueName("param")),
-			Type:   signalType(param.Type()),
+			Type:   b.signalType(param.Type()),
 			Kind:   Wire,
 			Source: param.Pos(),
 		}
@@ -583,7 +1205,7 @@ func (b *builder) bindFunctionParams(fn *ssa.Function) {
 	}
 }
 
-func (b *builder) handleMakeChan(mc *ssa.MakeChan) {
+func (b *builder) handleMakeChan(proc *Process, mc *ssa.MakeChan) {
 	chType, ok := mc.Type().Underlying().(*types.Chan)
 	if !ok {
 		b.reporter.Warning(mc.Pos(), "makechan without channel type encountered")
@@ -593,23 +1215,31 @@ func (b *builder) handleMakeChan(mc *ssa.MakeChan) {
 	if name == "" {
 		name = b.uniqueName("chan")
 	}
-	depth := 1
+	depth := 0
 	if c, ok := mc.Size.(*ssa.Const); ok && c.Value != nil {
 		if v, ok := constant.Int64Val(c.Value); ok && v > 0 {
 			depth = int(v)
 		}
 	}
 	channel := &Channel{
-		Name:   name,
-		Type:   signalType(chType.Elem()),
+		Name:   b.channelName(name),
+		Type:   b.signalType(chType.Elem()),
 		Depth:  depth,
+		Owner:  proc,
 		Source: mc.Pos(),
 	}
+	b.applyChannelDirectives(channel)
 	b.module.Channels[channel.Name] = channel
 	b.channels[mc] = channel
 	b.channelUsage[channel] = 0
 }
 
+// applyChannelDirectives reads the //mygo:arbiter directive attached to the
+// make statement that created ch.
+func (b *builder) applyChannelDirectives(ch *Channel) {
+	ch.Arbitration = b.arbiterDirective(ch.Source, ch.Arbitration)
+}
+
 func (b *builder) handleSend(proc *Process, bb *BasicBlock, send *ssa.Send) {
 	channel := b.channelForValue(send.Chan)
 	value := b.signalForValue(send.X)
@@ -619,15 +1249,16 @@ func (b *builder) handleSend(proc *Process, bb *BasicBlock, send *ssa.Send) {
 	bb.Ops = append(bb.Ops, &SendOperation{
 		Channel: channel,
 		Value:   value,
+		Source:  send.Pos(),
 	})
-	channel.AddEndpoint(proc, ChannelSend)
-	b.recordChannelDelta(channel, 1)
+	b.actual(channel).AddEndpoint(Site{Process: proc}, channel, ChannelSend)
+	b.recordChannelDelta(b.actual(channel), 1)
 }
 
 func (b *builder) handleRecv(proc *Process, bb *BasicBlock, recv *ssa.UnOp) {
 	channel := b.channelForValue(recv.X)
 	dest := b.ensureValueSignal(recv)
-	dest.Type = signalType(recv.Type())
+	dest.Type = b.signalType(recv.Type())
 	if channel == nil {
 		return
 	}
@@ -635,8 +1266,8 @@ func (b *builder) handleRecv(proc *Process, bb *BasicBlock, recv *ssa.UnOp) {
 		Channel: channel,
 		Dest:    dest,
 	})
-	channel.AddEndpoint(proc, ChannelReceive)
-	b.recordChannelDelta(channel, -1)
+	b.actual(channel).AddEndpoint(Site{Process: proc}, channel, ChannelReceive)
+	b.recordChannelDelta(b.actual(channel), -1)
 }
 
 func (b *builder) handleGo(proc *Process, bb *BasicBlock, stmt *ssa.Go) {
@@ -649,37 +1280,118 @@ func (b *builder) handleGo(proc *Process, bb *BasicBlock, stmt *ssa.Go) {
 		b.reporter.Warning(stmt.Pos(), "goroutine target has no static callee")
 		return
 	}
-	b.bindCallArguments(callee, stmt.Call.Args)
-	target := b.buildProcess(callee)
+	target := b.processForSpawn(callee, stmt.Call.Args, stmt.Pos())
 	b.assignChildStage(proc, target)
 	var args []*Signal
 	var chanArgs []*Channel
-	var params *types.Tuple
-	if sig := stmt.Call.Signature(); sig != nil {
-		params = sig.Params()
-	}
+	var groups []*WaitGroup
 	for idx, arg := range stmt.Call.Args {
-		var paramType types.Type
-		if params != nil && idx < params.Len() {
-			paramType = params.At(idx).Type()
+		if idx >= len(callee.Params) {
+			break
 		}
-		if paramType != nil && isChannelType(paramType) {
+		param := callee.Params[idx]
+		if isChannelType(param.Type()) {
 			if ch := b.channelForValueSilent(arg); ch != nil {
 				chanArgs = append(chanArgs, ch)
 			}
 			continue
 		}
-		if sig := b.signalForValue(arg); sig != nil {
+		if wg, ok := b.waitGroups[arg]; ok {
+			groups = append(groups, wg)
+			continue
+		}
+		if _, ok := b.components[arg]; ok || b.mutexForValue(arg) != nil {
+			continue
+		}
+		if _, ok := arg.Type().(*types.Pointer); ok {
+			// A variable whose address reaches a goroutine is shared.
+			if sig := b.signalForValue(arg); sig != nil {
+				sig.Kind = Shared
+			}
+			continue
+		}
+		// Software goroutines take only channels.
+		if sig := b.spawnArg(param, arg); sig != nil && target.Software == nil {
 			args = append(args, sig)
 		}
 	}
 	bb.Ops = append(bb.Ops, &SpawnOperation{
-		Callee:   target,
-		Args:     args,
-		ChanArgs: chanArgs,
+		Callee:     target,
+		Args:       args,
+		ChanArgs:   chanArgs,
+		WaitGroups: groups,
+		Source:     stmt.Pos(),
 	})
 }
 
+// handleWaitGroupCall folds Add into the group's constant count and lowers
+// Wait to a barrier. Done needs no operation: a member's completion is its
+// done handshake.
+func (b *builder) handleWaitGroupCall(bb *BasicBlock, call *ssa.CallCommon) {
+	method := ssainfo.WaitGroupMethod(call)
+	if method == "" || len(call.Args) == 0 {
+		return
+	}
+	wg, ok := b.waitGroups[call.Args[0]]
+	if !ok {
+		return
+	}
+	switch method {
+	case "Add":
+		if c, ok := call.Args[1].(*ssa.Const); ok && c.Value != nil {
+			if delta, ok := constant.Int64Val(c.Value); ok {
+				wg.Count += int(delta)
+			}
+		}
+	case "Wait":
+		bb.Ops = append(bb.Ops, &WaitOperation{Group: wg, Source: call.Pos()})
+	}
+}
+
+// handleChannelBuiltin lowers len and cap on a channel. cap folds to the
+// channel depth, and len reads the FIFO count. An unbuffered channel never
+// holds a value, so its len is the constant 0.
+func (b *builder) handleChannelBuiltin(bb *BasicBlock, call *ssa.Call) bool {
+	builtin, ok := call.Call.Value.(*ssa.Builtin)
+	if !ok || len(call.Call.Args) != 1 || !isChannelType(call.Call.Args[0].Type()) {
+		return false
+	}
+	switch builtin.Name() {
+	case "len", "cap":
+	default:
+		return false
+	}
+	ch := b.channelForValue(call.Call.Args[0])
+	if ch == nil {
+		return true
+	}
+	switch {
+	case builtin.Name() == "cap":
+		b.signals[call] = b.intConstSignal(call, int64(ch.Depth))
+	case ch.Unbuffered():
+		b.signals[call] = b.intConstSignal(call, 0)
+	default:
+		bb.Ops = append(bb.Ops, &LenOperation{
+			Channel: ch,
+			Dest:    b.ensureValueSignal(call),
+		})
+	}
+	return true
+}
+
+// intConstSignal builds a constant of v's type holding value.
+func (b *builder) intConstSignal(v ssa.Value, value int64) *Signal {
+	sig := &Signal{
+		Name:   b.newConstName(),
+		Type:   b.signalType(v.Type()),
+		Kind:   Const,
+		Source: v.Pos(),
+		Value:  value,
+	}
+	b.module.Signals[sig.Name] = sig
+	return sig
+}
+
 func (b *builder) bindCallArguments(fn *ssa.Function, args []ssa.Value) {
 	if fn == nil {
 		return
@@ -697,6 +1409,23 @@ func (b *builder) bindCallArguments(fn *ssa.Function, args []ssa.Value) {
 			}
 			continue
 		}
+		if ssainfo.IsWaitGroupPointer(paramType) {
+			continue
+		}
+		if ssainfo.IsMutexPointer(paramType) {
+			if mu := b.mutexForValue(arg); mu != nil {
+				if _, exists := b.paramMutexes[param]; !exists {
+					b.paramMutexes[param] = mu
+				}
+			}
+			continue
+		}
+		if comp, ok := b.components[arg]; ok {
+			if _, exists := b.paramComps[param]; !exists {
+				b.paramComps[param] = comp
+			}
+			continue
+		}
 		if sig := b.signalForValue(arg); sig != nil {
 			if _, exists := b.paramSignals[param]; !exists {
 				b.paramSignals[param] = sig
@@ -707,7 +1436,7 @@ func (b *builder) bindCallArguments(fn *ssa.Function, args []ssa.Value) {
 func (b *builder) buildConstSignal(c *ssa.Const) *Signal {
 	sig := &Signal{
 		Name:   b.newConstName(),
-		Type:   signalType(c.Type()),
+		Type:   b.signalType(c.Type()),
 		Kind:   Const,
 		Source: c.Pos(),
 		Value:  extractConstValue(c),
@@ -734,6 +1463,8 @@ func (b *builder) signalForValue(v ssa.Value) *Signal {
 		}
 	case *ssa.Phi:
 		return b.ensureValueSignal(val)
+	case *ssa.Global:
+		return b.globalSignal(val)
 	case *ssa.IndexAddr, *ssa.MakeInterface, *ssa.Slice, *ssa.MakeChan:
 		return nil
 	case *ssa.Call:
@@ -758,6 +1489,13 @@ func (b *builder) lookupChannel(v ssa.Value, warn bool) *Channel {
 	switch val := v.(type) {
 	case *ssa.ChangeType:
 		return b.lookupChannel(val.X, warn)
+	case *ssa.UnOp:
+		if slots, idx, ok := b.channelSlot(val.X); ok && val.Op == token.MUL {
+			if slots[idx] == nil && warn {
+				b.reporter.Warning(v.Pos(), fmt.Sprintf("channel array element %d is read before it is assigned", idx))
+			}
+			return slots[idx]
+		}
 	}
 	if warn && v != nil {
 		b.reporter.Warning(v.Pos(), fmt.Sprintf("no channel mapping for value %T", v))
@@ -765,6 +1503,28 @@ func (b *builder) lookupChannel(v ssa.Value, warn bool) *Channel {
 	return nil
 }
 
+// channelSlot resolves addr to an element of a local channel array indexed by
+// a constant.
+func (b *builder) channelSlot(addr ssa.Value) ([]*Channel, int, bool) {
+	ia, ok := addr.(*ssa.IndexAddr)
+	if !ok {
+		return nil, 0, false
+	}
+	slots, ok := b.chanArrays[ia.X]
+	if !ok {
+		return nil, 0, false
+	}
+	idx, ok := ia.Index.(*ssa.Const)
+	if !ok || idx.Value == nil {
+		return nil, 0, false
+	}
+	i, ok := constant.Int64Val(idx.Value)
+	if !ok || i < 0 || i >= int64(len(slots)) {
+		return nil, 0, false
+	}
+	return slots, int(i), true
+}
+
 func (b *builder) newConstName() string {
 	name := fmt.Sprintf("const_%d", b.tempID)
 	b.tempID++
@@ -816,7 +1576,7 @@ func (b *builder) handleFmtPrint(proc *Process, bb *BasicBlock, call *ssa.Call)
 	if len(segments) == 0 {
 		segments = appendLiteralSegment(nil, "")
 	}
-	bb.Ops = append(bb.Ops, &PrintOperation{Segments: segments})
+	bb.Ops = append(bb.Ops, &PrintOperation{Segments: segments, Source: call.Pos()})
 	return true
 }
 
@@ -1018,6 +1778,14 @@ func defaultPorts() []Port {
 				Signed: false,
 			},
 		},
+		{
+			Name:      "done",
+			Direction: Output,
+			Type: &SignalType{
+				Width:  1,
+				Signed: false,
+			},
+		},
 	}
 }
 
@@ -1103,16 +1871,42 @@ func isSignedType(t types.Type) bool {
 	return true
 }
 
-func signalType(t types.Type) *SignalType {
+func (b *builder) signalType(t types.Type) *SignalType {
 	switch bt := t.Underlying().(type) {
 	case *types.Basic:
 		width, signed := widthForBasic(bt)
-		return &SignalType{Width: width, Signed: signed}
+		return &SignalType{Width: width, Signed: signed, Enum: b.enumType(t), Float: bt.Info()&types.IsFloat != 0}
 	default:
 		return &SignalType{Width: 32, Signed: true}
 	}
 }
 
+// enumType returns the enum metadata for a named integer type with declared
+// constants, or nil for any other type. Finding the constants scans the
+// type's package scope, so the result is cached per named type.
+func (b *builder) enumType(t types.Type) *EnumType {
+	key, ok := types.Unalias(t).(*types.Named)
+	if !ok {
+		return nil
+	}
+	if enum, ok := b.enums[key]; ok {
+		return enum
+	}
+	var enum *EnumType
+	if named, consts := ssainfo.EnumConstants(key); named != nil {
+		enum = &EnumType{Name: named.Obj().Name()}
+		for _, c := range consts {
+			value, ok := constant.Int64Val(constant.ToInt(c.Val()))
+			if !ok {
+				continue
+			}
+			enum.Members = append(enum.Members, EnumMember{Name: c.Name(), Value: value})
+		}
+	}
+	b.enums[key] = enum
+	return enum
+}
+
 func widthForBasic(b *types.Basic) (int, bool) {
 	switch b.Kind() {
 	case types.Int8:
@@ -1133,6 +1927,8 @@ func widthForBasic(b *types.Basic) (int, bool) {
 		return 64, false
 	case types.Bool:
 		return 1, false
+	case types.Float32:
+		return 32, false
 	default:
 		return 32, true
 	}
@@ -1143,9 +1939,9 @@ func isChannelType(t types.Type) bool {
 	return ok
 }
 
-func channelElemType(t types.Type) *SignalType {
+func (b *builder) channelElemType(t types.Type) *SignalType {
 	if ch, ok := t.Underlying().(*types.Chan); ok {
-		return signalType(ch.Elem())
+		return b.signalType(ch.Elem())
 	}
 	return &SignalType{Width: 1, Signed: false}
 }
@@ -1173,6 +1969,9 @@ func extractConstValue(c *ssa.Const) interface{} {
 		}
 	case types.Bool:
 		return constant.BoolVal(c.Value)
+	case types.Float32:
+		f, _ := constant.Float32Val(c.Value)
+		return uint64(math.Float32bits(f))
 	}
 	return c.Value.ExactString()
 }
@@ -1242,7 +2041,7 @@ func (b *builder) ensureValueSignal(v ssa.Value) *Signal {
 	name := b.uniqueName(base)
 	sig := &Signal{
 		Name:   name,
-		Type:   signalType(v.Type()),
+		Type:   b.signalType(v.Type()),
 		Kind:   Wire,
 		Source: v.Pos(),
 	}
@@ -0,0 +1,174 @@
+package ir
+
+import (
+	"fmt"
+	"go/token"
+	"go/types"
+	"strings"
+
+	"golang.org/x/tools/go/ssa"
+)
+
+// inlineFrame tracks a component method while it is expanded into the
+// process that owns the component. Every return jumps to cont, and returns
+// collects the block and result of each of them.
+type inlineFrame struct {
+	fn      *ssa.Function
+	cont    *BasicBlock
+	returns []PhiIncoming
+}
+
+// newComponent turns a struct allocation into a component with one register
+// per field.
+func (b *builder) newComponent(a *ssa.Alloc, named *types.Named, st *types.Struct) {
+	name := b.componentName(named)
+	comp := &Component{
+		Name:   name,
+		Type:   named.Obj().Name(),
+		Source: a.Pos(),
+	}
+	for i := 0; i < st.NumFields(); i++ {
+		field := st.Field(i)
+		sig := &Signal{
+			Name:   name + "_" + field.Name(),
+			Type:   b.signalType(field.Type()),
+			Kind:   Reg,
+			Source: field.Pos(),
+		}
+		b.module.Signals[sig.Name] = sig
+		b.fieldComps[sig] = comp
+		comp.Fields = append(comp.Fields, sig)
+	}
+	b.module.Components[name] = comp
+	b.components[a] = comp
+}
+
+// componentName derives an instance name from the struct type, numbering
+// further instances of the same type.
+func (b *builder) componentName(named *types.Named) string {
+	base := strings.ToLower(named.Obj().Name())
+	name := base
+	for i := 1; ; i++ {
+		if _, taken := b.module.Components[name]; !taken {
+			return name
+		}
+		name = fmt.Sprintf("%s_%d", base, i)
+	}
+}
+
+// claimComponent records proc as the only process allowed to use the fields
+// of comp.
+func (b *builder) claimComponent(proc *Process, comp *Component, pos token.Pos) {
+	switch comp.Owner {
+	case nil:
+		comp.Owner = proc
+	case proc:
+	default:
+		b.reporter.Error(pos, fmt.Sprintf("component %s is owned by process %s; use its fields only from the methods that process runs", comp.Name, comp.Owner.Name))
+	}
+}
+
+func (b *builder) handleFieldAddr(fa *ssa.FieldAddr) {
+	comp := b.components[fa.X]
+	if comp == nil || fa.Field >= len(comp.Fields) {
+		b.reporter.Warning(fa.Pos(), "field address does not refer to a component")
+		return
+	}
+	b.signals[fa] = comp.Fields[fa.Field]
+}
+
+// readField returns the current value of a component field. A store earlier
+// in the same block is forwarded; otherwise the register itself is read.
+func (b *builder) readField(proc *Process, field *Signal, pos token.Pos) *Signal {
+	b.claimComponent(proc, b.fieldComps[field], pos)
+	if value, ok := b.fieldValues[field]; ok {
+		return value
+	}
+	return field
+}
+
+// writeField stores value into a component field. Constant stores made before
+// any process owns the component, such as composite literal fields, become
+// the register's initial value.
+func (b *builder) writeField(proc *Process, bb *BasicBlock, field, value *Signal, pos token.Pos) {
+	comp := b.fieldComps[field]
+	if comp.Owner == nil && value.Kind == Const {
+		field.Value = value.Value
+		return
+	}
+	b.claimComponent(proc, comp, pos)
+	bb.Ops = append(bb.Ops, &AssignOperation{Dest: field, Value: value})
+	b.fieldValues[field] = value
+}
+
+// inlineComponentCall expands a static method call on a component into the
+// calling process. The current block jumps into a copy of the method's
+// blocks, and each return jumps to a new block that carries on with the rest
+// of the caller. It returns that block, or nil when call is not a method call
+// on a component.
+func (b *builder) inlineComponentCall(proc *Process, bb *BasicBlock, call *ssa.Call) *BasicBlock {
+	callee := call.Call.StaticCallee()
+	if callee == nil || len(callee.Blocks) == 0 {
+		return nil
+	}
+	comp := b.receiverComponent(callee, call.Call.Args)
+	if comp == nil {
+		return nil
+	}
+	for _, frame := range b.inlining {
+		if frame.fn == callee {
+			b.reporter.Error(call.Pos(), fmt.Sprintf("recursion is not supported; refactor %s to an iterative form", callee.Name()))
+			return nil
+		}
+	}
+	b.claimComponent(proc, comp, call.Pos())
+	b.forgetFunction(callee)
+	b.bindCallArguments(callee, call.Call.Args)
+
+	frame := &inlineFrame{
+		fn:   callee,
+		cont: &BasicBlock{Label: bb.Label + ".cont"},
+	}
+	b.inlining = append(b.inlining, frame)
+	entry := b.translateBlocks(proc, callee)
+	b.inlining = b.inlining[:len(b.inlining)-1]
+
+	bb.Terminator = &JumpTerminator{Target: entry}
+	linkBlocks(bb, entry)
+	proc.Blocks = append(proc.Blocks, frame.cont)
+	for _, ret := range frame.returns {
+		linkBlocks(ret.Block, frame.cont)
+	}
+	if callee.Signature.Results().Len() == 1 {
+		b.bindInlineResult(call, frame)
+	}
+	b.fieldValues = make(map[*Signal]*Signal)
+	return frame.cont
+}
+
+// bindInlineResult maps the call's value to the method result, merging the
+// results of several returns with a phi in the continuation block.
+func (b *builder) bindInlineResult(call *ssa.Call, frame *inlineFrame) {
+	switch len(frame.returns) {
+	case 0:
+		return
+	case 1:
+		if value := frame.returns[0].Value; value != nil {
+			b.signals[call] = value
+		}
+		return
+	}
+	dest := b.ensureValueSignal(call)
+	frame.cont.Ops = append(frame.cont.Ops, &PhiOperation{
+		Dest:      dest,
+		Incomings: frame.returns,
+	})
+}
+
+func linkBlocks(from, to *BasicBlock) {
+	if from == nil || to == nil {
+		return
+	}
+	from.Successors = append(from.Successors, to)
+	to.Predecessors = append(to.Predecessors, from)
+}
@@ -1,9 +1,12 @@
 package ir
 
 import (
+	"bytes"
 	"io"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
 
 	"mygo/internal/diag"
@@ -73,6 +76,98 @@ func main() {
 }
 `
 
+const panicProgram = `
+package main
+
+const limit = 10
+
+func sink(v uint32) {}
+
+func main() {
+    var x uint32
+    x = 12
+    if x > limit {
+        panic("overflow")
+    }
+    sink(x)
+}
+`
+
+func TestPanicLowersToGuardedAssertion(t *testing.T) {
+	design := buildDesignFromSource(t, panicProgram)
+	if design == nil || design.TopLevel == nil {
+		t.Fatalf("expected design")
+	}
+	var assert *AssertOperation
+	for _, proc := range design.Processes() {
+		for _, block := range proc.Blocks {
+			for _, op := range block.Ops {
+				if a, ok := op.(*AssertOperation); ok {
+					assert = a
+				}
+			}
+		}
+	}
+	if assert == nil {
+		t.Fatalf("expected panic to lower to an assertion")
+	}
+	if assert.Cond == nil {
+		t.Fatalf("expected assertion to be guarded by the if condition")
+	}
+	if assert.Message != "overflow" {
+		t.Fatalf("expected panic message %q, got %q", "overflow", assert.Message)
+	}
+	if !strings.HasPrefix(assert.Location, "main.go:") {
+		t.Fatalf("expected Go source location, got %q", assert.Location)
+	}
+}
+
+const panicOrProgram = `
+package main
+
+func sink(v uint32) {}
+
+func main() {
+    in := make(chan uint32, 2)
+    in <- 3
+    in <- 4
+    a := <-in
+    b := <-in
+    if a > 5 || b > 6 {
+        panic("out of range")
+    }
+    sink(a + b)
+}
+`
+
+func TestPanicWithSeveralPredecessorsIsGuarded(t *testing.T) {
+	design := buildDesignFromSource(t, panicOrProgram)
+	var assert *AssertOperation
+	var ops []Operation
+	for _, proc := range design.Processes() {
+		for _, block := range proc.Blocks {
+			for _, op := range block.Ops {
+				if a, ok := op.(*AssertOperation); ok {
+					assert = a
+					ops = block.Ops
+				}
+			}
+		}
+	}
+	if assert == nil || assert.Cond == nil {
+		t.Fatalf("expected a guarded assertion, got %+v", assert)
+	}
+	var guard *BinOperation
+	for _, op := range ops {
+		if bin, ok := op.(*BinOperation); ok && bin.Dest == assert.Cond {
+			guard = bin
+		}
+	}
+	if guard == nil || guard.Op != Or {
+		t.Fatalf("expected the guard to OR the two ways of reaching the panic, got %+v", guard)
+	}
+}
+
 func TestControlFlowMuxLowering(t *testing.T) {
 	design := buildDesignFromSource(t, branchProgram)
 	if design == nil || design.TopLevel == nil {
@@ -80,7 +175,7 @@ func TestControlFlowMuxLowering(t *testing.T) {
 	}
 	muxCount := 0
 	cmpCount := 0
-	for _, proc := range design.TopLevel.Processes {
+	for _, proc := range design.Processes() {
 		for _, block := range proc.Blocks {
 			for _, op := range block.Ops {
 				switch op.(type) {
@@ -106,7 +201,7 @@ func TestControlFlowBranchMetadata(t *testing.T) {
 		t.Fatalf("expected design")
 	}
 	var branch *BranchTerminator
-	for _, proc := range design.TopLevel.Processes {
+	for _, proc := range design.Processes() {
 		for _, block := range proc.Blocks {
 			if term, ok := block.Terminator.(*BranchTerminator); ok {
 				branch = term
@@ -131,7 +226,7 @@ func TestSchedulerAssignsStages(t *testing.T) {
 		t.Fatalf("expected design")
 	}
 	stageMap := make(map[string]int)
-	for _, proc := range design.TopLevel.Processes {
+	for _, proc := range design.Processes() {
 		stageMap[proc.Name] = proc.Stage
 	}
 	if stageMap["main"] != 0 {
@@ -145,6 +240,1036 @@ func TestSchedulerAssignsStages(t *testing.T) {
 	}
 }
 
+func TestGoroutinesBecomeModules(t *testing.T) {
+	design := buildDesignFromSource(t, pipelineProgram)
+	top := design.TopLevel
+	if len(top.Processes) != 1 || top.Processes[0].Name != "main" {
+		t.Fatalf("expected only main in the top-level module, got %d processes", len(top.Processes))
+	}
+	if len(design.Modules) != 4 || len(top.Instances) != 3 {
+		t.Fatalf("expected 3 process modules and instances, got %d modules and %d instances", len(design.Modules)-1, len(top.Instances))
+	}
+	var middle *Instance
+	for _, inst := range top.Instances {
+		if inst.Name == "middle_inst1" {
+			middle = inst
+		}
+	}
+	if middle == nil || middle.Module.Name != "main__proc_middle" {
+		t.Fatalf("expected middle_inst1 of main__proc_middle, got %+v", top.Instances)
+	}
+	if got := middle.Module.Processes; len(got) != 1 || got[0].Name != "middle" {
+		t.Fatalf("expected main__proc_middle to hold middle")
+	}
+	var recv, send *Channel
+	for _, block := range middle.Module.Processes[0].Blocks {
+		for _, op := range block.Ops {
+			switch o := op.(type) {
+			case *RecvOperation:
+				recv = o.Channel
+			case *SendOperation:
+				send = o.Channel
+			}
+		}
+	}
+	if recv == nil || send == nil || recv == send {
+		t.Fatalf("expected middle to receive from one channel and send on another")
+	}
+	dirs := make(map[string]PortDirection)
+	for _, port := range middle.Module.Ports {
+		dirs[port.Name] = port.Direction
+	}
+	want := map[string]PortDirection{
+		ClockPort:                   Input,
+		StartPort:                   Input,
+		ChannelPort(recv, "rdata"):  InOut,
+		ChannelPort(recv, "rready"): InOut,
+		ChannelPort(send, "wdata"):  InOut,
+		ChannelPort(send, "wvalid"): InOut,
+		DonePort:                    Output,
+	}
+	for name, dir := range want {
+		if got, ok := dirs[name]; !ok || got != dir {
+			t.Fatalf("expected port %s with direction %v, got %v (present=%v)", name, dir, got, ok)
+		}
+	}
+	if _, ok := dirs[ChannelPort(recv, "wdata")]; ok {
+		t.Fatalf("middle only receives from %s", recv.Name)
+	}
+	nets := make(map[string]string)
+	for _, conn := range middle.Connections {
+		nets[conn.Port] = conn.Net
+	}
+	if nets[StartPort] != "middle_inst1_start" || nets[DonePort] != "middle_inst1_done" || nets[ChannelPort(recv, "rdata")] != "middle_inst1_"+ChannelPort(recv, "rdata") {
+		t.Fatalf("unexpected connections %v", middle.Connections)
+	}
+
+	BuildHierarchy(design)
+	if len(design.Modules) != 4 || len(top.Instances) != 3 || len(top.Processes) != 1 {
+		t.Fatalf("expected BuildHierarchy to be idempotent, got %d modules", len(design.Modules))
+	}
+}
+
+func TestEverySpawnSiteGetsAnInstance(t *testing.T) {
+	design := buildDesignFromSource(t, repeatedSpawnProgram)
+	top := design.TopLevel
+	if len(design.Modules) != 2 || len(top.Instances) != 2 || top.Instances[0].Module != top.Instances[1].Module {
+		t.Fatalf("expected one module placed once per go statement, got %d modules and %+v", len(design.Modules), top.Instances)
+	}
+	if top.Instances[0].Spawn == top.Instances[1].Spawn {
+		t.Fatalf("expected each instance to belong to a go statement of its own")
+	}
+	proc := top.Instances[0].Module.Processes[0]
+	if len(proc.Params) != 1 || ArgPort(proc, 0) != "arg_v" {
+		t.Fatalf("expected p to take v through arg_v, got %v", proc.Params)
+	}
+	for _, sig := range top.Instances[0].Module.Signals {
+		if sig.Kind == Const {
+			t.Fatalf("expected p to take its argument through a port, found constant %s", sig.Name)
+		}
+	}
+	for i, inst := range top.Instances {
+		nets := make(map[string]string)
+		for _, conn := range inst.Connections {
+			nets[conn.Port] = conn.Net
+		}
+		arg := top.Signals[nets[ArgPort(proc, 0)]]
+		if v, ok := IntValue(arg.Value); arg == nil || arg.Kind != Const || !ok || v != int64(i+1) {
+			t.Fatalf("expected %s to be driven with %d, got %v", inst.Name, i+1, nets)
+		}
+		if nets[DonePort] != inst.Name+"_"+DonePort || nets[StartPort] != inst.Name+"_"+StartPort {
+			t.Fatalf("expected %s to drive its own start and done nets, got %v", inst.Name, inst.Connections)
+		}
+		if want := inst.Name + "_chan_jobs_wdata"; nets["chan_jobs_wdata"] != want {
+			t.Fatalf("expected %s to send on %s, got %v", inst.Name, want, nets)
+		}
+	}
+}
+
+const serverLoopProgram = `
+package main
+
+func stage(in chan uint32, out chan uint32) {
+    for {
+        v := <-in
+        out <- v + 1
+    }
+}
+
+func main() {
+    in := make(chan uint32, 1)
+    out := make(chan uint32, 1)
+    go stage(in, out)
+    in <- 1
+    _ = <-out
+}
+`
+
+func TestServerLoopNeverReturns(t *testing.T) {
+	design := buildDesignFromSource(t, serverLoopProgram)
+	if design == nil || design.TopLevel == nil {
+		t.Fatalf("expected design")
+	}
+	var stage *Process
+	for _, proc := range design.Processes() {
+		if proc.Name == "stage" {
+			stage = proc
+		}
+	}
+	if stage == nil {
+		t.Fatalf("expected stage process")
+	}
+	backEdge := false
+	for _, block := range stage.Blocks {
+		switch term := block.Terminator.(type) {
+		case *ReturnTerminator:
+			t.Fatalf("server loop block %s should not return", block.Label)
+		case *JumpTerminator:
+			if term.Target == block {
+				backEdge = true
+				if !block.LoopHeader || block.TripCount != -1 {
+					t.Fatalf("expected unknown trip count on server loop, got %d", block.TripCount)
+				}
+			}
+		}
+	}
+	if !backEdge {
+		t.Fatalf("expected loop body to jump back to itself")
+	}
+}
+
+// zeroTripProgram has a loop whose body never runs.
+const zeroTripProgram = `
+package main
+
+const lanes = 0
+
+func main() {
+    out := make(chan int, 1)
+    for i := 0; i < lanes; i++ {
+        out <- i
+    }
+}
+`
+
+func TestZeroTripLoopKeepsItsHeader(t *testing.T) {
+	design := buildDesignFromSource(t, zeroTripProgram)
+	var headers []*BasicBlock
+	for _, block := range design.TopLevel.Processes[0].Blocks {
+		if block.LoopHeader {
+			headers = append(headers, block)
+		}
+	}
+	if len(headers) != 1 || headers[0].TripCount != 0 {
+		t.Fatalf("expected one loop header with trip count 0, got %v", headers)
+	}
+	var dump bytes.Buffer
+	Dump(design, &dump)
+	if !strings.Contains(dump.String(), "(trip=0)") {
+		t.Fatalf("expected the dump to mark the zero-trip header:\n%s", dump.String())
+	}
+}
+
+const waitGroupProgram = `
+package main
+
+import "sync"
+
+func worker(id uint32, wg *sync.WaitGroup, out chan<- uint32) {
+    defer wg.Done()
+    out <- id
+}
+
+func main() {
+    var wg sync.WaitGroup
+    out := make(chan uint32, 2)
+    wg.Add(2)
+    go worker(1, &wg, out)
+    go worker(2, &wg, out)
+    wg.Wait()
+    <-out
+}
+`
+
+func TestWaitGroupLowersToBarrier(t *testing.T) {
+	design := buildDesignFromSource(t, waitGroupProgram)
+	if design == nil || design.TopLevel == nil {
+		t.Fatalf("expected design")
+	}
+	wg := design.TopLevel.WaitGroups["wg"]
+	if wg == nil {
+		t.Fatalf("expected wait group wg, got %v", design.TopLevel.WaitGroups)
+	}
+	if wg.Count != 2 {
+		t.Fatalf("expected Add total 2, got %d", wg.Count)
+	}
+	if len(wg.Members) != 2 || wg.Members[0].Name() != "worker_inst0" || wg.Members[1].Name() != "worker_inst1" {
+		t.Fatalf("expected both spawned workers as members, got %v", wg.Members)
+	}
+	waits := 0
+	for _, proc := range design.Processes() {
+		for _, block := range proc.Blocks {
+			if block.Label == "recover" {
+				t.Fatalf("unexpected recover block in %s", proc.Name)
+			}
+			for _, op := range block.Ops {
+				if wait, ok := op.(*WaitOperation); ok {
+					if proc.Name != "main" || wait.Group != wg {
+						t.Fatalf("unexpected wait in %s on %v", proc.Name, wait.Group)
+					}
+					waits++
+				}
+			}
+		}
+	}
+	if waits != 1 {
+		t.Fatalf("expected one wait operation, got %d", waits)
+	}
+}
+
+const rendezvousProgram = `
+package main
+
+func producer(out chan<- uint16) {
+    out <- 7
+}
+
+func main() {
+    ch := make(chan uint16)
+    go producer(ch)
+    <-ch
+}
+`
+
+func TestUnbufferedChannelHasNoDepth(t *testing.T) {
+	design := buildDesignFromSource(t, rendezvousProgram)
+	if design == nil || design.TopLevel == nil {
+		t.Fatalf("expected design")
+	}
+	if len(design.TopLevel.Channels) != 1 {
+		t.Fatalf("expected one channel, got %d", len(design.TopLevel.Channels))
+	}
+	for _, ch := range design.TopLevel.Channels {
+		if !ch.Unbuffered() || ch.Occupancy != 0 {
+			t.Fatalf("expected unbuffered channel with no occupancy, got depth=%d occupancy=%d", ch.Depth, ch.Occupancy)
+		}
+	}
+}
+
+const channelLenProgram = `
+package main
+
+func sink(v int) {}
+
+func main() {
+    ch := make(chan uint8, 4)
+    rv := make(chan uint8)
+    ch <- 1
+    sink(len(ch))
+    sink(cap(ch))
+    sink(len(rv) + cap(rv))
+}
+`
+
+func TestChannelLenAndCap(t *testing.T) {
+	design := buildDesignFromSource(t, channelLenProgram)
+	if design == nil || design.TopLevel == nil {
+		t.Fatalf("expected design")
+	}
+	var lens []*LenOperation
+	for _, proc := range design.Processes() {
+		for _, block := range proc.Blocks {
+			for _, op := range block.Ops {
+				if l, ok := op.(*LenOperation); ok {
+					lens = append(lens, l)
+				}
+			}
+		}
+	}
+	if len(lens) != 1 || lens[0].Channel.Depth != 4 {
+		t.Fatalf("expected one len operation on the buffered channel, got %v", lens)
+	}
+	consts := make(map[int64]int)
+	for _, sig := range design.Signals() {
+		if v, ok := sig.Value.(int64); ok && sig.Kind == Const {
+			consts[v]++
+		}
+	}
+	if consts[4] == 0 {
+		t.Fatalf("expected cap(ch) to fold to 4, got constants %v", consts)
+	}
+	if consts[0] < 2 {
+		t.Fatalf("expected len and cap of the unbuffered channel to fold to 0, got constants %v", consts)
+	}
+}
+
+const channelArrayProgram = `
+package main
+
+func sink(v uint32) {}
+
+func worker(in <-chan uint32, out chan<- uint32) {
+    v := <-in
+    out <- v + 1
+}
+
+func main() {
+    var lanes [2]chan uint32
+    lanes[0] = make(chan uint32, 1)
+    lanes[1] = make(chan uint32, 1)
+    outs := [2]chan uint32{make(chan uint32, 1), make(chan uint32, 1)}
+    go worker(lanes[0], outs[0])
+    go worker(lanes[1], outs[1])
+    lanes[0] <- 1
+    lanes[1] <- 2
+    sink(<-outs[0] + <-outs[1])
+}
+`
+
+func TestChannelArrayLanesBindOneWorker(t *testing.T) {
+	design := buildDesignFromSource(t, channelArrayProgram)
+	if design == nil || design.TopLevel == nil {
+		t.Fatalf("expected design")
+	}
+	if len(design.TopLevel.Channels) != 4 {
+		t.Fatalf("expected one channel per array element, got %d", len(design.TopLevel.Channels))
+	}
+	var spawns []*SpawnOperation
+	for _, block := range design.TopLevel.Processes[0].Blocks {
+		for _, op := range block.Ops {
+			if spawn, ok := op.(*SpawnOperation); ok {
+				spawns = append(spawns, spawn)
+			}
+		}
+	}
+	if len(spawns) != 2 || spawns[0].Callee != spawns[1].Callee {
+		t.Fatalf("expected both lanes to run one worker process, got %v", spawns)
+	}
+	if insts := design.TopLevel.Instances; len(insts) != 2 || insts[0].Spawn != spawns[0] || insts[1].Spawn != spawns[1] {
+		t.Fatalf("expected an instance per lane, got %v", insts)
+	}
+	seen := make(map[*Channel]bool)
+	for _, spawn := range spawns {
+		if len(spawn.ChanArgs) != 2 {
+			t.Fatalf("expected two channel arguments for %s, got %v", spawn.Callee.Name, spawn.ChanArgs)
+		}
+		for _, ch := range spawn.ChanArgs {
+			if seen[ch] {
+				t.Fatalf("channel %s bound to more than one lane", ch.Name)
+			}
+			seen[ch] = true
+			if len(ch.Producers) != 1 || len(ch.Consumers) != 1 {
+				t.Fatalf("expected channel %s to have one producer and one consumer, got %d/%d", ch.Name, len(ch.Producers), len(ch.Consumers))
+			}
+		}
+	}
+}
+
+const repeatedSpawnProgram = `
+package main
+
+func sink(v int32) {}
+
+func p(jobs chan<- int32, v int32) {
+    jobs <- v
+}
+
+func main() {
+    jobs := make(chan int32, 2)
+    go p(jobs, 1)
+    go p(jobs, 2)
+    sink(<-jobs + <-jobs)
+}
+`
+
+func TestSpawnsOfOneFunctionShareAProcess(t *testing.T) {
+	design := buildDesignFromSource(t, repeatedSpawnProgram)
+	if design == nil || design.TopLevel == nil {
+		t.Fatalf("expected design")
+	}
+	var spawns []*SpawnOperation
+	for _, block := range design.TopLevel.Processes[0].Blocks {
+		for _, op := range block.Ops {
+			if spawn, ok := op.(*SpawnOperation); ok {
+				spawns = append(spawns, spawn)
+			}
+		}
+	}
+	if len(spawns) != 2 || spawns[0].Callee != spawns[1].Callee {
+		t.Fatalf("expected both go statements to start one process, got %v", spawns)
+	}
+	callee := spawns[0].Callee
+	if len(callee.Params) != 1 || len(callee.ChanParams) != 1 {
+		t.Fatalf("expected %s to take one value and one channel, got %v and %v", callee.Name, callee.Params, callee.ChanParams)
+	}
+	if len(design.TopLevel.Channels) != 1 {
+		t.Fatalf("expected one channel, got %v", design.TopLevel.Channels)
+	}
+	var jobs *Channel
+	for _, ch := range design.TopLevel.Channels {
+		jobs = ch
+	}
+	for i, spawn := range spawns {
+		if len(spawn.Args) != 1 || len(spawn.ChanArgs) != 1 || spawn.ChanArgs[0] != jobs {
+			t.Fatalf("expected spawn %d to pass jobs and one argument, got %v %v", i, spawn.ChanArgs, spawn.Args)
+		}
+		if v, ok := IntValue(spawn.Args[0].Value); !ok || v != int64(i+1) {
+			t.Fatalf("expected spawn %d to pass %d, got %v", i, i+1, spawn.Args[0].Value)
+		}
+	}
+	var sent []*Signal
+	for _, block := range callee.Blocks {
+		for _, op := range block.Ops {
+			if send, ok := op.(*SendOperation); ok {
+				sent = append(sent, send.Value)
+				if send.Channel != callee.ChanParams[0] {
+					t.Fatalf("expected %s to send on its channel param, got %s", callee.Name, send.Channel.Name)
+				}
+			}
+		}
+	}
+	if len(sent) != 1 || sent[0] != callee.Params[0] {
+		t.Fatalf("expected %s to send its param, got %v", callee.Name, sent)
+	}
+	if got := jobs.ProducerPorts(); len(got) != 2 || got[0].Name() != "p_inst0" || got[1].Name() != "p_inst1" {
+		t.Fatalf("expected a producer per goroutine on jobs, got %v", got)
+	}
+}
+
+const collidingSpawnProgram = `
+package main
+
+func sink(v int32) {}
+
+func worker(out chan<- int32, v int32) {
+    out <- v
+}
+
+func worker_1(out chan<- int32) {
+    out <- 9
+}
+
+func main() {
+    out := make(chan int32, 3)
+    go worker(out, 1)
+    go worker(out, 2)
+    go worker_1(out)
+    sink(<-out + <-out + <-out)
+}
+`
+
+func TestSpawnedProcessNamesAvoidUserFunctions(t *testing.T) {
+	design := buildDesignFromSource(t, collidingSpawnProgram)
+	procs := make(map[string]bool)
+	for _, proc := range design.Processes() {
+		if procs[proc.Name] {
+			t.Fatalf("process name %s used twice", proc.Name)
+		}
+		procs[proc.Name] = true
+	}
+	for _, name := range []string{"main", "worker", "worker_1"} {
+		if !procs[name] {
+			t.Fatalf("expected a process called %s, got %v", name, procs)
+		}
+	}
+	modules := make(map[string]bool)
+	for _, module := range design.Modules {
+		if modules[module.Name] {
+			t.Fatalf("module name %s used twice", module.Name)
+		}
+		modules[module.Name] = true
+	}
+}
+
+const nestedSpawnArgProgram = `
+package main
+
+func sink(v int32) {}
+
+func leaf(out chan<- int32, v int32) {
+    out <- v
+}
+
+func mid(in <-chan int32, out chan<- int32) {
+    v := <-in
+    go leaf(out, v+1)
+}
+
+func main() {
+    in := make(chan int32, 1)
+    out := make(chan int32, 1)
+    go mid(in, out)
+    in <- 3
+    sink(<-out)
+}
+`
+
+func TestChildSpawnerPlacesItsChild(t *testing.T) {
+	design := buildDesignFromSource(t, nestedSpawnArgProgram)
+	top := design.TopLevel
+	if len(top.Instances) != 1 || top.Instances[0].Module.Processes[0].Name != "mid" {
+		t.Fatalf("expected only mid to be placed in the top level, got %v", top.Instances)
+	}
+	mid := top.Instances[0]
+	if len(mid.Module.Instances) != 1 || mid.Module.Instances[0].Module.Processes[0].Name != "leaf" {
+		t.Fatalf("expected mid to place leaf, got %v", mid.Module.Instances)
+	}
+	leaf := mid.Module.Instances[0]
+	proc := leaf.Module.Processes[0]
+	if len(proc.Params) != 1 || ArgPort(proc, 0) != "arg_v" {
+		t.Fatalf("expected leaf to take v through arg_v, got %v", proc.Params)
+	}
+	nets := make(map[string]string)
+	for _, conn := range leaf.Connections {
+		nets[conn.Port] = conn.Net
+	}
+	if arg := leaf.Spawn.Args[0]; nets["arg_v"] != arg.Name || mid.Module.Signals[arg.Name] != arg {
+		t.Fatalf("expected arg_v to read the value mid computes, got %v", nets)
+	}
+	if nets[StartPort] != "leaf_inst0_start" || nets["chan_out_wdata"] != "leaf_inst0_chan_out_wdata" {
+		t.Fatalf("unexpected connections %v", leaf.Connections)
+	}
+	dirs := make(map[string]PortDirection)
+	for _, port := range mid.Module.Ports {
+		dirs[port.Name] = port.Direction
+	}
+	if dirs["leaf_inst0_chan_out_wdata"] != InOut {
+		t.Fatalf("expected mid to pass leaf's channel port on, got %v", mid.Module.Ports)
+	}
+	if _, ok := dirs["leaf_inst0_done"]; ok {
+		t.Fatalf("leaf's done is waited on by no one, got %v", mid.Module.Ports)
+	}
+	var out *Channel
+	for idx, formal := range mid.Spawn.Callee.ChanParams {
+		if formal == leaf.Spawn.ChanArgs[0] {
+			out = mid.Spawn.ChanArgs[idx]
+		}
+	}
+	if got := out.ProducerPorts(); len(got) != 1 || got[0].Name() != "mid_inst0.leaf_inst0" || got[0].Net("chan_out_wdata") != "mid_inst0_leaf_inst0_chan_out_wdata" {
+		t.Fatalf("expected leaf to send on out from inside mid, got %v", got)
+	}
+}
+
+const sharedChannelProgram = `
+package main
+
+func sink(v uint32) {}
+
+func producerA(out chan<- uint32) {
+    out <- 1
+}
+
+func producerB(out chan<- uint32) {
+    out <- 2
+}
+
+func relay(in <-chan uint32, out chan<- uint32) {
+    out <- <-in
+}
+
+func boost(in <-chan uint32, out chan<- uint32) {
+    out <- <-in + 10
+}
+
+func main() {
+    //mygo:arbiter priority
+    ch := make(chan uint32, 2)
+    res := make(chan uint32, 2)
+    go producerA(ch)
+    go producerB(ch)
+    go relay(ch, res)
+    go boost(ch, res)
+    sink(<-res + <-res)
+}
+`
+
+func TestSharedChannelArbitration(t *testing.T) {
+	design := buildDesignFromSource(t, sharedChannelProgram)
+	if design == nil || design.TopLevel == nil {
+		t.Fatalf("expected design")
+	}
+	var shared, results *Channel
+	for _, ch := range design.TopLevel.Channels {
+		if len(ch.ConsumerPorts()) == 2 {
+			shared = ch
+		} else {
+			results = ch
+		}
+	}
+	if shared == nil || results == nil {
+		t.Fatalf("expected a shared input channel and a result channel")
+	}
+	if got := len(shared.ProducerPorts()); got != 2 {
+		t.Fatalf("expected two producers on %s, got %d", shared.Name, got)
+	}
+	if shared.Arbitration != ArbitratePriority {
+		t.Fatalf("expected //mygo:arbiter priority on %s, got %s", shared.Name, shared.Arbitration)
+	}
+	if got := len(results.ProducerPorts()); got != 2 {
+		t.Fatalf("expected two producers on %s, got %d", results.Name, got)
+	}
+	if results.Arbitration != ArbitrateRoundRobin {
+		t.Fatalf("expected round-robin default on %s, got %s", results.Name, results.Arbitration)
+	}
+}
+
+const componentProgram = `
+package main
+
+type Counter struct {
+    n     uint32
+    limit uint32
+}
+
+func (c *Counter) bump(v uint32) {
+    c.n += v
+}
+
+func (c *Counter) Run(in <-chan uint32, out chan<- uint32) {
+    for i := 0; i < 4; i++ {
+        c.bump(<-in)
+        out <- c.n
+    }
+}
+
+func main() {
+    in := make(chan uint32, 1)
+    out := make(chan uint32, 1)
+    c := &Counter{limit: 9}
+    go c.Run(in, out)
+    for i := uint32(0); i < 4; i++ {
+        in <- i
+        <-out
+    }
+}
+`
+
+func TestComponentFieldsBecomeRegisters(t *testing.T) {
+	design := buildDesignFromSource(t, componentProgram)
+	if design == nil || design.TopLevel == nil {
+		t.Fatalf("expected design")
+	}
+	top := design.TopLevel
+	if len(top.Components) != 0 || len(top.Instances) != 1 {
+		t.Fatalf("expected counter to leave the top level for one instance, got components %v", top.Components)
+	}
+	module := top.Instances[0].Module
+	if module.Name != "main__comp_counter" {
+		t.Fatalf("expected counter to get a module of its own, got %s", module.Name)
+	}
+	comp := module.Components["counter"]
+	if comp == nil {
+		t.Fatalf("expected counter component in %s, got %v", module.Name, module.Components)
+	}
+	for _, field := range comp.Fields {
+		if top.Signals[field.Name] != nil || module.Signals[field.Name] != field {
+			t.Fatalf("expected register %s to live only in %s", field.Name, module.Name)
+		}
+	}
+	if comp.Owner == nil || comp.Owner.Name != "counter_Run" {
+		t.Fatalf("expected counter to be owned by counter_Run, got %v", comp.Owner)
+	}
+	if len(comp.Fields) != 2 {
+		t.Fatalf("expected a register per field, got %d", len(comp.Fields))
+	}
+	n, limit := comp.Fields[0], comp.Fields[1]
+	if n.Kind != Reg || limit.Kind != Reg {
+		t.Fatalf("expected field registers, got %v and %v", n.Kind, limit.Kind)
+	}
+	if limit.Value != uint64(9) {
+		t.Fatalf("expected composite literal to initialise limit to 9, got %v", limit.Value)
+	}
+	stores := 0
+	inlined := false
+	for _, block := range comp.Owner.Blocks {
+		if strings.HasPrefix(block.Label, "bump.") {
+			inlined = true
+		}
+		for _, op := range block.Ops {
+			if assign, ok := op.(*AssignOperation); ok && assign.Dest == n {
+				stores++
+			}
+		}
+	}
+	if !inlined || stores != 1 {
+		t.Fatalf("expected bump to be inlined into counter_Run with one store to n, got inlined=%v stores=%d", inlined, stores)
+	}
+}
+
+const enumProgram = `
+package main
+
+type state uint8
+
+const (
+    Idle state = iota
+    Busy
+    Done
+)
+
+func sink(v state) {}
+
+func main() {
+    st := Idle
+    for i := 0; i < 3; i++ {
+        if st == Idle {
+            st = Busy
+        } else {
+            st = Done
+        }
+    }
+    sink(st)
+}
+`
+
+func TestIotaConstantsCarryEnumNames(t *testing.T) {
+	design := buildDesignFromSource(t, enumProgram)
+	if design == nil || design.TopLevel == nil {
+		t.Fatalf("expected design")
+	}
+	var members []string
+	var shared *EnumType
+	for _, sig := range design.Signals() {
+		if sig.Kind != Const || sig.Type.Enum == nil {
+			continue
+		}
+		enum := sig.Type.Enum
+		if enum.Name != "state" || len(enum.Members) != 3 {
+			t.Fatalf("expected state enum with three members, got %+v", enum)
+		}
+		if shared == nil {
+			shared = enum
+		} else if enum != shared {
+			t.Fatalf("expected every state signal to share one cached enum")
+		}
+		value, _ := IntValue(sig.Value)
+		members = append(members, enum.MemberFor(value))
+	}
+	for _, want := range []string{"Idle", "Busy", "Done"} {
+		if !slices.Contains(members, want) {
+			t.Fatalf("expected a constant for %s, got %v", want, members)
+		}
+	}
+}
+
+const floatProgram = `
+package main
+
+func sink(v int32) {}
+
+func main() {
+    acc := float32(0)
+    for i := int32(0); i < 4; i++ {
+        x := float32(i) * 1.5
+        if x > acc {
+            acc = acc + x
+        }
+    }
+    sink(int32(-acc))
+}
+`
+
+func TestFloat32LowersToFloatOperations(t *testing.T) {
+	design := buildDesignFromSource(t, floatProgram)
+	if design == nil || design.TopLevel == nil {
+		t.Fatalf("expected design")
+	}
+	ops := make(map[FloatOp]bool)
+	negated := false
+	for _, proc := range design.Processes() {
+		for _, block := range proc.Blocks {
+			for _, op := range block.Ops {
+				switch o := op.(type) {
+				case *FloatOperation:
+					ops[o.Op] = true
+				case *BinOperation:
+					if bits, ok := o.Right.Value.(uint64); ok && o.Op == Xor && bits == 1<<31 {
+						negated = true
+					}
+				}
+			}
+		}
+	}
+	for _, want := range []FloatOp{FloatFromInt, FloatMul, FloatGT, FloatAdd, FloatToInt} {
+		if !ops[want] {
+			t.Fatalf("expected a float.%s operation, got %v", want, ops)
+		}
+	}
+	if !negated {
+		t.Fatalf("expected negation to flip the sign bit")
+	}
+	found := false
+	for _, sig := range design.Signals() {
+		if sig.Kind == Const && sig.Type.Float && sig.Value == uint64(0x3FC00000) {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("expected 1.5 to be stored as its float32 bit pattern")
+	}
+}
+
+const softwareProgram = `
+package main
+
+//mygo:software
+func stimulus(out chan int32, log chan<- int32) {
+    for i := int32(0); i < 4; i++ {
+        out <- i
+        log <- i
+    }
+}
+
+//mygo:software
+func checker(in <-chan int32, log <-chan int32, done chan<- bool) {
+    for i := 0; i < 4; i++ {
+        if <-in != 2*<-log {
+            panic("mismatch")
+        }
+    }
+    done <- true
+}
+
+func double(in <-chan int32, out chan<- int32) {
+    for {
+        v := <-in
+        out <- v * 2
+    }
+}
+
+func main() {
+    raw := make(chan int32)
+    doubled := make(chan int32)
+    log := make(chan int32, 4)
+    done := make(chan bool)
+    go stimulus(raw, log)
+    go double(raw, doubled)
+    go checker(doubled, log, done)
+    <-done
+}
+`
+
+func TestSoftwareGoroutinesBecomeStreams(t *testing.T) {
+	design := buildDesignFromSource(t, softwareProgram)
+	if design == nil || design.TopLevel == nil {
+		t.Fatalf("expected design")
+	}
+	module := design.TopLevel
+	software := make(map[string]*Process)
+	for _, proc := range module.Processes {
+		if proc.Software != nil {
+			software[proc.Name] = proc
+			if len(proc.Blocks) != 0 {
+				t.Fatalf("software process %s should not be translated", proc.Name)
+			}
+		}
+	}
+	if len(software) != 2 {
+		t.Fatalf("expected stimulus and checker to stay in software, got %v", software)
+	}
+	if got := software["stimulus"].Software.ElemTypes; !slices.Equal(got, []string{"int32", "int32"}) {
+		t.Fatalf("unexpected stimulus element types %v", got)
+	}
+	streams := make(map[string]PortDirection)
+	for _, stream := range module.Streams {
+		streams[stream.Name] = stream.Direction
+	}
+	want := map[string]PortDirection{"stimulus_out": Input, "checker_in": Output, "checker_done": Input}
+	if len(streams) != len(want) {
+		t.Fatalf("expected streams %v, got %v", want, streams)
+	}
+	for name, dir := range want {
+		if got, ok := streams[name]; !ok || got != dir {
+			t.Fatalf("expected stream %s with direction %v, got %v", name, dir, streams)
+		}
+	}
+	for _, ch := range module.Channels {
+		if ch.Depth == 4 {
+			t.Fatalf("channel %s joins two software goroutines and should stay in Go", ch.Name)
+		}
+	}
+	ports := make(map[string]PortDirection)
+	for _, port := range module.Ports {
+		ports[port.Name] = port.Direction
+	}
+	for name, dir := range map[string]PortDirection{
+		"stimulus_start":     Output,
+		"stimulus_out_data":  Input,
+		"stimulus_out_ready": Output,
+		"checker_in_data":    Output,
+		"checker_in_ready":   Input,
+	} {
+		if got, ok := ports[name]; !ok || got != dir {
+			t.Fatalf("expected port %s with direction %v, got %v", name, dir, ports)
+		}
+	}
+}
+
+const mutexProgram = `
+package main
+
+import "sync"
+
+//mygo:arbiter priority
+var mu sync.Mutex
+
+var total int32 = 7
+
+func add(count *int32, wg *sync.WaitGroup) {
+    defer wg.Done()
+    mu.Lock()
+    *count += 1
+    total += 1
+    mu.Unlock()
+}
+
+func double(count *int32, wg *sync.WaitGroup) {
+    defer wg.Done()
+    mu.Lock()
+    *count *= 2
+    mu.Unlock()
+}
+
+func main() {
+    var count int32
+    var wg sync.WaitGroup
+    wg.Add(2)
+    go add(&count, &wg)
+    go double(&count, &wg)
+    wg.Wait()
+    mu.Lock()
+    defer mu.Unlock()
+    total += count
+}
+`
+
+func TestMutexGuardedStateBecomesSharedRegisters(t *testing.T) {
+	design := buildDesignFromSource(t, mutexProgram)
+	if design == nil || design.TopLevel == nil {
+		t.Fatalf("expected design")
+	}
+	module := design.TopLevel
+	mu := module.Mutexes["mu"]
+	if mu == nil {
+		t.Fatalf("expected mutex mu, got %v", module.Mutexes)
+	}
+	if mu.Arbitration != ArbitratePriority {
+		t.Fatalf("expected //mygo:arbiter priority on mu, got %s", mu.Arbitration)
+	}
+	if got := len(mu.Users); got != 3 {
+		t.Fatalf("expected main, add and double to use mu, got %d", got)
+	}
+	total := module.Signals["total"]
+	if total == nil || total.Kind != Shared {
+		t.Fatalf("expected shared register for total, got %+v", total)
+	}
+	if total.Value != int64(7) {
+		t.Fatalf("expected total to start at 7, got %v", total.Value)
+	}
+	shared := 0
+	for _, sig := range module.Signals {
+		if sig.Kind == Shared {
+			shared++
+		}
+	}
+	if shared != 2 {
+		t.Fatalf("expected count and total to be shared, got %d shared signals", shared)
+	}
+	for _, user := range mu.Users {
+		locks, unlocks := 0, 0
+		for _, block := range user.Process.Blocks {
+			for _, op := range block.Ops {
+				switch op.(type) {
+				case *LockOperation:
+					locks++
+				case *UnlockOperation:
+					unlocks++
+				}
+			}
+		}
+		if locks != 1 || unlocks == 0 {
+			t.Fatalf("expected %s to lock and unlock mu, got %d locks and %d unlocks", user.Name(), locks, unlocks)
+		}
+	}
+}
+
+func TestTopLevelExposesDonePort(t *testing.T) {
+	design := buildDesignFromSource(t, pipelineProgram)
+	if design == nil || design.TopLevel == nil {
+		t.Fatalf("expected design")
+	}
+	for _, port := range design.TopLevel.Ports {
+		if port.Name != "done" {
+			continue
+		}
+		if port.Direction != Output || port.Type == nil || port.Type.Width != 1 {
+			t.Fatalf("expected 1-bit output done port, got %+v", port)
+		}
+		return
+	}
+	t.Fatalf("expected top-level done port")
+}
+
 func TestChannelOccupancyTracking(t *testing.T) {
 	design := buildDesignFromSource(t, occupancyProgram)
 	if design == nil || design.TopLevel == nil {
@@ -183,7 +1308,7 @@ func buildDesignFromSource(t *testing.T, source string) *Design {
 	if err != nil {
 		t.Fatalf("build ssa: %v", err)
 	}
-	design, err := BuildDesign(prog, reporter)
+	design, err := BuildDesign(prog, pkgs, reporter)
 	if err != nil {
 		t.Fatalf("build design: %v", err)
 	}
@@ -0,0 +1,78 @@
+package ir
+
+import (
+	"fmt"
+	"go/token"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// directivePrefix marks comments that carry compiler hints, such as
+// "//mygo:arbiter priority".
+const directivePrefix = "//mygo:"
+
+// directivesAt returns the //mygo: directives that annotate the statement at
+// pos: those on the same line or on the line directly above. Each entry is the
+// comment text without the prefix.
+func (b *builder) directivesAt(pos token.Pos) []string {
+	if b.fset == nil || !pos.IsValid() {
+		return nil
+	}
+	position := b.fset.Position(pos)
+	lines := b.directives[position.Filename]
+	if lines == nil {
+		return nil
+	}
+	var out []string
+	out = append(out, lines[position.Line-1]...)
+	out = append(out, lines[position.Line]...)
+	return out
+}
+
+// arbiterDirective returns the policy named by a //mygo:arbiter directive at
+// pos, or def when there is none.
+func (b *builder) arbiterDirective(pos token.Pos, def Arbitration) Arbitration {
+	policy := def
+	for _, directive := range b.directivesAt(pos) {
+		name, arg, _ := strings.Cut(directive, " ")
+		if name != "arbiter" {
+			continue
+		}
+		switch strings.TrimSpace(arg) {
+		case "round_robin":
+			policy = ArbitrateRoundRobin
+		case "priority":
+			policy = ArbitratePriority
+		default:
+			b.reporter.Error(pos, fmt.Sprintf("unknown arbiter policy %q; use round_robin or priority", strings.TrimSpace(arg)))
+		}
+	}
+	return policy
+}
+
+// indexDirectives collects the //mygo: comments of the loaded syntax trees,
+// keyed by file name and then by line.
+func indexDirectives(fset *token.FileSet, pkgs []*packages.Package) map[string]map[int][]string {
+	index := make(map[string]map[int][]string)
+	packages.Visit(pkgs, nil, func(pkg *packages.Package) {
+		for _, file := range pkg.Syntax {
+			for _, group := range file.Comments {
+				for _, comment := range group.List {
+					text, ok := strings.CutPrefix(comment.Text, directivePrefix)
+					if !ok {
+						continue
+					}
+					position := fset.Position(comment.Slash)
+					lines := index[position.Filename]
+					if lines == nil {
+						lines = make(map[int][]string)
+						index[position.Filename] = lines
+					}
+					lines[position.Line] = append(lines[position.Line], strings.TrimSpace(text))
+				}
+			}
+		}
+	})
+	return index
+}
@@ -0,0 +1,114 @@
+package ir
+
+import (
+	"fmt"
+	"go/token"
+	"go/types"
+
+	"golang.org/x/tools/go/ssa"
+)
+
+// floatSignBit is the sign bit of a float32 bit pattern.
+const floatSignBit = 1 << 31
+
+func isFloatType(t types.Type) bool {
+	if t == nil {
+		return false
+	}
+	basic, ok := t.Underlying().(*types.Basic)
+	return ok && basic.Info()&types.IsFloat != 0
+}
+
+func translateFloatOp(tok token.Token) (FloatOp, bool) {
+	switch tok {
+	case token.ADD:
+		return FloatAdd, true
+	case token.SUB:
+		return FloatSub, true
+	case token.MUL:
+		return FloatMul, true
+	case token.EQL:
+		return FloatEQ, true
+	case token.NEQ:
+		return FloatNE, true
+	case token.LSS:
+		return FloatLT, true
+	case token.LEQ:
+		return FloatLE, true
+	case token.GTR:
+		return FloatGT, true
+	case token.GEQ:
+		return FloatGE, true
+	default:
+		return 0, false
+	}
+}
+
+// handleFloatBinOp lowers float32 arithmetic and comparisons to operations on
+// generated floating-point units.
+func (b *builder) handleFloatBinOp(bb *BasicBlock, op *ssa.BinOp, left, right *Signal) {
+	fop, ok := translateFloatOp(op.Op)
+	if !ok {
+		b.reporter.Warning(op.Pos(), fmt.Sprintf("unsupported float32 op: %s", op.Op.String()))
+		return
+	}
+	dest := b.ensureValueSignal(op)
+	dest.Type = b.signalType(op.Type())
+	bb.Ops = append(bb.Ops, &FloatOperation{
+		Op:    fop,
+		Dest:  dest,
+		Left:  left,
+		Right: right,
+	})
+}
+
+// handleFloatNeg lowers -x by flipping the sign bit, which is exact for every
+// float32 including zeros, infinities and NaNs.
+func (b *builder) handleFloatNeg(bb *BasicBlock, op *ssa.UnOp) {
+	value := b.signalForValue(op.X)
+	if value == nil {
+		return
+	}
+	sign := &Signal{
+		Name:   b.newConstName(),
+		Type:   b.signalType(op.Type()),
+		Kind:   Const,
+		Value:  uint64(floatSignBit),
+		Source: op.Pos(),
+	}
+	b.module.Signals[sign.Name] = sign
+	dest := b.ensureValueSignal(op)
+	dest.Type = b.signalType(op.Type())
+	bb.Ops = append(bb.Ops, &BinOperation{
+		Op:    Xor,
+		Dest:  dest,
+		Left:  value,
+		Right: sign,
+	})
+}
+
+// handleFloatConvert lowers conversions between float32 and integers. It
+// reports whether conv involved a float type.
+func (b *builder) handleFloatConvert(bb *BasicBlock, conv *ssa.Convert, source *Signal) bool {
+	fromFloat := isFloatType(conv.X.Type())
+	toFloat := isFloatType(conv.Type())
+	if !fromFloat && !toFloat {
+		return false
+	}
+	if fromFloat && toFloat {
+		b.signals[conv] = source
+		return true
+	}
+	dest := b.ensureValueSignal(conv)
+	dest.Type = b.signalType(conv.Type())
+	op := FloatFromInt
+	if fromFloat {
+		op = FloatToInt
+	}
+	bb.Ops = append(bb.Ops, &FloatOperation{
+		Op:   op,
+		Dest: dest,
+		Left: source,
+	})
+	return true
+}
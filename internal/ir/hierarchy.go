@@ -0,0 +1,1244 @@
+package ir
+
+import (
+	"fmt"
+	"math/bits"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Instance places the module of a spawned process inside the module of the
+// process that spawns it, once per go statement. Spawn is that go statement,
+// one of the operations of the parent's process.
+type Instance struct {
+	Name        string
+	Module      *Module
+	Connections []Connection
+	Spawn       *SpawnOperation
+}
+
+// Connection wires a port of an instance to a net of the parent. start and
+// the arg_<param> inputs take the values the go statement passes, as
+// <instance>_start and the signals it names. Channel counts, wait groups and
+// shared register values are the same for every goroutine, so they take the
+// parent's net or port for them, such as chan_jobs_count. Every other port
+// belongs to this goroutine alone and reaches a net of its own,
+// <instance>_<port>, which the parent passes on as a port of that name until
+// it reaches the top-level module.
+type Connection struct {
+	Port string
+	Net  string
+}
+
+// Port names used by process modules. The parent nets carrying channels,
+// mutex handshakes and shared registers use the same names.
+const (
+	ClockPort = "clk"
+	ResetPort = "rst"
+	StartPort = "start"
+	DonePort  = "done"
+)
+
+// ChannelPort names the wire of ch a process uses: wdata, wvalid and wready
+// to send, rdata, rvalid and rready to receive, and count for len.
+func ChannelPort(ch *Channel, wire string) string {
+	return "chan_" + ch.Name + "_" + wire
+}
+
+// WaitGroupPort names the input that rises once every member of wg is done.
+func WaitGroupPort(wg *WaitGroup) string {
+	return "wg_" + wg.Name
+}
+
+// MutexPort names the req or grant wire of mu.
+func MutexPort(mu *Mutex, wire string) string {
+	return "mutex_" + mu.Name + "_" + wire
+}
+
+// SharedPort names the value of a shared register, or its we or wdata
+// wire when wire is not empty.
+func SharedPort(sig *Signal, wire string) string {
+	if wire == "" {
+		return "shared_" + sig.Name
+	}
+	return "shared_" + sig.Name + "_" + wire
+}
+
+// SpawnPort names the output that pulses when a process spawns the software
+// process callee.
+func SpawnPort(callee *Process) string {
+	return "start_" + callee.Name
+}
+
+// ArgPort names the input of proc's module that carries its idx'th param,
+// after the Go parameter it was passed as.
+func ArgPort(proc *Process, idx int) string {
+	if idx < len(proc.ParamNames) && proc.ParamNames[idx] != "" {
+		return "arg_" + proc.ParamNames[idx]
+	}
+	return "arg_" + proc.Params[idx].Name
+}
+
+// ResultPort names the output that carries result, one of a process's
+// Results.
+func ResultPort(result *Signal) string {
+	return "ret_" + result.Name
+}
+
+// Site is one goroutine of the design: the process it runs and the
+// instances, outermost first, that place the process's module. Every go
+// statement starts a goroutine of its own, so a process spawned twice has two
+// sites. A process of the top-level module has an empty Path.
+type Site struct {
+	Process *Process
+	Path    []*Instance
+}
+
+// Name names the goroutine in dumps: its instance path joined with dots, or
+// the process name for a process of the top-level module.
+func (s Site) Name() string {
+	if len(s.Path) == 0 {
+		return s.Process.Name
+	}
+	names := make([]string, len(s.Path))
+	for idx, inst := range s.Path {
+		names[idx] = inst.Name
+	}
+	return strings.Join(names, ".")
+}
+
+// Net names the top-level net that carries port of the goroutine's module,
+// <instance>_..._<port>, or port itself in the top-level module.
+func (s Site) Net(port string) string {
+	for idx := len(s.Path) - 1; idx >= 0; idx-- {
+		port = s.Path[idx].Name + "_" + port
+	}
+	return port
+}
+
+// Equal reports whether s and other are the same goroutine.
+func (s Site) Equal(other Site) bool {
+	return s.Process == other.Process && slices.Equal(s.Path, other.Path)
+}
+
+// CountType is the type of a channel's occupancy, wide enough to hold every
+// count from 0 to the depth.
+func (c *Channel) CountType() *SignalType {
+	return &SignalType{Width: FIFOCountWidth(c.Depth)}
+}
+
+// FIFOCountWidth is the width of the count output of a FIFO of the given
+// depth: enough bits to hold every occupancy from 0 to depth.
+func FIFOCountWidth(depth int) int {
+	if depth <= 0 {
+		depth = 1
+	}
+	return bits.Len(uint(depth))
+}
+
+// ProcessModuleName names the module a process of parent runs in.
+func ProcessModuleName(parent *Module, proc *Process) string {
+	return parent.Name + "__proc_" + proc.Name
+}
+
+// ComponentModuleName names the module that holds comp and runs its owner.
+func ComponentModuleName(parent *Module, comp *Component) string {
+	return parent.Name + "__comp_" + comp.Name
+}
+
+// ModuleOf returns the module whose Processes hold proc, or nil.
+func (d *Design) ModuleOf(proc *Process) *Module {
+	for _, module := range d.Modules {
+		if slices.Contains(module.Processes, proc) {
+			return module
+		}
+	}
+	return nil
+}
+
+// Processes returns every process of the design, module by module.
+func (d *Design) Processes() []*Process {
+	var procs []*Process
+	for _, module := range d.Modules {
+		procs = append(procs, module.Processes...)
+	}
+	return procs
+}
+
+// siteVisitor is called by walkSites. With a nil op it enters site, before
+// the site's operations. Otherwise op is one of the site's operations, and
+// actual maps the channel params of the site's process to the channels of
+// the top-level module. A spawn is visited after the goroutine it starts,
+// whose site is child.
+type siteVisitor func(site Site, op Operation, actual map[*Channel]*Channel, child Site)
+
+// walkSites visits every goroutine of the design, starting from the hardware
+// processes of the top-level module that no go statement spawns, and the
+// operations of each in block order. It descends into a hardware goroutine at
+// the go statement that starts it. A software goroutine is only visited as
+// the child of its spawn, with an empty path. In a flat design, whose spawns
+// have no instance, every site has an empty path.
+func walkSites(top *Module, visit siteVisitor) {
+	insts := make(map[*SpawnOperation]*Instance)
+	placed := make(map[*Module]bool)
+	var index func(*Module)
+	index = func(module *Module) {
+		for _, inst := range module.Instances {
+			if inst.Spawn != nil {
+				insts[inst.Spawn] = inst
+			}
+			if inst.Module != nil && !placed[inst.Module] {
+				placed[inst.Module] = true
+				index(inst.Module)
+			}
+		}
+	}
+	index(top)
+	spawned := make(map[*Process]bool)
+	for _, proc := range top.Processes {
+		for _, block := range proc.Blocks {
+			for _, op := range block.Ops {
+				if spawn, ok := op.(*SpawnOperation); ok && spawn.Callee != nil {
+					spawned[spawn.Callee] = true
+				}
+			}
+		}
+	}
+	active := make(map[*Process]bool)
+	var walk func(site Site, actual map[*Channel]*Channel)
+	walk = func(site Site, actual map[*Channel]*Channel) {
+		active[site.Process] = true
+		defer delete(active, site.Process)
+		visit(site, nil, actual, Site{})
+		for _, block := range site.Process.Blocks {
+			for _, op := range block.Ops {
+				var child Site
+				if spawn, ok := op.(*SpawnOperation); ok && spawn.Callee != nil {
+					child.Process = spawn.Callee
+					if spawn.Callee.Software == nil {
+						child.Path = site.Path
+						if inst := insts[spawn]; inst != nil {
+							child.Path = append(slices.Clip(site.Path), inst)
+						}
+						if !active[spawn.Callee] {
+							walk(child, spawnBinding(spawn, actual))
+						}
+					}
+				}
+				visit(site, op, actual, child)
+			}
+		}
+	}
+	for _, proc := range top.Processes {
+		if proc.Software == nil && !spawned[proc] {
+			walk(Site{Process: proc}, nil)
+		}
+	}
+}
+
+// spawnBinding maps the channel params of spawn's callee to the top-level
+// channels the go statement passes, given the binding of the spawner.
+func spawnBinding(spawn *SpawnOperation, actual map[*Channel]*Channel) map[*Channel]*Channel {
+	bound := make(map[*Channel]*Channel, len(spawn.Callee.ChanParams))
+	for idx, formal := range spawn.Callee.ChanParams {
+		if idx < len(spawn.ChanArgs) {
+			bound[formal] = actualChannel(actual, spawn.ChanArgs[idx])
+		}
+	}
+	return bound
+}
+
+// actualChannel returns the top-level channel ch stands for under actual.
+func actualChannel(actual map[*Channel]*Channel, ch *Channel) *Channel {
+	if bound, ok := actual[ch]; ok {
+		return bound
+	}
+	return ch
+}
+
+// Sites returns every goroutine of the design, each right before the
+// goroutines it spawns, in the order of the go statements.
+func (d *Design) Sites() []Site {
+	var sites []Site
+	if d.TopLevel == nil {
+		return nil
+	}
+	walkSites(d.TopLevel, func(site Site, op Operation, _ map[*Channel]*Channel, child Site) {
+		switch o := op.(type) {
+		case nil:
+			sites = append(sites, site)
+		case *SpawnOperation:
+			if o.Callee != nil && o.Callee.Software != nil {
+				sites = append(sites, child)
+			}
+		}
+	})
+	return sites
+}
+
+// channelSites maps each process to the instance path of its first
+// goroutine, so the endpoints of a channel a spawned process makes can be
+// given as its module sees them; see local.
+type channelSites map[*Process][]*Instance
+
+// enter records site if it is the first goroutine of its process.
+func (c channelSites) enter(site Site) {
+	if _, ok := c[site.Process]; !ok {
+		c[site.Process] = site.Path
+	}
+}
+
+// local returns site as the module holding ch sees it. A channel of the
+// top-level module sees every goroutine whole. A channel a spawned process
+// makes lives in that process's module, which every goroutine of the
+// process shares, so the goroutines below the first one stand for those
+// below all of them: local cuts their paths below its instance and reports
+// false for a goroutine under any other.
+func (c channelSites) local(site Site, ch *Channel) (Site, bool) {
+	if ch == nil || ch.Owner == nil {
+		return site, true
+	}
+	first, ok := c[ch.Owner]
+	if !ok || len(site.Path) < len(first) || !slices.Equal(site.Path[:len(first)], first) {
+		return site, false
+	}
+	return Site{Process: site.Process, Path: site.Path[len(first):]}, true
+}
+
+// addEndpoint records that site sends on or receives from ch through via,
+// unless local skips site.
+func (c channelSites) addEndpoint(ch *Channel, site Site, via *Channel, dir ChannelDirection) {
+	if at, ok := c.local(site, ch); ok {
+		ch.AddEndpoint(at, via, dir)
+	}
+}
+
+// linkSites rebuilds from the operations what each goroutine touches: the
+// endpoints of every channel, with software goroutines reaching theirs
+// through the top-level streams, the members of every wait group and the
+// users of every mutex.
+func linkSites(design *Design) {
+	top := design.TopLevel
+	if top == nil {
+		return
+	}
+	for _, module := range design.Modules {
+		for _, ch := range module.Channels {
+			ch.Producers, ch.Consumers = nil, nil
+		}
+		for _, wg := range module.WaitGroups {
+			wg.Members = nil
+		}
+		for _, mu := range module.Mutexes {
+			mu.Users = nil
+		}
+	}
+	sites := make(channelSites)
+	walkSites(top, func(site Site, op Operation, actual map[*Channel]*Channel, child Site) {
+		switch o := op.(type) {
+		case nil:
+			sites.enter(site)
+		case *SendOperation:
+			sites.addEndpoint(actualChannel(actual, o.Channel), site, o.Channel, ChannelSend)
+		case *RecvOperation:
+			sites.addEndpoint(actualChannel(actual, o.Channel), site, o.Channel, ChannelReceive)
+		case *LockOperation:
+			o.Mutex.AddUser(site)
+		case *SpawnOperation:
+			if o.Callee == nil {
+				return
+			}
+			if o.Callee.Software == nil {
+				for _, wg := range o.WaitGroups {
+					wg.AddMember(child)
+				}
+				return
+			}
+			for _, stream := range top.Streams {
+				if stream.Software != o.Callee {
+					continue
+				}
+				dir := ChannelReceive
+				if stream.Direction == Input {
+					dir = ChannelSend
+				}
+				stream.Channel.AddEndpoint(child, nil, dir)
+			}
+		}
+	})
+}
+
+// CountedChannels returns the channels whose occupancy a process reads with
+// len. Only their FIFOs expose a count output.
+func (d *Design) CountedChannels() map[*Channel]bool {
+	counted := make(map[*Channel]bool)
+	if d.TopLevel == nil {
+		return counted
+	}
+	walkSites(d.TopLevel, func(_ Site, op Operation, actual map[*Channel]*Channel, _ Site) {
+		if l, ok := op.(*LenOperation); ok && l.Channel != nil {
+			counted[actualChannel(actual, l.Channel)] = true
+		}
+	})
+	return counted
+}
+
+// Signals returns every signal of the design once, even when several
+// modules list it, ordered by module and then by name.
+func (d *Design) Signals() []*Signal {
+	var sigs []*Signal
+	seen := make(map[*Signal]bool)
+	for _, module := range d.Modules {
+		names := make([]string, 0, len(module.Signals))
+		for name := range module.Signals {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if sig := module.Signals[name]; !seen[sig] {
+				seen[sig] = true
+				sigs = append(sigs, sig)
+			}
+		}
+	}
+	return sigs
+}
+
+// BuildHierarchy gives every function that runs as a hardware goroutine a
+// module of its own and places it once per go statement, inside the module
+// of the process that spawns it. The root process, named after the top-level
+// module, and software processes stay in the top level, as do the wait
+// groups, mutexes, streams and the channels the root process makes. A
+// channel a spawned process makes moves into that process's module, together
+// with its FIFO. A child module lists every signal its process uses and
+// declares clk, rst, start, an arg_<param> input per param, a port for each
+// side of a channel it touches but does not hold, for each wait group, mutex
+// and shared register it touches, done, a ret_<result> output per result and
+// a start_<callee> output per software process it spawns. It also passes on
+// the ports of the instances it holds, except those of its own channels, so
+// each goroutine's channel and mutex handshakes reach the module holding the
+// channel or mutex. Shared registers stay listed in the top level too, since
+// it holds them.
+//
+// The builder translates a function once per go statement, with its channel
+// arguments as ChanParams. Processes of the same function that differ only
+// in their own signals, the channels they make and their channel params are
+// merged into one, and each go statement binds its channels through the
+// instance's connections. Copies that differ otherwise, for instance because
+// they wait on different wait groups or use other shared registers, keep a
+// module each.
+//
+// A component moves with the process that owns it, so its fields are
+// registers of that module only, and the module is named after the
+// component: go c.Run(in) on a Counter runs in <top>__comp_counter. A
+// component owned by the root process, or by no process, stays in the top
+// level.
+//
+// Child modules are ordered by name, with a numeric suffix on a name another
+// module already has. Instances are named <process>_inst<n>, numbered in
+// each parent in the order of its go statements. The design is flattened
+// first, so BuildHierarchy can run again after a pass changes what a process
+// touches.
+func BuildHierarchy(design *Design) {
+	top := design.TopLevel
+	if top == nil {
+		return
+	}
+	flattenHierarchy(design)
+	mergeClones(top)
+
+	var children []*Process
+	kept := top.Processes[:0]
+	for _, proc := range top.Processes {
+		if proc.Software == nil && proc.Name != top.Name {
+			children = append(children, proc)
+			continue
+		}
+		kept = append(kept, proc)
+	}
+	top.Processes = kept
+
+	owned := make(map[*Process][]*Component)
+	for _, name := range sortedKeys(top.Components) {
+		comp := top.Components[name]
+		if comp.Owner != nil && slices.Contains(children, comp.Owner) {
+			owned[comp.Owner] = append(owned[comp.Owner], comp)
+			delete(top.Components, name)
+		}
+	}
+	baseName := func(proc *Process) string {
+		if comps := owned[proc]; len(comps) > 0 {
+			return ComponentModuleName(top, comps[0])
+		}
+		return ProcessModuleName(top, proc)
+	}
+	sort.SliceStable(children, func(i, j int) bool {
+		return baseName(children[i]) < baseName(children[j])
+	})
+	taken := make(map[string]bool)
+	for _, module := range design.Modules {
+		taken[module.Name] = true
+	}
+	moduleNames := make(map[*Process]string, len(children))
+	for _, proc := range children {
+		name := baseName(proc)
+		for n := 1; taken[name]; n++ {
+			name = fmt.Sprintf("%s_%d", baseName(proc), n)
+		}
+		taken[name] = true
+		moduleNames[proc] = name
+	}
+
+	users := signalUsers(append(slices.Clone(top.Processes), children...))
+	fields := make(map[*Signal]bool)
+	for _, comp := range top.Components {
+		for _, field := range comp.Fields {
+			fields[field] = true
+		}
+	}
+	moved := make(map[*Signal]bool)
+	for _, comps := range owned {
+		for _, comp := range comps {
+			for _, field := range comp.Fields {
+				moved[field] = true
+			}
+		}
+	}
+	signals := top.Signals
+	top.Signals = make(map[string]*Signal)
+	for name, sig := range signals {
+		if moved[sig] {
+			continue
+		}
+		procs := users[sig]
+		inTop := len(procs) == 0 || sig.Kind == Shared || fields[sig]
+		for _, proc := range procs {
+			inTop = inTop || slices.Contains(top.Processes, proc)
+		}
+		if inTop {
+			top.Signals[name] = sig
+		}
+	}
+
+	modules := make(map[*Process]*Module, len(children))
+	for _, proc := range children {
+		child := &Module{
+			Name:       moduleNames[proc],
+			Signals:    make(map[string]*Signal),
+			Channels:   make(map[string]*Channel),
+			WaitGroups: make(map[string]*WaitGroup),
+			Components: make(map[string]*Component),
+			Mutexes:    make(map[string]*Mutex),
+			Processes:  []*Process{proc},
+			Source:     top.Source,
+		}
+		for _, sig := range processSignals(proc) {
+			child.Signals[sig.Name] = sig
+		}
+		for _, comp := range owned[proc] {
+			child.Components[comp.Name] = comp
+			for _, field := range comp.Fields {
+				child.Signals[field.Name] = field
+			}
+		}
+		modules[proc] = child
+		design.Modules = append(design.Modules, child)
+	}
+	for name, ch := range top.Channels {
+		if child := modules[ch.Owner]; child != nil {
+			child.Channels[name] = ch
+			delete(top.Channels, name)
+		}
+	}
+
+	for _, parent := range append(slices.Clone(top.Processes), children...) {
+		into := top
+		if module := modules[parent]; module != nil {
+			into = module
+		}
+		for _, block := range parent.Blocks {
+			for _, op := range block.Ops {
+				spawn, ok := op.(*SpawnOperation)
+				if !ok || spawn.Callee == nil || modules[spawn.Callee] == nil {
+					continue
+				}
+				into.Instances = append(into.Instances, &Instance{
+					Name:   fmt.Sprintf("%s_inst%d", spawn.Callee.Name, len(into.Instances)),
+					Module: modules[spawn.Callee],
+					Spawn:  spawn,
+				})
+			}
+		}
+	}
+
+	ports := make(map[*Process][]modulePort, len(children))
+	var portsOf func(*Process) []modulePort
+	portsOf = func(proc *Process) []modulePort {
+		if p, ok := ports[proc]; ok {
+			return p
+		}
+		ports[proc] = nil
+		p := processPorts(proc, modules[proc].Instances, portsOf)
+		ports[proc] = p
+		return p
+	}
+	for _, proc := range children {
+		module := modules[proc]
+		for _, port := range portsOf(proc) {
+			module.Ports = append(module.Ports, port.Port)
+		}
+	}
+	for _, module := range design.Modules {
+		for _, inst := range module.Instances {
+			inst.Connections = connectInstance(inst, portsOf(inst.Spawn.Callee), module == top)
+		}
+	}
+	linkSites(design)
+}
+
+// claimChannels makes the process of every process module the owner of the
+// channels the module holds, as BuildHierarchy placed them there.
+func claimChannels(design *Design) {
+	for _, module := range design.Modules {
+		if module == design.TopLevel || len(module.Processes) != 1 {
+			continue
+		}
+		for _, ch := range module.Channels {
+			ch.Owner = module.Processes[0]
+		}
+	}
+}
+
+// flattenHierarchy moves the processes, signals, components and channels of
+// every module placed below the top level back into it and drops those
+// modules.
+func flattenHierarchy(design *Design) {
+	top := design.TopLevel
+	placed := make(map[*Module]bool)
+	var flatten func(*Module)
+	flatten = func(module *Module) {
+		for _, inst := range module.Instances {
+			child := inst.Module
+			if child == nil || placed[child] {
+				continue
+			}
+			placed[child] = true
+			top.Processes = append(top.Processes, child.Processes...)
+			for name, sig := range child.Signals {
+				if top.Signals[name] == nil {
+					top.Signals[name] = sig
+				}
+			}
+			for name, comp := range child.Components {
+				top.Components[name] = comp
+			}
+			for name, ch := range child.Channels {
+				top.Channels[name] = ch
+			}
+			flatten(child)
+		}
+		module.Instances = nil
+	}
+	flatten(top)
+	modules := design.Modules[:0]
+	for _, module := range design.Modules {
+		if !placed[module] {
+			modules = append(modules, module)
+		}
+	}
+	design.Modules = modules
+}
+
+// signalUsers maps every signal the processes use to the processes using it.
+func signalUsers(procs []*Process) map[*Signal][]*Process {
+	users := make(map[*Signal][]*Process)
+	for _, proc := range procs {
+		for _, sig := range processSignals(proc) {
+			users[sig] = append(users[sig], proc)
+		}
+	}
+	return users
+}
+
+// mergeClones folds the processes the builder made for separate go
+// statements of one function into the first of them when they match but for
+// their own signals, the channels they make and their channel params, and
+// spawns the survivor in their place. Merging the goroutines a function
+// spawns can make its own copies match, so it repeats until nothing merges.
+// It then drops the hardware processes the root process no longer reaches,
+// with the signals only they used and the channels they made.
+func mergeClones(top *Module) {
+	owners := make(map[*Process]bool)
+	for _, comp := range top.Components {
+		owners[comp.Owner] = true
+	}
+	for {
+		users := signalUsers(top.Processes)
+		global := make(map[*Signal]bool)
+		for sig, procs := range users {
+			global[sig] = len(procs) > 1 || sig.Kind == Shared
+		}
+		for _, comp := range top.Components {
+			for _, field := range comp.Fields {
+				global[field] = true
+			}
+		}
+		var reps []*Process
+		merged := make(map[*Process]*Process)
+		for _, proc := range top.Processes {
+			if proc.Software != nil || proc.Name == top.Name || owners[proc] || !proc.Source.IsValid() {
+				continue
+			}
+			idx := slices.IndexFunc(reps, func(rep *Process) bool {
+				return rep.Source == proc.Source && sameProcess(rep, proc, global)
+			})
+			if idx < 0 {
+				reps = append(reps, proc)
+				continue
+			}
+			merged[proc] = reps[idx]
+			reps[idx].Stage = min(reps[idx].Stage, proc.Stage)
+		}
+		if len(merged) == 0 {
+			break
+		}
+		for _, proc := range top.Processes {
+			for _, block := range proc.Blocks {
+				for _, op := range block.Ops {
+					if spawn, ok := op.(*SpawnOperation); ok && merged[spawn.Callee] != nil {
+						spawn.Callee = merged[spawn.Callee]
+					}
+				}
+			}
+		}
+		dropProcesses(top, func(proc *Process) bool { return merged[proc] != nil })
+	}
+
+	reached := make(map[*Process]bool)
+	var reach func(*Process)
+	reach = func(proc *Process) {
+		if reached[proc] {
+			return
+		}
+		reached[proc] = true
+		for _, block := range proc.Blocks {
+			for _, op := range block.Ops {
+				if spawn, ok := op.(*SpawnOperation); ok && spawn.Callee != nil {
+					reach(spawn.Callee)
+				}
+			}
+		}
+	}
+	for _, proc := range top.Processes {
+		if proc.Software == nil && proc.Name == top.Name {
+			reach(proc)
+		}
+	}
+	if len(reached) == 0 {
+		return
+	}
+	dropProcesses(top, func(proc *Process) bool {
+		return proc.Software == nil && !reached[proc]
+	})
+}
+
+// dropProcesses removes the processes drop selects from top, together with
+// the signals no other process uses and the channels they made.
+func dropProcesses(top *Module, drop func(*Process) bool) {
+	users := signalUsers(top.Processes)
+	kept := top.Processes[:0]
+	for _, proc := range top.Processes {
+		if !drop(proc) {
+			kept = append(kept, proc)
+		}
+	}
+	top.Processes = kept
+	for name, sig := range top.Signals {
+		procs := users[sig]
+		if len(procs) > 0 && !slices.ContainsFunc(procs, func(proc *Process) bool { return !drop(proc) }) {
+			delete(top.Signals, name)
+		}
+	}
+	for name, ch := range top.Channels {
+		if ch.Owner != nil && drop(ch.Owner) {
+			delete(top.Channels, name)
+		}
+	}
+}
+
+// sameProcess reports whether a and b run the same code. Signals in global
+// must be the same in both; any other signal of a must correspond to exactly
+// one of b with the same kind, type and value. The channel params of a must
+// line up with those of b, a channel a makes must correspond to exactly one
+// b makes with the same type, depth and arbitration, and any other channel,
+// wait group, mutex or callee must be the same.
+func sameProcess(a, b *Process, global map[*Signal]bool) bool {
+	if a.Sensitivity != b.Sensitivity || len(a.Blocks) != len(b.Blocks) ||
+		len(a.Params) != len(b.Params) || len(a.Results) != len(b.Results) ||
+		!slices.Equal(a.ParamNames, b.ParamNames) || len(a.ChanParams) != len(b.ChanParams) {
+		return false
+	}
+	m := &processMatch{
+		procs:    [2]*Process{a, b},
+		global:   global,
+		sigs:     make(map[*Signal]*Signal),
+		rev:      make(map[*Signal]*Signal),
+		chans:    make(map[*Channel]*Channel),
+		revChans: make(map[*Channel]*Channel),
+	}
+	for idx, formal := range a.ChanParams {
+		other := b.ChanParams[idx]
+		if formal.Name != other.Name || !formal.Type.Equal(other.Type) || formal.Depth != other.Depth {
+			return false
+		}
+		m.chans[formal], m.revChans[other] = other, formal
+	}
+	if !m.signalList(a.Params, b.Params) || !m.signalList(a.Results, b.Results) {
+		return false
+	}
+	index := func(blocks []*BasicBlock, block *BasicBlock) int {
+		return slices.Index(blocks, block)
+	}
+	for idx, block := range a.Blocks {
+		other := b.Blocks[idx]
+		if block.Label != other.Label || block.LoopHeader != other.LoopHeader ||
+			block.TripCount != other.TripCount || len(block.Ops) != len(other.Ops) {
+			return false
+		}
+		for i, op := range block.Ops {
+			if !m.operation(op, other.Ops[i], func(x, y *BasicBlock) bool {
+				return index(a.Blocks, x) == index(b.Blocks, y)
+			}) {
+				return false
+			}
+		}
+		switch t := block.Terminator.(type) {
+		case *BranchTerminator:
+			u, ok := other.Terminator.(*BranchTerminator)
+			if !ok || !m.signal(t.Cond, u.Cond) ||
+				index(a.Blocks, t.True) != index(b.Blocks, u.True) ||
+				index(a.Blocks, t.False) != index(b.Blocks, u.False) {
+				return false
+			}
+		case *JumpTerminator:
+			u, ok := other.Terminator.(*JumpTerminator)
+			if !ok || index(a.Blocks, t.Target) != index(b.Blocks, u.Target) {
+				return false
+			}
+		default:
+			if reflect.TypeOf(block.Terminator) != reflect.TypeOf(other.Terminator) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// processMatch pairs the signals and channels of procs, the two processes
+// that sameProcess compares.
+type processMatch struct {
+	procs    [2]*Process
+	global   map[*Signal]bool
+	sigs     map[*Signal]*Signal
+	rev      map[*Signal]*Signal
+	chans    map[*Channel]*Channel
+	revChans map[*Channel]*Channel
+}
+
+func (m *processMatch) signal(a, b *Signal) bool {
+	if a == nil || b == nil || m.global[a] || m.global[b] {
+		return a == b
+	}
+	if to, ok := m.sigs[a]; ok {
+		return to == b
+	}
+	if _, ok := m.rev[b]; ok {
+		return false
+	}
+	if a.Kind != b.Kind || a.Type.Description() != b.Type.Description() ||
+		a.Type.Enum != b.Type.Enum || !reflect.DeepEqual(a.Value, b.Value) {
+		return false
+	}
+	m.sigs[a], m.rev[b] = b, a
+	return true
+}
+
+func (m *processMatch) signalList(a, b []*Signal) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for idx := range a {
+		if !m.signal(a[idx], b[idx]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *processMatch) channel(a, b *Channel) bool {
+	if to, ok := m.chans[a]; ok {
+		return to == b
+	}
+	if _, ok := m.revChans[b]; ok {
+		return false
+	}
+	if a == b {
+		return true
+	}
+	if a == nil || b == nil || a.Owner != m.procs[0] || b.Owner != m.procs[1] || !a.Type.Equal(b.Type) ||
+		a.Depth != b.Depth || a.Arbitration != b.Arbitration {
+		return false
+	}
+	m.chans[a], m.revChans[b] = b, a
+	return true
+}
+
+func (m *processMatch) operation(a, b Operation, sameBlock func(x, y *BasicBlock) bool) bool {
+	if reflect.TypeOf(a) != reflect.TypeOf(b) || !m.signalList(operationSignals(a), operationSignals(b)) {
+		return false
+	}
+	switch x := a.(type) {
+	case *BinOperation:
+		return x.Op == b.(*BinOperation).Op
+	case *CompareOperation:
+		return x.Predicate == b.(*CompareOperation).Predicate
+	case *FloatOperation:
+		return x.Op == b.(*FloatOperation).Op
+	case *PhiOperation:
+		y := b.(*PhiOperation)
+		for idx, in := range x.Incomings {
+			if !sameBlock(in.Block, y.Incomings[idx].Block) {
+				return false
+			}
+		}
+	case *PrintOperation:
+		y := b.(*PrintOperation)
+		if len(x.Segments) != len(y.Segments) {
+			return false
+		}
+		for idx, seg := range x.Segments {
+			other := y.Segments[idx]
+			if seg.Text != other.Text || seg.Verb != other.Verb || (seg.Value == nil) != (other.Value == nil) {
+				return false
+			}
+		}
+	case *AssertOperation:
+		y := b.(*AssertOperation)
+		return x.Message == y.Message && x.Location == y.Location && (x.Cond == nil) == (y.Cond == nil)
+	case *SendOperation:
+		return m.channel(x.Channel, b.(*SendOperation).Channel)
+	case *RecvOperation:
+		return m.channel(x.Channel, b.(*RecvOperation).Channel)
+	case *LenOperation:
+		return m.channel(x.Channel, b.(*LenOperation).Channel)
+	case *SpawnOperation:
+		y := b.(*SpawnOperation)
+		if x.Callee != y.Callee || len(x.ChanArgs) != len(y.ChanArgs) || !slices.Equal(x.WaitGroups, y.WaitGroups) {
+			return false
+		}
+		for idx, ch := range x.ChanArgs {
+			if !m.channel(ch, y.ChanArgs[idx]) {
+				return false
+			}
+		}
+	case *WaitOperation:
+		return x.Group == b.(*WaitOperation).Group
+	case *LockOperation:
+		return x.Mutex == b.(*LockOperation).Mutex
+	case *UnlockOperation:
+		return x.Mutex == b.(*UnlockOperation).Mutex
+	}
+	return true
+}
+
+// portKind says what a process module's port carries, and so what the
+// module placing it connects it to.
+type portKind int
+
+const (
+	// portGlobal is clk or rst, connected to the net of the same name.
+	portGlobal portKind = iota
+	portStart
+	portArg
+	// portCount is the count of a channel, portWait the release of a wait
+	// group and portShared the value of a shared register. Every goroutine
+	// sees the same net.
+	portCount
+	portWait
+	portShared
+	portDone
+	portResult
+	// portLocal is a handshake, spawn pulse or passed-on port of one
+	// goroutine, connected to a net of its own.
+	portLocal
+)
+
+// modulePort is a port of a process module together with what it carries:
+// the param index of an arg port, the channel, as the process names it, of a
+// count or handshake port, the wait group of a release and the register of a
+// shared value.
+type modulePort struct {
+	Port
+	kind    portKind
+	index   int
+	channel *Channel
+	group   *WaitGroup
+	signal  *Signal
+}
+
+// processPorts lists the ports of the module proc runs in, which holds
+// insts. childPorts returns the ports of the module of a spawned process.
+// The channels proc makes are wired inside the module, so neither proc's
+// handshakes on them nor those of the instances become ports.
+func processPorts(proc *Process, insts []*Instance, childPorts func(*Process) []modulePort) []modulePort {
+	bit := &SignalType{Width: 1}
+	var ports []modulePort
+	add := func(port modulePort) {
+		if slices.ContainsFunc(ports, func(p modulePort) bool { return p.Name == port.Name }) {
+			return
+		}
+		port.Type = port.Type.Clone()
+		ports = append(ports, port)
+	}
+	port := func(name string, dir PortDirection, typ *SignalType, kind portKind) modulePort {
+		return modulePort{Port: Port{Name: name, Direction: dir, Type: typ}, kind: kind}
+	}
+	add(port(ClockPort, Input, bit, portGlobal))
+	add(port(ResetPort, Input, bit, portGlobal))
+	add(port(StartPort, Input, bit, portStart))
+	for idx, param := range proc.Params {
+		arg := port(ArgPort(proc, idx), Input, param.Type, portArg)
+		arg.index = idx
+		add(arg)
+	}
+
+	var waits []*WaitGroup
+	var mutexes []*Mutex
+	var spawns []*Process
+	roles := make(map[*Channel]*[3]bool)
+	writes := make(map[*Signal]bool)
+	role := func(ch *Channel, idx int) {
+		if roles[ch] == nil {
+			roles[ch] = new([3]bool)
+		}
+		roles[ch][idx] = true
+	}
+	for _, block := range proc.Blocks {
+		for _, op := range block.Ops {
+			switch o := op.(type) {
+			case *WaitOperation:
+				if !slices.Contains(waits, o.Group) {
+					waits = append(waits, o.Group)
+				}
+			case *SendOperation:
+				role(o.Channel, 0)
+			case *RecvOperation:
+				role(o.Channel, 1)
+			case *LenOperation:
+				role(o.Channel, 2)
+			case *LockOperation:
+				if !slices.Contains(mutexes, o.Mutex) {
+					mutexes = append(mutexes, o.Mutex)
+				}
+			case *AssignOperation:
+				if o.Dest.Kind == Shared {
+					writes[o.Dest] = true
+				}
+			case *SpawnOperation:
+				if o.Callee.Software != nil && !slices.Contains(spawns, o.Callee) {
+					spawns = append(spawns, o.Callee)
+				}
+			}
+		}
+	}
+	// bound maps a child's channel to the channel proc names it by.
+	bound := func(inst *Instance, ch *Channel) *Channel {
+		if idx := slices.Index(inst.Spawn.Callee.ChanParams, ch); idx >= 0 && idx < len(inst.Spawn.ChanArgs) {
+			return inst.Spawn.ChanArgs[idx]
+		}
+		return ch
+	}
+	local := func(ch *Channel) bool {
+		return ch != nil && ch.Owner == proc
+	}
+
+	for _, wg := range waits {
+		wait := port(WaitGroupPort(wg), Input, bit, portWait)
+		wait.group = wg
+		add(wait)
+	}
+	for _, inst := range insts {
+		for _, p := range childPorts(inst.Spawn.Callee) {
+			if p.kind == portWait {
+				add(p)
+			}
+		}
+	}
+	channels := make([]*Channel, 0, len(roles))
+	for ch := range roles {
+		if !local(ch) {
+			channels = append(channels, ch)
+		}
+	}
+	sort.Slice(channels, func(i, j int) bool {
+		return channels[i].Name < channels[j].Name
+	})
+	count := func(ch *Channel) modulePort {
+		p := port(ChannelPort(ch, "count"), Input, ch.CountType(), portCount)
+		p.channel = ch
+		return p
+	}
+	for _, ch := range channels {
+		r := roles[ch]
+		wire := func(name string, typ *SignalType) {
+			p := port(ChannelPort(ch, name), InOut, typ, portLocal)
+			p.channel = ch
+			add(p)
+		}
+		wires := func(data, valid, ready string) {
+			wire(data, ch.Type)
+			wire(valid, bit)
+			wire(ready, bit)
+		}
+		if r[0] {
+			wires("wdata", "wvalid", "wready")
+		}
+		if r[1] {
+			wires("rdata", "rvalid", "rready")
+		}
+		if r[2] {
+			add(count(ch))
+		}
+	}
+	for _, inst := range insts {
+		for _, p := range childPorts(inst.Spawn.Callee) {
+			if p.kind == portCount && !local(bound(inst, p.channel)) {
+				add(count(bound(inst, p.channel)))
+			}
+		}
+	}
+	for _, mu := range mutexes {
+		add(port(MutexPort(mu, "req"), InOut, bit, portLocal))
+		add(port(MutexPort(mu, "grant"), InOut, bit, portLocal))
+	}
+	var shared []*Signal
+	for _, sig := range processSignals(proc) {
+		if sig.Kind == Shared {
+			shared = append(shared, sig)
+		}
+	}
+	sort.Slice(shared, func(i, j int) bool {
+		return shared[i].Name < shared[j].Name
+	})
+	for _, sig := range shared {
+		value := port(SharedPort(sig, ""), Input, sig.Type, portShared)
+		value.signal = sig
+		add(value)
+		if writes[sig] {
+			add(port(SharedPort(sig, "we"), InOut, bit, portLocal))
+			add(port(SharedPort(sig, "wdata"), InOut, sig.Type, portLocal))
+		}
+	}
+	for _, inst := range insts {
+		for _, p := range childPorts(inst.Spawn.Callee) {
+			if p.kind == portShared {
+				add(p)
+			}
+		}
+	}
+	for _, inst := range insts {
+		for _, p := range childPorts(inst.Spawn.Callee) {
+			if p.kind != portLocal || p.Direction != InOut || local(bound(inst, p.channel)) {
+				continue
+			}
+			passed := port(inst.Name+"_"+p.Name, InOut, p.Type, portLocal)
+			if p.channel != nil {
+				passed.channel = bound(inst, p.channel)
+			}
+			add(passed)
+		}
+	}
+
+	add(port(DonePort, Output, bit, portDone))
+	for _, result := range proc.Results {
+		add(port(ResultPort(result), Output, result.Type, portResult))
+	}
+	for _, callee := range spawns {
+		add(port(SpawnPort(callee), Output, bit, portLocal))
+	}
+	for _, inst := range insts {
+		for _, p := range childPorts(inst.Spawn.Callee) {
+			passed := p.kind == portLocal && p.Direction == Output ||
+				p.kind == portDone && len(inst.Spawn.WaitGroups) > 0
+			if passed {
+				add(port(inst.Name+"_"+p.Name, Output, p.Type, portLocal))
+			}
+		}
+	}
+	return ports
+}
+
+// connectInstance connects the ports of inst's module to the nets of the
+// module placing it; atTop says whether that is the top-level module, where
+// a wait group is released on wg_<group>_release.
+func connectInstance(inst *Instance, ports []modulePort, atTop bool) []Connection {
+	spawn := inst.Spawn
+	conns := make([]Connection, 0, len(ports))
+	for _, p := range ports {
+		net := inst.Name + "_" + p.Name
+		switch p.kind {
+		case portGlobal:
+			net = p.Name
+		case portStart:
+			net = inst.Name + "_" + StartPort
+		case portArg:
+			if p.index < len(spawn.Args) {
+				net = spawn.Args[p.index].Name
+			}
+		case portCount:
+			ch := p.channel
+			if idx := slices.Index(spawn.Callee.ChanParams, ch); idx >= 0 && idx < len(spawn.ChanArgs) {
+				ch = spawn.ChanArgs[idx]
+			}
+			net = ChannelPort(ch, "count")
+		case portWait:
+			net = WaitGroupPort(p.group)
+			if atTop {
+				net += "_release"
+			}
+		case portShared:
+			net = SharedPort(p.signal, "")
+		}
+		conns = append(conns, Connection{Port: p.Name, Net: net})
+	}
+	return conns
+}
+
+// processSignals returns proc's params and the distinct signals its
+// operations and branches use, in the order they first appear.
+func processSignals(proc *Process) []*Signal {
+	var sigs []*Signal
+	seen := make(map[*Signal]bool)
+	add := func(sig *Signal) {
+		if sig != nil && !seen[sig] {
+			seen[sig] = true
+			sigs = append(sigs, sig)
+		}
+	}
+	for _, param := range proc.Params {
+		add(param)
+	}
+	for _, block := range proc.Blocks {
+		for _, op := range block.Ops {
+			for _, sig := range operationSignals(op) {
+				add(sig)
+			}
+		}
+		if br, ok := block.Terminator.(*BranchTerminator); ok {
+			add(br.Cond)
+		}
+	}
+	return sigs
+}
@@ -3,22 +3,85 @@ package ir
 import (
 	"fmt"
 	"go/token"
+	"path/filepath"
+	"slices"
 )
 
 // Design is the top-level hardware description consisting of one or more modules.
 type Design struct {
 	Modules  []*Module
 	TopLevel *Module
+	// Fset resolves the Source positions in the design. It is nil for a
+	// design parsed from text, which has none.
+	Fset *token.FileSet
+	// Root is the directory of the main package. Source file names are
+	// given relative to it, so main.go is just main.go, as in the messages
+	// of assertions.
+	Root string
+	// FloatMode selects how the generated float32 units treat subnormals.
+	FloatMode FloatMode
+}
+
+// SourceName returns filename relative to Root with forward slashes, or
+// filename unchanged when there is no Root or no relative path to it.
+func (d *Design) SourceName(filename string) string {
+	if d.Root == "" {
+		return filename
+	}
+	rel, err := filepath.Rel(d.Root, filename)
+	if err != nil {
+		return filename
+	}
+	return filepath.ToSlash(rel)
+}
+
+// FloatMode configures the float32 arithmetic units.
+type FloatMode int
+
+const (
+	// FloatIEEE rounds to nearest even and keeps subnormals, matching Go's
+	// float32 arithmetic bit for bit.
+	FloatIEEE FloatMode = iota
+	// FloatFlushToZero rounds to nearest even but treats subnormal inputs
+	// and results as zero, which gives smaller units.
+	FloatFlushToZero
+)
+
+func (m FloatMode) String() string {
+	if m == FloatFlushToZero {
+		return "ftz"
+	}
+	return "ieee"
+}
+
+// ParseFloatMode maps a command-line spelling to a FloatMode.
+func ParseFloatMode(s string) (FloatMode, error) {
+	switch s {
+	case "", "ieee":
+		return FloatIEEE, nil
+	case "ftz":
+		return FloatFlushToZero, nil
+	}
+	return FloatIEEE, fmt.Errorf("unknown float mode %q (want ieee or ftz)", s)
 }
 
 // Module models a hardware module with ports, signals and processes.
 type Module struct {
-	Name      string
-	Ports     []Port
-	Signals   map[string]*Signal
-	Channels  map[string]*Channel
-	Processes []*Process
-	Source    token.Pos
+	Name       string
+	Ports      []Port
+	Signals    map[string]*Signal
+	Channels   map[string]*Channel
+	WaitGroups map[string]*WaitGroup
+	Components map[string]*Component
+	Mutexes    map[string]*Mutex
+	Processes  []*Process
+	// Instances are the process modules placed in this one; see
+	// BuildHierarchy.
+	Instances []*Instance
+	// Streams lists the channels that cross to software goroutines; each
+	// has its own top-level ports.
+	Streams []*Stream
+	Source  token.Pos
 }
 
 // Port represents a module IO port.
@@ -46,23 +109,136 @@ type Signal struct {
 	Source token.Pos
 }
 
-// Channel models a FIFO-style buffered channel between processes.
+// Channel models a channel between processes. Buffered channels lower to a
+// FIFO of Depth entries; a Depth of 0 is an unbuffered rendezvous. Owner is
+// the process that makes the channel. BuildHierarchy moves a channel a
+// spawned process makes into that process's module, and its endpoints are
+// then the goroutines of that module.
 type Channel struct {
 	Name      string
 	Type      *SignalType
 	Depth     int
 	Occupancy int
+	Owner     *Process
 	Source    token.Pos
 	Producers []*ChannelEndpoint
 	Consumers []*ChannelEndpoint
+	// Arbitration selects how several producers or consumers take turns.
+	Arbitration Arbitration
+}
+
+// Arbitration is the policy used to share one side of a channel between
+// several processes.
+type Arbitration int
+
+const (
+	// ArbitrateRoundRobin grants the next requester after the last winner.
+	ArbitrateRoundRobin Arbitration = iota
+	// ArbitratePriority always grants the requester spawned first.
+	ArbitratePriority
+)
+
+func (a Arbitration) String() string {
+	if a == ArbitratePriority {
+		return "priority"
+	}
+	return "round_robin"
+}
+
+// ProducerPorts returns the distinct ports that send on the channel, in the
+// order they were first seen. Each one needs a write port of its own.
+func (c *Channel) ProducerPorts() []*ChannelEndpoint {
+	return distinctEndpoints(c.Producers)
+}
+
+// ConsumerPorts returns the distinct ports that receive from the channel, in
+// the order they were first seen.
+func (c *Channel) ConsumerPorts() []*ChannelEndpoint {
+	return distinctEndpoints(c.Consumers)
+}
+
+func distinctEndpoints(endpoints []*ChannelEndpoint) []*ChannelEndpoint {
+	var distinct []*ChannelEndpoint
+	for _, ep := range endpoints {
+		if ep == nil || ep.Process == nil || slices.ContainsFunc(distinct, ep.samePort) {
+			continue
+		}
+		distinct = append(distinct, ep)
+	}
+	return distinct
 }
 
-// ChannelEndpoint records how a process interacts with a channel.
+// Unbuffered reports whether the channel has no storage, so each transfer
+// completes only when producer and consumer are ready in the same cycle.
+func (c *Channel) Unbuffered() bool {
+	return c != nil && c.Depth == 0
+}
+
+// WaitGroup models a sync.WaitGroup as a completion barrier. Count is the
+// constant total passed to Add; Members are the goroutines spawned with the
+// group, each of which calls Done once before it returns.
+type WaitGroup struct {
+	Name    string
+	Count   int
+	Members []Site
+	Source  token.Pos
+}
+
+// AddMember records site as a participant of the barrier.
+func (wg *WaitGroup) AddMember(site Site) {
+	if wg == nil || site.Process == nil || slices.ContainsFunc(wg.Members, site.Equal) {
+		return
+	}
+	wg.Members = append(wg.Members, site)
+}
+
+// Mutex models a sync.Mutex as a request/grant arbiter. Users are the
+// goroutines that lock it, in the order their first Lock was seen; the
+// arbiter grants it to one of them at a time and keeps the grant until the
+// holder unlocks.
+type Mutex struct {
+	Name        string
+	Users       []Site
+	Arbitration Arbitration
+	Source      token.Pos
+}
+
+// AddUser records site as a goroutine that locks the mutex.
+func (m *Mutex) AddUser(site Site) {
+	if m == nil || site.Process == nil || slices.ContainsFunc(m.Users, site.Equal) {
+		return
+	}
+	m.Users = append(m.Users, site)
+}
+
+// Component is an instance of a struct type whose methods run as hardware.
+// Each field becomes a register in Fields, initialised from Value and written
+// only by Owner, the process that runs the instance's methods. Owner is nil
+// until a method is started or a field is used outside an initialiser.
+// BuildHierarchy moves a component into the module its owner runs in.
+type Component struct {
+	Name   string
+	Type   string
+	Fields []*Signal
+	Owner  *Process
+	Source token.Pos
+}
+
+// ChannelEndpoint records how a goroutine interacts with a channel. Via is
+// the channel as the goroutine's process names it: one of its ChanParams, or
+// the channel itself.
 type ChannelEndpoint struct {
-	Process   *Process
+	Site
+	Via       *Channel
 	Direction ChannelDirection
 }
 
+// samePort reports whether ep and other reach the channel through the same
+// port of the same goroutine.
+func (ep *ChannelEndpoint) samePort(other *ChannelEndpoint) bool {
+	return ep.Site.Equal(other.Site) && ep.Via == other.Via
+}
+
 // ChannelDirection distinguishes send vs. receive endpoints.
 type ChannelDirection int
 
@@ -75,6 +251,53 @@ const (
 type SignalType struct {
 	Width  int
 	Signed bool
+	// Enum names the values of a named constant type, such as an FSM state
+	// declared with iota. It is nil for plain integers.
+	Enum *EnumType
+	// Float marks a float32 held as its IEEE-754 bit pattern.
+	Float bool
+}
+
+// IntValue converts an integer constant value stored on a Signal to int64.
+func IntValue(v interface{}) (int64, bool) {
+	switch n := v.(type) {
+	case int64:
+		return n, true
+	case uint64:
+		return int64(n), true
+	case bool:
+		if n {
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// EnumType records a named integer type and the constants declared with it.
+type EnumType struct {
+	Name    string
+	Members []EnumMember
+}
+
+// EnumMember is one named value of an enum.
+type EnumMember struct {
+	Name  string
+	Value int64
+}
+
+// MemberFor returns the name of the member holding value, or "" when none
+// does.
+func (e *EnumType) MemberFor(value int64) string {
+	if e == nil {
+		return ""
+	}
+	for _, member := range e.Members {
+		if member.Value == value {
+			return member.Name
+		}
+	}
+	return ""
 }
 
 // Clone returns a deep copy of the signal type.
@@ -169,6 +392,9 @@ func (t *SignalType) Description() string {
 	if t == nil || t.IsUnknown() {
 		return "<unknown>"
 	}
+	if t.Float {
+		return "f32"
+	}
 	sign := "u"
 	if t.Signed {
 		sign = "s"
@@ -183,13 +409,18 @@ func maxInt(a, b int) int {
 	return b
 }
 
-// AddEndpoint attaches metadata describing how the channel is used.
-func (c *Channel) AddEndpoint(proc *Process, dir ChannelDirection) {
-	if c == nil || proc == nil {
+// AddEndpoint records that site sends on or receives from the channel
+// through via. A nil via is the channel itself.
+func (c *Channel) AddEndpoint(site Site, via *Channel, dir ChannelDirection) {
+	if c == nil || site.Process == nil {
 		return
 	}
+	if via == nil {
+		via = c
+	}
 	endpoint := &ChannelEndpoint{
-		Process:   proc,
+		Site:      site,
+		Via:       via,
 		Direction: dir,
 	}
 	switch dir {
@@ -207,14 +438,71 @@ const (
 	Wire SignalKind = iota
 	Reg
 	Const
+	// Shared is a register that several processes read and write while
+	// holding a mutex. It lives in the top-level module.
+	Shared
 )
 
 // Process groups a sequence of operations under a specific clocking scheme.
+// A software process has no blocks; Software says how co-simulation starts it
+// in Go.
 type Process struct {
 	Name        string
 	Sensitivity Sensitivity
 	Blocks      []*BasicBlock
 	Stage       int
+	Software    *SoftwareBinding
+	// Params are the wires a spawned process reads its scalar arguments
+	// from. Each is an input port of the process module, arg_<name> after
+	// the matching entry of ParamNames, driven by the matching entry of the
+	// spawning SpawnOperation's Args.
+	Params     []*Signal
+	ParamNames []string
+	// ChanParams are the channels a spawned process takes as arguments. Its
+	// operations name them instead of the channels a go statement passes,
+	// so every goroutine of one function can share a module; each spawn
+	// binds them to the matching entry of its ChanArgs.
+	ChanParams []*Channel
+	// Results are the wires that hold the values a spawned function
+	// returns. The process drives each once, in the block every return
+	// jumps to, and its module exposes them as output ports.
+	Results []*Signal
+	// Source is the position of the function the process runs.
+	Source token.Pos
+}
+
+// SoftwareBinding describes a goroutine kept in Go by //mygo:software.
+// Co-simulation calls Function with one Go channel per entry of Channels.
+// Params names the matching parameters and ElemTypes spells each channel's
+// element type in Go.
+type SoftwareBinding struct {
+	Function  string
+	Channels  []*Channel
+	Params    []string
+	ElemTypes []string
+}
+
+// SoftwareStartPort names the top-level output that rises when the hardware
+// spawns the software process proc.
+func SoftwareStartPort(proc *Process) string {
+	return proc.Name + "_start"
+}
+
+// Stream is a channel that crosses between the hardware and a software
+// goroutine. It becomes three top-level ports: data and valid flow with the
+// values and ready flows back.
+type Stream struct {
+	Name     string
+	Channel  *Channel
+	Software *Process
+	// Direction is Input when software sends into the hardware and Output
+	// when the hardware sends to software.
+	Direction PortDirection
+}
+
+// PortName returns the name of the stream's data, valid or ready port.
+func (s *Stream) PortName(wire string) string {
+	return s.Name + "_" + wire
 }
 
 // Sensitivity indicates whether process is combinational or sequential.
@@ -232,6 +520,12 @@ type BasicBlock struct {
 	Terminator   Terminator
 	Predecessors []*BasicBlock
 	Successors   []*BasicBlock
+	// LoopHeader marks the header of a natural loop.
+	LoopHeader bool
+	// TripCount is the derived upper bound on loop body executions when
+	// LoopHeader is set, and -1 for loops whose bound is unknown, such as
+	// long-running server loops. It is meaningless on other blocks.
+	TripCount int64
 }
 
 // Operation is implemented by every IR operation node.
@@ -285,7 +579,8 @@ type CompareOperation struct {
 
 func (CompareOperation) isOperation() {}
 
-// AssignOperation copies one signal to another (e.g. store).
+// AssignOperation copies one signal to another (e.g. store). When Dest is a
+// component field the register takes the value as control leaves the block.
 type AssignOperation struct {
 	Dest  *Signal
 	Value *Signal
@@ -333,6 +628,19 @@ type PhiIncoming struct {
 
 func (PhiOperation) isOperation() {}
 
+// FloatOperation runs a float32 operation on a generated arithmetic unit.
+// Conversions from an integer read only Left; Dest's type gives the integer
+// type of a conversion to one. Units with a latency stall the process until
+// their result is ready.
+type FloatOperation struct {
+	Op    FloatOp
+	Dest  *Signal
+	Left  *Signal
+	Right *Signal
+}
+
+func (FloatOperation) isOperation() {}
+
 // PrintVerb enumerates supported formatting styles for print operations.
 type PrintVerb int
 
@@ -352,14 +660,28 @@ type PrintSegment struct {
 // PrintOperation emits formatted text to the simulator console.
 type PrintOperation struct {
 	Segments []PrintSegment
+	Source   token.Pos
 }
 
 func (PrintOperation) isOperation() {}
 
+// AssertOperation aborts simulation with Message when Cond is true. Cond is
+// the guard under which the originating Go panic is reached; a nil Cond fires
+// unconditionally. Location holds the rendered Go source position.
+type AssertOperation struct {
+	Cond     *Signal
+	Message  string
+	Location string
+	Source   token.Pos
+}
+
+func (AssertOperation) isOperation() {}
+
 // SendOperation emits a value onto a channel.
 type SendOperation struct {
 	Channel *Channel
 	Value   *Signal
+	Source  token.Pos
 }
 
 func (SendOperation) isOperation() {}
@@ -372,15 +694,89 @@ type RecvOperation struct {
 
 func (RecvOperation) isOperation() {}
 
-// SpawnOperation represents a goroutine launch.
+// LenOperation reads the number of values buffered in Channel into Dest. It
+// does not block.
+type LenOperation struct {
+	Channel *Channel
+	Dest    *Signal
+}
+
+func (LenOperation) isOperation() {}
+
+// SpawnOperation represents a goroutine launch. Args holds one value per
+// entry of the callee's Params and, for a hardware callee, ChanArgs one
+// channel per entry of its ChanParams; a software callee lists the channels
+// it is bound to. WaitGroups are the groups the goroutine joins.
 type SpawnOperation struct {
-	Callee   *Process
-	Args     []*Signal
-	ChanArgs []*Channel
+	Callee     *Process
+	Args       []*Signal
+	ChanArgs   []*Channel
+	WaitGroups []*WaitGroup
+	Source     token.Pos
 }
 
 func (SpawnOperation) isOperation() {}
 
+// WaitOperation blocks until every member of Group has completed.
+type WaitOperation struct {
+	Group  *WaitGroup
+	Source token.Pos
+}
+
+func (WaitOperation) isOperation() {}
+
+// LockOperation blocks until the process is granted Mutex.
+type LockOperation struct {
+	Mutex  *Mutex
+	Source token.Pos
+}
+
+func (LockOperation) isOperation() {}
+
+// UnlockOperation releases Mutex as control leaves the operation's state.
+type UnlockOperation struct {
+	Mutex  *Mutex
+	Source token.Pos
+}
+
+func (UnlockOperation) isOperation() {}
+
+// OperationSource returns the Go position op was lowered from: the position
+// of the value it drives, or of the statement for operations that drive
+// none. It is token.NoPos when unknown.
+func OperationSource(op Operation) token.Pos {
+	switch o := op.(type) {
+	case *AssertOperation:
+		return o.Source
+	case *PrintOperation:
+		return o.Source
+	case *SendOperation:
+		return o.Source
+	case *SpawnOperation:
+		return o.Source
+	case *WaitOperation:
+		return o.Source
+	case *LockOperation:
+		return o.Source
+	case *UnlockOperation:
+		return o.Source
+	}
+	if dest := OperationDest(op); dest != nil {
+		return dest.Source
+	}
+	return token.NoPos
+}
+
+// TerminatorSource returns the Go position term was lowered from: the
+// position of a branch's condition. Jumps and returns carry none, so it is
+// token.NoPos for them.
+func TerminatorSource(term Terminator) token.Pos {
+	if br, ok := term.(*BranchTerminator); ok && br.Cond != nil {
+		return br.Cond.Source
+	}
+	return token.NoPos
+}
+
 // BinOp enumerates supported binary ops.
 type BinOp int
 
@@ -411,3 +807,62 @@ const (
 	CompareUGT
 	CompareUGE
 )
+
+// FloatOp enumerates the float32 operations with generated units.
+type FloatOp int
+
+const (
+	FloatAdd FloatOp = iota
+	FloatSub
+	FloatMul
+	FloatEQ
+	FloatNE
+	FloatLT
+	FloatLE
+	FloatGT
+	FloatGE
+	// FloatFromInt converts an integer to float32, rounding to nearest even.
+	FloatFromInt
+	// FloatToInt converts a float32 to an integer, truncating toward zero.
+	FloatToInt
+)
+
+var floatOpNames = [...]string{
+	FloatAdd:     "add",
+	FloatSub:     "sub",
+	FloatMul:     "mul",
+	FloatEQ:      "eq",
+	FloatNE:      "ne",
+	FloatLT:      "lt",
+	FloatLE:      "le",
+	FloatGT:      "gt",
+	FloatGE:      "ge",
+	FloatFromInt: "from_int",
+	FloatToInt:   "to_int",
+}
+
+func (op FloatOp) String() string {
+	if int(op) < len(floatOpNames) {
+		return floatOpNames[op]
+	}
+	return fmt.Sprintf("float_op_%d", int(op))
+}
+
+// Latency is the number of cycles the unit for op takes to produce its
+// result. Comparisons are cheap enough to stay combinational.
+func (op FloatOp) Latency() int {
+	switch op {
+	case FloatAdd, FloatSub:
+		return 2
+	case FloatMul:
+		return 3
+	case FloatFromInt, FloatToInt:
+		return 1
+	}
+	return 0
+}
+
+// IsCompare reports whether op yields a boolean.
+func (op FloatOp) IsCompare() bool {
+	return op >= FloatEQ && op <= FloatGE
+}
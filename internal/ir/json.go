@@ -0,0 +1,1267 @@
+package ir
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/token"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// JSONVersion is the version of the schema EncodeJSON writes. DecodeJSON
+// rejects any other version.
+const JSONVersion = 1
+
+// The JSON form of a design mirrors the structs of this package. Everything
+// is referenced by name: processes, modules and detached channels across
+// the design, signals, channels, wait groups and mutexes within a module,
+// falling back to the top-level module, which comes first, and blocks
+// within a process. Kinds and operators are spelled as in Dump where Dump
+// uses a word and in lower case otherwise.
+type jsonDesign struct {
+	Version int           `json:"version"`
+	Top     string        `json:"top"`
+	Modules []*jsonModule `json:"modules"`
+}
+
+type jsonModule struct {
+	Name       string          `json:"name"`
+	Source     *jsonPos        `json:"source,omitempty"`
+	Ports      []jsonPort      `json:"ports,omitempty"`
+	Enums      []jsonEnum      `json:"enums,omitempty"`
+	Signals    []jsonSignal    `json:"signals,omitempty"`
+	Channels   []jsonChannel   `json:"channels,omitempty"`
+	WaitGroups []jsonWaitGroup `json:"wait_groups,omitempty"`
+	Mutexes    []jsonMutex     `json:"mutexes,omitempty"`
+	Components []jsonComponent `json:"components,omitempty"`
+	Streams    []jsonStream    `json:"streams,omitempty"`
+	Instances  []jsonInstance  `json:"instances,omitempty"`
+	Processes  []*jsonProcess  `json:"processes,omitempty"`
+}
+
+// jsonPos is a Go source position with 1-based line and column. File is
+// relative to the directory of the main package.
+type jsonPos struct {
+	File string `json:"file"`
+	Line int    `json:"line"`
+	Col  int    `json:"col"`
+}
+
+type jsonType struct {
+	Width  int    `json:"width"`
+	Signed bool   `json:"signed,omitempty"`
+	Float  bool   `json:"float,omitempty"`
+	Enum   string `json:"enum,omitempty"`
+}
+
+type jsonEnum struct {
+	Name    string       `json:"name"`
+	Members []jsonMember `json:"members"`
+}
+
+type jsonMember struct {
+	Name  string `json:"name"`
+	Value int64  `json:"value"`
+}
+
+type jsonPort struct {
+	Name      string   `json:"name"`
+	Direction string   `json:"direction"`
+	Type      jsonType `json:"type"`
+}
+
+type jsonSignal struct {
+	Name   string          `json:"name"`
+	Kind   string          `json:"kind"`
+	Type   jsonType        `json:"type"`
+	Value  json.RawMessage `json:"value,omitempty"`
+	Source *jsonPos        `json:"source,omitempty"`
+}
+
+type jsonChannel struct {
+	Name        string   `json:"name"`
+	Type        jsonType `json:"type"`
+	Depth       int      `json:"depth"`
+	Occupancy   int      `json:"occupancy,omitempty"`
+	Arbitration string   `json:"arbitration"`
+	// Producers and Consumers list the goroutine of every send or receive
+	// endpoint, as Dump names it, in arbitration order.
+	Producers []string `json:"producers,omitempty"`
+	Consumers []string `json:"consumers,omitempty"`
+	Source    *jsonPos `json:"source,omitempty"`
+}
+
+type jsonWaitGroup struct {
+	Name    string   `json:"name"`
+	Count   int      `json:"count"`
+	Members []string `json:"members,omitempty"`
+	Source  *jsonPos `json:"source,omitempty"`
+}
+
+type jsonMutex struct {
+	Name        string   `json:"name"`
+	Arbitration string   `json:"arbitration"`
+	Users       []string `json:"users,omitempty"`
+	Source      *jsonPos `json:"source,omitempty"`
+}
+
+type jsonComponent struct {
+	Name   string   `json:"name"`
+	Type   string   `json:"type"`
+	Owner  string   `json:"owner,omitempty"`
+	Fields []string `json:"fields,omitempty"`
+	Source *jsonPos `json:"source,omitempty"`
+}
+
+type jsonStream struct {
+	Name      string `json:"name"`
+	Direction string `json:"direction"`
+	Channel   string `json:"channel"`
+	Software  string `json:"software"`
+}
+
+type jsonInstance struct {
+	Name        string           `json:"name"`
+	Module      string           `json:"module"`
+	Connections []jsonConnection `json:"connections,omitempty"`
+}
+
+type jsonConnection struct {
+	Port string `json:"port"`
+	Net  string `json:"net"`
+}
+
+type jsonProcess struct {
+	Name        string          `json:"name"`
+	Sensitivity string          `json:"sensitivity"`
+	Stage       int             `json:"stage"`
+	Software    *jsonSoftware   `json:"software,omitempty"`
+	Params      []string        `json:"params,omitempty"`
+	ParamNames  []string        `json:"param_names,omitempty"`
+	ChanParams  []jsonChanParam `json:"chan_params,omitempty"`
+	Results     []string        `json:"results,omitempty"`
+	Blocks      []*jsonBlock    `json:"blocks,omitempty"`
+	Source      *jsonPos        `json:"source,omitempty"`
+}
+
+type jsonChanParam struct {
+	Name  string   `json:"name"`
+	Type  jsonType `json:"type"`
+	Depth int      `json:"depth"`
+}
+
+type jsonSoftware struct {
+	Function  string   `json:"function"`
+	Channels  []string `json:"channels,omitempty"`
+	Params    []string `json:"params,omitempty"`
+	ElemTypes []string `json:"elem_types,omitempty"`
+}
+
+// jsonBlock carries a trip count only on loop headers, with -1 for an
+// unknown bound.
+type jsonBlock struct {
+	Label      string          `json:"label"`
+	TripCount  *int64          `json:"trip_count,omitempty"`
+	Ops        []*jsonOp       `json:"ops,omitempty"`
+	Terminator *jsonTerminator `json:"terminator,omitempty"`
+}
+
+// jsonOp holds any operation; Kind says which fields are set. Source is
+// set for operations that drive no signal; the others take the source of
+// their destination.
+type jsonOp struct {
+	Kind       string         `json:"kind"`
+	Operator   string         `json:"operator,omitempty"`
+	Dest       string         `json:"dest,omitempty"`
+	Left       string         `json:"left,omitempty"`
+	Right      string         `json:"right,omitempty"`
+	Value      string         `json:"value,omitempty"`
+	Cond       string         `json:"cond,omitempty"`
+	True       string         `json:"true,omitempty"`
+	False      string         `json:"false,omitempty"`
+	Incomings  []jsonIncoming `json:"incomings,omitempty"`
+	Segments   []jsonSegment  `json:"segments,omitempty"`
+	Message    string         `json:"message,omitempty"`
+	Location   string         `json:"location,omitempty"`
+	Channel    string         `json:"channel,omitempty"`
+	Callee     string         `json:"callee,omitempty"`
+	Args       []string       `json:"args,omitempty"`
+	ChanArgs   []string       `json:"chan_args,omitempty"`
+	WaitGroups []string       `json:"wait_groups,omitempty"`
+	Group      string         `json:"group,omitempty"`
+	Mutex      string         `json:"mutex,omitempty"`
+	Source     *jsonPos       `json:"source,omitempty"`
+}
+
+type jsonIncoming struct {
+	Block string `json:"block"`
+	Value string `json:"value"`
+}
+
+// jsonSegment is literal text when Value is empty.
+type jsonSegment struct {
+	Text  string `json:"text,omitempty"`
+	Value string `json:"value,omitempty"`
+	Verb  string `json:"verb,omitempty"`
+}
+
+type jsonTerminator struct {
+	Kind   string `json:"kind"`
+	Cond   string `json:"cond,omitempty"`
+	True   string `json:"true,omitempty"`
+	False  string `json:"false,omitempty"`
+	Target string `json:"target,omitempty"`
+}
+
+var binOpNames = [...]string{
+	Add:  "add",
+	Sub:  "sub",
+	Mul:  "mul",
+	And:  "and",
+	Or:   "or",
+	Xor:  "xor",
+	Shl:  "shl",
+	ShrU: "shr_u",
+	ShrS: "shr_s",
+}
+
+var comparePredicateNames = [...]string{
+	CompareEQ:  "eq",
+	CompareNE:  "ne",
+	CompareSLT: "slt",
+	CompareSLE: "sle",
+	CompareSGT: "sgt",
+	CompareSGE: "sge",
+	CompareULT: "ult",
+	CompareULE: "ule",
+	CompareUGT: "ugt",
+	CompareUGE: "uge",
+}
+
+var printVerbNames = [...]string{
+	PrintVerbDec: "dec",
+	PrintVerbHex: "hex",
+	PrintVerbBin: "bin",
+}
+
+// nameOf returns names[v], or "" when v is out of range.
+func nameOf[T ~int](names []string, v T) string {
+	if int(v) < 0 || int(v) >= len(names) {
+		return ""
+	}
+	return names[v]
+}
+
+// lookupName is the inverse of nameOf.
+func lookupName[T ~int](names []string, text string) (T, bool) {
+	for idx, name := range names {
+		if name == text {
+			return T(idx), true
+		}
+	}
+	return 0, false
+}
+
+// EncodeJSON writes design as versioned JSON for tools. Unlike Dump it keeps
+// the Go source positions, resolved through design.Fset, and the order of
+// every channel's endpoints.
+func EncodeJSON(w io.Writer, design *Design) error {
+	if design == nil || design.TopLevel == nil {
+		return fmt.Errorf("no design to encode")
+	}
+	e := &jsonEncoder{design: design}
+	out := &jsonDesign{Version: JSONVersion, Top: design.TopLevel.Name}
+	for _, module := range design.Modules {
+		out.Modules = append(out.Modules, e.module(module))
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+type jsonEncoder struct {
+	design *Design
+}
+
+func (e *jsonEncoder) pos(pos token.Pos) *jsonPos {
+	if e.design.Fset == nil || !pos.IsValid() {
+		return nil
+	}
+	p := e.design.Fset.Position(pos)
+	return &jsonPos{File: e.design.SourceName(p.Filename), Line: p.Line, Col: p.Column}
+}
+
+func encodeType(t *SignalType) jsonType {
+	if t == nil {
+		return jsonType{}
+	}
+	out := jsonType{Width: t.Width, Signed: t.Signed, Float: t.Float}
+	if t.Enum != nil {
+		out.Enum = t.Enum.Name
+	}
+	return out
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (e *jsonEncoder) module(module *Module) *jsonModule {
+	out := &jsonModule{Name: module.Name, Source: e.pos(module.Source)}
+	enums := make(map[string]*EnumType)
+	addEnum := func(t *SignalType) {
+		if t != nil && t.Enum != nil {
+			enums[t.Enum.Name] = t.Enum
+		}
+	}
+	for _, port := range module.Ports {
+		addEnum(port.Type)
+		out.Ports = append(out.Ports, jsonPort{
+			Name:      port.Name,
+			Direction: strings.TrimSpace(portDirection(port.Direction)),
+			Type:      encodeType(port.Type),
+		})
+	}
+	for _, name := range sortedKeys(module.Signals) {
+		sig := module.Signals[name]
+		addEnum(sig.Type)
+		js := jsonSignal{Name: sig.Name, Kind: signalKind(sig.Kind), Type: encodeType(sig.Type), Source: e.pos(sig.Source)}
+		if sig.Value != nil {
+			js.Value, _ = json.Marshal(sig.Value)
+		}
+		out.Signals = append(out.Signals, js)
+	}
+	for _, name := range sortedKeys(module.Channels) {
+		ch := module.Channels[name]
+		addEnum(ch.Type)
+		jc := jsonChannel{
+			Name:        ch.Name,
+			Type:        encodeType(ch.Type),
+			Depth:       ch.Depth,
+			Occupancy:   ch.Occupancy,
+			Arbitration: ch.Arbitration.String(),
+			Source:      e.pos(ch.Source),
+		}
+		for _, ep := range ch.Producers {
+			jc.Producers = append(jc.Producers, ep.Name())
+		}
+		for _, ep := range ch.Consumers {
+			jc.Consumers = append(jc.Consumers, ep.Name())
+		}
+		out.Channels = append(out.Channels, jc)
+	}
+	for _, name := range sortedKeys(enums) {
+		je := jsonEnum{Name: name}
+		for _, member := range enums[name].Members {
+			je.Members = append(je.Members, jsonMember{Name: member.Name, Value: member.Value})
+		}
+		out.Enums = append(out.Enums, je)
+	}
+	for _, name := range sortedKeys(module.WaitGroups) {
+		wg := module.WaitGroups[name]
+		out.WaitGroups = append(out.WaitGroups, jsonWaitGroup{
+			Name:    wg.Name,
+			Count:   wg.Count,
+			Members: siteNameList(wg.Members),
+			Source:  e.pos(wg.Source),
+		})
+	}
+	for _, name := range sortedKeys(module.Mutexes) {
+		mu := module.Mutexes[name]
+		out.Mutexes = append(out.Mutexes, jsonMutex{
+			Name:        mu.Name,
+			Arbitration: mu.Arbitration.String(),
+			Users:       siteNameList(mu.Users),
+			Source:      e.pos(mu.Source),
+		})
+	}
+	for _, name := range sortedKeys(module.Components) {
+		comp := module.Components[name]
+		jc := jsonComponent{Name: comp.Name, Type: comp.Type, Source: e.pos(comp.Source)}
+		if comp.Owner != nil {
+			jc.Owner = comp.Owner.Name
+		}
+		for _, field := range comp.Fields {
+			jc.Fields = append(jc.Fields, field.Name)
+		}
+		out.Components = append(out.Components, jc)
+	}
+	for _, stream := range module.Streams {
+		out.Streams = append(out.Streams, jsonStream{
+			Name:      stream.Name,
+			Direction: strings.TrimSpace(portDirection(stream.Direction)),
+			Channel:   stream.Channel.Name,
+			Software:  stream.Software.Name,
+		})
+	}
+	for _, inst := range module.Instances {
+		ji := jsonInstance{Name: inst.Name, Module: inst.Module.Name}
+		for _, conn := range inst.Connections {
+			ji.Connections = append(ji.Connections, jsonConnection{Port: conn.Port, Net: conn.Net})
+		}
+		out.Instances = append(out.Instances, ji)
+	}
+	for _, proc := range module.Processes {
+		out.Processes = append(out.Processes, e.process(proc))
+	}
+	return out
+}
+
+func siteNameList(sites []Site) []string {
+	var names []string
+	for _, site := range sites {
+		names = append(names, site.Name())
+	}
+	return names
+}
+
+func signalNameOrEmpty(sig *Signal) string {
+	if sig == nil {
+		return ""
+	}
+	return sig.Name
+}
+
+func blockLabelOrEmpty(bb *BasicBlock) string {
+	if bb == nil {
+		return ""
+	}
+	return bb.Label
+}
+
+func (e *jsonEncoder) process(proc *Process) *jsonProcess {
+	out := &jsonProcess{
+		Name:        proc.Name,
+		Sensitivity: sensitivity(proc.Sensitivity),
+		Stage:       proc.Stage,
+		Source:      e.pos(proc.Source),
+	}
+	if sw := proc.Software; sw != nil {
+		js := &jsonSoftware{Function: sw.Function, Params: sw.Params, ElemTypes: sw.ElemTypes}
+		for _, ch := range sw.Channels {
+			js.Channels = append(js.Channels, ch.Name)
+		}
+		out.Software = js
+	}
+	for _, param := range proc.Params {
+		out.Params = append(out.Params, param.Name)
+	}
+	out.ParamNames = proc.ParamNames
+	for _, ch := range proc.ChanParams {
+		out.ChanParams = append(out.ChanParams, jsonChanParam{Name: ch.Name, Type: encodeType(ch.Type), Depth: ch.Depth})
+	}
+	for _, result := range proc.Results {
+		out.Results = append(out.Results, result.Name)
+	}
+	for _, block := range proc.Blocks {
+		jb := &jsonBlock{Label: block.Label}
+		if block.LoopHeader {
+			trip := block.TripCount
+			jb.TripCount = &trip
+		}
+		for _, op := range block.Ops {
+			jb.Ops = append(jb.Ops, e.op(op))
+		}
+		switch t := block.Terminator.(type) {
+		case *BranchTerminator:
+			jb.Terminator = &jsonTerminator{Kind: "branch", Cond: signalNameOrEmpty(t.Cond), True: blockLabelOrEmpty(t.True), False: blockLabelOrEmpty(t.False)}
+		case *JumpTerminator:
+			jb.Terminator = &jsonTerminator{Kind: "jump", Target: blockLabelOrEmpty(t.Target)}
+		case *ReturnTerminator:
+			jb.Terminator = &jsonTerminator{Kind: "return"}
+		}
+		out.Blocks = append(out.Blocks, jb)
+	}
+	return out
+}
+
+func (e *jsonEncoder) op(op Operation) *jsonOp {
+	var out *jsonOp
+	switch o := op.(type) {
+	case *AssignOperation:
+		out = &jsonOp{Kind: "assign", Value: signalNameOrEmpty(o.Value)}
+	case *ConvertOperation:
+		out = &jsonOp{Kind: "convert", Value: signalNameOrEmpty(o.Value)}
+	case *BinOperation:
+		out = &jsonOp{Kind: "bin", Operator: nameOf(binOpNames[:], o.Op), Left: signalNameOrEmpty(o.Left), Right: signalNameOrEmpty(o.Right)}
+	case *CompareOperation:
+		out = &jsonOp{Kind: "compare", Operator: nameOf(comparePredicateNames[:], o.Predicate), Left: signalNameOrEmpty(o.Left), Right: signalNameOrEmpty(o.Right)}
+	case *NotOperation:
+		out = &jsonOp{Kind: "not", Value: signalNameOrEmpty(o.Value)}
+	case *MuxOperation:
+		out = &jsonOp{Kind: "mux", Cond: signalNameOrEmpty(o.Cond), True: signalNameOrEmpty(o.TrueValue), False: signalNameOrEmpty(o.FalseValue)}
+	case *PhiOperation:
+		out = &jsonOp{Kind: "phi"}
+		for _, in := range o.Incomings {
+			out.Incomings = append(out.Incomings, jsonIncoming{Block: blockLabelOrEmpty(in.Block), Value: signalNameOrEmpty(in.Value)})
+		}
+	case *FloatOperation:
+		out = &jsonOp{Kind: "float", Operator: o.Op.String(), Left: signalNameOrEmpty(o.Left), Right: signalNameOrEmpty(o.Right)}
+	case *PrintOperation:
+		out = &jsonOp{Kind: "print"}
+		for _, seg := range o.Segments {
+			if seg.Value == nil {
+				out.Segments = append(out.Segments, jsonSegment{Text: seg.Text})
+				continue
+			}
+			out.Segments = append(out.Segments, jsonSegment{Value: seg.Value.Name, Verb: nameOf(printVerbNames[:], seg.Verb)})
+		}
+	case *AssertOperation:
+		out = &jsonOp{Kind: "assert", Cond: signalNameOrEmpty(o.Cond), Message: o.Message, Location: o.Location}
+	case *SendOperation:
+		out = &jsonOp{Kind: "send", Channel: o.Channel.Name, Value: signalNameOrEmpty(o.Value)}
+	case *RecvOperation:
+		out = &jsonOp{Kind: "recv", Channel: o.Channel.Name}
+	case *LenOperation:
+		out = &jsonOp{Kind: "len", Channel: o.Channel.Name}
+	case *SpawnOperation:
+		out = &jsonOp{Kind: "spawn"}
+		if o.Callee != nil {
+			out.Callee = o.Callee.Name
+		}
+		for _, arg := range o.Args {
+			out.Args = append(out.Args, arg.Name)
+		}
+		for _, ch := range o.ChanArgs {
+			out.ChanArgs = append(out.ChanArgs, ch.Name)
+		}
+		for _, wg := range o.WaitGroups {
+			out.WaitGroups = append(out.WaitGroups, wg.Name)
+		}
+	case *WaitOperation:
+		out = &jsonOp{Kind: "wait", Group: o.Group.Name}
+	case *LockOperation:
+		out = &jsonOp{Kind: "lock", Mutex: o.Mutex.Name}
+	case *UnlockOperation:
+		out = &jsonOp{Kind: "unlock", Mutex: o.Mutex.Name}
+	default:
+		return &jsonOp{Kind: fmt.Sprintf("unknown:%T", op)}
+	}
+	if dest := OperationDest(op); dest != nil {
+		out.Dest = dest.Name
+	} else {
+		out.Source = e.pos(OperationSource(op))
+	}
+	return out
+}
+
+// DecodeJSON reads a design written by EncodeJSON, possibly edited. As for
+// Parse, instances are tied to the go statements of their parent in order,
+// and channel endpoints, wait group members and mutex users are rebuilt from
+// the operations, in the order they are listed; block edges are rebuilt
+// from the terminators. Source positions are kept: Fset holds one file per
+// name with just enough lines and columns to resolve them.
+func DecodeJSON(r io.Reader) (*Design, error) {
+	var in jsonDesign
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&in); err != nil {
+		return nil, err
+	}
+	if in.Version != JSONVersion {
+		return nil, fmt.Errorf("unsupported IR JSON version %d (want %d)", in.Version, JSONVersion)
+	}
+	if len(in.Modules) == 0 {
+		return nil, fmt.Errorf("expected a module")
+	}
+	d := &jsonDecoder{
+		design:   &Design{},
+		modules:  make(map[string]*Module),
+		procs:    make(map[string]*Process),
+		signals:  make(map[string]*Signal),
+		detached: make(map[string]*Channel),
+		files:    make(map[string]*token.File),
+	}
+	d.buildFileSet(&in)
+	if err := d.decode(&in); err != nil {
+		return nil, err
+	}
+	return d.design, nil
+}
+
+type jsonDecoder struct {
+	design   *Design
+	modules  map[string]*Module
+	procs    map[string]*Process
+	signals  map[string]*Signal
+	detached map[string]*Channel
+	files    map[string]*token.File
+	// width is the line length of the synthetic files.
+	width int
+}
+
+// buildFileSet makes a file for every file named by a position, with lines
+// long enough for the widest column.
+func (d *jsonDecoder) buildFileSet(in *jsonDesign) {
+	lines := make(map[string]int)
+	d.width = 1
+	visit := func(p *jsonPos) {
+		if p == nil || p.File == "" || p.Line < 1 || p.Col < 1 {
+			return
+		}
+		lines[p.File] = max(lines[p.File], p.Line)
+		d.width = max(d.width, p.Col+1)
+	}
+	for _, m := range in.Modules {
+		visit(m.Source)
+		for _, s := range m.Signals {
+			visit(s.Source)
+		}
+		for _, c := range m.Channels {
+			visit(c.Source)
+		}
+		for _, wg := range m.WaitGroups {
+			visit(wg.Source)
+		}
+		for _, mu := range m.Mutexes {
+			visit(mu.Source)
+		}
+		for _, c := range m.Components {
+			visit(c.Source)
+		}
+		for _, p := range m.Processes {
+			visit(p.Source)
+			for _, b := range p.Blocks {
+				for _, op := range b.Ops {
+					visit(op.Source)
+				}
+			}
+		}
+	}
+	if len(lines) == 0 {
+		return
+	}
+	d.design.Fset = token.NewFileSet()
+	for _, name := range sortedKeys(lines) {
+		count := lines[name]
+		file := d.design.Fset.AddFile(name, -1, count*d.width)
+		offsets := make([]int, count)
+		for idx := range offsets {
+			offsets[idx] = idx * d.width
+		}
+		file.SetLines(offsets)
+		d.files[name] = file
+	}
+}
+
+func (d *jsonDecoder) pos(p *jsonPos) token.Pos {
+	if p == nil || p.Line < 1 || p.Col < 1 {
+		return token.NoPos
+	}
+	file := d.files[p.File]
+	if file == nil {
+		return token.NoPos
+	}
+	return file.Pos((p.Line-1)*d.width + p.Col - 1)
+}
+
+func (d *jsonDecoder) process(name string) (*Process, error) {
+	proc := d.procs[name]
+	if proc == nil {
+		return nil, fmt.Errorf("unknown process %q", name)
+	}
+	return proc, nil
+}
+
+func (d *jsonDecoder) decode(in *jsonDesign) error {
+	// Declare modules and processes first so that anything may refer to
+	// them.
+	for _, jm := range in.Modules {
+		if d.modules[jm.Name] != nil {
+			return fmt.Errorf("module %s declared twice", jm.Name)
+		}
+		module := &Module{
+			Name:       jm.Name,
+			Signals:    make(map[string]*Signal),
+			Channels:   make(map[string]*Channel),
+			WaitGroups: make(map[string]*WaitGroup),
+			Components: make(map[string]*Component),
+			Mutexes:    make(map[string]*Mutex),
+			Source:     d.pos(jm.Source),
+		}
+		d.modules[jm.Name] = module
+		d.design.Modules = append(d.design.Modules, module)
+		for _, jp := range jm.Processes {
+			if d.procs[jp.Name] != nil {
+				return fmt.Errorf("process %s declared twice", jp.Name)
+			}
+			proc := &Process{Name: jp.Name, Stage: jp.Stage, Source: d.pos(jp.Source)}
+			switch jp.Sensitivity {
+			case "sequential":
+				proc.Sensitivity = Sequential
+			case "combinational":
+				proc.Sensitivity = Combinational
+			default:
+				return fmt.Errorf("process %s: unknown sensitivity %q", jp.Name, jp.Sensitivity)
+			}
+			d.procs[jp.Name] = proc
+			module.Processes = append(module.Processes, proc)
+		}
+	}
+	d.design.TopLevel = d.modules[in.Top]
+	if d.design.TopLevel == nil {
+		return fmt.Errorf("unknown top-level module %q", in.Top)
+	}
+	if d.design.TopLevel != d.design.Modules[0] {
+		return fmt.Errorf("top-level module %s must come first", in.Top)
+	}
+	// The top-level module owns what process modules share, so it is
+	// decoded before them.
+	for idx, jm := range in.Modules {
+		if err := d.moduleDecls(d.design.Modules[idx], jm); err != nil {
+			return fmt.Errorf("module %s: %w", jm.Name, err)
+		}
+	}
+	for idx, jm := range in.Modules {
+		module := d.design.Modules[idx]
+		for pidx, jp := range jm.Processes {
+			if err := d.processBody(module, module.Processes[pidx], jp); err != nil {
+				return fmt.Errorf("module %s: process %s: %w", jm.Name, jp.Name, err)
+			}
+		}
+	}
+	claimChannels(d.design)
+	for _, module := range d.design.Modules {
+		linkInstances(module)
+	}
+	linkSites(d.design)
+	sites := siteNameSet(d.design)
+	known := func(names []string) error {
+		for _, name := range names {
+			if !sites[name] {
+				return fmt.Errorf("unknown goroutine %q", name)
+			}
+		}
+		return nil
+	}
+	for idx, jm := range in.Modules {
+		module := d.design.Modules[idx]
+		for _, jc := range jm.Channels {
+			ch := module.Channels[jc.Name]
+			if err := known(slices.Concat(jc.Producers, jc.Consumers)); err != nil {
+				return fmt.Errorf("module %s: channel %s: %w", jm.Name, jc.Name, err)
+			}
+			sortSites(ch.Producers, jc.Producers, endpointSite)
+			sortSites(ch.Consumers, jc.Consumers, endpointSite)
+		}
+		for _, jw := range jm.WaitGroups {
+			if err := known(jw.Members); err != nil {
+				return fmt.Errorf("module %s: wait group %s: %w", jm.Name, jw.Name, err)
+			}
+			sortSites(module.WaitGroups[jw.Name].Members, jw.Members, siteOf)
+		}
+		for _, ju := range jm.Mutexes {
+			if err := known(ju.Users); err != nil {
+				return fmt.Errorf("module %s: mutex %s: %w", jm.Name, ju.Name, err)
+			}
+			sortSites(module.Mutexes[ju.Name].Users, ju.Users, siteOf)
+		}
+	}
+	return nil
+}
+
+func (d *jsonDecoder) moduleDecls(module *Module, jm *jsonModule) error {
+	enums := make(map[string]*EnumType)
+	for _, je := range jm.Enums {
+		if enums[je.Name] != nil {
+			return fmt.Errorf("enum %s declared twice", je.Name)
+		}
+		enum := &EnumType{Name: je.Name}
+		for _, member := range je.Members {
+			enum.Members = append(enum.Members, EnumMember{Name: member.Name, Value: member.Value})
+		}
+		enums[je.Name] = enum
+	}
+	decodeType := func(t jsonType) (*SignalType, error) {
+		if t.Width <= 0 {
+			return nil, fmt.Errorf("bad width %d", t.Width)
+		}
+		typ := &SignalType{Width: t.Width, Signed: t.Signed, Float: t.Float}
+		if t.Enum != "" {
+			if typ.Enum = enums[t.Enum]; typ.Enum == nil {
+				return nil, fmt.Errorf("unknown enum %q", t.Enum)
+			}
+		}
+		return typ, nil
+	}
+	for _, jp := range jm.Ports {
+		dir, ok := parsePortDirection(jp.Direction)
+		if !ok {
+			return fmt.Errorf("port %s: unknown direction %q", jp.Name, jp.Direction)
+		}
+		typ, err := decodeType(jp.Type)
+		if err != nil {
+			return fmt.Errorf("port %s: %w", jp.Name, err)
+		}
+		module.Ports = append(module.Ports, Port{Name: jp.Name, Direction: dir, Type: typ})
+	}
+	for _, js := range jm.Signals {
+		kind, ok := parseSignalKind(js.Kind)
+		if !ok {
+			return fmt.Errorf("signal %s: unknown kind %q", js.Name, js.Kind)
+		}
+		typ, err := decodeType(js.Type)
+		if err != nil {
+			return fmt.Errorf("signal %s: %w", js.Name, err)
+		}
+		sig := &Signal{Name: js.Name, Kind: kind, Type: typ, Source: d.pos(js.Source)}
+		if len(js.Value) > 0 {
+			sig.Value = parseValue(string(bytes.TrimSpace(js.Value)), typ)
+			if _, ok := sig.Value.(string); ok {
+				return fmt.Errorf("signal %s: bad value %s", js.Name, js.Value)
+			}
+		}
+		if module.Signals[sig.Name] != nil {
+			return fmt.Errorf("signal %s declared twice", sig.Name)
+		}
+		// A signal listed by several modules is one signal.
+		if prev := d.signals[sig.Name]; prev != nil {
+			if prev.Kind != sig.Kind || prev.Type.Description() != sig.Type.Description() {
+				return fmt.Errorf("signal %s does not match its declaration in another module", sig.Name)
+			}
+			sig = prev
+		}
+		d.signals[sig.Name] = sig
+		module.Signals[sig.Name] = sig
+	}
+	for _, jc := range jm.Channels {
+		typ, err := decodeType(jc.Type)
+		if err != nil {
+			return fmt.Errorf("channel %s: %w", jc.Name, err)
+		}
+		if jc.Depth < 0 || jc.Occupancy < 0 {
+			return fmt.Errorf("channel %s: negative depth or occupancy", jc.Name)
+		}
+		ch := &Channel{Name: jc.Name, Type: typ, Depth: jc.Depth, Occupancy: jc.Occupancy, Source: d.pos(jc.Source)}
+		var ok bool
+		if ch.Arbitration, ok = parseArbitration(jc.Arbitration); !ok {
+			return fmt.Errorf("channel %s: unknown arbitration %q", jc.Name, jc.Arbitration)
+		}
+		module.Channels[ch.Name] = ch
+	}
+	for _, jw := range jm.WaitGroups {
+		module.WaitGroups[jw.Name] = &WaitGroup{Name: jw.Name, Count: jw.Count, Source: d.pos(jw.Source)}
+	}
+	for _, ju := range jm.Mutexes {
+		mu := &Mutex{Name: ju.Name, Source: d.pos(ju.Source)}
+		var ok bool
+		if mu.Arbitration, ok = parseArbitration(ju.Arbitration); !ok {
+			return fmt.Errorf("mutex %s: unknown arbitration %q", ju.Name, ju.Arbitration)
+		}
+		module.Mutexes[mu.Name] = mu
+	}
+	for _, jc := range jm.Components {
+		comp := &Component{Name: jc.Name, Type: jc.Type, Source: d.pos(jc.Source)}
+		if jc.Owner != "" {
+			owner, err := d.process(jc.Owner)
+			if err != nil {
+				return fmt.Errorf("component %s: %w", jc.Name, err)
+			}
+			comp.Owner = owner
+		}
+		for _, name := range jc.Fields {
+			sig := module.Signals[name]
+			if sig == nil {
+				return fmt.Errorf("component %s: unknown field signal %q", jc.Name, name)
+			}
+			comp.Fields = append(comp.Fields, sig)
+		}
+		module.Components[comp.Name] = comp
+	}
+	for _, js := range jm.Streams {
+		dir, ok := parsePortDirection(js.Direction)
+		if !ok || dir == InOut {
+			return fmt.Errorf("stream %s: direction must be in or out, got %q", js.Name, js.Direction)
+		}
+		ch := module.Channels[js.Channel]
+		if ch == nil {
+			return fmt.Errorf("stream %s: unknown channel %q", js.Name, js.Channel)
+		}
+		sw, err := d.process(js.Software)
+		if err != nil {
+			return fmt.Errorf("stream %s: %w", js.Name, err)
+		}
+		module.Streams = append(module.Streams, &Stream{Name: js.Name, Channel: ch, Software: sw, Direction: dir})
+	}
+	for _, ji := range jm.Instances {
+		child := d.modules[ji.Module]
+		if child == nil {
+			return fmt.Errorf("instance %s: unknown module %q", ji.Name, ji.Module)
+		}
+		inst := &Instance{Name: ji.Name, Module: child}
+		for _, conn := range ji.Connections {
+			inst.Connections = append(inst.Connections, Connection{Port: conn.Port, Net: conn.Net})
+		}
+		module.Instances = append(module.Instances, inst)
+	}
+	return nil
+}
+
+// channel finds name in module, then in the top-level module, then among
+// the channels only software goroutines use, which belong to no module.
+func (d *jsonDecoder) channel(module *Module, name string, detach bool) (*Channel, error) {
+	if ch := module.Channels[name]; ch != nil {
+		return ch, nil
+	}
+	if ch := d.design.TopLevel.Channels[name]; ch != nil {
+		return ch, nil
+	}
+	if !detach {
+		return nil, fmt.Errorf("unknown channel %q", name)
+	}
+	ch := d.detached[name]
+	if ch == nil {
+		ch = &Channel{Name: name}
+		d.detached[name] = ch
+	}
+	return ch, nil
+}
+
+func (d *jsonDecoder) processBody(module *Module, proc *Process, jp *jsonProcess) error {
+	if js := jp.Software; js != nil {
+		sw := &SoftwareBinding{Function: js.Function, Params: js.Params, ElemTypes: js.ElemTypes}
+		for _, name := range js.Channels {
+			ch, err := d.channel(module, name, true)
+			if err != nil {
+				return err
+			}
+			sw.Channels = append(sw.Channels, ch)
+		}
+		proc.Software = sw
+	}
+	blocks := make(map[string]*BasicBlock)
+	for _, jb := range jp.Blocks {
+		if blocks[jb.Label] != nil {
+			return fmt.Errorf("block %s declared twice", jb.Label)
+		}
+		block := &BasicBlock{Label: jb.Label}
+		if jb.TripCount != nil {
+			block.LoopHeader = true
+			block.TripCount = *jb.TripCount
+		}
+		blocks[jb.Label] = block
+		proc.Blocks = append(proc.Blocks, block)
+	}
+	proc.ParamNames = jp.ParamNames
+	for _, jc := range jp.ChanParams {
+		if jc.Type.Width <= 0 || jc.Depth < 0 {
+			return fmt.Errorf("channel param %s: bad width or depth", jc.Name)
+		}
+		typ := &SignalType{Width: jc.Type.Width, Signed: jc.Type.Signed, Float: jc.Type.Float}
+		proc.ChanParams = append(proc.ChanParams, &Channel{Name: jc.Name, Type: typ, Depth: jc.Depth})
+	}
+	od := &jsonOpDecoder{jsonDecoder: d, module: module, proc: proc, blocks: blocks}
+	if len(jp.Params) > 0 {
+		params, err := od.signals(jp.Params...)
+		if err != nil {
+			return fmt.Errorf("params: %w", err)
+		}
+		proc.Params = params
+	}
+	if len(jp.Results) > 0 {
+		results, err := od.signals(jp.Results...)
+		if err != nil {
+			return fmt.Errorf("results: %w", err)
+		}
+		proc.Results = results
+	}
+	for idx, jb := range jp.Blocks {
+		block := proc.Blocks[idx]
+		for opIdx, jo := range jb.Ops {
+			op, err := od.op(jo)
+			if err != nil {
+				return fmt.Errorf("block %s: op %d (%s): %w", jb.Label, opIdx, jo.Kind, err)
+			}
+			block.Ops = append(block.Ops, op)
+		}
+		if jb.Terminator != nil {
+			term, err := od.terminator(jb.Terminator)
+			if err != nil {
+				return fmt.Errorf("block %s: %s: %w", jb.Label, jb.Terminator.Kind, err)
+			}
+			block.Terminator = term
+		}
+	}
+	for _, block := range proc.Blocks {
+		var succs []*BasicBlock
+		switch term := block.Terminator.(type) {
+		case *BranchTerminator:
+			succs = []*BasicBlock{term.True, term.False}
+		case *JumpTerminator:
+			succs = []*BasicBlock{term.Target}
+		}
+		for _, succ := range succs {
+			block.Successors = append(block.Successors, succ)
+			succ.Predecessors = append(succ.Predecessors, block)
+		}
+	}
+	return nil
+}
+
+// jsonOpDecoder resolves the names an operation uses within one process.
+type jsonOpDecoder struct {
+	*jsonDecoder
+	module *Module
+	proc   *Process
+	blocks map[string]*BasicBlock
+}
+
+// channel finds name among the channel params of the process first.
+func (o *jsonOpDecoder) channel(name string, detach bool) (*Channel, error) {
+	for _, ch := range o.proc.ChanParams {
+		if ch.Name == name {
+			return ch, nil
+		}
+	}
+	return o.jsonDecoder.channel(o.module, name, detach)
+}
+
+// signal resolves a required signal name; optional ones are left empty by
+// the encoder and go through optSignal.
+func (o *jsonOpDecoder) signal(name string) (*Signal, error) {
+	if name == "" {
+		return nil, fmt.Errorf("missing signal")
+	}
+	sig := o.module.Signals[name]
+	if sig == nil {
+		return nil, fmt.Errorf("unknown signal %q", name)
+	}
+	return sig, nil
+}
+
+func (o *jsonOpDecoder) optSignal(name string) (*Signal, error) {
+	if name == "" {
+		return nil, nil
+	}
+	return o.signal(name)
+}
+
+func (o *jsonOpDecoder) block(name string) (*BasicBlock, error) {
+	block := o.blocks[name]
+	if block == nil {
+		return nil, fmt.Errorf("unknown block %q", name)
+	}
+	return block, nil
+}
+
+// signals resolves several names, stopping at the first error.
+func (o *jsonOpDecoder) signals(names ...string) ([]*Signal, error) {
+	sigs := make([]*Signal, len(names))
+	for idx, name := range names {
+		sig, err := o.signal(name)
+		if err != nil {
+			return nil, err
+		}
+		sigs[idx] = sig
+	}
+	return sigs, nil
+}
+
+func (o *jsonOpDecoder) op(jo *jsonOp) (Operation, error) {
+	source := o.pos(jo.Source)
+	switch jo.Kind {
+	case "assign", "convert", "not":
+		s, err := o.signals(jo.Dest, jo.Value)
+		if err != nil {
+			return nil, err
+		}
+		switch jo.Kind {
+		case "assign":
+			return &AssignOperation{Dest: s[0], Value: s[1]}, nil
+		case "convert":
+			return &ConvertOperation{Dest: s[0], Value: s[1]}, nil
+		}
+		return &NotOperation{Dest: s[0], Value: s[1]}, nil
+	case "bin":
+		binop, ok := lookupName[BinOp](binOpNames[:], jo.Operator)
+		if !ok {
+			return nil, fmt.Errorf("unknown operator %q", jo.Operator)
+		}
+		s, err := o.signals(jo.Dest, jo.Left, jo.Right)
+		if err != nil {
+			return nil, err
+		}
+		return &BinOperation{Op: binop, Dest: s[0], Left: s[1], Right: s[2]}, nil
+	case "compare":
+		pred, ok := lookupName[ComparePredicate](comparePredicateNames[:], jo.Operator)
+		if !ok {
+			return nil, fmt.Errorf("unknown predicate %q", jo.Operator)
+		}
+		s, err := o.signals(jo.Dest, jo.Left, jo.Right)
+		if err != nil {
+			return nil, err
+		}
+		return &CompareOperation{Predicate: pred, Dest: s[0], Left: s[1], Right: s[2]}, nil
+	case "mux":
+		s, err := o.signals(jo.Dest, jo.Cond, jo.True, jo.False)
+		if err != nil {
+			return nil, err
+		}
+		return &MuxOperation{Dest: s[0], Cond: s[1], TrueValue: s[2], FalseValue: s[3]}, nil
+	case "phi":
+		dest, err := o.signal(jo.Dest)
+		if err != nil {
+			return nil, err
+		}
+		op := &PhiOperation{Dest: dest}
+		for _, in := range jo.Incomings {
+			block, err := o.block(in.Block)
+			if err != nil {
+				return nil, err
+			}
+			value, err := o.signal(in.Value)
+			if err != nil {
+				return nil, err
+			}
+			op.Incomings = append(op.Incomings, PhiIncoming{Block: block, Value: value})
+		}
+		return op, nil
+	case "float":
+		fop, ok := parseFloatOp(jo.Operator)
+		if !ok {
+			return nil, fmt.Errorf("unknown float operator %q", jo.Operator)
+		}
+		s, err := o.signals(jo.Dest, jo.Left)
+		if err != nil {
+			return nil, err
+		}
+		right, err := o.optSignal(jo.Right)
+		if err != nil {
+			return nil, err
+		}
+		return &FloatOperation{Op: fop, Dest: s[0], Left: s[1], Right: right}, nil
+	case "print":
+		op := &PrintOperation{Source: source}
+		for _, seg := range jo.Segments {
+			if seg.Value == "" {
+				op.Segments = append(op.Segments, PrintSegment{Text: seg.Text})
+				continue
+			}
+			value, err := o.signal(seg.Value)
+			if err != nil {
+				return nil, err
+			}
+			verb, ok := lookupName[PrintVerb](printVerbNames[:], seg.Verb)
+			if !ok {
+				return nil, fmt.Errorf("unknown verb %q", seg.Verb)
+			}
+			op.Segments = append(op.Segments, PrintSegment{Value: value, Verb: verb})
+		}
+		return op, nil
+	case "assert":
+		cond, err := o.optSignal(jo.Cond)
+		if err != nil {
+			return nil, err
+		}
+		return &AssertOperation{Cond: cond, Message: jo.Message, Location: jo.Location, Source: source}, nil
+	case "send":
+		ch, err := o.channel(jo.Channel, false)
+		if err != nil {
+			return nil, err
+		}
+		value, err := o.signal(jo.Value)
+		if err != nil {
+			return nil, err
+		}
+		return &SendOperation{Channel: ch, Value: value, Source: source}, nil
+	case "recv", "len":
+		ch, err := o.channel(jo.Channel, false)
+		if err != nil {
+			return nil, err
+		}
+		dest, err := o.signal(jo.Dest)
+		if err != nil {
+			return nil, err
+		}
+		if jo.Kind == "recv" {
+			return &RecvOperation{Channel: ch, Dest: dest}, nil
+		}
+		return &LenOperation{Channel: ch, Dest: dest}, nil
+	case "spawn":
+		callee, err := o.process(jo.Callee)
+		if err != nil {
+			return nil, err
+		}
+		args, err := o.signals(jo.Args...)
+		if err != nil {
+			return nil, err
+		}
+		op := &SpawnOperation{Callee: callee, Args: args, Source: source}
+		for _, name := range jo.ChanArgs {
+			ch, err := o.channel(name, true)
+			if err != nil {
+				return nil, err
+			}
+			op.ChanArgs = append(op.ChanArgs, ch)
+		}
+		for _, name := range jo.WaitGroups {
+			wg := o.module.WaitGroups[name]
+			if wg == nil {
+				wg = o.design.TopLevel.WaitGroups[name]
+			}
+			if wg == nil {
+				return nil, fmt.Errorf("unknown wait group %q", name)
+			}
+			op.WaitGroups = append(op.WaitGroups, wg)
+		}
+		return op, nil
+	case "wait":
+		wg := o.module.WaitGroups[jo.Group]
+		if wg == nil {
+			wg = o.design.TopLevel.WaitGroups[jo.Group]
+		}
+		if wg == nil {
+			return nil, fmt.Errorf("unknown wait group %q", jo.Group)
+		}
+		return &WaitOperation{Group: wg, Source: source}, nil
+	case "lock", "unlock":
+		mu := o.module.Mutexes[jo.Mutex]
+		if mu == nil {
+			mu = o.design.TopLevel.Mutexes[jo.Mutex]
+		}
+		if mu == nil {
+			return nil, fmt.Errorf("unknown mutex %q", jo.Mutex)
+		}
+		if jo.Kind == "lock" {
+			return &LockOperation{Mutex: mu, Source: source}, nil
+		}
+		return &UnlockOperation{Mutex: mu, Source: source}, nil
+	}
+	return nil, fmt.Errorf("unknown operation kind %q", jo.Kind)
+}
+
+func (o *jsonOpDecoder) terminator(jt *jsonTerminator) (Terminator, error) {
+	switch jt.Kind {
+	case "branch":
+		cond, err := o.signal(jt.Cond)
+		if err != nil {
+			return nil, err
+		}
+		t, err := o.block(jt.True)
+		if err != nil {
+			return nil, err
+		}
+		f, err := o.block(jt.False)
+		if err != nil {
+			return nil, err
+		}
+		return &BranchTerminator{Cond: cond, True: t, False: f}, nil
+	case "jump":
+		target, err := o.block(jt.Target)
+		if err != nil {
+			return nil, err
+		}
+		return &JumpTerminator{Target: target}, nil
+	case "return":
+		return &ReturnTerminator{}, nil
+	}
+	return nil, fmt.Errorf("unknown terminator kind %q", jt.Kind)
+}
@@ -0,0 +1,97 @@
+package ir
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestJSONRoundTripsDesign(t *testing.T) {
+	programs := map[string]string{
+		"branch":         branchProgram,
+		"pipeline":       pipelineProgram,
+		"panic":          panicProgram,
+		"serverLoop":     serverLoopProgram,
+		"zeroTrip":       zeroTripProgram,
+		"waitGroup":      waitGroupProgram,
+		"channelLen":     channelLenProgram,
+		"sharedChannel":  sharedChannelProgram,
+		"component":      componentProgram,
+		"enum":           enumProgram,
+		"float":          floatProgram,
+		"software":       softwareProgram,
+		"mutex":          mutexProgram,
+		"nestedSpawnArg": nestedSpawnArgProgram,
+		"sensitivity":    sensitivityProgram,
+	}
+	for name, src := range programs {
+		t.Run(name, func(t *testing.T) {
+			design := buildDesignFromSource(t, src)
+			var encoded bytes.Buffer
+			if err := EncodeJSON(&encoded, design); err != nil {
+				t.Fatalf("encode failed: %v", err)
+			}
+			decoded, err := DecodeJSON(bytes.NewReader(encoded.Bytes()))
+			if err != nil {
+				t.Fatalf("decode failed: %v\n%s", err, encoded.String())
+			}
+			var want, got bytes.Buffer
+			Dump(design, &want)
+			Dump(decoded, &got)
+			if got.String() != want.String() {
+				t.Fatalf("dump of decoded design differs\nwant:\n%s\ngot:\n%s", want.String(), got.String())
+			}
+			var again bytes.Buffer
+			if err := EncodeJSON(&again, decoded); err != nil {
+				t.Fatalf("re-encode failed: %v", err)
+			}
+			if again.String() != encoded.String() {
+				t.Fatalf("re-encoded JSON differs\nwant:\n%s\ngot:\n%s", encoded.String(), again.String())
+			}
+		})
+	}
+}
+
+func TestDecodeJSONReportsErrors(t *testing.T) {
+	cases := []struct {
+		name string
+		src  string
+		msg  string
+	}{
+		{
+			name: "version",
+			src:  `{"version": 2, "top": "main", "modules": [{"name": "main"}]}`,
+			msg:  "unsupported IR JSON version 2",
+		},
+		{
+			name: "unknown signal",
+			src: `{"version": 1, "top": "main", "modules": [{"name": "main",
+				"signals": [{"name": "a", "kind": "wire", "type": {"width": 8}}],
+				"processes": [{"name": "main", "sensitivity": "sequential", "stage": 0, "blocks": [
+					{"label": "entry", "ops": [{"kind": "bin", "operator": "add", "dest": "a", "left": "a", "right": "b"}],
+					 "terminator": {"kind": "return"}}]}]}]}`,
+			msg: `module main: process main: block entry: op 0 (bin): unknown signal "b"`,
+		},
+		{
+			name: "unknown block",
+			src: `{"version": 1, "top": "main", "modules": [{"name": "main",
+				"processes": [{"name": "main", "sensitivity": "sequential", "stage": 0, "blocks": [
+					{"label": "entry", "terminator": {"kind": "jump", "target": "exit"}}]}]}]}`,
+			msg: `unknown block "exit"`,
+		},
+		{
+			name: "unknown goroutine",
+			src: `{"version": 1, "top": "main", "modules": [{"name": "main",
+				"wait_groups": [{"name": "wg", "count": 1, "members": ["ghost"]}]}]}`,
+			msg: `module main: wait group wg: unknown goroutine "ghost"`,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := DecodeJSON(strings.NewReader(tc.src))
+			if err == nil || !strings.Contains(err.Error(), tc.msg) {
+				t.Fatalf("expected error containing %q, got %v", tc.msg, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package ir
+
+import (
+	"go/token"
+	"go/types"
+
+	"golang.org/x/tools/go/ssa"
+
+	"mygo/internal/ssainfo"
+)
+
+// newMutex records the sync.Mutex held at v. A //mygo:arbiter directive on
+// its declaration picks how waiting processes take turns.
+func (b *builder) newMutex(v ssa.Value, name string, pos token.Pos) *Mutex {
+	mu := &Mutex{
+		Name:        name,
+		Arbitration: b.arbiterDirective(pos, ArbitrateRoundRobin),
+		Source:      pos,
+	}
+	b.module.Mutexes[name] = mu
+	b.mutexes[v] = mu
+	return mu
+}
+
+// mutexForValue returns the mutex v points to. Package-level mutexes are
+// created the first time a process uses them.
+func (b *builder) mutexForValue(v ssa.Value) *Mutex {
+	if mu, ok := b.mutexes[v]; ok {
+		return mu
+	}
+	if g, ok := v.(*ssa.Global); ok && ssainfo.IsMutexPointer(g.Type()) {
+		return b.newMutex(g, g.Name(), g.Pos())
+	}
+	return nil
+}
+
+// handleMutexCall lowers Lock to a blocking request for the mutex and Unlock
+// to its release. Values forwarded from earlier stores to shared registers
+// are dropped at either point: another process may write the register while
+// this one waits, and the stores have landed by the time it runs on.
+func (b *builder) handleMutexCall(proc *Process, bb *BasicBlock, call *ssa.CallCommon) {
+	method := ssainfo.MutexMethod(call)
+	if method == "" || len(call.Args) == 0 {
+		return
+	}
+	mu := b.mutexForValue(call.Args[0])
+	if mu == nil {
+		return
+	}
+	switch method {
+	case "Lock":
+		mu.AddUser(Site{Process: proc})
+		bb.Ops = append(bb.Ops, &LockOperation{Mutex: mu, Source: call.Pos()})
+	case "Unlock":
+		bb.Ops = append(bb.Ops, &UnlockOperation{Mutex: mu, Source: call.Pos()})
+	}
+	b.forgetSharedValues()
+}
+
+// deferUnlock records a deferred Unlock, which runs when fn returns.
+func (b *builder) deferUnlock(fn *ssa.Function, call *ssa.CallCommon) {
+	if mu := b.mutexForValue(call.Args[0]); mu != nil {
+		b.deferred[fn] = append(b.deferred[fn], mu)
+	}
+}
+
+// runDefers releases the mutexes fn unlocks with defer, latest first.
+func (b *builder) runDefers(bb *BasicBlock, fn *ssa.Function) {
+	deferred := b.deferred[fn]
+	for i := len(deferred) - 1; i >= 0; i-- {
+		bb.Ops = append(bb.Ops, &UnlockOperation{Mutex: deferred[i]})
+	}
+	if len(deferred) > 0 {
+		b.forgetSharedValues()
+	}
+}
+
+// globalSignal returns the shared register behind a package-level variable.
+// It starts with the constant the package initializer stores into it.
+func (b *builder) globalSignal(g *ssa.Global) *Signal {
+	elem := g.Type().(*types.Pointer).Elem()
+	sig := &Signal{
+		Name:   g.Name(),
+		Type:   b.signalType(elem),
+		Kind:   Shared,
+		Source: g.Pos(),
+	}
+	if _, taken := b.module.Signals[sig.Name]; taken {
+		sig.Name = b.uniqueName(g.Name())
+	}
+	if init := g.Pkg.Func("init"); init != nil {
+		for _, block := range init.Blocks {
+			for _, instr := range block.Instrs {
+				if store, ok := instr.(*ssa.Store); ok && store.Addr == g {
+					if c, ok := store.Val.(*ssa.Const); ok {
+						sig.Value = extractConstValue(c)
+					}
+				}
+			}
+		}
+	}
+	b.module.Signals[sig.Name] = sig
+	b.signals[g] = sig
+	return sig
+}
+
+// readShared returns the value of a shared register, forwarding a store made
+// earlier in the same state.
+func (b *builder) readShared(sig *Signal) *Signal {
+	if value, ok := b.fieldValues[sig]; ok {
+		return value
+	}
+	return sig
+}
+
+// forgetSharedValues stops forwarding stores to shared registers.
+func (b *builder) forgetSharedValues() {
+	for sig := range b.fieldValues {
+		if sig.Kind == Shared {
+			delete(b.fieldValues, sig)
+		}
+	}
+}
@@ -0,0 +1,1460 @@
+package ir
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ParseError reports malformed textual IR at a 1-based line and column.
+type ParseError struct {
+	Line   int
+	Column int
+	Msg    string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%d:%d: %s", e.Line, e.Column, e.Msg)
+}
+
+// Parse reads a design in the textual form Dump writes. Modules, processes,
+// blocks and enums may be referenced before they are declared; signals,
+// channels, wait groups and mutexes must be listed in their section first.
+// Process modules see the channels, wait groups and mutexes of the top-level
+// module, which comes first, and a signal listed by several modules is one
+// signal. Instances are tied to the go statements of the module's process in
+// order. Channel endpoints, wait group members, mutex users, block edges and
+// software bindings are rebuilt from the operations and streams; the
+// goroutines a channel, wait group or mutex lists only fix their order. Lines
+// starting with // are comments.
+func Parse(r io.Reader) (*Design, error) {
+	p := &textParser{
+		design:        &Design{},
+		signals:       make(map[string]*Signal),
+		modules:       make(map[string]*Module),
+		moduleDefined: make(map[*Module]bool),
+		moduleRefs:    make(map[*Module]*ParseError),
+		procs:         make(map[string]*Process),
+		procDefined:   make(map[*Process]bool),
+		procRefs:      make(map[*Process]*ParseError),
+		detached:      make(map[string]*Channel),
+		endpointOrder: make(map[*Channel]map[ChannelDirection]listedSites),
+		memberOrder:   make(map[*WaitGroup]listedSites),
+		userOrder:     make(map[*Mutex]listedSites),
+	}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	for scanner.Scan() {
+		p.line++
+		if err := p.parseLine(scanner.Text()); err != nil {
+			return nil, err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if err := p.finishModule(); err != nil {
+		return nil, err
+	}
+	if len(p.design.Modules) == 0 {
+		return nil, &ParseError{Line: p.line + 1, Column: 1, Msg: "expected a module"}
+	}
+	if err := firstUnresolved(p.procRefs, p.procDefined); err != nil {
+		return nil, err
+	}
+	if err := firstUnresolved(p.moduleRefs, p.moduleDefined); err != nil {
+		return nil, err
+	}
+	p.design.TopLevel = p.design.Modules[0]
+	if err := p.finishDesign(); err != nil {
+		return nil, err
+	}
+	return p.design, nil
+}
+
+type textParser struct {
+	design  *Design
+	module  *Module
+	section string
+	line    int
+
+	proc   *Process
+	block  *BasicBlock
+	blocks map[string]*BasicBlock
+
+	// Forward references are resolved when the design, module or process
+	// ends; the positions point at their first use. Signals, modules,
+	// processes and detached channels are shared by every module, enums and
+	// blocks are local.
+	signals       map[string]*Signal
+	modules       map[string]*Module
+	moduleDefined map[*Module]bool
+	moduleRefs    map[*Module]*ParseError
+	procs         map[string]*Process
+	procDefined   map[*Process]bool
+	procRefs      map[*Process]*ParseError
+	blockDefined  map[*BasicBlock]bool
+	blockRefs     map[*BasicBlock]*ParseError
+	enums         map[string]*EnumType
+	enumDefined   map[*EnumType]bool
+	enumRefs      map[*EnumType]*ParseError
+	detached      map[string]*Channel
+	// endpointOrder keeps the goroutine order a channel listed explicitly
+	// for a shared side, which decides priority arbitration, and
+	// memberOrder and userOrder the order of wait group members and mutex
+	// users.
+	endpointOrder map[*Channel]map[ChannelDirection]listedSites
+	memberOrder   map[*WaitGroup]listedSites
+	userOrder     map[*Mutex]listedSites
+}
+
+// listedSites are the goroutine names a section entry lists and the
+// position of the entry.
+type listedSites struct {
+	names []string
+	at    ParseError
+}
+
+func (p *textParser) errorf(col int, format string, args ...interface{}) error {
+	return &ParseError{Line: p.line, Column: col, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *textParser) parseLine(text string) error {
+	trimmed := strings.TrimSpace(text)
+	if trimmed == "" || strings.HasPrefix(trimmed, "//") {
+		return nil
+	}
+	indent := len(text) - len(strings.TrimLeft(text, " \t"))
+	col := indent + 1
+	if indent == 0 {
+		name, ok := strings.CutPrefix(trimmed, "module ")
+		if !ok || strings.TrimSpace(name) == "" {
+			return p.errorf(col, "expected module <name>")
+		}
+		return p.startModule(strings.TrimSpace(name))
+	}
+	if p.module == nil {
+		return p.errorf(col, "expected module <name> before %q", trimmed)
+	}
+	switch {
+	case strings.HasPrefix(trimmed, "process "):
+		return p.parseProcess(trimmed, col)
+	case strings.HasPrefix(trimmed, "params "):
+		return p.parseSignalList(trimmed, col, "params")
+	case strings.HasPrefix(trimmed, "chans "):
+		return p.parseChanParams(trimmed, col)
+	case strings.HasPrefix(trimmed, "results "):
+		return p.parseSignalList(trimmed, col, "results")
+	case strings.HasPrefix(trimmed, "block "):
+		return p.parseBlock(trimmed, col)
+	case strings.HasSuffix(trimmed, ":") && !strings.Contains(trimmed, " "):
+		if err := p.finishProcess(); err != nil {
+			return err
+		}
+		p.section = strings.TrimSuffix(trimmed, ":")
+		switch p.section {
+		case "ports", "signals", "enums", "channels", "waitgroups", "mutexes", "components", "streams", "instances":
+			return nil
+		}
+		return p.errorf(col, "unknown section %q", p.section)
+	}
+	if p.proc != nil {
+		if p.block == nil {
+			return p.errorf(col, "operation outside a block")
+		}
+		return p.parseOperation(text, indent)
+	}
+	if p.section == "" {
+		return p.errorf(col, "expected a section or process, got %q", trimmed)
+	}
+	return p.parseEntry(strings.Fields(trimmed), col)
+}
+
+func (p *textParser) startModule(name string) error {
+	if err := p.finishModule(); err != nil {
+		return err
+	}
+	module := p.moduleRef(name, 1)
+	if p.moduleDefined[module] {
+		return p.errorf(1, "module %s declared twice", name)
+	}
+	p.moduleDefined[module] = true
+	p.module = module
+	p.design.Modules = append(p.design.Modules, p.module)
+	p.section = ""
+	p.enums = make(map[string]*EnumType)
+	p.enumDefined = make(map[*EnumType]bool)
+	p.enumRefs = make(map[*EnumType]*ParseError)
+	return nil
+}
+
+// moduleRef returns the module called name, creating a placeholder for a
+// forward reference at col.
+func (p *textParser) moduleRef(name string, col int) *Module {
+	module, ok := p.modules[name]
+	if !ok {
+		module = &Module{
+			Name:       name,
+			Signals:    make(map[string]*Signal),
+			Channels:   make(map[string]*Channel),
+			WaitGroups: make(map[string]*WaitGroup),
+			Components: make(map[string]*Component),
+			Mutexes:    make(map[string]*Mutex),
+		}
+		p.modules[name] = module
+	}
+	if _, ok := p.moduleRefs[module]; !ok && !p.moduleDefined[module] {
+		p.moduleRefs[module] = &ParseError{Line: p.line, Column: col, Msg: fmt.Sprintf("unknown module %q", name)}
+	}
+	return module
+}
+
+// finishModule checks the module's enum references.
+func (p *textParser) finishModule() error {
+	if p.module == nil {
+		return nil
+	}
+	if err := p.finishProcess(); err != nil {
+		return err
+	}
+	if err := firstUnresolved(p.enumRefs, p.enumDefined); err != nil {
+		return err
+	}
+	p.module = nil
+	return nil
+}
+
+// finishDesign rebuilds the state Dump leaves implicit: the owner of each
+// channel, the go statement of each instance, software bindings from the
+// streams, and channel endpoints, wait group members and mutex users from
+// the operations, in the order an entry listed them.
+func (p *textParser) finishDesign() error {
+	claimChannels(p.design)
+	for _, module := range p.design.Modules {
+		linkInstances(module)
+		for _, stream := range module.Streams {
+			sw := stream.Software.Software
+			if sw == nil {
+				continue
+			}
+			sw.Channels = append(sw.Channels, stream.Channel)
+			sw.Params = append(sw.Params, strings.TrimPrefix(stream.Name, stream.Software.Name+"_"))
+			sw.ElemTypes = append(sw.ElemTypes, goTypeName(stream.Channel.Type))
+		}
+	}
+	linkSites(p.design)
+	sites := siteNameSet(p.design)
+	var lists []listedSites
+	for ch, order := range p.endpointOrder {
+		sortSites(ch.Producers, order[ChannelSend].names, endpointSite)
+		sortSites(ch.Consumers, order[ChannelReceive].names, endpointSite)
+		lists = append(lists, order[ChannelSend], order[ChannelReceive])
+	}
+	for wg, order := range p.memberOrder {
+		sortSites(wg.Members, order.names, siteOf)
+		lists = append(lists, order)
+	}
+	for mu, order := range p.userOrder {
+		sortSites(mu.Users, order.names, siteOf)
+		lists = append(lists, order)
+	}
+	var first *ParseError
+	for _, order := range lists {
+		for _, name := range order.names {
+			if sites[name] {
+				continue
+			}
+			if first == nil || order.at.Line < first.Line {
+				first = &ParseError{Line: order.at.Line, Column: order.at.Column, Msg: fmt.Sprintf("unknown goroutine %q", name)}
+			}
+			break
+		}
+	}
+	if first != nil {
+		return first
+	}
+	return nil
+}
+
+// linkInstances ties each instance of module to the next go statement of the
+// module's processes that spawns a process of the instance's module.
+func linkInstances(module *Module) {
+	var spawns []*SpawnOperation
+	for _, proc := range module.Processes {
+		for _, block := range proc.Blocks {
+			for _, op := range block.Ops {
+				if spawn, ok := op.(*SpawnOperation); ok && spawn.Callee.Software == nil {
+					spawns = append(spawns, spawn)
+				}
+			}
+		}
+	}
+	for _, inst := range module.Instances {
+		idx := slices.IndexFunc(spawns, func(spawn *SpawnOperation) bool {
+			return slices.Contains(inst.Module.Processes, spawn.Callee)
+		})
+		if idx >= 0 {
+			inst.Spawn = spawns[idx]
+			spawns = slices.Delete(spawns, idx, idx+1)
+		}
+	}
+}
+
+// siteNameSet returns the names of the design's goroutines, together with
+// the names a process module gives those below it, by which a channel the
+// module holds lists them.
+func siteNameSet(design *Design) map[string]bool {
+	sites := make(map[string]bool)
+	for _, site := range design.Sites() {
+		for idx := range len(site.Path) + 1 {
+			sites[Site{Process: site.Process, Path: site.Path[idx:]}.Name()] = true
+		}
+	}
+	return sites
+}
+
+func endpointSite(ep *ChannelEndpoint) Site { return ep.Site }
+
+func siteOf(site Site) Site { return site }
+
+// sortSites moves the items of the goroutines names lists to the front, in
+// that order.
+func sortSites[T any](items []T, names []string, site func(T) Site) {
+	rank := func(item T) int {
+		if idx := slices.Index(names, site(item).Name()); idx >= 0 {
+			return idx
+		}
+		return len(names)
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return rank(items[i]) < rank(items[j])
+	})
+}
+
+// firstUnresolved returns the earliest reference to something that was never
+// declared, or nil.
+func firstUnresolved[K comparable](refs map[K]*ParseError, defined map[K]bool) error {
+	var first *ParseError
+	for key, ref := range refs {
+		if defined[key] {
+			continue
+		}
+		if first == nil || ref.Line < first.Line || ref.Line == first.Line && ref.Column < first.Column {
+			first = ref
+		}
+	}
+	if first == nil {
+		return nil
+	}
+	return first
+}
+
+// goTypeName spells the Go type of a channel element for co-simulation.
+func goTypeName(t *SignalType) string {
+	switch {
+	case t.Float:
+		return "float32"
+	case t.Width == 1:
+		return "bool"
+	case t.Signed:
+		return fmt.Sprintf("int%d", t.Width)
+	}
+	return fmt.Sprintf("uint%d", t.Width)
+}
+
+// finishProcess checks that every block the current process jumps to was
+// declared and links the blocks' edges.
+func (p *textParser) finishProcess() error {
+	if p.proc == nil {
+		return nil
+	}
+	if err := firstUnresolved(p.blockRefs, p.blockDefined); err != nil {
+		return err
+	}
+	for _, block := range p.proc.Blocks {
+		var succs []*BasicBlock
+		switch term := block.Terminator.(type) {
+		case *BranchTerminator:
+			succs = []*BasicBlock{term.True, term.False}
+		case *JumpTerminator:
+			succs = []*BasicBlock{term.Target}
+		}
+		for _, succ := range succs {
+			block.Successors = append(block.Successors, succ)
+			succ.Predecessors = append(succ.Predecessors, block)
+		}
+	}
+	p.proc = nil
+	p.block = nil
+	return nil
+}
+
+// process returns the process called name, creating a placeholder for a
+// forward reference at col.
+func (p *textParser) process(name string, col int) *Process {
+	proc, ok := p.procs[name]
+	if !ok {
+		proc = &Process{Name: name, Sensitivity: Sequential}
+		p.procs[name] = proc
+	}
+	if _, ok := p.procRefs[proc]; !ok && !p.procDefined[proc] {
+		p.procRefs[proc] = &ParseError{Line: p.line, Column: col, Msg: fmt.Sprintf("unknown process %q", name)}
+	}
+	return proc
+}
+
+func (p *textParser) enum(name string, col int) *EnumType {
+	enum, ok := p.enums[name]
+	if !ok {
+		enum = &EnumType{Name: name}
+		p.enums[name] = enum
+		p.enumRefs[enum] = &ParseError{Line: p.line, Column: col, Msg: fmt.Sprintf("unknown enum %q", name)}
+	}
+	return enum
+}
+
+// blockRef returns the block labelled name in the current process.
+func (p *textParser) blockRef(name string, col int) *BasicBlock {
+	block, ok := p.blocks[name]
+	if !ok {
+		block = &BasicBlock{Label: name}
+		p.blocks[name] = block
+		p.blockRefs[block] = &ParseError{Line: p.line, Column: col, Msg: fmt.Sprintf("unknown block %q", name)}
+	}
+	return block
+}
+
+// parseProcess reads "process <idx> <name> (stage=<n>, <sensitivity>)" or
+// "(stage=<n>, software <fn>)".
+func (p *textParser) parseProcess(text string, col int) error {
+	if err := p.finishProcess(); err != nil {
+		return err
+	}
+	open := strings.Index(text, "(")
+	fields := strings.Fields(text[:max(open, 0)])
+	if open < 0 || !strings.HasSuffix(text, ")") || len(fields) != 3 {
+		return p.errorf(col, "expected process <index> <name> (stage=<n>, <kind>)")
+	}
+	if _, err := strconv.Atoi(fields[1]); err != nil {
+		return p.errorf(col, "bad process index %q", fields[1])
+	}
+	proc := p.process(fields[2], col)
+	if p.procDefined[proc] {
+		return p.errorf(col, "process %s declared twice", proc.Name)
+	}
+	p.procDefined[proc] = true
+	attrs := strings.Split(text[open+1:len(text)-1], ",")
+	if len(attrs) != 2 {
+		return p.errorf(col+open, "expected (stage=<n>, <kind>)")
+	}
+	stage, ok := strings.CutPrefix(strings.TrimSpace(attrs[0]), "stage=")
+	n, err := strconv.Atoi(stage)
+	if !ok || err != nil {
+		return p.errorf(col+open, "bad stage %q", strings.TrimSpace(attrs[0]))
+	}
+	proc.Stage = n
+	switch kind := strings.Fields(attrs[1]); {
+	case len(kind) == 1 && kind[0] == "sequential":
+		proc.Sensitivity = Sequential
+	case len(kind) == 1 && kind[0] == "combinational":
+		proc.Sensitivity = Combinational
+	case len(kind) == 2 && kind[0] == "software":
+		proc.Software = &SoftwareBinding{Function: kind[1]}
+	default:
+		return p.errorf(col+open, "unknown process kind %q", strings.TrimSpace(attrs[1]))
+	}
+	p.module.Processes = append(p.module.Processes, proc)
+	p.proc = proc
+	p.block = nil
+	p.blocks = make(map[string]*BasicBlock)
+	p.blockDefined = make(map[*BasicBlock]bool)
+	p.blockRefs = make(map[*BasicBlock]*ParseError)
+	return nil
+}
+
+// parseSignalList reads "params <name>=<signal>, ..." or "results <signal>,
+// ..." between a process line and its first block. A param may leave out its
+// Go name.
+func (p *textParser) parseSignalList(text string, col int, keyword string) error {
+	if p.proc == nil || p.proc.Software != nil || p.block != nil {
+		return p.errorf(col, "%s must directly follow a hardware process line", keyword)
+	}
+	list := &p.proc.Params
+	if keyword == "results" {
+		list = &p.proc.Results
+	}
+	if len(*list) > 0 {
+		return p.errorf(col, "%s of process %s declared twice", keyword, p.proc.Name)
+	}
+	offset := col + len(keyword) + 1
+	for _, field := range strings.Split(strings.TrimPrefix(text, keyword+" "), ",") {
+		name := strings.TrimSpace(field)
+		if param, sig, ok := strings.Cut(name, "="); ok && keyword == "params" {
+			p.proc.ParamNames = append(p.proc.ParamNames, param)
+			field = strings.Repeat(" ", len(field)-len(sig)) + sig
+			name = sig
+		} else if keyword == "params" {
+			p.proc.ParamNames = append(p.proc.ParamNames, "")
+		}
+		sig := p.module.Signals[name]
+		if sig == nil {
+			return p.errorf(offset+len(field)-len(strings.TrimLeft(field, " ")), "unknown signal %q", name)
+		}
+		*list = append(*list, sig)
+		offset += len(field) + 1
+	}
+	return nil
+}
+
+// parseChanParams reads "chans <name> depth=<n> type=<type>, ..." between a
+// process line and its first block.
+func (p *textParser) parseChanParams(text string, col int) error {
+	if p.proc == nil || p.proc.Software != nil || p.block != nil {
+		return p.errorf(col, "chans must directly follow a hardware process line")
+	}
+	if len(p.proc.ChanParams) > 0 {
+		return p.errorf(col, "chans of process %s declared twice", p.proc.Name)
+	}
+	for _, item := range strings.Split(strings.TrimPrefix(text, "chans "), ",") {
+		fields := strings.Fields(item)
+		if len(fields) == 0 {
+			return p.errorf(col, "expected <name> depth=<n> type=<type>")
+		}
+		attrs, err := p.attributes(fields, col, "depth", "type")
+		if err != nil {
+			return err
+		}
+		depth, err := strconv.Atoi(attrs["depth"])
+		if err != nil || depth < 0 {
+			return p.errorf(col, "bad channel depth %q", attrs["depth"])
+		}
+		typ, err := p.parseType(attrs["type"], col)
+		if err != nil {
+			return err
+		}
+		p.proc.ChanParams = append(p.proc.ChanParams, &Channel{Name: fields[0], Depth: depth, Type: typ})
+	}
+	return nil
+}
+
+// parseBlock reads "block <label>" with an optional "(trip=<n>)" or
+// "(trip=?)".
+func (p *textParser) parseBlock(text string, col int) error {
+	if p.proc == nil {
+		return p.errorf(col, "block outside a process")
+	}
+	if p.proc.Software != nil {
+		return p.errorf(col, "software process %s has no blocks", p.proc.Name)
+	}
+	fields := strings.Fields(text)
+	if len(fields) < 2 || len(fields) > 3 {
+		return p.errorf(col, "expected block <label> [(trip=<n>)]")
+	}
+	block := p.blockRef(fields[1], col+len("block "))
+	if p.blockDefined[block] {
+		return p.errorf(col, "block %s declared twice in process %s", block.Label, p.proc.Name)
+	}
+	p.blockDefined[block] = true
+	if len(fields) == 3 {
+		trip, ok := strings.CutPrefix(fields[2], "(trip=")
+		trip, closed := strings.CutSuffix(trip, ")")
+		if !ok || !closed {
+			return p.errorf(col, "expected (trip=<n>), got %q", fields[2])
+		}
+		block.LoopHeader = true
+		if trip == "?" {
+			block.TripCount = -1
+		} else if n, err := strconv.ParseInt(trip, 10, 64); err == nil && n >= 0 {
+			block.TripCount = n
+		} else {
+			return p.errorf(col, "bad trip count %q", trip)
+		}
+	}
+	p.proc.Blocks = append(p.proc.Blocks, block)
+	p.block = block
+	return nil
+}
+
+// parseEntry reads one line of a module section.
+func (p *textParser) parseEntry(fields []string, col int) error {
+	m := p.module
+	switch p.section {
+	case "ports":
+		if len(fields) != 3 {
+			return p.errorf(col, "expected <in|out|io> <name> <type>")
+		}
+		dir, ok := parsePortDirection(fields[0])
+		if !ok {
+			return p.errorf(col, "unknown port direction %q", fields[0])
+		}
+		typ, err := p.parseType(fields[2], col)
+		if err != nil {
+			return err
+		}
+		m.Ports = append(m.Ports, Port{Name: fields[1], Direction: dir, Type: typ})
+	case "signals":
+		return p.parseSignal(fields, col)
+	case "enums":
+		if len(fields) == 0 {
+			return p.errorf(col, "expected <name> <member>=<value>...")
+		}
+		enum := p.enum(fields[0], col)
+		if p.enumDefined[enum] {
+			return p.errorf(col, "enum %s declared twice", enum.Name)
+		}
+		p.enumDefined[enum] = true
+		for _, field := range fields[1:] {
+			name, value, ok := strings.Cut(field, "=")
+			n, err := strconv.ParseInt(value, 10, 64)
+			if !ok || err != nil {
+				return p.errorf(col, "bad enum member %q", field)
+			}
+			enum.Members = append(enum.Members, EnumMember{Name: name, Value: n})
+		}
+	case "channels":
+		attrs, err := p.attributes(fields, col, "depth", "type")
+		if err != nil {
+			return err
+		}
+		depth, err := strconv.Atoi(attrs["depth"])
+		if err != nil || depth < 0 {
+			return p.errorf(col, "bad channel depth %q", attrs["depth"])
+		}
+		typ, err := p.parseType(attrs["type"], col)
+		if err != nil {
+			return err
+		}
+		ch := &Channel{Name: fields[0], Depth: depth, Type: typ}
+		if occupancy, ok := attrs["occupancy"]; ok {
+			if ch.Occupancy, err = strconv.Atoi(occupancy); err != nil || ch.Occupancy < 0 {
+				return p.errorf(col, "bad channel occupancy %q", occupancy)
+			}
+		}
+		if policy, ok := attrs["arbiter"]; ok {
+			if ch.Arbitration, ok = parseArbitration(policy); !ok {
+				return p.errorf(col, "unknown arbiter %q", policy)
+			}
+		}
+		order := make(map[ChannelDirection]listedSites)
+		for dir, key := range map[ChannelDirection]string{ChannelSend: "producers", ChannelReceive: "consumers"} {
+			if names := splitList(attrs[key]); len(names) > 0 {
+				order[dir] = p.listed(names, col)
+			}
+		}
+		if len(order) > 0 {
+			p.endpointOrder[ch] = order
+		}
+		m.Channels[ch.Name] = ch
+	case "waitgroups":
+		attrs, err := p.attributes(fields, col, "count", "members")
+		if err != nil {
+			return err
+		}
+		count, err := strconv.Atoi(attrs["count"])
+		if err != nil {
+			return p.errorf(col, "bad wait group count %q", attrs["count"])
+		}
+		wg := &WaitGroup{Name: fields[0], Count: count}
+		p.memberOrder[wg] = p.listed(splitList(attrs["members"]), col)
+		m.WaitGroups[wg.Name] = wg
+	case "mutexes":
+		attrs, err := p.attributes(fields, col, "arbiter", "users")
+		if err != nil {
+			return err
+		}
+		mu := &Mutex{Name: fields[0]}
+		var ok bool
+		if mu.Arbitration, ok = parseArbitration(attrs["arbiter"]); !ok {
+			return p.errorf(col, "unknown arbiter %q", attrs["arbiter"])
+		}
+		p.userOrder[mu] = p.listed(splitList(attrs["users"]), col)
+		m.Mutexes[mu.Name] = mu
+	case "components":
+		attrs, err := p.attributes(fields, col, "type", "owner", "fields")
+		if err != nil {
+			return err
+		}
+		comp := &Component{Name: fields[0], Type: attrs["type"]}
+		if owner := attrs["owner"]; owner != "-" {
+			comp.Owner = p.process(owner, col)
+		}
+		for _, name := range splitList(attrs["fields"]) {
+			sig := m.Signals[name]
+			if sig == nil {
+				return p.errorf(col, "unknown field signal %q", name)
+			}
+			comp.Fields = append(comp.Fields, sig)
+		}
+		m.Components[comp.Name] = comp
+	case "streams":
+		if len(fields) < 2 {
+			return p.errorf(col, "expected <in|out> <name> chan=<channel> software=<process>")
+		}
+		dir, ok := parsePortDirection(fields[0])
+		if !ok || dir == InOut {
+			return p.errorf(col, "stream direction must be in or out, got %q", fields[0])
+		}
+		attrs, err := p.attributes(fields[1:], col, "chan", "software")
+		if err != nil {
+			return err
+		}
+		ch := m.Channels[attrs["chan"]]
+		if ch == nil {
+			return p.errorf(col, "unknown channel %q", attrs["chan"])
+		}
+		m.Streams = append(m.Streams, &Stream{
+			Name:      fields[1],
+			Channel:   ch,
+			Software:  p.process(attrs["software"], col),
+			Direction: dir,
+		})
+	case "instances":
+		return p.parseInstance(fields, col)
+	}
+	return nil
+}
+
+// listed records the goroutine names an entry at col lists.
+func (p *textParser) listed(names []string, col int) listedSites {
+	return listedSites{names: names, at: ParseError{Line: p.line, Column: col}}
+}
+
+// parseInstance reads "<name> <module> (<port>=<net>, ...)".
+func (p *textParser) parseInstance(fields []string, col int) error {
+	if len(fields) < 3 {
+		return p.errorf(col, "expected <name> <module> (<port>=<net>, ...)")
+	}
+	list := strings.Join(fields[2:], " ")
+	list, open := strings.CutPrefix(list, "(")
+	list, closed := strings.CutSuffix(list, ")")
+	if !open || !closed {
+		return p.errorf(col, "expected (<port>=<net>, ...) after module %s", fields[1])
+	}
+	inst := &Instance{Name: fields[0], Module: p.moduleRef(fields[1], col+len(fields[0])+1)}
+	for _, item := range strings.Split(list, ",") {
+		port, net, ok := strings.Cut(strings.TrimSpace(item), "=")
+		if !ok || port == "" || net == "" {
+			return p.errorf(col, "expected <port>=<net>, got %q", strings.TrimSpace(item))
+		}
+		inst.Connections = append(inst.Connections, Connection{Port: port, Net: net})
+	}
+	p.module.Instances = append(p.module.Instances, inst)
+	return nil
+}
+
+// lookupChannel, lookupWaitGroup and lookupMutex find name in the current module and then
+// in the top-level module, which owns them for process modules. A channel
+// param of the current process comes first.
+func (p *textParser) lookupChannel(name string) *Channel {
+	if p.proc != nil {
+		if idx := slices.IndexFunc(p.proc.ChanParams, func(ch *Channel) bool { return ch.Name == name }); idx >= 0 {
+			return p.proc.ChanParams[idx]
+		}
+	}
+	if ch := p.module.Channels[name]; ch != nil {
+		return ch
+	}
+	return p.design.Modules[0].Channels[name]
+}
+
+func (p *textParser) lookupWaitGroup(name string) *WaitGroup {
+	if wg := p.module.WaitGroups[name]; wg != nil {
+		return wg
+	}
+	return p.design.Modules[0].WaitGroups[name]
+}
+
+func (p *textParser) lookupMutex(name string) *Mutex {
+	if mu := p.module.Mutexes[name]; mu != nil {
+		return mu
+	}
+	return p.design.Modules[0].Mutexes[name]
+}
+
+// parseSignal reads "<name> <kind> <type> [= <value> [(<note>)]]".
+func (p *textParser) parseSignal(fields []string, col int) error {
+	if len(fields) < 3 {
+		return p.errorf(col, "expected <name> <kind> <type> [= <value>]")
+	}
+	kind, ok := parseSignalKind(fields[1])
+	if !ok {
+		return p.errorf(col, "unknown signal kind %q", fields[1])
+	}
+	typ, err := p.parseType(fields[2], col)
+	if err != nil {
+		return err
+	}
+	sig := &Signal{Name: fields[0], Kind: kind, Type: typ}
+	if len(fields) > 3 {
+		if fields[3] != "=" || len(fields) < 5 {
+			return p.errorf(col, "expected = <value> after the type of %s", sig.Name)
+		}
+		sig.Value = parseValue(fields[4], typ)
+	}
+	if _, taken := p.module.Signals[sig.Name]; taken {
+		return p.errorf(col, "signal %s declared twice", sig.Name)
+	}
+	if prev := p.signals[sig.Name]; prev != nil {
+		if prev.Kind != sig.Kind || prev.Type.Description() != sig.Type.Description() || !reflect.DeepEqual(prev.Value, sig.Value) {
+			return p.errorf(col, "signal %s does not match its declaration in another module", sig.Name)
+		}
+		sig = prev
+	}
+	p.signals[sig.Name] = sig
+	p.module.Signals[sig.Name] = sig
+	return nil
+}
+
+// parseValue converts a constant as Dump prints it back to the Go type the
+// builder stores: bool, int64 for signed and uint64 for unsigned and float
+// types.
+func parseValue(text string, typ *SignalType) interface{} {
+	switch text {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	if typ.Signed {
+		if n, err := strconv.ParseInt(text, 10, 64); err == nil {
+			return n
+		}
+	} else if n, err := strconv.ParseUint(text, 10, 64); err == nil {
+		return n
+	}
+	return text
+}
+
+// parseType reads "<width>b<s|u>" or "f32", optionally followed by
+// ":<enum>".
+func (p *textParser) parseType(text string, col int) (*SignalType, error) {
+	text, enumName, hasEnum := strings.Cut(text, ":")
+	typ := &SignalType{}
+	if text == "f32" {
+		typ.Width = 32
+		typ.Float = true
+	} else {
+		width, sign, ok := strings.Cut(text, "b")
+		n, err := strconv.Atoi(width)
+		if !ok || err != nil || n <= 0 || (sign != "s" && sign != "u") {
+			return nil, p.errorf(col, "bad type %q; want <width>b<s|u> or f32", text)
+		}
+		typ.Width = n
+		typ.Signed = sign == "s"
+	}
+	if hasEnum {
+		typ.Enum = p.enum(enumName, col)
+	}
+	return typ, nil
+}
+
+// attributes splits "<name> key=value..." and checks that every required
+// key is present. Comma-separated lists stay joined.
+func (p *textParser) attributes(fields []string, col int, required ...string) (map[string]string, error) {
+	if len(fields) == 0 {
+		return nil, p.errorf(col, "expected <name> %s", strings.Join(required, "=... ")+"=...")
+	}
+	attrs := make(map[string]string)
+	for _, field := range fields[1:] {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			return nil, p.errorf(col, "expected key=value, got %q", field)
+		}
+		attrs[key] = value
+	}
+	for _, key := range required {
+		if _, ok := attrs[key]; !ok {
+			return nil, p.errorf(col, "%s is missing %s=", fields[0], key)
+		}
+	}
+	return attrs, nil
+}
+
+func splitList(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(text, ",")
+}
+
+func parsePortDirection(text string) (PortDirection, bool) {
+	for _, dir := range []PortDirection{Input, Output, InOut} {
+		if strings.TrimSpace(portDirection(dir)) == text {
+			return dir, true
+		}
+	}
+	return Input, false
+}
+
+func parseSignalKind(text string) (SignalKind, bool) {
+	for _, kind := range []SignalKind{Wire, Reg, Const, Shared} {
+		if signalKind(kind) == text {
+			return kind, true
+		}
+	}
+	return Wire, false
+}
+
+func parseArbitration(text string) (Arbitration, bool) {
+	for _, policy := range []Arbitration{ArbitrateRoundRobin, ArbitratePriority} {
+		if policy.String() == text {
+			return policy, true
+		}
+	}
+	return ArbitrateRoundRobin, false
+}
+
+// opToken is a word, a quoted string or one of the punctuation characters
+// ( ) [ ] , ; ? : and the := operator.
+type opToken struct {
+	text   string
+	quoted bool
+	col    int
+}
+
+func tokenizeOp(line string, indent int) ([]opToken, error) {
+	var toks []opToken
+	for i := indent; i < len(line); {
+		c := line[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case c == '"':
+			quoted, err := strconv.QuotedPrefix(line[i:])
+			if err != nil {
+				return nil, &ParseError{Column: i + 1, Msg: "unterminated string"}
+			}
+			text, _ := strconv.Unquote(quoted)
+			toks = append(toks, opToken{text: text, quoted: true, col: i + 1})
+			i += len(quoted)
+		case c == ':' && i+1 < len(line) && line[i+1] == '=':
+			toks = append(toks, opToken{text: ":=", col: i + 1})
+			i += 2
+		case strings.IndexByte("()[],;?:", c) >= 0:
+			toks = append(toks, opToken{text: string(c), col: i + 1})
+			i++
+		default:
+			start := i
+			for i < len(line) && !unicode.IsSpace(rune(line[i])) && strings.IndexByte("()[],;?:\"", line[i]) < 0 {
+				i++
+			}
+			toks = append(toks, opToken{text: line[start:i], col: start + 1})
+		}
+	}
+	return toks, nil
+}
+
+// opParser walks the tokens of one operation line.
+type opParser struct {
+	*textParser
+	toks []opToken
+	pos  int
+	end  int
+}
+
+func (o *opParser) peek() string {
+	if o.pos < len(o.toks) {
+		return o.toks[o.pos].text
+	}
+	return ""
+}
+
+func (o *opParser) col() int {
+	if o.pos < len(o.toks) {
+		return o.toks[o.pos].col
+	}
+	return o.end
+}
+
+func (o *opParser) next() opToken {
+	tok := opToken{col: o.end}
+	if o.pos < len(o.toks) {
+		tok = o.toks[o.pos]
+		o.pos++
+	}
+	return tok
+}
+
+func (o *opParser) expect(text string) error {
+	if o.peek() != text || o.pos < len(o.toks) && o.toks[o.pos].quoted {
+		return o.errorf(o.col(), "expected %q, got %s", text, o.describe())
+	}
+	o.pos++
+	return nil
+}
+
+func (o *opParser) describe() string {
+	if o.pos >= len(o.toks) {
+		return "end of line"
+	}
+	return strconv.Quote(o.toks[o.pos].text)
+}
+
+func (o *opParser) word() (opToken, error) {
+	if o.pos >= len(o.toks) || o.toks[o.pos].quoted || len(o.toks[o.pos].text) == 1 && strings.Contains("()[],;?:", o.toks[o.pos].text) {
+		return opToken{}, o.errorf(o.col(), "expected a name, got %s", o.describe())
+	}
+	return o.next(), nil
+}
+
+func (o *opParser) quoted() (string, error) {
+	if o.pos >= len(o.toks) || !o.toks[o.pos].quoted {
+		return "", o.errorf(o.col(), "expected a quoted string, got %s", o.describe())
+	}
+	return o.next().text, nil
+}
+
+func (o *opParser) signal() (*Signal, error) {
+	tok, err := o.word()
+	if err != nil {
+		return nil, err
+	}
+	sig := o.module.Signals[tok.text]
+	if sig == nil {
+		return nil, o.errorf(tok.col, "unknown signal %q", tok.text)
+	}
+	return sig, nil
+}
+
+func (o *opParser) channel() (*Channel, error) {
+	tok, err := o.word()
+	if err != nil {
+		return nil, err
+	}
+	ch := o.lookupChannel(tok.text)
+	if ch == nil {
+		return nil, o.errorf(tok.col, "unknown channel %q", tok.text)
+	}
+	return ch, nil
+}
+
+func (o *opParser) block() (*BasicBlock, error) {
+	tok, err := o.word()
+	if err != nil {
+		return nil, err
+	}
+	return o.blockRef(tok.text, tok.col), nil
+}
+
+func (o *opParser) done() error {
+	if o.pos < len(o.toks) {
+		return o.errorf(o.col(), "unexpected %s", o.describe())
+	}
+	return nil
+}
+
+// parseOperation reads one operation or terminator into the current block.
+func (p *textParser) parseOperation(line string, indent int) error {
+	toks, err := tokenizeOp(line, indent)
+	if err != nil {
+		perr := err.(*ParseError)
+		perr.Line = p.line
+		return perr
+	}
+	o := &opParser{textParser: p, toks: toks, end: len(line) + 1}
+	if p.block.Terminator != nil {
+		return p.errorf(indent+1, "operation after the terminator of block %s", p.block.Label)
+	}
+	var op Operation
+	var term Terminator
+	if len(toks) > 1 && (toks[1].text == ":=" || toks[1].text == "<-" || toks[1].text == "=") {
+		op, err = o.parseAssignment()
+	} else {
+		op, term, err = o.parseStatement()
+	}
+	if err == nil {
+		err = o.done()
+	}
+	if err != nil {
+		return err
+	}
+	if term != nil {
+		p.block.Terminator = term
+	} else {
+		p.block.Ops = append(p.block.Ops, op)
+	}
+	return nil
+}
+
+// parseStatement reads an operation without a destination or a terminator.
+func (o *opParser) parseStatement() (Operation, Terminator, error) {
+	keyword, err := o.word()
+	if err != nil {
+		return nil, nil, err
+	}
+	switch keyword.text {
+	case "return":
+		return nil, &ReturnTerminator{}, nil
+	case "jump":
+		target, err := o.block()
+		return nil, &JumpTerminator{Target: target}, err
+	case "br":
+		term := &BranchTerminator{}
+		if term.Cond, err = o.signal(); err != nil {
+			return nil, nil, err
+		}
+		if err = o.expect("?"); err != nil {
+			return nil, nil, err
+		}
+		if term.True, err = o.block(); err != nil {
+			return nil, nil, err
+		}
+		if err = o.expect(":"); err != nil {
+			return nil, nil, err
+		}
+		term.False, err = o.block()
+		return nil, term, err
+	case "send":
+		op := &SendOperation{}
+		if op.Channel, err = o.channel(); err != nil {
+			return nil, nil, err
+		}
+		if err = o.expect("<-"); err != nil {
+			return nil, nil, err
+		}
+		op.Value, err = o.signal()
+		return op, nil, err
+	case "wait":
+		tok, err := o.word()
+		if err != nil {
+			return nil, nil, err
+		}
+		wg := o.lookupWaitGroup(tok.text)
+		if wg == nil {
+			return nil, nil, o.errorf(tok.col, "unknown wait group %q", tok.text)
+		}
+		return &WaitOperation{Group: wg}, nil, nil
+	case "lock", "unlock":
+		tok, err := o.word()
+		if err != nil {
+			return nil, nil, err
+		}
+		mu := o.lookupMutex(tok.text)
+		if mu == nil {
+			return nil, nil, o.errorf(tok.col, "unknown mutex %q", tok.text)
+		}
+		if keyword.text == "lock" {
+			return &LockOperation{Mutex: mu}, nil, nil
+		}
+		return &UnlockOperation{Mutex: mu}, nil, nil
+	case "print":
+		op, err := o.parsePrint()
+		return op, nil, err
+	case "panic":
+		op := &AssertOperation{}
+		if o.peek() == "when" {
+			o.next()
+			if op.Cond, err = o.signal(); err != nil {
+				return nil, nil, err
+			}
+		}
+		if op.Message, err = o.quoted(); err != nil {
+			return nil, nil, err
+		}
+		if err = o.expect("at"); err != nil {
+			return nil, nil, err
+		}
+		op.Location, err = o.quoted()
+		return op, nil, err
+	case "go":
+		op, err := o.parseSpawn()
+		return op, nil, err
+	}
+	return nil, nil, o.errorf(keyword.col, "unknown operation %q", keyword.text)
+}
+
+// parsePrint reads quoted text and %d(<signal>), %x(...) or %b(...) values.
+func (o *opParser) parsePrint() (Operation, error) {
+	op := &PrintOperation{}
+	for o.pos < len(o.toks) {
+		if o.toks[o.pos].quoted {
+			op.Segments = append(op.Segments, PrintSegment{Text: o.next().text})
+			continue
+		}
+		verb := o.next()
+		seg := PrintSegment{}
+		switch verb.text {
+		case "%d":
+			seg.Verb = PrintVerbDec
+		case "%x":
+			seg.Verb = PrintVerbHex
+		case "%b":
+			seg.Verb = PrintVerbBin
+		default:
+			return nil, o.errorf(verb.col, "expected a quoted string or %%d(<signal>), got %q", verb.text)
+		}
+		var err error
+		if err = o.expect("("); err != nil {
+			return nil, err
+		}
+		if seg.Value, err = o.signal(); err != nil {
+			return nil, err
+		}
+		if err = o.expect(")"); err != nil {
+			return nil, err
+		}
+		op.Segments = append(op.Segments, seg)
+	}
+	return op, nil
+}
+
+// parseSpawn reads "go <process>(stage=<n>)(<args>; ch:<channels>;
+// wg:<wait groups>)". The stage is the callee's and is taken from its
+// process line.
+func (o *opParser) parseSpawn() (Operation, error) {
+	callee, err := o.word()
+	if err != nil {
+		return nil, err
+	}
+	op := &SpawnOperation{Callee: o.process(callee.text, callee.col)}
+	if o.peek() == "(" && o.pos+1 < len(o.toks) && strings.HasPrefix(o.toks[o.pos+1].text, "stage=") {
+		o.pos += 2
+		if err := o.expect(")"); err != nil {
+			return nil, err
+		}
+	}
+	if err := o.expect("("); err != nil {
+		return nil, err
+	}
+	// section is "", "ch" or "wg", which follow each other in that order.
+	section := ""
+	for o.peek() != ")" {
+		if len(op.Args)+len(op.ChanArgs)+len(op.WaitGroups) > 0 || section != "" {
+			switch o.peek() {
+			case ",":
+				o.next()
+			case ";":
+				if section == "wg" {
+					return nil, o.errorf(o.col(), "unexpected \";\"")
+				}
+				o.next()
+			default:
+				return nil, o.errorf(o.col(), "expected \",\" or \")\", got %s", o.describe())
+			}
+		}
+		if label := o.peek(); (label == "ch" || label == "wg") && label > section && o.pos+1 < len(o.toks) && o.toks[o.pos+1].text == ":" {
+			o.pos += 2
+			section = label
+		}
+		switch section {
+		case "ch":
+			tok, err := o.word()
+			if err != nil {
+				return nil, err
+			}
+			op.ChanArgs = append(op.ChanArgs, o.spawnChannel(tok.text))
+			continue
+		case "wg":
+			tok, err := o.word()
+			if err != nil {
+				return nil, err
+			}
+			wg := o.lookupWaitGroup(tok.text)
+			if wg == nil {
+				return nil, o.errorf(tok.col, "unknown wait group %q", tok.text)
+			}
+			op.WaitGroups = append(op.WaitGroups, wg)
+			continue
+		}
+		arg, err := o.signal()
+		if err != nil {
+			return nil, err
+		}
+		op.Args = append(op.Args, arg)
+	}
+	return op, o.expect(")")
+}
+
+// parseAssignment reads an operation that writes a destination signal.
+func (o *opParser) parseAssignment() (Operation, error) {
+	dest, err := o.signal()
+	if err != nil {
+		return nil, err
+	}
+	switch o.next().text {
+	case "<-":
+		ch, err := o.channel()
+		return &RecvOperation{Channel: ch, Dest: dest}, err
+	case "=":
+		if err := o.expect("len"); err != nil {
+			return nil, err
+		}
+		ch, err := o.channel()
+		return &LenOperation{Channel: ch, Dest: dest}, err
+	}
+	head := o.peek()
+	switch {
+	case head == "convert":
+		o.next()
+		value, err := o.parenthesized()
+		return &ConvertOperation{Dest: dest, Value: value}, err
+	case head == "not":
+		o.next()
+		value, err := o.signal()
+		return &NotOperation{Dest: dest, Value: value}, err
+	case head == "cmp":
+		o.next()
+		op := &CompareOperation{Dest: dest}
+		if err := o.expect("("); err != nil {
+			return nil, err
+		}
+		if op.Left, err = o.signal(); err != nil {
+			return nil, err
+		}
+		pred, err := o.word()
+		if err != nil {
+			return nil, err
+		}
+		var ok bool
+		if op.Predicate, ok = parseComparePredicate(pred.text); !ok {
+			return nil, o.errorf(pred.col, "unknown comparison %q", pred.text)
+		}
+		if op.Right, err = o.signal(); err != nil {
+			return nil, err
+		}
+		return op, o.expect(")")
+	case head == "mux":
+		o.next()
+		op := &MuxOperation{Dest: dest}
+		if err := o.expect("("); err != nil {
+			return nil, err
+		}
+		if op.Cond, err = o.signal(); err != nil {
+			return nil, err
+		}
+		if err := o.expect("?"); err != nil {
+			return nil, err
+		}
+		if op.TrueValue, err = o.signal(); err != nil {
+			return nil, err
+		}
+		if err := o.expect(":"); err != nil {
+			return nil, err
+		}
+		if op.FalseValue, err = o.signal(); err != nil {
+			return nil, err
+		}
+		return op, o.expect(")")
+	case head == "phi":
+		o.next()
+		op := &PhiOperation{Dest: dest}
+		if err := o.expect("["); err != nil {
+			return nil, err
+		}
+		for o.peek() != "]" {
+			if len(op.Incomings) > 0 {
+				if err := o.expect(","); err != nil {
+					return nil, err
+				}
+			}
+			in := PhiIncoming{}
+			if in.Block, err = o.block(); err != nil {
+				return nil, err
+			}
+			if err := o.expect(":"); err != nil {
+				return nil, err
+			}
+			if in.Value, err = o.signal(); err != nil {
+				return nil, err
+			}
+			op.Incomings = append(op.Incomings, in)
+		}
+		return op, o.expect("]")
+	case strings.HasPrefix(head, "float."):
+		tok := o.next()
+		op := &FloatOperation{Dest: dest}
+		var ok bool
+		if op.Op, ok = parseFloatOp(strings.TrimPrefix(tok.text, "float.")); !ok {
+			return nil, o.errorf(tok.col, "unknown float operation %q", tok.text)
+		}
+		if err := o.expect("("); err != nil {
+			return nil, err
+		}
+		if op.Left, err = o.signal(); err != nil {
+			return nil, err
+		}
+		if o.peek() == "," {
+			o.next()
+			if op.Right, err = o.signal(); err != nil {
+				return nil, err
+			}
+		}
+		return op, o.expect(")")
+	}
+	left, err := o.signal()
+	if err != nil {
+		return nil, err
+	}
+	if o.pos == len(o.toks) {
+		return &AssignOperation{Dest: dest, Value: left}, nil
+	}
+	sym, err := o.word()
+	if err != nil {
+		return nil, err
+	}
+	binop, ok := parseBinOp(sym.text)
+	if !ok {
+		return nil, o.errorf(sym.col, "unknown operator %q", sym.text)
+	}
+	right, err := o.signal()
+	return &BinOperation{Op: binop, Dest: dest, Left: left, Right: right}, err
+}
+
+// spawnChannel returns the channel passed to a goroutine. A channel used only
+// between software goroutines is left out of the module but still named by
+// the spawns; it becomes a channel of its own outside the module.
+func (o *opParser) spawnChannel(name string) *Channel {
+	if ch := o.lookupChannel(name); ch != nil {
+		return ch
+	}
+	ch := o.detached[name]
+	if ch == nil {
+		ch = &Channel{Name: name}
+		o.detached[name] = ch
+	}
+	return ch
+}
+
+func (o *opParser) parenthesized() (*Signal, error) {
+	if err := o.expect("("); err != nil {
+		return nil, err
+	}
+	sig, err := o.signal()
+	if err != nil {
+		return nil, err
+	}
+	return sig, o.expect(")")
+}
+
+func parseBinOp(text string) (BinOp, bool) {
+	for op := Add; op <= ShrS; op++ {
+		if binOpSymbol(op) == text {
+			return op, true
+		}
+	}
+	return Add, false
+}
+
+func parseComparePredicate(text string) (ComparePredicate, bool) {
+	for pred := CompareEQ; pred <= CompareUGE; pred++ {
+		if compareSymbol(pred) == text {
+			return pred, true
+		}
+	}
+	return CompareEQ, false
+}
+
+func parseFloatOp(text string) (FloatOp, bool) {
+	for op := range floatOpNames {
+		if floatOpNames[op] == text {
+			return FloatOp(op), true
+		}
+	}
+	return FloatAdd, false
+}
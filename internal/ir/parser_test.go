@@ -0,0 +1,146 @@
+package ir
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseRoundTripsDump(t *testing.T) {
+	programs := map[string]string{
+		"branch":         branchProgram,
+		"pipeline":       pipelineProgram,
+		"panic":          panicProgram,
+		"serverLoop":     serverLoopProgram,
+		"zeroTrip":       zeroTripProgram,
+		"waitGroup":      waitGroupProgram,
+		"channelLen":     channelLenProgram,
+		"sharedChannel":  sharedChannelProgram,
+		"component":      componentProgram,
+		"enum":           enumProgram,
+		"float":          floatProgram,
+		"software":       softwareProgram,
+		"mutex":          mutexProgram,
+		"nestedSpawnArg": nestedSpawnArgProgram,
+		"sensitivity":    sensitivityProgram,
+	}
+	for name, src := range programs {
+		t.Run(name, func(t *testing.T) {
+			design := buildDesignFromSource(t, src)
+			var want bytes.Buffer
+			Dump(design, &want)
+			parsed, err := Parse(strings.NewReader(want.String()))
+			if err != nil {
+				t.Fatalf("parse failed: %v\n%s", err, want.String())
+			}
+			var got bytes.Buffer
+			Dump(parsed, &got)
+			if got.String() != want.String() {
+				t.Fatalf("dump of parsed design differs\nwant:\n%s\ngot:\n%s", want.String(), got.String())
+			}
+		})
+	}
+}
+
+const handwrittenIR = `
+module main
+  ports:
+    in  clk 1bu
+    in  rst 1bu
+  signals:
+    a        wire  8bu
+    big      wire  1bu
+    one      const 8bu = 1
+    out      wire  8bu
+    sum      wire  8bu
+    ten      const 8bu = 10
+  channels:
+    in       depth=1 type=8bu
+  // Forward references to blocks resolve when the process ends.
+  process 0 main (stage=0, sequential)
+    block entry
+      a <- in
+      big := cmp(a >u ten)
+      br big ? clamp : done
+    block clamp
+      sum := a + one
+      jump done
+    block done
+      out := phi[entry:a, clamp:sum]
+      print "out=" %x(out) "\n"
+      return
+`
+
+func TestParseHandwrittenIR(t *testing.T) {
+	design, err := Parse(strings.NewReader(handwrittenIR))
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	proc := design.TopLevel.Processes[0]
+	if len(proc.Blocks) != 3 {
+		t.Fatalf("expected 3 blocks, got %d", len(proc.Blocks))
+	}
+	done := proc.Blocks[2]
+	if len(done.Predecessors) != 2 {
+		t.Fatalf("expected done to have two predecessors, got %d", len(done.Predecessors))
+	}
+	if got := design.TopLevel.Channels["in"].ConsumerPorts(); len(got) != 1 || got[0].Process != proc {
+		t.Fatalf("expected main to consume in, got %v", got)
+	}
+	print, ok := done.Ops[1].(*PrintOperation)
+	if !ok || len(print.Segments) != 3 || print.Segments[1].Verb != PrintVerbHex {
+		t.Fatalf("unexpected print operation %#v", done.Ops[1])
+	}
+	if value := design.TopLevel.Signals["ten"].Value; value != uint64(10) {
+		t.Fatalf("expected ten to parse as uint64(10), got %#v", value)
+	}
+}
+
+func TestParseReportsPositions(t *testing.T) {
+	cases := []struct {
+		name string
+		src  string
+		line int
+		col  int
+		msg  string
+	}{
+		{
+			name: "unknown signal",
+			src:  "module main\n  signals:\n    a wire 8bu\n  process 0 main (stage=0, sequential)\n    block entry\n      a := a + b\n",
+			line: 6, col: 16, msg: `unknown signal "b"`,
+		},
+		{
+			name: "missing block",
+			src:  "module main\n  process 0 main (stage=0, sequential)\n    block entry\n      jump exit\n",
+			line: 4, col: 12, msg: `unknown block "exit"`,
+		},
+		{
+			name: "bad type",
+			src:  "module main\n  signals:\n    a wire 8bx\n",
+			line: 3, col: 5, msg: `bad type "8bx"`,
+		},
+		{
+			name: "unknown goroutine",
+			src:  "module main\n  waitgroups:\n    wg count=1 members=ghost\n",
+			line: 3, col: 5, msg: `unknown goroutine "ghost"`,
+		},
+		{
+			name: "op after terminator",
+			src:  "module main\n  process 0 main (stage=0, sequential)\n    block entry\n      return\n      return\n",
+			line: 5, col: 7, msg: "operation after the terminator",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Parse(strings.NewReader(tc.src))
+			var perr *ParseError
+			if !errors.As(err, &perr) {
+				t.Fatalf("expected a ParseError, got %v", err)
+			}
+			if perr.Line != tc.line || perr.Column != tc.col || !strings.Contains(perr.Msg, tc.msg) {
+				t.Fatalf("expected %d:%d: %s, got %v", tc.line, tc.col, tc.msg, perr)
+			}
+		})
+	}
+}
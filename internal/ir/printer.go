@@ -3,6 +3,7 @@ package ir
 import (
 	"fmt"
 	"io"
+	"math"
 	"sort"
 	"strings"
 )
@@ -17,7 +18,13 @@ func Dump(design *Design, w io.Writer) {
 		fmt.Fprintf(w, "module %s\n", module.Name)
 		dumpPorts(module, w)
 		dumpSignals(module, w)
+		dumpEnums(module, w)
 		dumpChannels(module, w)
+		dumpWaitGroups(module, w)
+		dumpMutexes(module, w)
+		dumpComponents(module, w)
+		dumpStreams(module, w)
+		dumpInstances(module, w)
 		dumpProcesses(module, w)
 		fmt.Fprintln(w)
 	}
@@ -51,19 +58,69 @@ func dumpSignals(module *Module, w io.Writer) {
 	for _, name := range names {
 		sig := module.Signals[name]
 		value := ""
-		if sig.Kind == Const && sig.Value != nil {
+		if sig.Kind != Wire && sig.Value != nil {
 			value = fmt.Sprintf(" = %v", sig.Value)
+			if member := enumMember(sig); member != "" {
+				value += fmt.Sprintf(" (%s)", member)
+			}
+			if bits, ok := sig.Value.(uint64); ok && sig.Type.Float {
+				value += fmt.Sprintf(" (%g)", math.Float32frombits(uint32(bits)))
+			}
+		}
+		typ := fmt.Sprintf("%db%s", sig.Type.Width, signSuffix(sig.Type.Signed))
+		if sig.Type.Float {
+			typ = "f32"
 		}
-		fmt.Fprintf(w, "    %-8s %-5s %db%s%s\n",
+		if sig.Type.Enum != nil {
+			typ += ":" + sig.Type.Enum.Name
+		}
+		fmt.Fprintf(w, "    %-8s %-5s %s%s\n",
 			sig.Name,
 			signalKind(sig.Kind),
-			sig.Type.Width,
-			signSuffix(sig.Type.Signed),
+			typ,
 			value,
 		)
 	}
 }
 
+// dumpEnums lists every enum type carried by the module's signals.
+func dumpEnums(module *Module, w io.Writer) {
+	enums := make(map[string]*EnumType)
+	for _, sig := range module.Signals {
+		if sig.Type != nil && sig.Type.Enum != nil {
+			enums[sig.Type.Enum.Name] = sig.Type.Enum
+		}
+	}
+	if len(enums) == 0 {
+		return
+	}
+	fmt.Fprintln(w, "  enums:")
+	names := make([]string, 0, len(enums))
+	for name := range enums {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		members := make([]string, 0, len(enums[name].Members))
+		for _, member := range enums[name].Members {
+			members = append(members, fmt.Sprintf("%s=%d", member.Name, member.Value))
+		}
+		fmt.Fprintf(w, "    %-8s %s\n", name, strings.Join(members, " "))
+	}
+}
+
+// enumMember returns the enum member named by a constant signal's value.
+func enumMember(sig *Signal) string {
+	if sig.Type == nil || sig.Type.Enum == nil {
+		return ""
+	}
+	value, ok := IntValue(sig.Value)
+	if !ok {
+		return ""
+	}
+	return sig.Type.Enum.MemberFor(value)
+}
+
 func dumpChannels(module *Module, w io.Writer) {
 	if len(module.Channels) == 0 {
 		return
@@ -76,19 +133,180 @@ func dumpChannels(module *Module, w io.Writer) {
 	sort.Strings(names)
 	for _, name := range names {
 		ch := module.Channels[name]
-		fmt.Fprintf(w, "    %-8s depth=%d type=%s\n",
+		fmt.Fprintf(w, "    %-8s depth=%d type=%s",
 			ch.Name,
 			ch.Depth,
 			ch.Type.Description(),
 		)
+		if ch.Occupancy > 0 {
+			fmt.Fprintf(w, " occupancy=%d", ch.Occupancy)
+		}
+		producers, consumers := ch.ProducerPorts(), ch.ConsumerPorts()
+		if len(producers) > 1 || len(consumers) > 1 {
+			fmt.Fprintf(w, " arbiter=%s", ch.Arbitration)
+		}
+		// The order of a shared side decides who wins under priority
+		// arbitration, so spell it out.
+		if len(producers) > 1 {
+			fmt.Fprintf(w, " producers=%s", endpointNames(producers))
+		}
+		if len(consumers) > 1 {
+			fmt.Fprintf(w, " consumers=%s", endpointNames(consumers))
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+func endpointNames(endpoints []*ChannelEndpoint) string {
+	sites := make([]Site, 0, len(endpoints))
+	for _, ep := range endpoints {
+		sites = append(sites, ep.Site)
+	}
+	return siteNames(sites)
+}
+
+func siteNames(sites []Site) string {
+	names := make([]string, 0, len(sites))
+	for _, site := range sites {
+		names = append(names, site.Name())
+	}
+	return strings.Join(names, ",")
+}
+
+func dumpWaitGroups(module *Module, w io.Writer) {
+	if len(module.WaitGroups) == 0 {
+		return
+	}
+	fmt.Fprintln(w, "  waitgroups:")
+	names := make([]string, 0, len(module.WaitGroups))
+	for name := range module.WaitGroups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		wg := module.WaitGroups[name]
+		fmt.Fprintf(w, "    %-8s count=%d members=%s\n", wg.Name, wg.Count, siteNames(wg.Members))
+	}
+}
+
+func dumpMutexes(module *Module, w io.Writer) {
+	if len(module.Mutexes) == 0 {
+		return
+	}
+	fmt.Fprintln(w, "  mutexes:")
+	names := make([]string, 0, len(module.Mutexes))
+	for name := range module.Mutexes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		mu := module.Mutexes[name]
+		fmt.Fprintf(w, "    %-8s arbiter=%s users=%s\n", mu.Name, mu.Arbitration, siteNames(mu.Users))
+	}
+}
+
+func dumpComponents(module *Module, w io.Writer) {
+	if len(module.Components) == 0 {
+		return
+	}
+	fmt.Fprintln(w, "  components:")
+	names := make([]string, 0, len(module.Components))
+	for name := range module.Components {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		comp := module.Components[name]
+		owner := "-"
+		if comp.Owner != nil {
+			owner = comp.Owner.Name
+		}
+		fields := make([]string, 0, len(comp.Fields))
+		for _, field := range comp.Fields {
+			fields = append(fields, field.Name)
+		}
+		fmt.Fprintf(w, "    %-8s type=%s owner=%s fields=%s\n", comp.Name, comp.Type, owner, strings.Join(fields, ","))
+	}
+}
+
+func dumpStreams(module *Module, w io.Writer) {
+	if len(module.Streams) == 0 {
+		return
+	}
+	fmt.Fprintln(w, "  streams:")
+	for _, stream := range module.Streams {
+		fmt.Fprintf(w, "    %s %-8s chan=%s software=%s\n",
+			portDirection(stream.Direction),
+			stream.Name,
+			stream.Channel.Name,
+			stream.Software.Name,
+		)
 	}
 }
 
+func dumpInstances(module *Module, w io.Writer) {
+	if len(module.Instances) == 0 {
+		return
+	}
+	fmt.Fprintln(w, "  instances:")
+	for _, inst := range module.Instances {
+		conns := make([]string, 0, len(inst.Connections))
+		for _, conn := range inst.Connections {
+			conns = append(conns, conn.Port+"="+conn.Net)
+		}
+		fmt.Fprintf(w, "    %s %s (%s)\n", inst.Name, inst.Module.Name, strings.Join(conns, ", "))
+	}
+}
+
+// dumpSignalList prints "<keyword> a, b" when sigs is not empty, with each
+// signal after its Go name as <name>=<signal> where names has one.
+func dumpSignalList(w io.Writer, keyword string, sigs []*Signal, names []string) {
+	if len(sigs) == 0 {
+		return
+	}
+	items := make([]string, 0, len(sigs))
+	for idx, sig := range sigs {
+		if idx < len(names) && names[idx] != "" {
+			items = append(items, names[idx]+"="+sig.Name)
+			continue
+		}
+		items = append(items, sig.Name)
+	}
+	fmt.Fprintf(w, "    %s %s\n", keyword, strings.Join(items, ", "))
+}
+
+// dumpChanParams prints "chans <name> depth=<n> type=<type>, ..." when proc
+// takes channel params.
+func dumpChanParams(w io.Writer, proc *Process) {
+	if len(proc.ChanParams) == 0 {
+		return
+	}
+	items := make([]string, 0, len(proc.ChanParams))
+	for _, ch := range proc.ChanParams {
+		items = append(items, fmt.Sprintf("%s depth=%d type=%s", ch.Name, ch.Depth, ch.Type.Description()))
+	}
+	fmt.Fprintf(w, "    chans %s\n", strings.Join(items, ", "))
+}
+
 func dumpProcesses(module *Module, w io.Writer) {
 	for idx, proc := range module.Processes {
+		if sw := proc.Software; sw != nil {
+			fmt.Fprintf(w, "  process %d %s (stage=%d, software %s)\n", idx, proc.Name, proc.Stage, sw.Function)
+			continue
+		}
 		fmt.Fprintf(w, "  process %d %s (stage=%d, %s)\n", idx, proc.Name, proc.Stage, sensitivity(proc.Sensitivity))
+		dumpSignalList(w, "params", proc.Params, proc.ParamNames)
+		dumpChanParams(w, proc)
+		dumpSignalList(w, "results", proc.Results, nil)
 		for _, block := range proc.Blocks {
-			fmt.Fprintf(w, "    block %s\n", block.Label)
+			switch {
+			case block.LoopHeader && block.TripCount >= 0:
+				fmt.Fprintf(w, "    block %s (trip=%d)\n", block.Label, block.TripCount)
+			case block.LoopHeader:
+				fmt.Fprintf(w, "    block %s (trip=?)\n", block.Label)
+			default:
+				fmt.Fprintf(w, "    block %s\n", block.Label)
+			}
 			for _, op := range block.Ops {
 				fmt.Fprintf(w, "      %s\n", renderOp(op))
 			}
@@ -111,6 +329,11 @@ func renderOp(op Operation) string {
 		return fmt.Sprintf("%s := cmp(%s %s %s)", o.Dest.Name, o.Left.Name, compareSymbol(o.Predicate), o.Right.Name)
 	case *NotOperation:
 		return fmt.Sprintf("%s := not %s", o.Dest.Name, o.Value.Name)
+	case *FloatOperation:
+		if o.Right == nil {
+			return fmt.Sprintf("%s := float.%s(%s)", o.Dest.Name, o.Op, o.Left.Name)
+		}
+		return fmt.Sprintf("%s := float.%s(%s, %s)", o.Dest.Name, o.Op, o.Left.Name, o.Right.Name)
 	case *MuxOperation:
 		return fmt.Sprintf("%s := mux(%s ? %s : %s)", o.Dest.Name, signalName(o.Cond), signalName(o.TrueValue), signalName(o.FalseValue))
 	case *PhiOperation:
@@ -126,20 +349,26 @@ func renderOp(op Operation) string {
 				parts = append(parts, fmt.Sprintf("%q", seg.Text))
 				continue
 			}
-			verb := "%d"
-			switch seg.Verb {
-			case PrintVerbHex:
-				verb = "%x"
-			case PrintVerbBin:
-				verb = "%b"
-			}
-			parts = append(parts, fmt.Sprintf(verb, signalName(seg.Value)))
+			parts = append(parts, fmt.Sprintf("%s(%s)", printVerb(seg.Verb), signalName(seg.Value)))
+		}
+		return fmt.Sprintf("print %s", strings.Join(parts, " "))
+	case *AssertOperation:
+		if o.Cond == nil {
+			return fmt.Sprintf("panic %q at %q", o.Message, o.Location)
 		}
-		return fmt.Sprintf("print %s", strings.Join(parts, ""))
+		return fmt.Sprintf("panic when %s %q at %q", signalName(o.Cond), o.Message, o.Location)
+	case *WaitOperation:
+		return fmt.Sprintf("wait %s", o.Group.Name)
+	case *LockOperation:
+		return fmt.Sprintf("lock %s", o.Mutex.Name)
+	case *UnlockOperation:
+		return fmt.Sprintf("unlock %s", o.Mutex.Name)
 	case *SendOperation:
 		return fmt.Sprintf("send %s <- %s", o.Channel.Name, o.Value.Name)
 	case *RecvOperation:
 		return fmt.Sprintf("%s <- %s", o.Dest.Name, o.Channel.Name)
+	case *LenOperation:
+		return fmt.Sprintf("%s = len %s", o.Dest.Name, o.Channel.Name)
 	case *SpawnOperation:
 		argNames := make([]string, 0, len(o.Args))
 		for _, arg := range o.Args {
@@ -149,13 +378,20 @@ func renderOp(op Operation) string {
 		for _, ch := range o.ChanArgs {
 			chanNames = append(chanNames, ch.Name)
 		}
-		segments := make([]string, 0, 2)
+		groupNames := make([]string, 0, len(o.WaitGroups))
+		for _, wg := range o.WaitGroups {
+			groupNames = append(groupNames, wg.Name)
+		}
+		segments := make([]string, 0, 3)
 		if len(argNames) > 0 {
 			segments = append(segments, strings.Join(argNames, ", "))
 		}
 		if len(chanNames) > 0 {
 			segments = append(segments, "ch:"+strings.Join(chanNames, ", "))
 		}
+		if len(groupNames) > 0 {
+			segments = append(segments, "wg:"+strings.Join(groupNames, ", "))
+		}
 		targetName := "<nil>"
 		stage := -1
 		if o.Callee != nil {
@@ -233,6 +469,17 @@ func compareSymbol(pred ComparePredicate) string {
 	}
 }
 
+func printVerb(verb PrintVerb) string {
+	switch verb {
+	case PrintVerbHex:
+		return "%x"
+	case PrintVerbBin:
+		return "%b"
+	default:
+		return "%d"
+	}
+}
+
 func portDirection(dir PortDirection) string {
 	switch dir {
 	case Input:
@@ -261,6 +508,8 @@ func signalKind(k SignalKind) string {
 		return "reg"
 	case Const:
 		return "const"
+	case Shared:
+		return "shared"
 	default:
 		return "?"
 	}
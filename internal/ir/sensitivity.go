@@ -0,0 +1,109 @@
+package ir
+
+import (
+	"fmt"
+	"slices"
+)
+
+// ClassifySensitivity marks every process of design that can run as
+// combinational logic as Combinational and every other hardware process as
+// Sequential. The MLIR emitter builds a combinational process without an FSM:
+// it finishes in the cycle its start input rises.
+func ClassifySensitivity(design *Design) {
+	for _, module := range design.Modules {
+		for _, proc := range module.Processes {
+			if proc.Software != nil {
+				continue
+			}
+			proc.Sensitivity = Sequential
+			if combinationalBlocker(design, proc) == "" {
+				proc.Sensitivity = Combinational
+			}
+		}
+	}
+}
+
+// combinationalBlocker returns why proc needs a state machine, or "" when it
+// can run as combinational logic. A combinational process has no channel
+// operations, prints, waits, locks, loops or pipelined float operations and
+// drives each signal at most once. The root process, wait group members and
+// the owners of components stay sequential, since the design's done output,
+// a barrier and a component field all need state that holds.
+func combinationalBlocker(design *Design, proc *Process) string {
+	if proc.Software != nil {
+		return "it runs in software"
+	}
+	if len(proc.Blocks) == 0 {
+		return "it has no blocks"
+	}
+	for _, module := range design.Modules {
+		if module.Name == proc.Name && slices.Contains(module.Processes, proc) {
+			return "it is the root process"
+		}
+		for _, wg := range module.WaitGroups {
+			if slices.ContainsFunc(wg.Members, func(site Site) bool { return site.Process == proc }) {
+				return fmt.Sprintf("it is a member of wait group %s", wg.Name)
+			}
+		}
+		for _, comp := range module.Components {
+			if comp.Owner == proc {
+				return fmt.Sprintf("it owns component %s", comp.Name)
+			}
+		}
+	}
+	if block := loopBlock(proc); block != nil {
+		return fmt.Sprintf("block %s is part of a loop", block.Label)
+	}
+	driven := make(map[*Signal]bool)
+	for _, block := range proc.Blocks {
+		for _, op := range block.Ops {
+			switch o := op.(type) {
+			case *SendOperation:
+				return fmt.Sprintf("it sends on channel %s", o.Channel.Name)
+			case *RecvOperation:
+				return fmt.Sprintf("it receives from channel %s", o.Channel.Name)
+			case *LenOperation:
+				return fmt.Sprintf("it reads the length of channel %s", o.Channel.Name)
+			case *PrintOperation:
+				return "it prints"
+			case *WaitOperation:
+				return fmt.Sprintf("it waits on %s", o.Group.Name)
+			case *LockOperation, *UnlockOperation:
+				return "it uses a mutex"
+			case *FloatOperation:
+				if o.Op.Latency() > 0 {
+					return fmt.Sprintf("float %s takes %d cycles", o.Op, o.Op.Latency())
+				}
+			case *AssignOperation:
+				if o.Dest.Kind == Shared {
+					return fmt.Sprintf("it writes shared register %s", o.Dest.Name)
+				}
+			}
+			if dest := OperationDest(op); dest != nil {
+				if driven[dest] {
+					return fmt.Sprintf("it drives %s more than once", dest.Name)
+				}
+				driven[dest] = true
+			}
+		}
+	}
+	return ""
+}
+
+// loopBlock returns a block of proc that a cycle of the control flow graph
+// runs through, or nil when the graph is acyclic.
+func loopBlock(proc *Process) *BasicBlock {
+	order := reversePostorder(proc.Blocks[0])
+	index := make(map[*BasicBlock]int, len(order))
+	for i, block := range order {
+		index[block] = i
+	}
+	for i, block := range order {
+		for _, succ := range block.Successors {
+			if index[succ] <= i {
+				return succ
+			}
+		}
+	}
+	return nil
+}
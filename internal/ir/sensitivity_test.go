@@ -0,0 +1,105 @@
+package ir
+
+import "testing"
+
+const sensitivityProgram = `
+package main
+
+import "sync"
+
+func add(a, b uint32) uint32 {
+	s := a + b
+	if s > 10 {
+		s = s - 10
+	}
+	return s
+}
+
+func count(n uint8) {
+	var total uint8
+	for i := uint8(0); i < n; i++ {
+		total += i
+	}
+	_ = total
+}
+
+func forward(out chan<- uint32, v uint32) {
+	out <- v
+}
+
+func member(wg *sync.WaitGroup, v uint32) {
+	defer wg.Done()
+	_ = v * 2
+}
+
+func main() {
+	ch := make(chan uint32, 1)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go add(3, 4)
+	go count(4)
+	go forward(ch, 1)
+	go member(&wg, 5)
+	wg.Wait()
+	<-ch
+}
+`
+
+func TestClassifySensitivity(t *testing.T) {
+	design := buildDesignFromSource(t, sensitivityProgram)
+	want := map[string]Sensitivity{
+		"main":    Sequential,
+		"add":     Combinational,
+		"count":   Sequential,
+		"forward": Sequential,
+		"member":  Sequential,
+	}
+	for _, proc := range design.Processes() {
+		sens, ok := want[proc.Name]
+		if !ok {
+			t.Fatalf("unexpected process %s", proc.Name)
+		}
+		if proc.Sensitivity != sens {
+			t.Errorf("process %s: got %s, want %s (%s)", proc.Name, sensitivity(proc.Sensitivity), sensitivity(sens), combinationalBlocker(design, proc))
+		}
+		delete(want, proc.Name)
+	}
+	if len(want) != 0 {
+		t.Fatalf("missing processes: %v", want)
+	}
+}
+
+func TestReturnedValueLeavesThroughResultPort(t *testing.T) {
+	design := buildDesignFromSource(t, sensitivityProgram)
+	var add *Process
+	for _, proc := range design.Processes() {
+		if proc.Name == "add" {
+			add = proc
+		}
+	}
+	if add == nil || len(add.Results) != 1 {
+		t.Fatalf("expected add with one result, got %+v", add)
+	}
+	result := add.Results[0]
+	driven := false
+	for _, block := range add.Blocks {
+		for _, op := range block.Ops {
+			if OperationDest(op) == result {
+				driven = true
+			}
+		}
+	}
+	if !driven {
+		t.Fatalf("result %s is never driven", result.Name)
+	}
+	module := design.ModuleOf(add)
+	found := false
+	for _, port := range module.Ports {
+		if port.Name == ResultPort(result) && port.Direction == Output && port.Type.Width == 32 {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("module %s has no output %s: %+v", module.Name, ResultPort(result), module.Ports)
+	}
+}
@@ -0,0 +1,134 @@
+package ir
+
+import (
+	"fmt"
+	"go/token"
+	"go/types"
+	"slices"
+
+	"golang.org/x/tools/go/ssa"
+)
+
+// softwareProcess records a goroutine kept in Go by //mygo:software. Its body
+// is not translated; the process only claims the channel endpoints the
+// software side owns so they can become stream ports. Like a hardware
+// goroutine, each go statement gets a process of its own.
+func (b *builder) softwareProcess(fn *ssa.Function, args []ssa.Value) *Process {
+	binding := b.channelBinding(fn, args)
+	spawned := b.spawns[fn]
+	sw := &SoftwareBinding{Function: fn.Name()}
+	proc := &Process{
+		Name:        b.processName(fn.Name()),
+		Sensitivity: Sequential,
+		Stage:       -1,
+		Software:    sw,
+		Source:      fn.Pos(),
+	}
+	b.module.Processes = append(b.module.Processes, proc)
+	qualifier := types.RelativeTo(fn.Pkg.Pkg)
+	idx := 0
+	for _, param := range fn.Params {
+		chType, ok := param.Type().Underlying().(*types.Chan)
+		if !ok {
+			continue
+		}
+		ch := binding[idx]
+		idx++
+		if ch == nil {
+			b.reporter.Error(param.Pos(), fmt.Sprintf("channel passed to software goroutine %s as %s must be made in hardware", fn.Name(), param.Name()))
+			continue
+		}
+		dir, ok := softwareChannelDirection(fn, param, chType)
+		if !ok {
+			b.reporter.Error(param.Pos(), fmt.Sprintf("cannot tell whether software goroutine %s sends or receives on %s; give the parameter a directional channel type", fn.Name(), param.Name()))
+			continue
+		}
+		ch.AddEndpoint(Site{Process: proc}, nil, dir)
+		sw.Channels = append(sw.Channels, ch)
+		sw.Params = append(sw.Params, param.Name())
+		sw.ElemTypes = append(sw.ElemTypes, types.TypeString(chType.Elem(), qualifier))
+	}
+	b.spawns[fn] = append(spawned, proc)
+	return proc
+}
+
+// softwareChannelDirection tells which side of a channel parameter a software
+// goroutine uses: the declared direction when there is one, otherwise the only
+// kind of operation the function body applies to it.
+func softwareChannelDirection(fn *ssa.Function, param *ssa.Parameter, chType *types.Chan) (ChannelDirection, bool) {
+	switch chType.Dir() {
+	case types.SendOnly:
+		return ChannelSend, true
+	case types.RecvOnly:
+		return ChannelReceive, true
+	}
+	var sends, recvs bool
+	for _, block := range fn.Blocks {
+		for _, instr := range block.Instrs {
+			switch in := instr.(type) {
+			case *ssa.Send:
+				sends = sends || in.Chan == param
+			case *ssa.UnOp:
+				recvs = recvs || (in.Op == token.ARROW && in.X == param)
+			}
+		}
+	}
+	switch {
+	case sends && !recvs:
+		return ChannelSend, true
+	case recvs && !sends:
+		return ChannelReceive, true
+	}
+	return ChannelSend, false
+}
+
+// collectStreams gives every software process a start port and turns each
+// channel it shares with the hardware into a stream with top-level ports.
+// Channels used only by software goroutines stay in Go and leave the module.
+func (b *builder) collectStreams() {
+	bit := &SignalType{Width: 1}
+	for _, proc := range b.module.Processes {
+		sw := proc.Software
+		if sw == nil {
+			continue
+		}
+		b.module.Ports = append(b.module.Ports, Port{Name: SoftwareStartPort(proc), Direction: Output, Type: bit})
+		for i, ch := range sw.Channels {
+			if !hasHardwareEndpoint(ch) {
+				delete(b.module.Channels, ch.Name)
+				continue
+			}
+			// The stream's ports are top-level ports, so its channel
+			// stays in the top level whoever makes it.
+			ch.Owner = nil
+			stream := &Stream{
+				Name:      proc.Name + "_" + sw.Params[i],
+				Channel:   ch,
+				Software:  proc,
+				Direction: Input,
+			}
+			if slices.ContainsFunc(ch.ConsumerPorts(), func(ep *ChannelEndpoint) bool { return ep.Process == proc }) {
+				stream.Direction = Output
+			}
+			back := Output
+			if stream.Direction == Output {
+				back = Input
+			}
+			b.module.Streams = append(b.module.Streams, stream)
+			b.module.Ports = append(b.module.Ports,
+				Port{Name: stream.PortName("data"), Direction: stream.Direction, Type: ch.Type},
+				Port{Name: stream.PortName("valid"), Direction: stream.Direction, Type: bit},
+				Port{Name: stream.PortName("ready"), Direction: back, Type: bit},
+			)
+		}
+	}
+}
+
+func hasHardwareEndpoint(ch *Channel) bool {
+	for _, ep := range slices.Concat(ch.Producers, ch.Consumers) {
+		if ep.Process != nil && ep.Process.Software == nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,211 @@
+package ir
+
+// Use is a place in a process that reads or writes a signal: an operation of
+// Block, or Block's terminator when Op is nil.
+type Use struct {
+	Block *BasicBlock
+	Op    Operation
+}
+
+// UseDef holds the def-use chains of one process: for every signal, the
+// operations that drive it and the operations and terminators that read it,
+// in block order. It describes a snapshot; compute it again once a pass
+// changes the process. Signals other processes touch, such as shared
+// registers, only list the places in this process.
+type UseDef struct {
+	defs  map[*Signal][]Use
+	uses  map[*Signal][]Use
+	order []*Signal
+}
+
+// ComputeUseDef scans proc once and records where each signal is driven and
+// read. An operation that reads a signal twice, as in x + x, is one use.
+func ComputeUseDef(proc *Process) *UseDef {
+	ud := &UseDef{
+		defs: make(map[*Signal][]Use),
+		uses: make(map[*Signal][]Use),
+	}
+	for _, block := range proc.Blocks {
+		for _, op := range block.Ops {
+			if dest := OperationDest(op); dest != nil {
+				ud.note(dest)
+				ud.defs[dest] = append(ud.defs[dest], Use{Block: block, Op: op})
+			}
+			for _, sig := range OperationOperands(op) {
+				ud.addUse(sig, Use{Block: block, Op: op})
+			}
+		}
+		if br, ok := block.Terminator.(*BranchTerminator); ok {
+			ud.addUse(br.Cond, Use{Block: block})
+		}
+	}
+	return ud
+}
+
+func (ud *UseDef) addUse(sig *Signal, use Use) {
+	if sig == nil {
+		return
+	}
+	ud.note(sig)
+	uses := ud.uses[sig]
+	if n := len(uses); n > 0 && uses[n-1] == use {
+		return
+	}
+	ud.uses[sig] = append(uses, use)
+}
+
+func (ud *UseDef) note(sig *Signal) {
+	if _, ok := ud.defs[sig]; ok {
+		return
+	}
+	if _, ok := ud.uses[sig]; ok {
+		return
+	}
+	ud.order = append(ud.order, sig)
+}
+
+// Signals returns every signal the process drives or reads, in the order
+// they first appear.
+func (ud *UseDef) Signals() []*Signal {
+	return ud.order
+}
+
+// Defs returns the operations that drive sig.
+func (ud *UseDef) Defs(sig *Signal) []Use {
+	return ud.defs[sig]
+}
+
+// Uses returns the operations and terminators that read sig.
+func (ud *UseDef) Uses(sig *Signal) []Use {
+	return ud.uses[sig]
+}
+
+// OperationDest returns the signal op drives, or nil.
+func OperationDest(op Operation) *Signal {
+	dest, _ := operationDest(op)
+	return dest
+}
+
+// operationDest returns the signal op drives and whether op is a kind of
+// operation that drives one, so the verifier can tell a missing Dest from an
+// operation without a destination.
+func operationDest(op Operation) (*Signal, bool) {
+	switch o := op.(type) {
+	case *BinOperation:
+		return o.Dest, true
+	case *CompareOperation:
+		return o.Dest, true
+	case *AssignOperation:
+		return o.Dest, true
+	case *ConvertOperation:
+		return o.Dest, true
+	case *NotOperation:
+		return o.Dest, true
+	case *MuxOperation:
+		return o.Dest, true
+	case *PhiOperation:
+		return o.Dest, true
+	case *FloatOperation:
+		return o.Dest, true
+	case *RecvOperation:
+		return o.Dest, true
+	case *LenOperation:
+		return o.Dest, true
+	}
+	return nil, false
+}
+
+// OperationOperands returns the signals op reads. Optional operands that are
+// unset, such as an unconditional assert's Cond, are left out. A phi reads
+// each incoming value at the end of the matching predecessor.
+func OperationOperands(op Operation) []*Signal {
+	switch o := op.(type) {
+	case *BinOperation:
+		return []*Signal{o.Left, o.Right}
+	case *CompareOperation:
+		return []*Signal{o.Left, o.Right}
+	case *AssignOperation:
+		return []*Signal{o.Value}
+	case *ConvertOperation:
+		return []*Signal{o.Value}
+	case *NotOperation:
+		return []*Signal{o.Value}
+	case *MuxOperation:
+		return []*Signal{o.Cond, o.TrueValue, o.FalseValue}
+	case *PhiOperation:
+		sigs := make([]*Signal, 0, len(o.Incomings))
+		for _, in := range o.Incomings {
+			sigs = append(sigs, in.Value)
+		}
+		return sigs
+	case *FloatOperation:
+		if o.Right != nil {
+			return []*Signal{o.Left, o.Right}
+		}
+		return []*Signal{o.Left}
+	case *PrintOperation:
+		var sigs []*Signal
+		for _, seg := range o.Segments {
+			if seg.Value != nil {
+				sigs = append(sigs, seg.Value)
+			}
+		}
+		return sigs
+	case *AssertOperation:
+		if o.Cond != nil {
+			return []*Signal{o.Cond}
+		}
+	case *SendOperation:
+		return []*Signal{o.Value}
+	case *SpawnOperation:
+		return o.Args
+	}
+	return nil
+}
+
+// ReplaceOperands makes op read to wherever it reads from. The destination is
+// left alone, and so are the operands OperationOperands leaves out.
+func ReplaceOperands(op Operation, from, to *Signal) {
+	swap := func(sig **Signal) {
+		if *sig == from {
+			*sig = to
+		}
+	}
+	switch o := op.(type) {
+	case *BinOperation:
+		swap(&o.Left)
+		swap(&o.Right)
+	case *CompareOperation:
+		swap(&o.Left)
+		swap(&o.Right)
+	case *AssignOperation:
+		swap(&o.Value)
+	case *ConvertOperation:
+		swap(&o.Value)
+	case *NotOperation:
+		swap(&o.Value)
+	case *MuxOperation:
+		swap(&o.Cond)
+		swap(&o.TrueValue)
+		swap(&o.FalseValue)
+	case *PhiOperation:
+		for idx := range o.Incomings {
+			swap(&o.Incomings[idx].Value)
+		}
+	case *FloatOperation:
+		swap(&o.Left)
+		swap(&o.Right)
+	case *PrintOperation:
+		for idx := range o.Segments {
+			swap(&o.Segments[idx].Value)
+		}
+	case *AssertOperation:
+		swap(&o.Cond)
+	case *SendOperation:
+		swap(&o.Value)
+	case *SpawnOperation:
+		for idx := range o.Args {
+			swap(&o.Args[idx])
+		}
+	}
+}
@@ -0,0 +1,402 @@
+package ir
+
+import (
+	"fmt"
+	"slices"
+
+	"mygo/internal/diag"
+)
+
+// VerifyOptions selects the invariants that only hold at some points of the
+// pipeline.
+type VerifyOptions struct {
+	// RequireWidths reports signals whose width is still unknown. Set it
+	// once width inference has run.
+	RequireWidths bool
+}
+
+// Verify checks the structural invariants the passes and the MLIR emitter
+// rely on and reports each violation through reporter:
+//
+//   - every block ends in a terminator whose targets are its Successors, and
+//     Successors and Predecessors agree;
+//   - phi incomings name each predecessor exactly once;
+//   - every operand is a signal of the module;
+//   - wires are driven at most once per process, and constants and params
+//     never;
+//   - a process's params are wires of its module, and every spawn passes
+//     one argument per param;
+//   - a process's results are wires of its module that the process drives;
+//   - each channel's Producers and Consumers are exactly the goroutines that
+//     send and receive on it, with channel params bound by the spawns;
+//   - every instance places a module of the design that holds one process,
+//     belongs to a go statement of its parent that spawns that process, and
+//     connects only ports of the module;
+//   - a combinational process needs no state, see ClassifySensitivity.
+//
+// reporter may be nil. The returned error counts the violations and is nil
+// when the design is well formed.
+func Verify(design *Design, reporter *diag.Reporter, opts VerifyOptions) error {
+	v := &verifier{reporter: reporter, opts: opts}
+	if design == nil {
+		v.errorf("nil design")
+		return v.result()
+	}
+	if design.TopLevel != nil && !slices.Contains(design.Modules, design.TopLevel) {
+		v.errorf("top-level module %s is not in the design", design.TopLevel.Name)
+	}
+	for _, module := range design.Modules {
+		if module != nil {
+			v.verifyModule(module)
+		}
+	}
+	v.verifyEndpoints(design)
+	v.verifyInstances(design)
+	v.verifySensitivity(design)
+	return v.result()
+}
+
+type verifier struct {
+	reporter *diag.Reporter
+	opts     VerifyOptions
+	count    int
+	first    string
+}
+
+func (v *verifier) errorf(format string, args ...any) {
+	msg := "ir verify: " + fmt.Sprintf(format, args...)
+	if v.count == 0 {
+		v.first = msg
+	}
+	v.count++
+	if v.reporter != nil {
+		v.reporter.Errorf("%s", msg)
+	}
+}
+
+func (v *verifier) result() error {
+	switch v.count {
+	case 0:
+		return nil
+	case 1:
+		return fmt.Errorf("%s", v.first)
+	}
+	return fmt.Errorf("%s (and %d more)", v.first, v.count-1)
+}
+
+func (v *verifier) verifyModule(module *Module) {
+	for name, sig := range module.Signals {
+		switch {
+		case sig == nil:
+			v.errorf("module %s: signal %s is nil", module.Name, name)
+		case sig.Name != name:
+			v.errorf("module %s: signal %s is listed as %s", module.Name, sig.Name, name)
+		case v.opts.RequireWidths && sig.Type.IsUnknown():
+			v.errorf("module %s: signal %s has an unknown width", module.Name, name)
+		}
+	}
+	for _, proc := range module.Processes {
+		if proc != nil {
+			v.verifyProcess(module, proc)
+		}
+	}
+}
+
+func (v *verifier) verifyProcess(module *Module, proc *Process) {
+	where := fmt.Sprintf("module %s: process %s", module.Name, proc.Name)
+	if proc.Software != nil {
+		if len(proc.Blocks) != 0 {
+			v.errorf("%s: software process has blocks", where)
+		}
+		return
+	}
+	if len(proc.Blocks) == 0 {
+		v.errorf("%s: no blocks", where)
+		return
+	}
+	owned := make(map[*BasicBlock]bool, len(proc.Blocks))
+	labels := make(map[string]bool, len(proc.Blocks))
+	for _, block := range proc.Blocks {
+		owned[block] = true
+		if labels[block.Label] {
+			v.errorf("%s: duplicate block label %s", where, block.Label)
+		}
+		labels[block.Label] = true
+	}
+	params := make(map[*Signal]bool, len(proc.Params))
+	for _, param := range proc.Params {
+		switch {
+		case param == nil:
+			v.errorf("%s: nil param", where)
+		case module.Signals[param.Name] != param:
+			v.errorf("%s: param %s is not a signal of module %s", where, param.Name, module.Name)
+		case param.Kind != Wire:
+			v.errorf("%s: param %s is not a wire", where, param.Name)
+		}
+		params[param] = true
+	}
+	defined := make(map[*Signal]string)
+	for _, block := range proc.Blocks {
+		at := fmt.Sprintf("%s: block %s", where, block.Label)
+		v.verifyEdges(at, block, owned)
+		for _, op := range block.Ops {
+			v.verifyOperands(at, module, op)
+			switch o := op.(type) {
+			case *PhiOperation:
+				v.verifyPhi(at, block, o)
+			case *SpawnOperation:
+				if o.Callee != nil && o.Callee.Software == nil && len(o.Args) != len(o.Callee.Params) {
+					v.errorf("%s: go %s passes %d arguments for %d params", at, o.Callee.Name, len(o.Args), len(o.Callee.Params))
+				}
+			}
+			dest := OperationDest(op)
+			if dest == nil {
+				continue
+			}
+			switch {
+			case dest.Kind == Const:
+				v.errorf("%s: constant %s is assigned", at, dest.Name)
+			case params[dest]:
+				v.errorf("%s: param %s is assigned", at, dest.Name)
+			case dest.Kind == Wire:
+				if prev, ok := defined[dest]; ok {
+					v.errorf("%s: wire %s is already driven in block %s", at, dest.Name, prev)
+				}
+				defined[dest] = block.Label
+			}
+		}
+	}
+	for _, result := range proc.Results {
+		switch {
+		case result == nil:
+			v.errorf("%s: nil result", where)
+		case module.Signals[result.Name] != result:
+			v.errorf("%s: result %s is not a signal of module %s", where, result.Name, module.Name)
+		case result.Kind != Wire:
+			v.errorf("%s: result %s is not a wire", where, result.Name)
+		case defined[result] == "":
+			v.errorf("%s: result %s is never driven", where, result.Name)
+		}
+	}
+}
+
+// verifyEdges checks block's terminator against its edge lists.
+func (v *verifier) verifyEdges(at string, block *BasicBlock, owned map[*BasicBlock]bool) {
+	var targets []*BasicBlock
+	switch term := block.Terminator.(type) {
+	case nil:
+		v.errorf("%s: missing terminator", at)
+		return
+	case *JumpTerminator:
+		targets = []*BasicBlock{term.Target}
+	case *BranchTerminator:
+		if term.Cond == nil {
+			v.errorf("%s: branch has no condition", at)
+		}
+		targets = []*BasicBlock{term.True, term.False}
+	}
+	for _, target := range targets {
+		switch {
+		case target == nil:
+			v.errorf("%s: terminator has a nil target", at)
+		case !owned[target]:
+			v.errorf("%s: terminator targets block %s of another process", at, target.Label)
+		case !slices.Contains(block.Successors, target):
+			v.errorf("%s: terminator target %s is not a successor", at, target.Label)
+		}
+	}
+	for _, succ := range block.Successors {
+		if !slices.Contains(targets, succ) {
+			v.errorf("%s: successor %s is not a terminator target", at, succ.Label)
+		}
+		if !slices.Contains(succ.Predecessors, block) {
+			v.errorf("%s: successor %s does not list it as a predecessor", at, succ.Label)
+		}
+	}
+	for _, pred := range block.Predecessors {
+		if !owned[pred] {
+			v.errorf("%s: predecessor %s belongs to another process", at, pred.Label)
+		} else if !slices.Contains(pred.Successors, block) {
+			v.errorf("%s: predecessor %s does not list it as a successor", at, pred.Label)
+		}
+	}
+}
+
+func (v *verifier) verifyPhi(at string, block *BasicBlock, phi *PhiOperation) {
+	seen := make(map[*BasicBlock]bool, len(phi.Incomings))
+	for _, in := range phi.Incomings {
+		switch {
+		case in.Block == nil:
+			v.errorf("%s: phi %s has an incoming without a block", at, phi.Dest.Name)
+		case seen[in.Block]:
+			v.errorf("%s: phi %s names predecessor %s twice", at, phi.Dest.Name, in.Block.Label)
+		case !slices.Contains(block.Predecessors, in.Block):
+			v.errorf("%s: phi %s has an incoming from %s, which is not a predecessor", at, phi.Dest.Name, in.Block.Label)
+		}
+		seen[in.Block] = true
+	}
+	for _, pred := range block.Predecessors {
+		if !seen[pred] {
+			v.errorf("%s: phi %s has no incoming from predecessor %s", at, phi.Dest.Name, pred.Label)
+		}
+	}
+}
+
+// verifyOperands checks that every signal op reads or writes belongs to
+// module.
+func (v *verifier) verifyOperands(at string, module *Module, op Operation) {
+	for _, sig := range operationSignals(op) {
+		if sig == nil {
+			v.errorf("%s: %T has a nil operand", at, op)
+			continue
+		}
+		if module.Signals[sig.Name] != sig {
+			v.errorf("%s: %s is not a signal of module %s", at, sig.Name, module.Name)
+		}
+	}
+}
+
+// verifyEndpoints compares each channel's recorded endpoints with the sends
+// and receives of every goroutine in the design. Software goroutines reach
+// their channels through streams rather than operations.
+func (v *verifier) verifyEndpoints(design *Design) {
+	producers := make(map[*Channel][]string)
+	consumers := make(map[*Channel][]string)
+	sites := make(channelSites)
+	add := func(m map[*Channel][]string, ch *Channel, site Site) {
+		site, ok := sites.local(site, ch)
+		if ok && !slices.Contains(m[ch], site.Name()) {
+			m[ch] = append(m[ch], site.Name())
+		}
+	}
+	if design.TopLevel == nil {
+		return
+	}
+	walkSites(design.TopLevel, func(site Site, op Operation, actual map[*Channel]*Channel, child Site) {
+		switch o := op.(type) {
+		case nil:
+			sites.enter(site)
+		case *SendOperation:
+			add(producers, actualChannel(actual, o.Channel), site)
+		case *RecvOperation:
+			add(consumers, actualChannel(actual, o.Channel), site)
+		case *SpawnOperation:
+			if o.Callee == nil || o.Callee.Software == nil {
+				return
+			}
+			for _, stream := range design.TopLevel.Streams {
+				switch {
+				case stream.Software != o.Callee:
+				case stream.Direction == Output:
+					add(consumers, stream.Channel, child)
+				default:
+					add(producers, stream.Channel, child)
+				}
+			}
+		}
+	})
+	for _, module := range design.Modules {
+		for name, ch := range module.Channels {
+			v.compareEndpoints(module, name, "producers", ch.ProducerPorts(), producers[ch])
+			v.compareEndpoints(module, name, "consumers", ch.ConsumerPorts(), consumers[ch])
+			delete(producers, ch)
+			delete(consumers, ch)
+		}
+	}
+	for _, m := range []map[*Channel][]string{producers, consumers} {
+		for ch := range m {
+			if ch == nil {
+				v.errorf("channel operation without a channel")
+			} else {
+				v.errorf("channel %s is used but not declared", ch.Name)
+			}
+		}
+	}
+}
+
+// verifyInstances checks that every instance places a one-process module of
+// the design for a go statement of its parent and only connects ports the
+// module has.
+func (v *verifier) verifyInstances(design *Design) {
+	linked := make(map[*SpawnOperation]string)
+	for _, module := range design.Modules {
+		var spawns []*SpawnOperation
+		for _, proc := range module.Processes {
+			for _, block := range proc.Blocks {
+				for _, op := range block.Ops {
+					if spawn, ok := op.(*SpawnOperation); ok {
+						spawns = append(spawns, spawn)
+					}
+				}
+			}
+		}
+		for _, inst := range module.Instances {
+			where := fmt.Sprintf("module %s: instance %s", module.Name, inst.Name)
+			child := inst.Module
+			switch {
+			case child == nil:
+				v.errorf("%s: no module", where)
+				continue
+			case !slices.Contains(design.Modules, child):
+				v.errorf("%s: module %s is not in the design", where, child.Name)
+			}
+			if len(child.Processes) != 1 {
+				v.errorf("%s: module %s holds %d processes, want 1", where, child.Name, len(child.Processes))
+			}
+			switch spawn := inst.Spawn; {
+			case spawn == nil || !slices.Contains(spawns, spawn):
+				v.errorf("%s: no go statement of module %s starts it", where, module.Name)
+			case !slices.Contains(child.Processes, spawn.Callee):
+				v.errorf("%s: its go statement spawns %s, which module %s does not run", where, spawn.Callee.Name, child.Name)
+			case linked[spawn] != "":
+				v.errorf("%s: its go statement already starts %s", where, linked[spawn])
+			default:
+				linked[spawn] = inst.Name
+			}
+			for _, conn := range inst.Connections {
+				if !slices.ContainsFunc(child.Ports, func(p Port) bool { return p.Name == conn.Port }) {
+					v.errorf("%s: module %s has no port %s", where, child.Name, conn.Port)
+				}
+			}
+		}
+	}
+}
+
+// verifySensitivity checks that every process marked combinational could
+// have been classified as one.
+func (v *verifier) verifySensitivity(design *Design) {
+	for _, module := range design.Modules {
+		for _, proc := range module.Processes {
+			if proc == nil || proc.Software != nil || proc.Sensitivity != Combinational {
+				continue
+			}
+			if reason := combinationalBlocker(design, proc); reason != "" {
+				v.errorf("module %s: process %s is combinational but %s", module.Name, proc.Name, reason)
+			}
+		}
+	}
+}
+
+func (v *verifier) compareEndpoints(module *Module, name, side string, recorded []*ChannelEndpoint, used []string) {
+	var names []string
+	for _, ep := range recorded {
+		names = append(names, ep.Name())
+		if !slices.Contains(used, ep.Name()) {
+			v.errorf("module %s: channel %s lists %s among its %s but it never uses the channel", module.Name, name, ep.Name(), side)
+		}
+	}
+	for _, site := range used {
+		if !slices.Contains(names, site) {
+			v.errorf("module %s: channel %s is missing %s from its %s", module.Name, name, site, side)
+		}
+	}
+}
+
+// operationSignals returns every signal op reads or writes, its destination
+// first. A missing destination is returned as nil.
+func operationSignals(op Operation) []*Signal {
+	if dest, ok := operationDest(op); ok {
+		return append([]*Signal{dest}, OperationOperands(op)...)
+	}
+	return OperationOperands(op)
+}
@@ -0,0 +1,150 @@
+package ir
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"mygo/internal/diag"
+)
+
+func TestVerifyAcceptsBuiltDesigns(t *testing.T) {
+	programs := map[string]string{
+		"branch":         branchProgram,
+		"pipeline":       pipelineProgram,
+		"occupancy":      occupancyProgram,
+		"panic":          panicProgram,
+		"serverLoop":     serverLoopProgram,
+		"waitGroup":      waitGroupProgram,
+		"rendezvous":     rendezvousProgram,
+		"channelLen":     channelLenProgram,
+		"channelArray":   channelArrayProgram,
+		"sharedChannel":  sharedChannelProgram,
+		"component":      componentProgram,
+		"enum":           enumProgram,
+		"float":          floatProgram,
+		"software":       softwareProgram,
+		"mutex":          mutexProgram,
+		"nestedSpawnArg": nestedSpawnArgProgram,
+		"sensitivity":    sensitivityProgram,
+	}
+	for name, src := range programs {
+		t.Run(name, func(t *testing.T) {
+			design := buildDesignFromSource(t, src)
+			if err := Verify(design, nil, VerifyOptions{RequireWidths: true}); err != nil {
+				t.Fatalf("unexpected violation: %v", err)
+			}
+		})
+	}
+}
+
+func TestVerifyReportsViolations(t *testing.T) {
+	cases := []struct {
+		name   string
+		mutate func(d *Design)
+		want   string
+	}{
+		{
+			name: "missing terminator",
+			mutate: func(d *Design) {
+				d.TopLevel.Processes[0].Blocks[2].Terminator = nil
+			},
+			want: "block done: missing terminator",
+		},
+		{
+			name: "one-sided edge",
+			mutate: func(d *Design) {
+				done := d.TopLevel.Processes[0].Blocks[2]
+				done.Predecessors = done.Predecessors[:1]
+			},
+			want: "does not list it as a predecessor",
+		},
+		{
+			name: "phi incoming",
+			mutate: func(d *Design) {
+				phi := d.TopLevel.Processes[0].Blocks[2].Ops[0].(*PhiOperation)
+				phi.Incomings = phi.Incomings[:1]
+			},
+			want: "phi out has no incoming from predecessor clamp",
+		},
+		{
+			name: "wire driven twice",
+			mutate: func(d *Design) {
+				clamp := d.TopLevel.Processes[0].Blocks[1]
+				clamp.Ops = append(clamp.Ops, clamp.Ops[0])
+			},
+			want: "wire sum is already driven in block clamp",
+		},
+		{
+			name: "foreign signal",
+			mutate: func(d *Design) {
+				clamp := d.TopLevel.Processes[0].Blocks[1]
+				clamp.Ops[0].(*BinOperation).Right = &Signal{Name: "one", Type: &SignalType{Width: 8}}
+			},
+			want: "one is not a signal of module main",
+		},
+		{
+			name: "assigned param",
+			mutate: func(d *Design) {
+				d.TopLevel.Processes[0].Params = []*Signal{d.TopLevel.Signals["sum"]}
+			},
+			want: "param sum is assigned",
+		},
+		{
+			name: "undriven result",
+			mutate: func(d *Design) {
+				spare := &Signal{Name: "spare", Type: &SignalType{Width: 8}, Kind: Wire}
+				d.TopLevel.Signals[spare.Name] = spare
+				d.TopLevel.Processes[0].Results = []*Signal{spare}
+			},
+			want: "result spare is never driven",
+		},
+		{
+			name: "stale endpoint",
+			mutate: func(d *Design) {
+				d.TopLevel.Channels["in"].Consumers = nil
+			},
+			want: "channel in is missing main from its consumers",
+		},
+		{
+			name: "combinational root",
+			mutate: func(d *Design) {
+				d.TopLevel.Processes[0].Sensitivity = Combinational
+			},
+			want: "process main is combinational but it is the root process",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			design, err := Parse(strings.NewReader(handwrittenIR))
+			if err != nil {
+				t.Fatalf("parse failed: %v", err)
+			}
+			tc.mutate(design)
+			var out bytes.Buffer
+			reporter := diag.NewReporter(&out, "text")
+			err = Verify(design, reporter, VerifyOptions{})
+			if err == nil {
+				t.Fatalf("expected a violation")
+			}
+			if !reporter.HasErrors() || !strings.Contains(out.String(), tc.want) {
+				t.Fatalf("expected a report containing %q, got:\n%s", tc.want, out.String())
+			}
+		})
+	}
+}
+
+func TestVerifyRequiresWidthsOnRequest(t *testing.T) {
+	design, err := Parse(strings.NewReader(handwrittenIR))
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	design.TopLevel.Signals["sum"].Type.Width = 0
+	if err := Verify(design, nil, VerifyOptions{}); err != nil {
+		t.Fatalf("unknown widths are fine before width inference: %v", err)
+	}
+	err = Verify(design, nil, VerifyOptions{RequireWidths: true})
+	if err == nil || !strings.Contains(err.Error(), "signal sum has an unknown width") {
+		t.Fatalf("expected an unknown width violation, got %v", err)
+	}
+}
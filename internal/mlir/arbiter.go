@@ -0,0 +1,324 @@
+package mlir
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"mygo/internal/ir"
+)
+
+// arbiterInfo describes a generated module that shares one side of a channel
+// between several processes. An arbiter merges n producers into one write
+// port; a dispatcher hands each value on a read port to one of n consumers. A
+// mutex arbiter grants a sync.Mutex to one of n users.
+type arbiterInfo struct {
+	moduleName string
+	dispatch   bool
+	mutex      bool
+	policy     ir.Arbitration
+	n          int
+	elemType   *ir.SignalType
+}
+
+func arbiterModuleName(dispatch bool, policy ir.Arbitration, n int, elemType *ir.SignalType) string {
+	kind := "arbiter"
+	if dispatch {
+		kind = "dispatch"
+	}
+	return fmt.Sprintf("mygo_%s_%s_n%d_%s", kind, policy, n, sanitize(typeString(elemType)))
+}
+
+// emitEndpointWires declares one handshake wire set per endpoint on each
+// shared side of ch. Channels with a single producer and consumer connect
+// their goroutines to the FIFO wires directly.
+func (e *emitter) emitEndpointWires(ch *ir.Channel, wireSet *channelWireSet) {
+	s := sanitize(ch.Name)
+	declare := func(prefix string, endpoints []*ir.ChannelEndpoint) map[endpointKey]handshakeWires {
+		if len(endpoints) < 2 {
+			return nil
+		}
+		out := make(map[endpointKey]handshakeWires, len(endpoints))
+		for idx, ep := range endpoints {
+			wires := handshakeWires{
+				data:  fmt.Sprintf("%%chan_%s_%s%d_data", s, prefix, idx),
+				valid: fmt.Sprintf("%%chan_%s_%s%d_valid", s, prefix, idx),
+				ready: fmt.Sprintf("%%chan_%s_%s%d_ready", s, prefix, idx),
+			}
+			e.printIndent()
+			e.w.op("%s = sv.wire : %s", wires.data, inoutTypeString(ch.Type))
+			e.printIndent()
+			e.w.op("%s = sv.wire : !hw.inout<i1>", wires.valid)
+			e.printIndent()
+			e.w.op("%s = sv.wire : !hw.inout<i1>", wires.ready)
+			out[keyOf(ep)] = wires
+		}
+		return out
+	}
+	wireSet.writers = declare("p", ch.ProducerPorts())
+	wireSet.readers = declare("c", ch.ConsumerPorts())
+}
+
+// emitChannelArbiters instantiates an arbiter for every channel with several
+// producers and a dispatcher for every channel with several consumers.
+func (e *emitter) emitChannelArbiters(module *ir.Module, wires map[*ir.Channel]*channelWireSet) {
+	names := make([]string, 0, len(module.Channels))
+	for name := range module.Channels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		ch := module.Channels[name]
+		wireSet := wires[ch]
+		if wireSet == nil {
+			continue
+		}
+		if len(wireSet.writers) > 0 {
+			fifoSide := handshakeWires{data: wireSet.writeData, valid: wireSet.writeValid, ready: wireSet.writeReady}
+			e.emitArbiterInstance(ch, false, ch.ProducerPorts(), wireSet.writers, fifoSide)
+		}
+		if len(wireSet.readers) > 0 {
+			fifoSide := handshakeWires{data: wireSet.readData, valid: wireSet.readValid, ready: wireSet.readReady}
+			e.emitArbiterInstance(ch, true, ch.ConsumerPorts(), wireSet.readers, fifoSide)
+		}
+	}
+}
+
+func (e *emitter) emitArbiterInstance(ch *ir.Channel, dispatch bool, eps []*ir.ChannelEndpoint, endpoints map[endpointKey]handshakeWires, shared handshakeWires) {
+	moduleName := arbiterModuleName(dispatch, ch.Arbitration, len(eps), ch.Type)
+	if _, ok := e.arbiterDecls[moduleName]; !ok {
+		e.arbiterDecls[moduleName] = &arbiterInfo{
+			moduleName: moduleName,
+			dispatch:   dispatch,
+			policy:     ch.Arbitration,
+			n:          len(eps),
+			elemType:   ch.Type,
+		}
+	}
+	elemInout := inoutTypeString(ch.Type)
+	sharedPrefix, endpointPrefix, instSuffix := "out", "in", "arbiter"
+	if dispatch {
+		sharedPrefix, endpointPrefix, instSuffix = "in", "out", "dispatch"
+	}
+	ports := []string{"clk: %clk : i1", "rst: %rst : i1"}
+	for idx, ep := range eps {
+		wires := endpoints[keyOf(ep)]
+		ports = append(ports,
+			fmt.Sprintf("%s%d_data: %s : %s", endpointPrefix, idx, wires.data, elemInout),
+			fmt.Sprintf("%s%d_valid: %s : !hw.inout<i1>", endpointPrefix, idx, wires.valid),
+			fmt.Sprintf("%s%d_ready: %s : !hw.inout<i1>", endpointPrefix, idx, wires.ready),
+		)
+	}
+	ports = append(ports,
+		fmt.Sprintf("%s_data: %s : %s", sharedPrefix, shared.data, elemInout),
+		fmt.Sprintf("%s_valid: %s : !hw.inout<i1>", sharedPrefix, shared.valid),
+		fmt.Sprintf("%s_ready: %s : !hw.inout<i1>", sharedPrefix, shared.ready),
+	)
+	e.printIndent()
+	e.w.op("hw.instance \"%s_%s\" @%s(%s) -> ()", sanitize(ch.Name), instSuffix, moduleName, strings.Join(ports, ", "))
+}
+
+func (e *emitter) emitArbiterModules() {
+	names := make([]string, 0, len(e.arbiterDecls))
+	for name := range e.arbiterDecls {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if info := e.arbiterDecls[name]; info.mutex {
+			e.emitMutexArbiterModule(info)
+		} else {
+			e.emitArbiterModule(info)
+		}
+	}
+}
+
+// emitArbiterModule prints the body of a generated arbiter or dispatcher.
+// The requests are the producers' valid strobes for an arbiter and the
+// consumers' ready strobes for a dispatcher. Exactly one request is granted
+// per transfer, so every value is written or delivered once.
+func (e *emitter) emitArbiterModule(info *arbiterInfo) {
+	elemType := typeString(info.elemType)
+	sharedPrefix, endpointPrefix := "out", "in"
+	if info.dispatch {
+		sharedPrefix, endpointPrefix = "in", "out"
+	}
+	ports := []string{"in %clk: i1", "in %rst: i1"}
+	for i := 0; i < info.n; i++ {
+		ports = append(ports,
+			fmt.Sprintf("inout %%%s%d_data: %s", endpointPrefix, i, elemType),
+			fmt.Sprintf("inout %%%s%d_valid: i1", endpointPrefix, i),
+			fmt.Sprintf("inout %%%s%d_ready: i1", endpointPrefix, i),
+		)
+	}
+	ports = append(ports,
+		fmt.Sprintf("inout %%%s_data: %s", sharedPrefix, elemType),
+		fmt.Sprintf("inout %%%s_valid: i1", sharedPrefix),
+		fmt.Sprintf("inout %%%s_ready: i1", sharedPrefix),
+	)
+	e.printIndent()
+	e.w.open("hw.module @%s(%s) {", info.moduleName, strings.Join(ports, ", "))
+	e.indent++
+	b := &arbiterBuilder{w: e.w, indent: e.indent}
+	b.line("%%true = hw.constant true")
+	b.line("%%false = hw.constant false")
+
+	reqs := make([]string, info.n)
+	for i := range reqs {
+		port := fmt.Sprintf("%%%s%d_valid", endpointPrefix, i)
+		if info.dispatch {
+			port = fmt.Sprintf("%%%s%d_ready", endpointPrefix, i)
+		}
+		reqs[i] = b.read(port, "i1")
+	}
+	anyReq := b.or(reqs)
+	// The shared side answers every request: the FIFO's ready for an
+	// arbiter, its valid for a dispatcher.
+	sharedPort := "%out_ready"
+	if info.dispatch {
+		sharedPort = "%in_valid"
+	}
+	shared := b.read(sharedPort, "i1")
+	grants := b.grants(reqs, info.policy, b.and(shared, anyReq))
+
+	if info.dispatch {
+		data := b.read("%in_data", elemType)
+		b.line("sv.assign %%in_ready, %s : i1", anyReq)
+		for i, grant := range grants {
+			b.line("sv.assign %%out%d_data, %s : %s", i, data, elemType)
+			b.line("sv.assign %%out%d_valid, %s : i1", i, b.and(shared, grant))
+		}
+	} else {
+		data := b.read(fmt.Sprintf("%%in%d_data", info.n-1), elemType)
+		for i := info.n - 2; i >= 0; i-- {
+			in := b.read(fmt.Sprintf("%%in%d_data", i), elemType)
+			sel := b.fresh("sel")
+			b.line("%s = comb.mux %s, %s, %s : %s", sel, grants[i], in, data, elemType)
+			data = sel
+		}
+		b.line("sv.assign %%out_data, %s : %s", data, elemType)
+		b.line("sv.assign %%out_valid, %s : i1", anyReq)
+		for i, grant := range grants {
+			b.line("sv.assign %%in%d_ready, %s : i1", i, b.and(shared, grant))
+		}
+	}
+	b.line("hw.output")
+	e.indent--
+	e.printIndent()
+	e.w.close()
+}
+
+// arbiterBuilder prints the combinational netlist of an arbiter module.
+type arbiterBuilder struct {
+	w      io.Writer
+	indent int
+	next   int
+}
+
+func (b *arbiterBuilder) line(format string, args ...any) {
+	fmt.Fprint(b.w, strings.Repeat("  ", b.indent))
+	fmt.Fprintf(b.w, format+"\n", args...)
+}
+
+func (b *arbiterBuilder) fresh(prefix string) string {
+	name := fmt.Sprintf("%%%s%d", prefix, b.next)
+	b.next++
+	return name
+}
+
+func (b *arbiterBuilder) read(port, typ string) string {
+	value := b.fresh("v")
+	b.line("%s = sv.read_inout %s : !hw.inout<%s>", value, port, typ)
+	return value
+}
+
+func (b *arbiterBuilder) and(x, y string) string {
+	value := b.fresh("and")
+	b.line("%s = comb.and %s, %s : i1", value, x, y)
+	return value
+}
+
+func (b *arbiterBuilder) or(values []string) string {
+	if len(values) == 1 {
+		return values[0]
+	}
+	value := b.fresh("or")
+	b.line("%s = comb.or %s : i1", value, strings.Join(values, ", "))
+	return value
+}
+
+func (b *arbiterBuilder) not(x string) string {
+	value := b.fresh("not")
+	b.line("%s = comb.xor %s, %%true : i1", value, x)
+	return value
+}
+
+// priority grants the lowest-numbered request.
+func (b *arbiterBuilder) priority(reqs []string) []string {
+	grants := make([]string, len(reqs))
+	grants[0] = reqs[0]
+	taken := reqs[0]
+	for i := 1; i < len(reqs); i++ {
+		grants[i] = b.and(reqs[i], b.not(taken))
+		if i < len(reqs)-1 {
+			taken = b.or([]string{taken, reqs[i]})
+		}
+	}
+	return grants
+}
+
+// grants selects one request. Round-robin keeps the last grant in a register
+// and prefers requests numbered after it, falling back to plain priority when
+// none of those is raised. The register advances on every transfer.
+func (b *arbiterBuilder) grants(reqs []string, policy ir.Arbitration, fire string) []string {
+	if policy == ir.ArbitratePriority || len(reqs) == 1 {
+		return b.priority(reqs)
+	}
+	lastRegs := make([]string, len(reqs))
+	last := make([]string, len(reqs))
+	for i := range reqs {
+		lastRegs[i] = b.fresh("last_reg")
+		b.line("%s = sv.reg : !hw.inout<i1>", lastRegs[i])
+		last[i] = b.read(lastRegs[i], "i1")
+	}
+	masked := make([]string, len(reqs))
+	masked[0] = "%false"
+	after := last[0]
+	for i := 1; i < len(reqs); i++ {
+		masked[i] = b.and(reqs[i], after)
+		if i < len(reqs)-1 {
+			after = b.or([]string{after, last[i]})
+		}
+	}
+	anyMasked := b.or(masked[1:])
+	maskedGrants := append([]string{"%false"}, b.priority(masked[1:])...)
+	plainGrants := b.priority(reqs)
+	grants := make([]string, len(reqs))
+	for i := range reqs {
+		grants[i] = b.fresh("grant")
+		b.line("%s = comb.mux %s, %s, %s : i1", grants[i], anyMasked, maskedGrants[i], plainGrants[i])
+	}
+	b.line("sv.always posedge %%clk {")
+	b.indent++
+	b.line("sv.if %%rst {")
+	b.indent++
+	for _, reg := range lastRegs {
+		b.line("sv.passign %s, %%false : i1", reg)
+	}
+	b.indent--
+	b.line("} else {")
+	b.indent++
+	b.line("sv.if %s {", fire)
+	b.indent++
+	for i, reg := range lastRegs {
+		b.line("sv.passign %s, %s : i1", reg, grants[i])
+	}
+	b.indent--
+	b.line("}")
+	b.indent--
+	b.line("}")
+	b.indent--
+	b.line("}")
+	return grants
+}
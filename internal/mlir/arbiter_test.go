@@ -0,0 +1,98 @@
+package mlir
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"mygo/internal/diag"
+	"mygo/internal/frontend"
+	"mygo/internal/ir"
+)
+
+// replicatedWorkerProgram starts one worker twice on a shared channel, each
+// goroutine with its own id.
+const replicatedWorkerProgram = `
+package main
+
+func worker(out chan<- uint32, id uint32) {
+    out <- id
+}
+
+func main() {
+    out := make(chan uint32, 2)
+    go worker(out, 1)
+    go worker(out, 2)
+    _ = <-out + <-out
+}
+`
+
+func TestReplicatedWorkersShareChannelThroughArbiter(t *testing.T) {
+	text := emitFromSource(t, replicatedWorkerProgram)
+	for _, want := range []string{
+		`hw.instance "worker_inst0" @main__proc_worker(`,
+		`hw.instance "worker_inst1" @main__proc_worker(`,
+		"@mygo_arbiter_round_robin_n2_i32(",
+		"hw.module @mygo_arbiter_round_robin_n2_i32(",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("MLIR missing %q:\n%s", want, text)
+		}
+	}
+	if n := strings.Count(text, "hw.module @main__proc_worker("); n != 1 {
+		t.Errorf("expected the worker module once, got %d:\n%s", n, text)
+	}
+	for idx, inst := range []string{"worker_inst0", "worker_inst1"} {
+		line := instanceLine(t, text, inst)
+		want := fmt.Sprintf("chan_out_wdata: %%chan_t0_p%d_data", idx)
+		if !strings.Contains(line, want) {
+			t.Errorf("expected %s to send through its own arbiter input (%s):\n%s", inst, want, line)
+		}
+	}
+}
+
+// instanceLine returns the line that instantiates name.
+func instanceLine(t *testing.T, text, name string) string {
+	t.Helper()
+	for _, line := range strings.Split(text, "\n") {
+		if strings.Contains(line, "hw.instance \""+name+"\"") {
+			return line
+		}
+	}
+	t.Fatalf("missing instance %s:\n%s", name, text)
+	return ""
+}
+
+// emitFromSource compiles a one-file main package and returns its MLIR.
+func emitFromSource(t *testing.T, source string) string {
+	t.Helper()
+	dir := t.TempDir()
+	file := filepath.Join(dir, "main.go")
+	if err := os.WriteFile(file, []byte(source), 0o644); err != nil {
+		t.Fatalf("write source: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module testcase\n\ngo 1.22\n"), 0o644); err != nil {
+		t.Fatalf("write go.mod: %v", err)
+	}
+	reporter := diag.NewReporter(io.Discard, "text")
+	pkgs, _, err := frontend.LoadPackages(frontend.LoadConfig{Sources: []string{file}}, reporter)
+	if err != nil {
+		t.Fatalf("load packages: %v", err)
+	}
+	prog, _, err := frontend.BuildSSA(pkgs, reporter)
+	if err != nil {
+		t.Fatalf("build ssa: %v", err)
+	}
+	design, err := ir.BuildDesign(prog, pkgs, reporter)
+	if err != nil {
+		t.Fatalf("build design: %v", err)
+	}
+	var out strings.Builder
+	if err := Write(&out, design); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	return out.String()
+}
@@ -0,0 +1,155 @@
+package mlir
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"mygo/internal/ir"
+)
+
+// combBuilder lowers a combinational process without a state machine. Every
+// operation is plain logic; a block is active while the process's start input
+// is high and the branches on the way to it are taken, and that activity
+// gates the spawns and assertions in the block. A phi selects the value of
+// the edge that is taken.
+type combBuilder struct {
+	printer  *processPrinter
+	proc     *ir.Process
+	opBlocks map[ir.Operation]*ir.BasicBlock
+	active   map[*ir.BasicBlock]string
+	edges    map[edgeKey]string
+}
+
+func newCombBuilder(printer *processPrinter, proc *ir.Process) *combBuilder {
+	c := &combBuilder{
+		printer:  printer,
+		proc:     proc,
+		opBlocks: make(map[ir.Operation]*ir.BasicBlock),
+		active:   make(map[*ir.BasicBlock]string),
+		edges:    make(map[edgeKey]string),
+	}
+	for _, block := range proc.Blocks {
+		for _, op := range block.Ops {
+			c.opBlocks[op] = block
+		}
+	}
+	return c
+}
+
+// opActive returns the activity of the block holding op.
+func (c *combBuilder) opActive(op ir.Operation) string {
+	block := c.opBlocks[op]
+	if block == nil {
+		return ""
+	}
+	return c.blockActive(block)
+}
+
+// blockActive returns an i1 value that is high while control is in block: the
+// start input for the entry block, otherwise the OR of the edges into it.
+func (c *combBuilder) blockActive(block *ir.BasicBlock) string {
+	if name, ok := c.active[block]; ok {
+		if name == "" {
+			// A cycle, which ir.Verify rejects; read it as never taken.
+			return c.printer.boolConst(false)
+		}
+		return name
+	}
+	if len(c.proc.Blocks) > 0 && block == c.proc.Blocks[0] {
+		c.active[block] = c.printer.startValue
+		return c.printer.startValue
+	}
+	c.active[block] = ""
+	// Predecessors are walked in block order, which a parsed design keeps.
+	var edges []string
+	for _, pred := range c.proc.Blocks {
+		if slices.Contains(block.Predecessors, pred) {
+			edges = append(edges, c.edgeActive(pred, block))
+		}
+	}
+	var name string
+	switch len(edges) {
+	case 0:
+		name = c.printer.boolConst(false)
+	case 1:
+		name = edges[0]
+	default:
+		name = c.printer.freshValueName("active")
+		c.printer.printIndent()
+		c.printer.w.op("%s = comb.or %s : i1", name, strings.Join(edges, ", "))
+	}
+	c.active[block] = name
+	return name
+}
+
+// edgeActive returns an i1 value that is high while control passes from pred
+// to succ.
+func (c *combBuilder) edgeActive(pred, succ *ir.BasicBlock) string {
+	key := edgeKey{pred: pred, succ: succ}
+	if name, ok := c.edges[key]; ok {
+		return name
+	}
+	value := c.blockActive(pred)
+	if br, ok := pred.Terminator.(*ir.BranchTerminator); ok && br.True != br.False {
+		p := c.printer
+		cond := p.valueRef(br.Cond)
+		defer p.at(ir.TerminatorSource(br))()
+		if succ == br.False {
+			one := p.boolConst(true)
+			inverted := p.freshValueName("not")
+			p.printIndent()
+			p.w.op("%s = comb.xor %s, %s : i1", inverted, cond, one)
+			cond = inverted
+		}
+		edge := p.freshValueName("edge")
+		p.printIndent()
+		p.w.op("%s = comb.and %s, %s : i1", edge, value, cond)
+		value = edge
+	}
+	c.edges[key] = value
+	return value
+}
+
+// emitPhi drives phi's destination from a chain of muxes on the edges into
+// block. The last incoming needs no select, since one edge is always taken
+// while the block is active.
+func (c *combBuilder) emitPhi(block *ir.BasicBlock, phi *ir.PhiOperation) {
+	p := c.printer
+	if len(phi.Incomings) == 0 {
+		p.printIndent()
+		fmt.Fprintf(p.w, "// phi %s has no incoming values\n", sanitize(phi.Dest.Name))
+		return
+	}
+	typeStr := typeString(phi.Dest.Type)
+	dest := p.bindSSA(phi.Dest)
+	last := len(phi.Incomings) - 1
+	value := p.valueRef(phi.Incomings[last].Value)
+	if last == 0 {
+		p.printIndent()
+		p.w.op("%s = hw.wire %s : %s", dest, value, typeStr)
+		return
+	}
+	for idx := last - 1; idx >= 0; idx-- {
+		in := phi.Incomings[idx]
+		edge := c.edgeActive(in.Block, block)
+		name := dest
+		if idx > 0 {
+			name = p.freshValueName("phi_sel")
+		}
+		p.printIndent()
+		p.w.op("%s = comb.mux %s, %s, %s : %s", name, edge, p.valueRef(in.Value), value, typeStr)
+		value = name
+	}
+}
+
+// emitAssign makes the destination of a store another name for the stored
+// value. A combinational process drives each signal once, so no register is
+// needed to hold it.
+func (c *combBuilder) emitAssign(o *ir.AssignOperation) {
+	p := c.printer
+	src := p.valueRef(o.Value)
+	dest := p.bindSSA(o.Dest)
+	p.printIndent()
+	p.w.op("%s = hw.wire %s : %s", dest, src, typeString(o.Dest.Type))
+}
@@ -0,0 +1,137 @@
+package mlir
+
+import (
+	"strings"
+	"testing"
+
+	"mygo/internal/ir"
+)
+
+// combinationalIR spawns pick, a combinational process that branches, merges
+// the branches in a phi, asserts on the result and returns it. pick places
+// the leaf it spawns itself.
+const combinationalIR = `module main
+  ports:
+    in  clk 1bu
+    in  rst 1bu
+    out done 1bu
+  signals:
+    const_0  const 8bu = 5
+  instances:
+    pick_inst0 main__proc_pick (clk=clk, rst=rst, start=pick_inst0_start, arg_v_1=const_0, done=pick_inst0_done, ret_result_2=pick_inst0_ret_result_2)
+  process 0 main (stage=0, sequential)
+    block entry
+      go pick(stage=2)(const_0)
+      return
+
+module main__proc_leaf
+  ports:
+    in  clk 1bu
+    in  rst 1bu
+    in  start 1bu
+    in  arg_v_5 8bu
+    out done 1bu
+    out ret_result_6 8bu
+  signals:
+    const_7  const 8bu = 1
+    result_6 wire  8bu
+    t0_8     wire  8bu
+    v_5      wire  8bu
+  process 0 leaf (stage=1, combinational)
+    params v_5
+    results result_6
+    block entry
+      t0_8 := v_5 + const_7
+      jump exit
+    block exit
+      result_6 := phi[entry:t0_8]
+      return
+
+module main__proc_pick
+  ports:
+    in  clk 1bu
+    in  rst 1bu
+    in  start 1bu
+    in  arg_v_1 8bu
+    out done 1bu
+    out ret_result_2 8bu
+  signals:
+    const_12 const 8bu = 9
+    const_13 const 8bu = 0
+    const_15 const 8bu = 1
+    const_3  const 8bu = 3
+    const_9  const 8bu = 3
+    result_2 wire  8bu
+    t0_4     wire  1bu
+    t1_10    wire  8bu
+    t2_11    wire  8bu
+    t3_14    wire  1bu
+    t4_16    wire  1bu
+    v_1      wire  8bu
+  instances:
+    leaf_inst0 main__proc_leaf (clk=clk, rst=rst, start=leaf_inst0_start, arg_v_5=v_1, done=leaf_inst0_done, ret_result_6=leaf_inst0_ret_result_6)
+  process 0 pick (stage=2, combinational)
+    params v_1
+    results result_2
+    block entry
+      t0_4 := cmp(v_1 >u const_3)
+      br t0_4 ? if.then.2 : if.else
+    block if.else
+      t4_16 := cmp(v_1 == const_15)
+      br t4_16 ? if.then.1 : if.done.1
+    block if.then.1
+      jump if.done.1
+    block if.then.2
+      go leaf(stage=1)(v_1)
+      t1_10 := v_1 - const_9
+      jump if.done.1
+    block if.done.1
+      t2_11 := phi[if.then.2:t1_10, if.else:v_1, if.then.1:const_12]
+      t3_14 := cmp(t2_11 == const_13)
+      br t3_14 ? if.then.3 : if.done.2
+    block if.done.2
+      jump exit
+    block exit
+      result_2 := phi[if.done.2:t2_11]
+      return
+    block if.then.3
+      panic when t3_14 "zero" at "main.go:16:8"
+      return
+
+`
+
+func TestCombinationalProcessHasNoStateMachine(t *testing.T) {
+	design, err := ir.Parse(strings.NewReader(combinationalIR))
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	var out strings.Builder
+	if err := Write(&out, design); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	text := out.String()
+	start := strings.Index(text, "hw.module @main__proc_pick(")
+	if start < 0 {
+		t.Fatalf("missing pick module:\n%s", text)
+	}
+	pick := text[start:]
+	pick = pick[:strings.Index(pick, "\n  }\n")]
+	for _, unwanted := range []string{"sv.reg", "seq.compreg", "state"} {
+		if strings.Contains(pick, unwanted) {
+			t.Errorf("combinational module contains %q:\n%s", unwanted, pick)
+		}
+	}
+	for _, want := range []string{
+		"in %arg_v_1: i8, out done: i1, out ret_result_2: i8",
+		"%edge7 = comb.and %start, %v5 : i1",
+		"%v9 = comb.mux %edge7, %v8, %phi_sel14 : i8",
+		"%v16 = hw.wire %v9 : i8",
+		"sv.if %edge20 {",
+		`hw.instance "leaf_inst0" @main__proc_leaf(clk: %clk : i1, rst: %rst : i1, start: %edge7 : i1, arg_v_5: %arg_v_1 : i8)`,
+		"hw.output %start, %v16 : i1, i8",
+	} {
+		if !strings.Contains(pick, want) {
+			t.Errorf("combinational module missing %q:\n%s", want, pick)
+		}
+	}
+}
@@ -2,9 +2,12 @@ package mlir
 
 import (
 	"fmt"
+	"go/token"
 	"io"
+	"maps"
 	"math/bits"
 	"os"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
@@ -15,60 +18,120 @@ import (
 // Emit writes the MLIR representation of the design to outputPath. When
 // outputPath is empty or "-", the result is written to stdout.
 func Emit(design *ir.Design, outputPath string) error {
-	var w io.Writer
 	if outputPath == "" || outputPath == "-" {
-		w = os.Stdout
-	} else {
-		f, err := os.Create(outputPath)
+		return Write(os.Stdout, design)
+	}
+	f, err := os.Create(outputPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return Write(f, design)
+}
+
+// Write writes the MLIR representation of the design to w.
+func Write(w io.Writer, design *ir.Design) error {
+	// A module placed by instances runs one process and is printed once,
+	// after the top-level modules, however many goroutines run it.
+	placed := make(map[*ir.Module]bool)
+	for _, module := range design.Modules {
+		for _, inst := range module.Instances {
+			placed[inst.Module] = true
+		}
+	}
+	infos := make(map[*ir.Process]*processInfo)
+	var tops, children []*ir.Module
+	for _, module := range design.Modules {
+		info, err := moduleProcessInfo(module, placed[module])
 		if err != nil {
 			return err
 		}
-		defer f.Close()
-		w = f
+		if info != nil {
+			infos[info.proc] = info
+		}
+		if placed[module] {
+			children = append(children, module)
+		} else {
+			tops = append(tops, module)
+		}
 	}
 
 	em := &emitter{
-		w:         w,
-		fifoDecls: make(map[string]*fifoInfo),
-	}
-	fmt.Fprintln(w, "module {")
+		w:            newOpWriter(w, design),
+		fifoDecls:    make(map[string]*fifoInfo),
+		arbiterDecls: make(map[string]*arbiterInfo),
+		floatUnits:   make(map[string]*floatUnitInfo),
+		floatMode:    design.FloatMode,
+		counted:      design.CountedChannels(),
+	}
+	em.w.open("module {")
 	em.indent++
-	for _, module := range design.Modules {
-		em.emitModule(module)
+	for _, module := range tops {
+		em.emitTopLevelModule(module, moduleSites(design, module), infos)
+	}
+	for _, module := range children {
+		em.emitProcessModule(infos[module.Processes[0]])
 	}
+	// The shared library modules below come from no one line of Go.
+	em.w.restore("")
 	em.emitFifoExterns()
+	em.emitArbiterModules()
+	em.emitFloatUnitModules()
 	em.indent--
-	fmt.Fprintln(w, "}")
-	return nil
+	em.w.close()
+	if em.w.err != nil {
+		return em.w.err
+	}
+	return em.err
 }
 
 type emitter struct {
-	w         io.Writer
-	indent    int
-	fifoDecls map[string]*fifoInfo
-}
-
-func (e *emitter) emitModule(module *ir.Module) {
-	if module == nil {
-		return
-	}
-	processInfos := buildProcessInfos(module)
-	var root *processInfo
-	others := make([]*processInfo, 0, len(processInfos))
-	for _, info := range processInfos {
-		if info.proc != nil && info.proc.Name == module.Name && root == nil {
-			root = info
-			continue
+	w            *opWriter
+	indent       int
+	fifoDecls    map[string]*fifoInfo
+	arbiterDecls map[string]*arbiterInfo
+	floatUnits   map[string]*floatUnitInfo
+	floatMode    ir.FloatMode
+	// counted holds the channels read with len, whose FIFOs expose count.
+	counted map[*ir.Channel]bool
+	// err is the first inconsistency found in the hierarchy.
+	err error
+}
+
+// fail records an inconsistency in the hierarchy; Write returns the first.
+func (e *emitter) fail(format string, args ...any) {
+	if e.err == nil {
+		e.err = fmt.Errorf(format, args...)
+	}
+}
+
+// moduleSites returns the hardware goroutines that run in module or below
+// it. Only the top level of the design places instances; any other module
+// that is not placed runs its processes once each.
+func moduleSites(design *ir.Design, module *ir.Module) []ir.Site {
+	var sites []ir.Site
+	if module == design.TopLevel {
+		for _, site := range design.Sites() {
+			if site.Process.Software == nil {
+				sites = append(sites, site)
+			}
 		}
-		others = append(others, info)
+		return sites
 	}
-	e.emitTopLevelModule(module, root, others)
-	for _, info := range others {
-		e.emitProcessModule(module, info)
+	for _, proc := range module.Processes {
+		if proc.Software == nil {
+			sites = append(sites, ir.Site{Process: proc})
+		}
 	}
+	return sites
 }
 
-func (e *emitter) emitTopLevelModule(module *ir.Module, root *processInfo, processes []*processInfo) map[*ir.Channel]*channelWireSet {
+// emitTopLevelModule prints module with its root process inline. The
+// channels, wait groups, mutexes and shared registers live here, with a set
+// of handshake wires for every goroutine that reaches them, and the nets
+// the instances connect to are mapped onto those wires.
+func (e *emitter) emitTopLevelModule(module *ir.Module, sites []ir.Site, infos map[*ir.Process]*processInfo) {
+	e.w.at(module.Source)
 	e.printIndent()
 	fmt.Fprintf(e.w, "hw.module @%s(", module.Name)
 	decls := portDecls(module.Ports)
@@ -79,24 +142,59 @@ func (e *emitter) emitTopLevelModule(module *ir.Module, root *processInfo, proce
 		fmt.Fprint(e.w, decl)
 	}
 	fmt.Fprint(e.w, ")")
-	fmt.Fprintln(e.w, " {")
+	e.w.open(" {")
 	e.indent++
 
+	nets := map[string]string{
+		ir.ClockPort: "%clk",
+		ir.ResetPort: "%rst",
+	}
 	channelWires := e.emitChannelWires(module)
 	e.emitChannelFifos(module, channelWires)
+	e.emitChannelArbiters(module, channelWires)
+	bindChannelNets(module, channelWires, nets)
+	outputs := e.emitStreams(module, channelWires)
+	mutexWires := e.emitMutexes(module, nets)
+	sharedWires := e.emitSharedRegisters(sites, infos, nets)
+	releases := e.emitWaitGroupReleases(module, nets)
+	var root *processInfo
+	for _, proc := range module.Processes {
+		if info := infos[proc]; info != nil {
+			root = info
+		}
+	}
+	var pp *processPrinter
 	if root != nil {
-		e.emitRootProcess(module, root, channelWires)
+		pp = e.emitRootProcess(module, root, channelWires, mutexWires, sharedWires, releases)
+		outputs[ir.DonePort] = pp.doneValue
+		pp.bindSpawnNets(module, nets)
 	}
-	for idx, info := range processes {
-		e.emitProcessInstance(idx, info, channelWires)
+	for _, inst := range module.Instances {
+		e.emitInstance(inst, nets)
+	}
+	for _, proc := range module.Processes {
+		if proc.Software == nil {
+			continue
+		}
+		var sources []string
+		for _, site := range sites {
+			info := infos[site.Process]
+			if info == nil || !slices.Contains(info.spawns, proc) {
+				continue
+			}
+			if len(site.Path) == 0 && pp != nil {
+				sources = append(sources, pp.spawnStartValue(proc))
+				continue
+			}
+			sources = append(sources, portName(site.Net(ir.SpawnPort(proc))))
+		}
+		outputs[ir.SoftwareStartPort(proc)] = e.emitSoftwareStart(proc, sources)
 	}
 
-	e.printIndent()
-	fmt.Fprintln(e.w, "hw.output")
+	e.emitTopOutputs(module, outputs)
 	e.indent--
 	e.printIndent()
-	fmt.Fprintln(e.w, "}")
-	return channelWires
+	e.w.close()
 }
 
 func (e *emitter) emitChannelWires(module *ir.Module) map[*ir.Channel]*channelWireSet {
@@ -109,9 +207,19 @@ func (e *emitter) emitChannelWires(module *ir.Module) map[*ir.Channel]*channelWi
 		names = append(names, name)
 	}
 	sort.Strings(names)
+	base := e.w.at(token.NoPos)
+	defer e.w.restore(base)
 	for _, name := range names {
 		ch := module.Channels[name]
+		e.w.restore(base)
+		e.w.at(ch.Source)
 		s := sanitize(ch.Name)
+		if ch.Unbuffered() {
+			wires[ch] = e.emitRendezvousWires(ch, s)
+			e.emitEndpointWires(ch, wires[ch])
+			e.emitChannelMetadata(ch)
+			continue
+		}
 		wireSet := &channelWireSet{
 			writeData:  fmt.Sprintf("%%chan_%s_wdata", s),
 			writeValid: fmt.Sprintf("%%chan_%s_wvalid", s),
@@ -120,26 +228,56 @@ func (e *emitter) emitChannelWires(module *ir.Module) map[*ir.Channel]*channelWi
 			readValid:  fmt.Sprintf("%%chan_%s_rvalid", s),
 			readReady:  fmt.Sprintf("%%chan_%s_rready", s),
 		}
+		if e.counted[ch] {
+			wireSet.count = fmt.Sprintf("%%chan_%s_count", s)
+		}
 		wires[ch] = wireSet
 		e.printIndent()
 		fmt.Fprintf(e.w, "// channel %s depth=%d type=%s\n", ch.Name, ch.Depth, typeString(ch.Type))
 		e.printIndent()
-		fmt.Fprintf(e.w, "%s = sv.wire : %s\n", wireSet.writeData, inoutTypeString(ch.Type))
+		e.w.op("%s = sv.wire : %s", wireSet.writeData, inoutTypeString(ch.Type))
 		e.printIndent()
-		fmt.Fprintf(e.w, "%s = sv.wire : !hw.inout<i1>\n", wireSet.writeValid)
+		e.w.op("%s = sv.wire : !hw.inout<i1>", wireSet.writeValid)
 		e.printIndent()
-		fmt.Fprintf(e.w, "%s = sv.wire : !hw.inout<i1>\n", wireSet.writeReady)
+		e.w.op("%s = sv.wire : !hw.inout<i1>", wireSet.writeReady)
 		e.printIndent()
-		fmt.Fprintf(e.w, "%s = sv.wire : %s\n", wireSet.readData, inoutTypeString(ch.Type))
+		e.w.op("%s = sv.wire : %s", wireSet.readData, inoutTypeString(ch.Type))
 		e.printIndent()
-		fmt.Fprintf(e.w, "%s = sv.wire : !hw.inout<i1>\n", wireSet.readValid)
+		e.w.op("%s = sv.wire : !hw.inout<i1>", wireSet.readValid)
 		e.printIndent()
-		fmt.Fprintf(e.w, "%s = sv.wire : !hw.inout<i1>\n", wireSet.readReady)
+		e.w.op("%s = sv.wire : !hw.inout<i1>", wireSet.readReady)
+		e.emitEndpointWires(ch, wireSet)
 		e.emitChannelMetadata(ch)
 	}
 	return wires
 }
 
+// emitRendezvousWires connects the two ends of an unbuffered channel
+// directly. The producer drives data and valid, the consumer drives ready, and
+// both sides read the same wires, so a send and its receive fire in the same
+// cycle and each stalls until the other arrives.
+func (e *emitter) emitRendezvousWires(ch *ir.Channel, s string) *channelWireSet {
+	data := fmt.Sprintf("%%chan_%s_data", s)
+	valid := fmt.Sprintf("%%chan_%s_valid", s)
+	ready := fmt.Sprintf("%%chan_%s_ready", s)
+	e.printIndent()
+	fmt.Fprintf(e.w, "// channel %s unbuffered type=%s\n", ch.Name, typeString(ch.Type))
+	e.printIndent()
+	e.w.op("%s = sv.wire : %s", data, inoutTypeString(ch.Type))
+	e.printIndent()
+	e.w.op("%s = sv.wire : !hw.inout<i1>", valid)
+	e.printIndent()
+	e.w.op("%s = sv.wire : !hw.inout<i1>", ready)
+	return &channelWireSet{
+		writeData:  data,
+		writeValid: valid,
+		writeReady: ready,
+		readData:   data,
+		readValid:  valid,
+		readReady:  ready,
+	}
+}
+
 func (e *emitter) emitChannelFifos(module *ir.Module, wires map[*ir.Channel]*channelWireSet) {
 	if module == nil || len(module.Channels) == 0 {
 		return
@@ -149,13 +287,24 @@ func (e *emitter) emitChannelFifos(module *ir.Module, wires map[*ir.Channel]*cha
 		names = append(names, name)
 	}
 	sort.Strings(names)
+	base := e.w.at(token.NoPos)
+	defer e.w.restore(base)
 	for _, name := range names {
 		ch := module.Channels[name]
+		if ch.Unbuffered() {
+			continue
+		}
+		e.w.restore(base)
+		e.w.at(ch.Source)
 		wireSet := wires[ch]
 		elemInout := inoutTypeString(ch.Type)
-		moduleName := fifoModuleName(ch)
-		e.recordFifo(moduleName, ch)
+		counted := e.counted[ch]
+		moduleName := fifoModuleName(ch, counted)
+		e.recordFifo(moduleName, ch, counted)
 		e.printIndent()
+		if counted {
+			fmt.Fprintf(e.w, "%s = ", wireSet.count)
+		}
 		fmt.Fprintf(e.w, "hw.instance \"%s_fifo\" @%s(", sanitize(ch.Name), moduleName)
 		ports := []struct {
 			name  string
@@ -177,148 +326,285 @@ func (e *emitter) emitChannelFifos(module *ir.Module, wires map[*ir.Channel]*cha
 			}
 			fmt.Fprintf(e.w, "%s: %s : %s", port.name, port.value, port.typ)
 		}
-		fmt.Fprintln(e.w, ") -> ()")
+		if counted {
+			e.w.op(") -> (count: %s)", fifoCountType(ch))
+		} else {
+			e.w.op(") -> ()")
+		}
 	}
 }
 
-func (e *emitter) emitProcessInstance(idx int, info *processInfo, wires map[*ir.Channel]*channelWireSet) {
-	if info == nil {
-		return
-	}
-	ports := e.processPorts(info)
-	connections := map[string]string{
-		"%clk": "%clk",
-		"%rst": "%rst",
-	}
-	for _, ch := range info.channelOrder {
-		role := info.channelRoles[ch]
-		wire := wires[ch]
-		if role == nil || wire == nil {
+// emitTopOutputs drives the top-level output ports from values keyed by port
+// name: done mirrors the root process reaching its final FSM state, and the
+// remaining outputs belong to software goroutines and their streams.
+func (e *emitter) emitTopOutputs(module *ir.Module, outputs map[string]string) {
+	var values, types []string
+	for _, port := range module.Ports {
+		if port.Direction != ir.Output {
 			continue
 		}
-		portSet := info.channelPorts[ch]
-		if portSet == nil {
-			continue
+		value := outputs[port.Name]
+		if value == "" {
+			value = fmt.Sprintf("%%%s_undriven", sanitize(port.Name))
+			e.printIndent()
+			e.w.op("%s = hw.constant 0 : %s", value, typeString(port.Type))
 		}
-		if role.send {
-			connections[portSet.sendData] = wire.writeData
-			connections[portSet.sendValid] = wire.writeValid
-			connections[portSet.sendReady] = wire.writeReady
+		values = append(values, value)
+		types = append(types, typeString(port.Type))
+	}
+	e.printIndent()
+	if len(values) == 0 {
+		e.w.op("hw.output")
+		return
+	}
+	e.w.op("hw.output %s : %s", strings.Join(values, ", "), strings.Join(types, ", "))
+}
+
+// emitWaitGroupReleases builds one barrier per WaitGroup: the AND of the done
+// output of every goroutine it waits for. Done outputs hold once a process
+// returns, so the barrier stays released after the last member finishes.
+func (e *emitter) emitWaitGroupReleases(module *ir.Module, nets map[string]string) map[*ir.WaitGroup]string {
+	releases := make(map[*ir.WaitGroup]string)
+	names := make([]string, 0, len(module.WaitGroups))
+	for name := range module.WaitGroups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		wg := module.WaitGroups[name]
+		var dones []string
+		for _, member := range wg.Members {
+			if len(member.Path) > 0 {
+				dones = append(dones, portName(member.Net(ir.DonePort)))
+			}
 		}
-		if role.recv {
-			connections[portSet.recvData] = wire.readData
-			connections[portSet.recvValid] = wire.readValid
-			connections[portSet.recvReady] = wire.readReady
+		release := fmt.Sprintf("%%wg_%s_release", sanitize(wg.Name))
+		e.printIndent()
+		fmt.Fprintf(e.w, "// waitgroup %s count=%d members=%d\n", wg.Name, wg.Count, len(wg.Members))
+		e.printIndent()
+		if len(dones) == 0 {
+			e.w.op("%s = hw.constant 1 : i1", release)
+		} else {
+			e.w.op("%s = comb.and %s : i1", release, strings.Join(dones, ", "))
 		}
+		releases[wg] = release
+		nets[ir.WaitGroupPort(wg)+"_release"] = release
+	}
+	return releases
+}
+
+// emitSoftwareStart returns the value of the start output of software
+// process proc. The pulses of every goroutine that spawns it are ORed; a
+// process nobody spawns is tied low.
+func (e *emitter) emitSoftwareStart(proc *ir.Process, sources []string) string {
+	switch len(sources) {
+	case 1:
+		return sources[0]
+	case 0:
+		name := fmt.Sprintf("%%%s_start", processName(proc))
+		e.printIndent()
+		e.w.op("%s = hw.constant 0 : i1", name)
+		return name
 	}
-	instName := fmt.Sprintf("%s_inst%d", sanitize(info.proc.Name), idx)
+	name := fmt.Sprintf("%%%s_start", processName(proc))
 	e.printIndent()
-	fmt.Fprintf(e.w, "hw.instance \"%s\" @%s(", instName, info.moduleName)
-	for i, port := range ports {
-		if i > 0 {
-			fmt.Fprint(e.w, ", ")
+	e.w.op("%s = comb.or %s : i1", name, strings.Join(sources, ", "))
+	return name
+}
+
+// emitInstance places inst, connecting each input and inout port to the
+// value nets holds for the net its connection names. The outputs are named
+// after their nets, so the module placing inst can pass them on or combine
+// them.
+func (e *emitter) emitInstance(inst *ir.Instance, nets map[string]string) {
+	defer e.w.restore(e.w.at(ir.OperationSource(inst.Spawn)))
+	connected := make(map[string]string, len(inst.Connections))
+	for _, conn := range inst.Connections {
+		connected[conn.Port] = conn.Net
+	}
+	var inputs, results, outputs []string
+	for _, port := range inst.Module.Ports {
+		typ := typeString(port.Type)
+		net, ok := connected[port.Name]
+		if !ok {
+			e.fail("instance %s of %s does not connect port %s", inst.Name, inst.Module.Name, port.Name)
+			net = inst.Name + "_" + port.Name
 		}
-		value := connections[port.name]
-		if value == "" {
-			value = port.name
+		if port.Direction == ir.Output {
+			results = append(results, portName(net))
+			outputs = append(outputs, fmt.Sprintf("%s: %s", sanitize(port.Name), typ))
+			continue
 		}
-		portLabel := strings.TrimPrefix(port.name, "%")
-		valueType := port.typ
-		if port.inout {
-			valueType = fmt.Sprintf("!hw.inout<%s>", port.typ)
+		value, ok := nets[net]
+		if !ok {
+			e.fail("instance %s of %s: no net %s for port %s", inst.Name, inst.Module.Name, net, port.Name)
+			value = portName(net)
 		}
-		fmt.Fprintf(e.w, "%s: %s : %s", portLabel, value, valueType)
+		if port.Direction == ir.InOut {
+			typ = fmt.Sprintf("!hw.inout<%s>", typ)
+		}
+		inputs = append(inputs, fmt.Sprintf("%s: %s : %s", sanitize(port.Name), value, typ))
+	}
+	e.printIndent()
+	if len(results) > 0 {
+		fmt.Fprintf(e.w, "%s = ", strings.Join(results, ", "))
 	}
-	fmt.Fprintln(e.w, ") -> ()")
+	e.w.op("hw.instance \"%s\" @%s(%s) -> (%s)", sanitize(inst.Name), sanitize(inst.Module.Name), strings.Join(inputs, ", "), strings.Join(outputs, ", "))
 }
 
-func (e *emitter) emitProcessModule(module *ir.Module, info *processInfo) {
+// emitProcessModule prints the module of a spawned process once, with the
+// instances of the goroutines it spawns. Its inputs and inouts are the nets
+// those instances connect to, next to the start and argument values each of
+// its go statements drives. The channels the process makes are wired here
+// like those of the top level, with their FIFOs and arbiters, and the
+// instance nets on them map onto those wires. The outputs it does not drive
+// itself are passed on from the instance output of the same name.
+func (e *emitter) emitProcessModule(info *processInfo) {
 	if info == nil || info.proc == nil {
 		return
 	}
-	ports := e.processPorts(info)
+	module := info.module
+	e.w.at(info.proc.Source)
 	e.printIndent()
 	fmt.Fprintf(e.w, "hw.module @%s(", info.moduleName)
-	for i, port := range ports {
-		if i > 0 {
-			fmt.Fprint(e.w, ", ")
+	var decls []string
+	nets := make(map[string]string)
+	for _, port := range module.Ports {
+		if port.Direction == ir.Output {
+			continue
 		}
 		dir := "in"
-		if port.inout {
+		if port.Direction == ir.InOut {
 			dir = "inout"
 		}
-		fmt.Fprintf(e.w, "%s %s: %s", dir, port.name, port.typ)
+		decls = append(decls, fmt.Sprintf("%s %s: %s", dir, portName(port.Name), typeString(port.Type)))
+		nets[port.Name] = portName(port.Name)
+	}
+	for _, port := range module.Ports {
+		if port.Direction == ir.Output {
+			decls = append(decls, fmt.Sprintf("out %s: %s", sanitize(port.Name), typeString(port.Type)))
+		}
 	}
-	fmt.Fprintln(e.w, ") {")
+	e.w.open("%s) {", strings.Join(decls, ", "))
 	e.indent++
 
+	channelWires := e.emitChannelWires(module)
+	e.emitChannelFifos(module, channelWires)
+	e.emitChannelArbiters(module, channelWires)
+	bindChannelNets(module, channelWires, nets)
+	maps.Copy(info.channelPorts, channelPortsFromWires(info, channelWires))
+	releases := make(map[*ir.WaitGroup]string)
+	for _, wg := range info.waits {
+		releases[wg] = waitGroupPort(wg)
+	}
 	pp := &processPrinter{
 		w:             e.w,
 		indent:        e.indent,
 		moduleSignals: module.Signals,
 		usedSignals:   info.usedSignals,
 		channelPorts:  info.channelPorts,
+		waitReleases:  releases,
+		registers:     info.registers,
+		mutexOrder:    info.mutexes,
+		mutexPorts:    info.mutexPorts,
+		sharedPorts:   info.sharedPorts,
+		floatUnits:    e.floatUnits,
+		floatMode:     e.floatMode,
 	}
 	pp.resetState()
+	pp.startValue = "%start"
 	pp.emitProcess(info.proc)
 
+	driven := map[string]string{ir.DonePort: pp.doneValue}
+	for _, result := range info.proc.Results {
+		driven[ir.ResultPort(result)] = pp.valueRef(result)
+	}
+	for _, callee := range info.spawns {
+		if callee.Software != nil {
+			driven[ir.SpawnPort(callee)] = pp.spawnStartValue(callee)
+		}
+	}
+	pp.bindSpawnNets(module, nets)
+	for _, inst := range module.Instances {
+		e.emitInstance(inst, nets)
+	}
+
+	var values, types []string
+	for _, port := range module.Ports {
+		if port.Direction != ir.Output {
+			continue
+		}
+		value, ok := driven[port.Name]
+		if !ok {
+			value = portName(port.Name)
+		}
+		values = append(values, value)
+		types = append(types, typeString(port.Type))
+	}
+	e.printIndent()
+	e.w.op("hw.output %s : %s", strings.Join(values, ", "), strings.Join(types, ", "))
+
 	e.indent--
 	e.printIndent()
-	fmt.Fprintln(e.w, "}")
+	e.w.close()
 }
 
-func (e *emitter) emitRootProcess(module *ir.Module, info *processInfo, wires map[*ir.Channel]*channelWireSet) {
-	if info == nil || info.proc == nil {
-		return
-	}
+// emitRootProcess prints the root process inline in the top-level module. The
+// root has no spawner, so it starts as soon as reset is released.
+func (e *emitter) emitRootProcess(module *ir.Module, info *processInfo, wires map[*ir.Channel]*channelWireSet, mutexWires map[*ir.Mutex]*mutexWireSet, sharedWires map[*ir.Signal]*sharedWireSet, releases map[*ir.WaitGroup]string) *processPrinter {
+	mutexPorts, sharedPorts := mutexPortsFromWires(info, mutexWires, sharedWires)
 	pp := &processPrinter{
 		w:             e.w,
 		indent:        e.indent,
 		moduleSignals: module.Signals,
 		usedSignals:   info.usedSignals,
 		channelPorts:  channelPortsFromWires(info, wires),
+		waitReleases:  releases,
+		registers:     info.registers,
+		mutexOrder:    info.mutexes,
+		mutexPorts:    mutexPorts,
+		sharedPorts:   sharedPorts,
+		floatUnits:    e.floatUnits,
+		floatMode:     e.floatMode,
 	}
 	pp.resetState()
+	one := pp.boolConst(true)
+	pp.startValue = pp.freshValueName("run")
+	pp.printIndent()
+	pp.w.op("%s = comb.xor %s, %s : i1", pp.startValue, pp.portRef("rst"), one)
 	pp.emitProcess(info.proc)
+	return pp
 }
 
-func (e *emitter) processPorts(info *processInfo) []portDesc {
-	ports := []portDesc{
-		{name: "%clk", typ: "i1"},
-		{name: "%rst", typ: "i1"},
-	}
+// bindChannelPorts names the ports a process module reaches each channel it
+// does not hold through.
+func bindChannelPorts(info *processInfo) {
 	for _, ch := range info.channelOrder {
 		role := info.channelRoles[ch]
-		if role == nil {
+		if role == nil || info.module.Channels[ch.Name] == ch {
 			continue
 		}
-		portSet := info.channelPorts[ch]
-		if portSet == nil {
-			portSet = &channelPortSet{}
-			info.channelPorts[ch] = portSet
-		}
+		set := &channelPortSet{}
 		if role.send {
-			portSet.sendData = fmt.Sprintf("%%chan_%s_wdata", sanitize(ch.Name))
-			portSet.sendValid = fmt.Sprintf("%%chan_%s_wvalid", sanitize(ch.Name))
-			portSet.sendReady = fmt.Sprintf("%%chan_%s_wready", sanitize(ch.Name))
-			ports = append(ports,
-				portDesc{name: portSet.sendData, typ: typeString(ch.Type), inout: true},
-				portDesc{name: portSet.sendValid, typ: "i1", inout: true},
-				portDesc{name: portSet.sendReady, typ: "i1", inout: true},
-			)
+			set.sendData = portName(ir.ChannelPort(ch, "wdata"))
+			set.sendValid = portName(ir.ChannelPort(ch, "wvalid"))
+			set.sendReady = portName(ir.ChannelPort(ch, "wready"))
 		}
 		if role.recv {
-			portSet.recvData = fmt.Sprintf("%%chan_%s_rdata", sanitize(ch.Name))
-			portSet.recvValid = fmt.Sprintf("%%chan_%s_rvalid", sanitize(ch.Name))
-			portSet.recvReady = fmt.Sprintf("%%chan_%s_rready", sanitize(ch.Name))
-			ports = append(ports,
-				portDesc{name: portSet.recvData, typ: typeString(ch.Type), inout: true},
-				portDesc{name: portSet.recvValid, typ: "i1", inout: true},
-				portDesc{name: portSet.recvReady, typ: "i1", inout: true},
-			)
+			set.recvData = portName(ir.ChannelPort(ch, "rdata"))
+			set.recvValid = portName(ir.ChannelPort(ch, "rvalid"))
+			set.recvReady = portName(ir.ChannelPort(ch, "rready"))
 		}
+		if role.count {
+			set.count = portName(ir.ChannelPort(ch, "count"))
+		}
+		info.channelPorts[ch] = set
 	}
-	return ports
+}
+
+// portName is the SSA name of the IR port called name inside its module.
+func portName(name string) string {
+	return "%" + sanitize(name)
 }
 
 func (e *emitter) emitChannelMetadata(ch *ir.Channel) {
@@ -328,16 +614,12 @@ func (e *emitter) emitChannelMetadata(ch *ir.Channel) {
 	e.printIndent()
 	fmt.Fprintf(e.w, "// channel %s occupancy %d/%d\n", sanitize(ch.Name), ch.Occupancy, ch.Depth)
 	for _, prod := range ch.Producers {
-		stage := processStage(prod.Process)
-		name := processName(prod.Process)
 		e.printIndent()
-		fmt.Fprintf(e.w, "//   producer %s stage %d\n", name, stage)
+		fmt.Fprintf(e.w, "//   producer %s stage %d\n", prod.Name(), processStage(prod.Process))
 	}
 	for _, cons := range ch.Consumers {
-		stage := processStage(cons.Process)
-		name := processName(cons.Process)
 		e.printIndent()
-		fmt.Fprintf(e.w, "//   consumer %s stage %d\n", name, stage)
+		fmt.Fprintf(e.w, "//   consumer %s stage %d\n", cons.Name(), processStage(cons.Process))
 	}
 }
 
@@ -347,15 +629,14 @@ func (e *emitter) printIndent() {
 	}
 }
 
-type portDesc struct {
-	name  string
-	typ   string
-	inout bool
+func waitGroupPort(wg *ir.WaitGroup) string {
+	return portName(ir.WaitGroupPort(wg))
 }
 
 type channelRole struct {
-	send bool
-	recv bool
+	send  bool
+	recv  bool
+	count bool
 }
 
 type channelPortSet struct {
@@ -365,8 +646,13 @@ type channelPortSet struct {
 	recvData  string
 	recvValid string
 	recvReady string
+	count     string
 }
 
+// channelWireSet names the top-level wires of a channel. count is the FIFO
+// occupancy result and is empty for unbuffered channels. writers and readers
+// hold per-endpoint handshake wires when several goroutines share one side
+// of the channel; an arbiter or dispatcher joins them to the FIFO side.
 type channelWireSet struct {
 	writeData  string
 	writeValid string
@@ -374,12 +660,51 @@ type channelWireSet struct {
 	readData   string
 	readValid  string
 	readReady  string
+	count      string
+	writers    map[endpointKey]handshakeWires
+	readers    map[endpointKey]handshakeWires
+}
+
+// endpointKey identifies the port one goroutine reaches a channel through:
+// the goroutine's site name and the channel as its process names it.
+type endpointKey struct {
+	site string
+	via  *ir.Channel
+}
+
+func keyOf(ep *ir.ChannelEndpoint) endpointKey {
+	return endpointKey{site: ep.Name(), via: ep.Via}
+}
+
+type handshakeWires struct {
+	data  string
+	valid string
+	ready string
+}
+
+// writerFor returns the wires the endpoint key drives to send on the
+// channel.
+func (w *channelWireSet) writerFor(key endpointKey) handshakeWires {
+	if wires, ok := w.writers[key]; ok {
+		return wires
+	}
+	return handshakeWires{data: w.writeData, valid: w.writeValid, ready: w.writeReady}
+}
+
+// readerFor returns the wires the endpoint key uses to receive from the
+// channel.
+func (w *channelWireSet) readerFor(key endpointKey) handshakeWires {
+	if wires, ok := w.readers[key]; ok {
+		return wires
+	}
+	return handshakeWires{data: w.readData, valid: w.readValid, ready: w.readReady}
 }
 
 type fifoInfo struct {
 	moduleName string
 	elemType   *ir.SignalType
 	depth      int
+	counted    bool
 }
 
 func channelPortsFromWires(info *processInfo, wires map[*ir.Channel]*channelWireSet) map[*ir.Channel]*channelPortSet {
@@ -395,62 +720,126 @@ func channelPortsFromWires(info *processInfo, wires map[*ir.Channel]*channelWire
 		}
 		set := &channelPortSet{}
 		if role.send {
-			set.sendData = wire.writeData
-			set.sendValid = wire.writeValid
-			set.sendReady = wire.writeReady
+			writer := wire.writerFor(endpointKey{site: info.proc.Name, via: ch})
+			set.sendData = writer.data
+			set.sendValid = writer.valid
+			set.sendReady = writer.ready
 		}
 		if role.recv {
-			set.recvData = wire.readData
-			set.recvValid = wire.readValid
-			set.recvReady = wire.readReady
+			reader := wire.readerFor(endpointKey{site: info.proc.Name, via: ch})
+			set.recvData = reader.data
+			set.recvValid = reader.valid
+			set.recvReady = reader.ready
+		}
+		if role.count {
+			set.count = wire.count
 		}
 		ports[ch] = set
 	}
 	return ports
 }
 
+// bindChannelNets maps the nets of every goroutine's channel ports onto the
+// handshake wires its endpoint uses, and the count net of each counted
+// channel onto its FIFO's count.
+func bindChannelNets(module *ir.Module, wires map[*ir.Channel]*channelWireSet, nets map[string]string) {
+	for _, ch := range module.Channels {
+		wireSet := wires[ch]
+		if wireSet == nil {
+			continue
+		}
+		for _, ep := range ch.ProducerPorts() {
+			writer := wireSet.writerFor(keyOf(ep))
+			nets[ep.Net(ir.ChannelPort(ep.Via, "wdata"))] = writer.data
+			nets[ep.Net(ir.ChannelPort(ep.Via, "wvalid"))] = writer.valid
+			nets[ep.Net(ir.ChannelPort(ep.Via, "wready"))] = writer.ready
+		}
+		for _, ep := range ch.ConsumerPorts() {
+			reader := wireSet.readerFor(keyOf(ep))
+			nets[ep.Net(ir.ChannelPort(ep.Via, "rdata"))] = reader.data
+			nets[ep.Net(ir.ChannelPort(ep.Via, "rvalid"))] = reader.valid
+			nets[ep.Net(ir.ChannelPort(ep.Via, "rready"))] = reader.ready
+		}
+		if wireSet.count != "" {
+			nets[ir.ChannelPort(ch, "count")] = wireSet.count
+		}
+	}
+}
+
+// processInfo describes a process and the module it is printed in: the
+// top-level module for the root process, or the module of its own that
+// instances place.
 type processInfo struct {
 	proc         *ir.Process
+	module       *ir.Module
 	moduleName   string
 	channelOrder []*ir.Channel
 	channelRoles map[*ir.Channel]*channelRole
 	channelPorts map[*ir.Channel]*channelPortSet
 	usedSignals  map[*ir.Signal]struct{}
-}
-
-func buildProcessInfos(module *ir.Module) []*processInfo {
-	if module == nil {
-		return nil
+	spawns       []*ir.Process
+	waits        []*ir.WaitGroup
+	registers    []*ir.Signal
+	mutexes      []*ir.Mutex
+	shared       []*ir.Signal
+	sharedWrites map[*ir.Signal]bool
+	mutexPorts   map[*ir.Mutex]mutexPortSet
+	sharedPorts  map[*ir.Signal]sharedPortSet
+}
+
+// moduleProcessInfo describes the hardware process module runs. A module
+// that instances place runs exactly one; a top-level module runs at most its
+// root process, and every other hardware process must have been moved into
+// a module of its own by ir.BuildHierarchy.
+func moduleProcessInfo(module *ir.Module, placed bool) (*processInfo, error) {
+	for _, inst := range module.Instances {
+		if inst.Module == nil || inst.Spawn == nil || inst.Spawn.Callee == nil {
+			return nil, fmt.Errorf("instance %s of module %s is not tied to a go statement and its module", inst.Name, module.Name)
+		}
 	}
-	infos := make([]*processInfo, 0, len(module.Processes))
+	if placed {
+		if len(module.Processes) != 1 || module.Processes[0].Software != nil {
+			return nil, fmt.Errorf("module %s must hold exactly one hardware process", module.Name)
+		}
+		info := newProcessInfo(module, module.Processes[0])
+		bindChannelPorts(info)
+		bindMutexPorts(info)
+		return info, nil
+	}
+	var root *processInfo
 	for _, proc := range module.Processes {
-		if proc == nil {
+		if proc == nil || proc.Software != nil {
 			continue
 		}
-		roles, order := collectProcessChannelRoles(proc)
-		info := &processInfo{
-			proc:         proc,
-			moduleName:   processModuleName(module, proc),
-			channelOrder: order,
-			channelRoles: roles,
-			channelPorts: make(map[*ir.Channel]*channelPortSet),
-			usedSignals:  collectProcessSignals(proc),
+		if proc.Name != module.Name || root != nil {
+			return nil, fmt.Errorf("process %s of module %s has no instance; run ir.BuildHierarchy before emitting", proc.Name, module.Name)
 		}
-		infos = append(infos, info)
+		root = newProcessInfo(module, proc)
+	}
+	return root, nil
+}
+
+// newProcessInfo collects what proc, printed in module, uses, including the
+// components of module it owns.
+func newProcessInfo(module *ir.Module, proc *ir.Process) *processInfo {
+	roles, order := collectProcessChannelRoles(proc)
+	used := collectProcessSignals(proc)
+	mutexes, shared, writes := collectProcessMutexes(proc, used)
+	return &processInfo{
+		proc:         proc,
+		module:       module,
+		moduleName:   sanitize(module.Name),
+		channelOrder: order,
+		channelRoles: roles,
+		channelPorts: make(map[*ir.Channel]*channelPortSet),
+		usedSignals:  used,
+		spawns:       collectProcessSpawns(proc),
+		waits:        collectProcessWaits(proc),
+		registers:    collectProcessRegisters(module, proc),
+		mutexes:      mutexes,
+		shared:       shared,
+		sharedWrites: writes,
 	}
-	sort.SliceStable(infos, func(i, j int) bool {
-		return infos[i].moduleName < infos[j].moduleName
-	})
-	return infos
-}
-
-func processModuleName(module *ir.Module, proc *ir.Process) string {
-	modName := "module"
-	if module != nil && module.Name != "" {
-		modName = sanitize(module.Name)
-	}
-	procName := processName(proc)
-	return fmt.Sprintf("%s__proc_%s", modName, procName)
 }
 
 func collectProcessChannelRoles(proc *ir.Process) (map[*ir.Channel]*channelRole, []*ir.Channel) {
@@ -481,6 +870,16 @@ func collectProcessChannelRoles(proc *ir.Process) (map[*ir.Channel]*channelRole,
 					roles[o.Channel] = role
 				}
 				role.recv = true
+			case *ir.LenOperation:
+				if o.Channel == nil {
+					continue
+				}
+				role := roles[o.Channel]
+				if role == nil {
+					role = &channelRole{}
+					roles[o.Channel] = role
+				}
+				role.count = true
 			}
 		}
 	}
@@ -494,6 +893,57 @@ func collectProcessChannelRoles(proc *ir.Process) (map[*ir.Channel]*channelRole,
 	return roles, order
 }
 
+func collectProcessSpawns(proc *ir.Process) []*ir.Process {
+	var spawns []*ir.Process
+	seen := make(map[*ir.Process]bool)
+	for _, block := range proc.Blocks {
+		for _, op := range block.Ops {
+			spawn, ok := op.(*ir.SpawnOperation)
+			if !ok || spawn.Callee == nil || seen[spawn.Callee] {
+				continue
+			}
+			seen[spawn.Callee] = true
+			spawns = append(spawns, spawn.Callee)
+		}
+	}
+	return spawns
+}
+
+func collectProcessWaits(proc *ir.Process) []*ir.WaitGroup {
+	var waits []*ir.WaitGroup
+	seen := make(map[*ir.WaitGroup]bool)
+	for _, block := range proc.Blocks {
+		for _, op := range block.Ops {
+			wait, ok := op.(*ir.WaitOperation)
+			if !ok || wait.Group == nil || seen[wait.Group] {
+				continue
+			}
+			seen[wait.Group] = true
+			waits = append(waits, wait.Group)
+		}
+	}
+	return waits
+}
+
+// collectProcessRegisters returns the fields of every component proc owns,
+// ordered by component name.
+func collectProcessRegisters(module *ir.Module, proc *ir.Process) []*ir.Signal {
+	var comps []*ir.Component
+	for _, comp := range module.Components {
+		if comp.Owner == proc {
+			comps = append(comps, comp)
+		}
+	}
+	sort.Slice(comps, func(i, j int) bool {
+		return comps[i].Name < comps[j].Name
+	})
+	var regs []*ir.Signal
+	for _, comp := range comps {
+		regs = append(regs, comp.Fields...)
+	}
+	return regs
+}
+
 func collectProcessSignals(proc *ir.Process) map[*ir.Signal]struct{} {
 	used := make(map[*ir.Signal]struct{})
 	if proc == nil {
@@ -521,6 +971,8 @@ func collectProcessSignals(proc *ir.Process) map[*ir.Signal]struct{} {
 				add(o.Value)
 			case *ir.RecvOperation:
 				add(o.Dest)
+			case *ir.LenOperation:
+				add(o.Dest)
 			case *ir.CompareOperation:
 				add(o.Left)
 				add(o.Right)
@@ -528,6 +980,10 @@ func collectProcessSignals(proc *ir.Process) map[*ir.Signal]struct{} {
 			case *ir.NotOperation:
 				add(o.Value)
 				add(o.Dest)
+			case *ir.FloatOperation:
+				add(o.Left)
+				add(o.Right)
+				add(o.Dest)
 			case *ir.MuxOperation:
 				add(o.Cond)
 				add(o.TrueValue)
@@ -546,6 +1002,8 @@ func collectProcessSignals(proc *ir.Process) map[*ir.Signal]struct{} {
 				for _, arg := range o.Args {
 					add(arg)
 				}
+			case *ir.AssertOperation:
+				add(o.Cond)
 			}
 		}
 		if block.Terminator != nil {
@@ -578,9 +1036,11 @@ type phiRegInfo struct {
 type fsmBuilder struct {
 	printer       *processPrinter
 	proc          *ir.Process
-	blockOrder    []*ir.BasicBlock
+	segments      []*fsmSegment
+	opSegments    map[ir.Operation]*fsmSegment
 	blockIDs      map[*ir.BasicBlock]int
 	doneID        int
+	idleID        int
 	stateWidth    int
 	stateType     string
 	stateConsts   map[int]string
@@ -589,8 +1049,53 @@ type fsmBuilder struct {
 	phiInfos      map[*ir.PhiOperation]*phiRegInfo
 	phiOrder      []*ir.PhiOperation
 	phiUpdates    map[edgeKey][]phiUpdate
-}
-
+	fieldRegs     map[*ir.Signal]*fieldReg
+	fieldOrder    []*ir.Signal
+	fieldStores   map[*ir.BasicBlock][]*ir.AssignOperation
+	paramRegs     []*paramReg
+}
+
+// paramReg is the register that holds a param from the cycle the process
+// starts.
+type paramReg struct {
+	regName string
+	port    string
+	typeStr string
+}
+
+// fieldReg is the register behind a component field. Stores in a block take
+// effect as control leaves it, and reset restores the initial value.
+type fieldReg struct {
+	regName string
+	init    string
+	typeStr string
+}
+
+// fsmSegment is one FSM state. Blocks are split after every blocking operation
+// so each send, receive, wait or multi-cycle float operation owns a state
+// that stalls until it fires.
+type fsmSegment struct {
+	block  *ir.BasicBlock
+	id     int
+	next   *fsmSegment
+	wait   ir.Operation
+	fire   string
+	latch  *recvLatch
+	active string
+}
+
+// recvLatch captures channel data, or a float unit's result, into a register
+// on the cycle the operation completes, so later states see a stable value
+// after the FIFO pops or the unit moves on.
+type recvLatch struct {
+	regName string
+	data    string
+	typeStr string
+}
+
+// newFSMBuilder lays out one state per block segment, followed by a done state
+// and an idle state. The process sits in idle until its start input is raised
+// and returns there whenever reset is asserted.
 func newFSMBuilder(printer *processPrinter, proc *ir.Process) *fsmBuilder {
 	if printer == nil || proc == nil {
 		return nil
@@ -598,20 +1103,36 @@ func newFSMBuilder(printer *processPrinter, proc *ir.Process) *fsmBuilder {
 	builder := &fsmBuilder{
 		printer:     printer,
 		proc:        proc,
+		opSegments:  make(map[ir.Operation]*fsmSegment),
 		blockIDs:    make(map[*ir.BasicBlock]int),
 		stateConsts: make(map[int]string),
 		phiInfos:    make(map[*ir.PhiOperation]*phiRegInfo),
 		phiUpdates:  make(map[edgeKey][]phiUpdate),
+		fieldRegs:   make(map[*ir.Signal]*fieldReg),
+		fieldStores: make(map[*ir.BasicBlock][]*ir.AssignOperation),
 	}
 	for _, block := range proc.Blocks {
 		if block == nil {
 			continue
 		}
-		builder.blockOrder = append(builder.blockOrder, block)
-		builder.blockIDs[block] = len(builder.blockOrder) - 1
+		builder.blockIDs[block] = len(builder.segments)
+		seg := builder.addSegment(block)
+		for idx, op := range block.Ops {
+			builder.opSegments[op] = seg
+			if !isBlockingOperation(op) {
+				continue
+			}
+			seg.wait = op
+			if idx < len(block.Ops)-1 {
+				next := builder.addSegment(block)
+				seg.next = next
+				seg = next
+			}
+		}
 	}
-	builder.doneID = len(builder.blockOrder)
-	stateCount := builder.doneID + 1
+	builder.doneID = len(builder.segments)
+	builder.idleID = builder.doneID + 1
+	stateCount := builder.idleID + 1
 	if stateCount <= 0 {
 		stateCount = 1
 	}
@@ -623,6 +1144,22 @@ func newFSMBuilder(printer *processPrinter, proc *ir.Process) *fsmBuilder {
 	return builder
 }
 
+func (f *fsmBuilder) addSegment(block *ir.BasicBlock) *fsmSegment {
+	seg := &fsmSegment{block: block, id: len(f.segments)}
+	f.segments = append(f.segments, seg)
+	return seg
+}
+
+func isBlockingOperation(op ir.Operation) bool {
+	switch o := op.(type) {
+	case *ir.SendOperation, *ir.RecvOperation, *ir.WaitOperation, *ir.LockOperation:
+		return true
+	case *ir.FloatOperation:
+		return o.Op.Latency() > 0
+	}
+	return false
+}
+
 func bitWidth(count int) int {
 	if count <= 1 {
 		return 1
@@ -634,10 +1171,11 @@ func (f *fsmBuilder) emitStateConstants() {
 	if f == nil {
 		return
 	}
-	for _, block := range f.blockOrder {
-		f.ensureStateConst(f.blockIDs[block])
+	for _, seg := range f.segments {
+		f.ensureStateConst(seg.id)
 	}
 	f.ensureStateConst(f.doneID)
+	f.ensureStateConst(f.idleID)
 }
 
 func (f *fsmBuilder) ensureStateConst(id int) string {
@@ -649,7 +1187,7 @@ func (f *fsmBuilder) ensureStateConst(id int) string {
 	}
 	name := f.printer.freshValueName("state_const")
 	f.printer.printIndent()
-	fmt.Fprintf(f.printer.w, "%s = hw.constant %d : %s\n", name, id, f.stateType)
+	f.printer.w.op("%s = hw.constant %d : %s", name, id, f.stateType)
 	f.stateConsts[id] = name
 	return name
 }
@@ -662,26 +1200,90 @@ func (f *fsmBuilder) literalForID(id int) string {
 }
 
 func (f *fsmBuilder) emitStateRegister() {
-	if f == nil || len(f.blockOrder) == 0 || f.printer == nil {
+	if f == nil || len(f.segments) == 0 || f.printer == nil {
 		return
 	}
-	entryConst := f.ensureStateConst(0)
+	idleConst := f.ensureStateConst(f.idleID)
 	f.stateRegInout = f.printer.freshValueName("state_reg")
 	f.printer.printIndent()
-	fmt.Fprintf(f.printer.w, "%s = sv.reg : !hw.inout<%s>\n", f.stateRegInout, f.stateType)
-	if entryConst != "" {
+	f.printer.w.op("%s = sv.reg : !hw.inout<%s>", f.stateRegInout, f.stateType)
+	if idleConst != "" {
 		f.printer.printIndent()
-		fmt.Fprintln(f.printer.w, "sv.initial {")
+		f.printer.w.open("sv.initial {")
 		f.printer.indent++
 		f.printer.printIndent()
-		fmt.Fprintf(f.printer.w, "sv.bpassign %s, %s : %s\n", f.stateRegInout, entryConst, f.stateType)
+		f.printer.w.op("sv.bpassign %s, %s : %s", f.stateRegInout, idleConst, f.stateType)
 		f.printer.indent--
 		f.printer.printIndent()
-		fmt.Fprintln(f.printer.w, "}")
+		f.printer.w.close()
 	}
 	f.stateValue = f.printer.freshValueName("state")
 	f.printer.printIndent()
-	fmt.Fprintf(f.printer.w, "%s = sv.read_inout %s : !hw.inout<%s>\n", f.stateValue, f.stateRegInout, f.stateType)
+	f.printer.w.op("%s = sv.read_inout %s : !hw.inout<%s>", f.stateValue, f.stateRegInout, f.stateType)
+}
+
+// emitFieldRegisters declares a register for each component field and binds
+// the field signal to its current value.
+func (f *fsmBuilder) emitFieldRegisters(fields []*ir.Signal) {
+	if f == nil || f.printer == nil {
+		return
+	}
+	p := f.printer
+	for _, field := range fields {
+		reg := &fieldReg{
+			regName: p.freshValueName("field_reg"),
+			init:    p.freshValueName("field_init"),
+			typeStr: typeString(field.Type),
+		}
+		p.printIndent()
+		p.w.op("%s = hw.constant %s : %s", reg.init, constLiteral(field.Value), reg.typeStr)
+		p.printIndent()
+		p.w.op("%s = sv.reg : !hw.inout<%s>", reg.regName, reg.typeStr)
+		p.printIndent()
+		p.w.open("sv.initial {")
+		p.indent++
+		p.printIndent()
+		p.w.op("sv.bpassign %s, %s : %s", reg.regName, reg.init, reg.typeStr)
+		p.indent--
+		p.printIndent()
+		p.w.close()
+		p.printIndent()
+		p.w.op("%s = sv.read_inout %s : !hw.inout<%s>", p.bindSSA(field), reg.regName, reg.typeStr)
+		f.fieldRegs[field] = reg
+		f.fieldOrder = append(f.fieldOrder, field)
+	}
+}
+
+// emitParamRegisters declares a register for each param that captures the
+// param's port as the process leaves idle, so the arguments hold while the
+// spawner moves on, and binds the param to it.
+func (f *fsmBuilder) emitParamRegisters(proc *ir.Process) {
+	if f == nil || f.printer == nil {
+		return
+	}
+	p := f.printer
+	for idx, param := range proc.Params {
+		reg := &paramReg{
+			regName: p.freshValueName("arg_reg"),
+			port:    p.portRef(ir.ArgPort(proc, idx)),
+			typeStr: typeString(param.Type),
+		}
+		p.printIndent()
+		p.w.op("%s = sv.reg : !hw.inout<%s>", reg.regName, reg.typeStr)
+		p.printIndent()
+		p.w.op("%s = sv.read_inout %s : !hw.inout<%s>", p.bindSSA(param), reg.regName, reg.typeStr)
+		f.paramRegs = append(f.paramRegs, reg)
+	}
+}
+
+// recordFieldStore defers a store to a component field until control leaves
+// block. It reports false when op writes something else.
+func (f *fsmBuilder) recordFieldStore(block *ir.BasicBlock, op *ir.AssignOperation) bool {
+	if f == nil || f.fieldRegs[op.Dest] == nil {
+		return false
+	}
+	f.fieldStores[block] = append(f.fieldStores[block], op)
+	return true
 }
 
 func (f *fsmBuilder) registerPhi(block *ir.BasicBlock, phi *ir.PhiOperation) {
@@ -694,10 +1296,10 @@ func (f *fsmBuilder) registerPhi(block *ir.BasicBlock, phi *ir.PhiOperation) {
 	typeStr := typeString(phi.Dest.Type)
 	regName := f.printer.freshValueName("phi_reg")
 	f.printer.printIndent()
-	fmt.Fprintf(f.printer.w, "%s = sv.reg : !hw.inout<%s>\n", regName, typeStr)
+	f.printer.w.op("%s = sv.reg : !hw.inout<%s>", regName, typeStr)
 	destName := f.printer.bindSSA(phi.Dest)
 	f.printer.printIndent()
-	fmt.Fprintf(f.printer.w, "%s = sv.read_inout %s : !hw.inout<%s>\n", destName, regName, typeStr)
+	f.printer.w.op("%s = sv.read_inout %s : !hw.inout<%s>", destName, regName, typeStr)
 	info := &phiRegInfo{
 		phi:       phi,
 		regName:   regName,
@@ -724,47 +1326,149 @@ func (f *fsmBuilder) emitControlLogic() {
 	}
 	clk := f.printer.portRef("clk")
 	f.printer.printIndent()
-	fmt.Fprintf(f.printer.w, "sv.always posedge %s {\n", clk)
+	f.printer.w.open("sv.always posedge %s {", clk)
+	f.printer.indent++
+	f.printer.printIndent()
+	f.printer.w.open("sv.if %s {", f.printer.portRef("rst"))
 	f.printer.indent++
-	if len(f.blockOrder) > 0 {
+	f.printer.printIndent()
+	f.printer.w.op("sv.passign %s, %s : %s", f.stateRegInout, f.ensureStateConst(f.idleID), f.stateType)
+	for _, field := range f.fieldOrder {
+		reg := f.fieldRegs[field]
+		f.printer.printIndent()
+		f.printer.w.op("sv.passign %s, %s : %s", reg.regName, reg.init, reg.typeStr)
+	}
+	f.printer.indent--
+	f.printer.printIndent()
+	fmt.Fprintln(f.printer.w, "} else {")
+	f.printer.indent++
+	if len(f.segments) > 0 {
 		f.printer.printIndent()
 		fmt.Fprintf(f.printer.w, "sv.case %s : %s\n", f.stateValue, f.stateType)
-		for _, block := range f.blockOrder {
-			id := f.blockIDs[block]
+		for _, seg := range f.segments {
 			f.printer.printIndent()
-			fmt.Fprintf(f.printer.w, "case %s: {\n", f.literalForID(id))
+			f.printer.w.openCase("case %s: {", f.literalForID(seg.id))
 			f.printer.indent++
-			f.emitBlockCase(block)
+			f.emitSegmentCase(seg)
 			f.printer.indent--
 			f.printer.printIndent()
-			fmt.Fprintln(f.printer.w, "}")
+			f.printer.w.close()
 		}
 		f.printer.printIndent()
-		fmt.Fprintf(f.printer.w, "case %s: {\n", f.literalForID(f.doneID))
+		f.printer.w.openCase("case %s: {", f.literalForID(f.doneID))
 		f.printer.indent++
 		f.printer.printIndent()
-		fmt.Fprintf(f.printer.w, "sv.passign %s, %s : %s\n", f.stateRegInout, f.stateValue, f.stateType)
+		f.printer.w.op("sv.passign %s, %s : %s", f.stateRegInout, f.stateValue, f.stateType)
 		f.printer.indent--
 		f.printer.printIndent()
-		fmt.Fprintln(f.printer.w, "}")
+		f.printer.w.close()
 		f.printer.printIndent()
-		fmt.Fprintln(f.printer.w, "default: {")
+		f.printer.w.openCase("case %s: {", f.literalForID(f.idleID))
 		f.printer.indent++
 		f.printer.printIndent()
-		fmt.Fprintf(f.printer.w, "sv.passign %s, %s : %s\n", f.stateRegInout, f.stateValue, f.stateType)
+		f.printer.w.open("sv.if %s {", f.printer.startValue)
+		f.printer.indent++
+		f.printer.printIndent()
+		f.printer.w.op("sv.passign %s, %s : %s", f.stateRegInout, f.ensureStateConst(0), f.stateType)
+		for _, reg := range f.paramRegs {
+			f.printer.printIndent()
+			f.printer.w.op("sv.passign %s, %s : %s", reg.regName, reg.port, reg.typeStr)
+		}
+		f.printer.indent--
+		f.printer.printIndent()
+		f.printer.w.close()
+		f.printer.indent--
+		f.printer.printIndent()
+		f.printer.w.close()
+		f.printer.printIndent()
+		f.printer.w.openCase("default: {")
+		f.printer.indent++
+		f.printer.printIndent()
+		f.printer.w.op("sv.passign %s, %s : %s", f.stateRegInout, f.stateValue, f.stateType)
 		f.printer.indent--
 		f.printer.printIndent()
-		fmt.Fprintln(f.printer.w, "}")
+		f.printer.w.close()
 	}
 	f.printer.indent--
 	f.printer.printIndent()
-	fmt.Fprintln(f.printer.w, "}")
+	f.printer.w.close()
+	f.printer.indent--
+	f.printer.printIndent()
+	f.printer.w.close()
+}
+
+// stateActive returns an i1 value that is high while the FSM sits in id.
+func (f *fsmBuilder) stateActive(id int) string {
+	if f == nil || f.printer == nil || f.stateValue == "" {
+		return ""
+	}
+	stateConst := f.ensureStateConst(id)
+	name := f.printer.freshValueName("in_state")
+	f.printer.printIndent()
+	f.printer.w.op("%s = comb.icmp eq %s, %s : %s", name, f.stateValue, stateConst, f.stateType)
+	return name
+}
+
+// opActive returns the cached state-match value for the segment holding op.
+func (f *fsmBuilder) opActive(op ir.Operation) string {
+	if f == nil {
+		return ""
+	}
+	seg := f.opSegments[op]
+	if seg == nil {
+		return ""
+	}
+	if seg.active == "" {
+		seg.active = f.stateActive(seg.id)
+	}
+	return seg.active
+}
+
+// emitSegmentCase advances past seg. A segment ending in a channel operation
+// holds its state until the handshake fires; a received value is latched on
+// that same edge.
+func (f *fsmBuilder) emitSegmentCase(seg *fsmSegment) {
+	if seg.wait != nil {
+		defer f.printer.at(ir.OperationSource(seg.wait))()
+	}
+	if seg.wait != nil && seg.fire != "" {
+		f.printer.printIndent()
+		f.printer.w.open("sv.if %s {", seg.fire)
+		f.printer.indent++
+		if seg.latch != nil {
+			f.printer.printIndent()
+			f.printer.w.op("sv.passign %s, %s : %s", seg.latch.regName, seg.latch.data, seg.latch.typeStr)
+		}
+		f.emitSegmentExit(seg)
+		f.printer.indent--
+		f.printer.printIndent()
+		f.printer.w.close()
+		return
+	}
+	f.emitSegmentExit(seg)
+}
+
+func (f *fsmBuilder) emitSegmentExit(seg *fsmSegment) {
+	if seg.next != nil {
+		f.printer.printIndent()
+		f.printer.w.op("sv.passign %s, %s : %s", f.stateRegInout, f.ensureStateConst(seg.next.id), f.stateType)
+		return
+	}
+	f.emitBlockCase(seg.block)
 }
 
 func (f *fsmBuilder) emitBlockCase(block *ir.BasicBlock) {
 	if block == nil {
 		return
 	}
+	for _, store := range f.fieldStores[block] {
+		reg := f.fieldRegs[store.Dest]
+		restore := f.printer.at(ir.OperationSource(store))
+		f.printer.printIndent()
+		f.printer.w.op("sv.passign %s, %s : %s", reg.regName, f.printer.valueRef(store.Value), reg.typeStr)
+		restore()
+	}
+	defer f.printer.at(ir.TerminatorSource(block.Terminator))()
 	switch term := block.Terminator.(type) {
 	case *ir.BranchTerminator:
 		cond := f.printer.valueRef(term.Cond)
@@ -772,7 +1476,7 @@ func (f *fsmBuilder) emitBlockCase(block *ir.BasicBlock) {
 			cond = f.printer.boolConst(false)
 		}
 		f.printer.printIndent()
-		fmt.Fprintf(f.printer.w, "sv.if %s {\n", cond)
+		f.printer.w.open("sv.if %s {", cond)
 		f.printer.indent++
 		f.emitTransition(block, term.True)
 		f.printer.indent--
@@ -782,7 +1486,7 @@ func (f *fsmBuilder) emitBlockCase(block *ir.BasicBlock) {
 		f.emitTransition(block, term.False)
 		f.printer.indent--
 		f.printer.printIndent()
-		fmt.Fprintln(f.printer.w, "}")
+		f.printer.w.close()
 	case *ir.JumpTerminator:
 		f.emitTransition(block, term.Target)
 	case *ir.ReturnTerminator:
@@ -804,7 +1508,7 @@ func (f *fsmBuilder) emitTransition(pred, succ *ir.BasicBlock) {
 	}
 	targetConst := f.ensureStateConst(targetID)
 	f.printer.printIndent()
-	fmt.Fprintf(f.printer.w, "sv.passign %s, %s : %s\n", f.stateRegInout, targetConst, f.stateType)
+	f.printer.w.op("sv.passign %s, %s : %s", f.stateRegInout, targetConst, f.stateType)
 	if succ == nil {
 		return
 	}
@@ -818,30 +1522,52 @@ func (f *fsmBuilder) emitTransition(pred, succ *ir.BasicBlock) {
 		if val == "" || val == "%unknown" {
 			continue
 		}
+		restore := f.printer.at(ir.OperationSource(update.phi))
 		f.printer.printIndent()
-		fmt.Fprintf(f.printer.w, "sv.passign %s, %s : %s\n", info.regName, val, info.typeStr)
+		f.printer.w.op("sv.passign %s, %s : %s", info.regName, val, info.typeStr)
+		restore()
 	}
 }
 
 type processPrinter struct {
-	w             io.Writer
-	indent        int
-	nextTemp      int
-	constNames    map[*ir.Signal]string
-	valueNames    map[*ir.Signal]string
-	portNames     map[string]string
-	channelPorts  map[*ir.Channel]*channelPortSet
-	moduleSignals map[string]*ir.Signal
-	usedSignals   map[*ir.Signal]struct{}
-	boolConsts    map[bool]string
-	stdoutFD      string
-	fsm           *fsmBuilder
-	seqClockName  string
+	w              *opWriter
+	indent         int
+	nextTemp       int
+	constNames     map[*ir.Signal]string
+	valueNames     map[*ir.Signal]string
+	portNames      map[string]string
+	channelPorts   map[*ir.Channel]*channelPortSet
+	moduleSignals  map[string]*ir.Signal
+	usedSignals    map[*ir.Signal]struct{}
+	boolConsts     map[bool]string
+	stdoutFD       string
+	stderrFD       string
+	fsm            *fsmBuilder
+	comb           *combBuilder
+	seqClockName   string
+	startValue     string
+	doneValue      string
+	spawnStarts    map[*ir.Process][]string
+	spawnSets      map[*ir.SpawnOperation]spawnArgSet
+	waitReleases   map[*ir.WaitGroup]string
+	registers      []*ir.Signal
+	floatUnits     map[string]*floatUnitInfo
+	floatMode      ir.FloatMode
+	enumParams     map[string]bool
+	handshakes     map[string]*handshakeDrivers
+	handshakeOrder []string
+	mutexOrder     []*ir.Mutex
+	mutexPorts     map[*ir.Mutex]mutexPortSet
+	sharedPorts    map[*ir.Signal]sharedPortSet
+	locks          map[*ir.Mutex][]ir.Operation
+	unlocks        map[*ir.Mutex][]ir.Operation
+	sharedStores   []*ir.AssignOperation
 }
 
 func (p *processPrinter) resetState() {
 	p.nextTemp = 0
 	p.constNames = make(map[*ir.Signal]string)
+	p.enumParams = make(map[string]bool)
 	p.valueNames = make(map[*ir.Signal]string)
 	p.portNames = map[string]string{
 		"clk": "%clk",
@@ -857,8 +1583,22 @@ func (p *processPrinter) resetState() {
 		p.boolConsts = make(map[bool]string)
 	}
 	p.stdoutFD = ""
+	p.stderrFD = ""
 	p.fsm = nil
+	p.comb = nil
 	p.seqClockName = ""
+	p.startValue = ""
+	p.doneValue = ""
+	p.spawnStarts = make(map[*ir.Process][]string)
+	p.spawnSets = make(map[*ir.SpawnOperation]spawnArgSet)
+	p.handshakes = make(map[string]*handshakeDrivers)
+	p.handshakeOrder = nil
+	p.locks = make(map[*ir.Mutex][]ir.Operation)
+	p.unlocks = make(map[*ir.Mutex][]ir.Operation)
+	p.sharedStores = nil
+	for sig, ports := range p.sharedPorts {
+		p.valueNames[sig] = ports.value
+	}
 }
 
 func (p *processPrinter) emitProcess(proc *ir.Process) {
@@ -866,24 +1606,240 @@ func (p *processPrinter) emitProcess(proc *ir.Process) {
 		return
 	}
 	p.emitConstants()
-	if processHasPhi(proc) {
+	if proc.Sensitivity == ir.Combinational {
+		p.comb = newCombBuilder(p, proc)
+	} else {
 		p.fsm = newFSMBuilder(p, proc)
-		if p.fsm != nil {
-			p.fsm.emitStateConstants()
-			p.fsm.emitStateRegister()
+	}
+	if p.fsm != nil {
+		p.fsm.emitStateConstants()
+		p.fsm.emitStateRegister()
+		p.fsm.emitFieldRegisters(p.registers)
+		p.fsm.emitParamRegisters(proc)
+	}
+	if p.comb != nil {
+		// A combinational process reads its arguments in the cycle it
+		// starts, straight from the ports.
+		for idx, param := range proc.Params {
+			p.valueNames[param] = p.portRef(ir.ArgPort(proc, idx))
 		}
-	} else {
-		p.fsm = nil
 	}
 	for _, block := range proc.Blocks {
 		for _, op := range block.Ops {
 			p.emitOperation(block, op, proc)
 		}
 	}
+	p.emitMutexLogic()
+	p.emitHandshakes()
 	if p.fsm != nil {
 		p.fsm.emitControlLogic()
+		p.doneValue = p.fsm.stateActive(p.fsm.doneID)
+	}
+	if p.comb != nil {
+		// A combinational process finishes in the cycle it starts.
+		p.doneValue = p.startValue
+	}
+	if p.doneValue == "" {
+		p.doneValue = p.boolConst(true)
 	}
 	p.fsm = nil
+	p.comb = nil
+}
+
+// activeFor returns the i1 value that is high while op runs: its FSM state,
+// or the activity of its block in a combinational process. It is empty when
+// there is neither.
+func (p *processPrinter) activeFor(op ir.Operation) string {
+	switch {
+	case p.fsm != nil:
+		return p.fsm.opActive(op)
+	case p.comb != nil:
+		return p.comb.opActive(op)
+	}
+	return ""
+}
+
+// opActive returns the i1 value gating op, or constant true outside an FSM.
+func (p *processPrinter) opActive(op ir.Operation) string {
+	if active := p.activeFor(op); active != "" {
+		return active
+	}
+	return p.boolConst(true)
+}
+
+// waitFor makes op's FSM state stall until the handshake wire reads high.
+func (p *processPrinter) waitFor(op ir.Operation, handshake string, latch *recvLatch) {
+	if p.fsm == nil || handshake == "" {
+		return
+	}
+	fire := p.freshValueName("fire")
+	p.printIndent()
+	p.w.op("%s = sv.read_inout %s : !hw.inout<i1>", fire, handshake)
+	p.stallUntil(op, fire, latch)
+}
+
+// stallUntil holds op's FSM state until fire is high.
+func (p *processPrinter) stallUntil(op ir.Operation, fire string, latch *recvLatch) {
+	if p.fsm == nil || fire == "" {
+		return
+	}
+	seg := p.fsm.opSegments[op]
+	if seg == nil {
+		return
+	}
+	seg.fire = fire
+	seg.latch = latch
+}
+
+// driveHandshake records that port carries value while active is high, on
+// behalf of the operation at pos. Ports driven from several states are
+// resolved in emitHandshakes.
+func (p *processPrinter) driveHandshake(port, active, value, typeStr string, pos token.Pos) {
+	if port == "" {
+		return
+	}
+	drivers, ok := p.handshakes[port]
+	if !ok {
+		p.handshakeOrder = append(p.handshakeOrder, port)
+		drivers = &handshakeDrivers{typeStr: typeStr}
+		p.handshakes[port] = drivers
+	}
+	drivers.actives = append(drivers.actives, active)
+	drivers.values = append(drivers.values, value)
+	drivers.sources = append(drivers.sources, pos)
+}
+
+// emitHandshakes assigns every channel port driven by this process. 1-bit
+// strobes are ORed across states; data ports select the active state's value.
+func (p *processPrinter) emitHandshakes() {
+	for _, port := range p.handshakeOrder {
+		drivers := p.handshakes[port]
+		restore := p.at(drivers.source())
+		last := len(drivers.values) - 1
+		value := drivers.values[last]
+		if drivers.isStrobe() {
+			if last > 0 {
+				value = p.freshValueName("strobe")
+				p.printIndent()
+				p.w.op("%s = comb.or %s : i1", value, strings.Join(drivers.values, ", "))
+			}
+		} else {
+			for idx := last - 1; idx >= 0; idx-- {
+				sel := p.freshValueName("sel")
+				back := p.at(drivers.sources[idx])
+				p.printIndent()
+				p.w.op("%s = comb.mux %s, %s, %s : %s", sel, drivers.actives[idx], drivers.values[idx], value, drivers.typeStr)
+				back()
+				value = sel
+			}
+		}
+		p.printIndent()
+		p.w.op("sv.assign %s, %s : %s", port, value, drivers.typeStr)
+		restore()
+	}
+}
+
+type handshakeDrivers struct {
+	typeStr string
+	actives []string
+	values  []string
+	sources []token.Pos
+}
+
+// source returns the position shared by every driver of the port, or
+// token.NoPos when operations from several places drive it.
+func (d *handshakeDrivers) source() token.Pos {
+	for _, pos := range d.sources[1:] {
+		if pos != d.sources[0] {
+			return token.NoPos
+		}
+	}
+	return d.sources[0]
+}
+
+func (d *handshakeDrivers) isStrobe() bool {
+	for idx, value := range d.values {
+		if value != d.actives[idx] {
+			return false
+		}
+	}
+	return true
+}
+
+// spawnStartValue returns the start pulse this process drives for the
+// software process callee. A callee spawned from several blocks starts when
+// any of them is active.
+func (p *processPrinter) spawnStartValue(callee *ir.Process) string {
+	values := p.spawnStarts[callee]
+	switch len(values) {
+	case 0:
+		return p.boolConst(false)
+	case 1:
+		return values[0]
+	}
+	name := p.freshValueName("spawn")
+	p.printIndent()
+	p.w.op("%s = comb.or %s : i1", name, strings.Join(values, ", "))
+	return name
+}
+
+// spawnArgSet holds the activity that starts one go statement's goroutine
+// and the values it passes for the callee's params.
+type spawnArgSet struct {
+	active string
+	values []string
+}
+
+// bindSpawnNets maps the start and argument nets of every instance module
+// places onto the values the instance's go statement drives in this process.
+func (p *processPrinter) bindSpawnNets(module *ir.Module, nets map[string]string) {
+	for _, inst := range module.Instances {
+		set, ok := p.spawnSets[inst.Spawn]
+		if !ok {
+			continue
+		}
+		start := set.active
+		if start == "" {
+			start = p.boolConst(false)
+		}
+		callee := inst.Spawn.Callee
+		for _, conn := range inst.Connections {
+			if conn.Port == ir.StartPort {
+				nets[conn.Net] = start
+				continue
+			}
+			for idx := range callee.Params {
+				if conn.Port == ir.ArgPort(callee, idx) && idx < len(set.values) {
+					nets[conn.Net] = set.values[idx]
+				}
+			}
+		}
+	}
+}
+
+// guardedAlways opens an always block whose body only runs while op's FSM
+// state is active. The returned func closes both scopes.
+func (p *processPrinter) guardedAlways(op ir.Operation) func() {
+	active := p.activeFor(op)
+	clk := p.portRef("clk")
+	p.printIndent()
+	p.w.open("sv.always posedge %s {", clk)
+	p.indent++
+	if active != "" {
+		p.printIndent()
+		p.w.open("sv.if %s {", active)
+		p.indent++
+	}
+	return func() {
+		if active != "" {
+			p.indent--
+			p.printIndent()
+			p.w.close()
+		}
+		p.indent--
+		p.printIndent()
+		p.w.close()
+	}
 }
 
 func (p *processPrinter) emitConstants() {
@@ -903,29 +1859,25 @@ func (p *processPrinter) emitConstants() {
 		if _, ok := p.usedSignals[sig]; !ok {
 			continue
 		}
+		if name := p.enumParam(sig); name != "" {
+			p.constNames[sig] = name
+			continue
+		}
 		ssaName := p.assignConst(sig)
 		p.printIndent()
-		val := sig.Value
-		switch v := val.(type) {
-		case bool:
-			if v {
-				val = 1
-			} else {
-				val = 0
-			}
-		}
-		fmt.Fprintf(p.w, "%s = hw.constant %v : %s\n", ssaName, val, typeString(sig.Type))
+		p.w.op("%s = hw.constant %s : %s", ssaName, constLiteral(sig.Value), typeString(sig.Type))
 	}
 }
 
 func (p *processPrinter) emitOperation(block *ir.BasicBlock, op ir.Operation, proc *ir.Process) {
+	defer p.at(ir.OperationSource(op))()
 	switch o := op.(type) {
 	case *ir.BinOperation:
 		left := p.valueRef(o.Left)
 		right := p.valueRef(o.Right)
 		dest := p.bindSSA(o.Dest)
 		p.printIndent()
-		fmt.Fprintf(p.w, "%s = comb.%s %s, %s : %s\n",
+		p.w.op("%s = comb.%s %s, %s : %s",
 			dest,
 			binOpName(o.Op),
 			left,
@@ -935,11 +1887,18 @@ func (p *processPrinter) emitOperation(block *ir.BasicBlock, op ir.Operation, pr
 	case *ir.ConvertOperation:
 		p.emitConvertOperation(o)
 	case *ir.AssignOperation:
+		if p.recordSharedStore(o) || p.fsm.recordFieldStore(block, o) {
+			return
+		}
+		if p.comb != nil {
+			p.comb.emitAssign(o)
+			return
+		}
 		clk := p.seqClock()
 		src := p.valueRef(o.Value)
 		dest := p.bindSSA(o.Dest)
 		p.printIndent()
-		fmt.Fprintf(p.w, "%s = seq.compreg %s, %s : %s\n", dest, src, clk, typeString(o.Dest.Type))
+		p.w.op("%s = seq.compreg %s, %s : %s", dest, src, clk, typeString(o.Dest.Type))
 	case *ir.SendOperation:
 		value := p.valueRef(o.Value)
 		ports := p.channelPorts[o.Channel]
@@ -948,18 +1907,10 @@ func (p *processPrinter) emitOperation(block *ir.BasicBlock, op ir.Operation, pr
 			fmt.Fprintf(p.w, "// missing channel send ports for %s\n", sanitize(o.Channel.Name))
 			return
 		}
-		p.printIndent()
-		fmt.Fprintf(p.w, "sv.assign %s, %s : %s\n",
-			ports.sendData,
-			value,
-			typeString(o.Value.Type),
-		)
-		validConst := p.boolConst(true)
-		p.printIndent()
-		fmt.Fprintf(p.w, "sv.assign %s, %s : i1\n",
-			ports.sendValid,
-			validConst,
-		)
+		active := p.opActive(o)
+		p.driveHandshake(ports.sendData, active, value, typeString(o.Value.Type), ir.OperationSource(o))
+		p.driveHandshake(ports.sendValid, active, active, "i1", ir.OperationSource(o))
+		p.waitFor(o, ports.sendReady, nil)
 	case *ir.RecvOperation:
 		dest := p.bindSSA(o.Dest)
 		ports := p.channelPorts[o.Channel]
@@ -968,18 +1919,52 @@ func (p *processPrinter) emitOperation(block *ir.BasicBlock, op ir.Operation, pr
 			fmt.Fprintf(p.w, "// missing channel recv ports for %s\n", sanitize(o.Channel.Name))
 			return
 		}
+		typeStr := typeString(o.Channel.Type)
+		latch := &recvLatch{
+			regName: p.freshValueName("recv_reg"),
+			data:    p.freshValueName("recv_data"),
+			typeStr: typeStr,
+		}
 		p.printIndent()
-		fmt.Fprintf(p.w, "%s = sv.read_inout %s : %s\n",
-			dest,
+		p.w.op("%s = sv.reg : !hw.inout<%s>", latch.regName, typeStr)
+		p.printIndent()
+		p.w.op("%s = sv.read_inout %s : !hw.inout<%s>", dest, latch.regName, typeStr)
+		p.printIndent()
+		p.w.op("%s = sv.read_inout %s : %s",
+			latch.data,
 			ports.recvData,
 			inoutTypeString(o.Channel.Type),
 		)
-		readyConst := p.boolConst(true)
-		p.printIndent()
-		fmt.Fprintf(p.w, "sv.assign %s, %s : i1\n",
-			ports.recvReady,
-			readyConst,
-		)
+		active := p.opActive(o)
+		p.driveHandshake(ports.recvReady, active, active, "i1", ir.OperationSource(o))
+		p.waitFor(o, ports.recvValid, latch)
+	case *ir.LenOperation:
+		ports := p.channelPorts[o.Channel]
+		if ports == nil || ports.count == "" {
+			p.printIndent()
+			fmt.Fprintf(p.w, "// missing channel count port for %s\n", sanitize(o.Channel.Name))
+			return
+		}
+		p.emitResize(p.bindSSA(o.Dest), ports.count, ir.FIFOCountWidth(o.Channel.Depth), o.Dest.Type)
+	case *ir.WaitOperation:
+		release := p.waitReleases[o.Group]
+		if release == "" {
+			p.printIndent()
+			fmt.Fprintf(p.w, "// missing waitgroup barrier for %s\n", sanitize(o.Group.Name))
+			return
+		}
+		p.stallUntil(o, release, nil)
+	case *ir.LockOperation:
+		ports, ok := p.mutexPorts[o.Mutex]
+		if !ok {
+			p.printIndent()
+			fmt.Fprintf(p.w, "// missing mutex ports for %s\n", sanitize(o.Mutex.Name))
+			return
+		}
+		p.locks[o.Mutex] = append(p.locks[o.Mutex], o)
+		p.waitFor(o, ports.grant, nil)
+	case *ir.UnlockOperation:
+		p.unlocks[o.Mutex] = append(p.unlocks[o.Mutex], o)
 	case *ir.SpawnOperation:
 		childStage := processStage(o.Callee)
 		parentStage := processStage(proc)
@@ -989,13 +1974,22 @@ func (p *processPrinter) emitOperation(block *ir.BasicBlock, op ir.Operation, pr
 			childStage,
 			parentStage,
 		)
+		active := p.activeFor(o)
+		if active != "" && !slices.Contains(p.spawnStarts[o.Callee], active) {
+			p.spawnStarts[o.Callee] = append(p.spawnStarts[o.Callee], active)
+		}
+		set := spawnArgSet{active: active}
+		for _, arg := range o.Args {
+			set.values = append(set.values, p.valueRef(arg))
+		}
+		p.spawnSets[o] = set
 	case *ir.CompareOperation:
 		left := p.valueRef(o.Left)
 		right := p.valueRef(o.Right)
 		dest := p.bindSSA(o.Dest)
 		operandType := typeString(o.Left.Type)
 		p.printIndent()
-		fmt.Fprintf(p.w, "%s = comb.icmp %s %s, %s : %s\n",
+		p.w.op("%s = comb.icmp %s %s, %s : %s",
 			dest,
 			comparePredicateName(o.Predicate),
 			left,
@@ -1006,14 +2000,16 @@ func (p *processPrinter) emitOperation(block *ir.BasicBlock, op ir.Operation, pr
 		value := p.valueRef(o.Value)
 		dest := p.bindSSA(o.Dest)
 		p.printIndent()
-		fmt.Fprintf(p.w, "%s = comb.not %s : %s\n", dest, value, typeString(o.Value.Type))
+		p.w.op("%s = comb.not %s : %s", dest, value, typeString(o.Value.Type))
+	case *ir.FloatOperation:
+		p.emitFloatOperation(o)
 	case *ir.MuxOperation:
 		cond := p.valueRef(o.Cond)
 		tVal := p.valueRef(o.TrueValue)
 		fVal := p.valueRef(o.FalseValue)
 		dest := p.bindSSA(o.Dest)
 		p.printIndent()
-		fmt.Fprintf(p.w, "%s = comb.mux %s, %s, %s : %s\n",
+		p.w.op("%s = comb.mux %s, %s, %s : %s",
 			dest,
 			cond,
 			tVal,
@@ -1023,12 +2019,16 @@ func (p *processPrinter) emitOperation(block *ir.BasicBlock, op ir.Operation, pr
 	case *ir.PhiOperation:
 		if p.fsm != nil {
 			p.fsm.registerPhi(block, o)
+		} else if p.comb != nil {
+			p.comb.emitPhi(block, o)
 		} else {
 			p.printIndent()
 			fmt.Fprintf(p.w, "// phi %s has %d incoming values\n", sanitize(o.Dest.Name), len(o.Incomings))
 		}
 	case *ir.PrintOperation:
-		p.emitPrintOperation(o)
+		p.emitPrintOperation(block, o)
+	case *ir.AssertOperation:
+		p.emitAssertOperation(block, o)
 	default:
 		// skip unknown operations
 	}
@@ -1041,25 +2041,11 @@ func (p *processPrinter) seqClock() string {
 	clk := p.portRef("clk")
 	name := p.freshValueName("clk_seq")
 	p.printIndent()
-	fmt.Fprintf(p.w, "%s = seq.to_clock %s\n", name, clk)
+	p.w.op("%s = seq.to_clock %s", name, clk)
 	p.seqClockName = name
 	return name
 }
 
-func processHasPhi(proc *ir.Process) bool {
-	if proc == nil {
-		return false
-	}
-	for _, block := range proc.Blocks {
-		for _, op := range block.Ops {
-			if _, ok := op.(*ir.PhiOperation); ok {
-				return true
-			}
-		}
-	}
-	return false
-}
-
 func (p *processPrinter) assignConst(sig *ir.Signal) string {
 	if name, ok := p.constNames[sig]; ok {
 		return name
@@ -1105,6 +2091,14 @@ func (p *processPrinter) portRef(name string) string {
 	return fmt.Sprintf("%%%s", sanitize(name))
 }
 
+// at makes pos the location of what p prints until the returned func puts
+// the previous one back. An unknown pos keeps the enclosing location, which
+// is the process's own.
+func (p *processPrinter) at(pos token.Pos) func() {
+	prev := p.w.at(pos)
+	return func() { p.w.restore(prev) }
+}
+
 func (p *processPrinter) printIndent() {
 	for i := 0; i < p.indent; i++ {
 		fmt.Fprint(p.w, "  ")
@@ -1122,7 +2116,7 @@ func (p *processPrinter) boolConst(val bool) string {
 	if val {
 		intVal = 1
 	}
-	fmt.Fprintf(p.w, "%s = hw.constant %d : i1\n", name, intVal)
+	p.w.op("%s = hw.constant %d : i1", name, intVal)
 	return name
 }
 
@@ -1149,18 +2143,18 @@ func (p *processPrinter) emitConvertOperation(o *ir.ConvertOperation) {
 	switch {
 	case destWidth == srcWidth:
 		p.printIndent()
-		fmt.Fprintf(p.w, "%s = comb.bitcast %s : %s -> %s\n", dest, src, from, to)
+		p.w.op("%s = comb.bitcast %s : %s -> %s", dest, src, from, to)
 	case destWidth > srcWidth:
 		extendWidth := destWidth - srcWidth
 		if extendWidth <= 0 {
 			p.printIndent()
-			fmt.Fprintf(p.w, "%s = comb.bitcast %s : %s -> %s\n", dest, src, from, to)
+			p.w.op("%s = comb.bitcast %s : %s -> %s", dest, src, from, to)
 			return
 		}
 		if o.Value.Type != nil && o.Value.Type.Signed {
 			signBit := p.freshValueName("sext_msb")
 			p.printIndent()
-			fmt.Fprintf(p.w, "%s = comb.extract %s from %d : (%s) -> i1\n",
+			p.w.op("%s = comb.extract %s from %d : (%s) -> i1",
 				signBit,
 				src,
 				srcWidth-1,
@@ -1168,13 +2162,13 @@ func (p *processPrinter) emitConvertOperation(o *ir.ConvertOperation) {
 			)
 			replicated := p.freshValueName("sext_bits")
 			p.printIndent()
-			fmt.Fprintf(p.w, "%s = comb.replicate %s : (i1) -> i%d\n",
+			p.w.op("%s = comb.replicate %s : (i1) -> i%d",
 				replicated,
 				signBit,
 				extendWidth,
 			)
 			p.printIndent()
-			fmt.Fprintf(p.w, "%s = comb.concat %s, %s : i%d, %s\n",
+			p.w.op("%s = comb.concat %s, %s : i%d, %s",
 				dest,
 				replicated,
 				src,
@@ -1184,9 +2178,9 @@ func (p *processPrinter) emitConvertOperation(o *ir.ConvertOperation) {
 		} else {
 			p.printIndent()
 			zeros := p.freshValueName("zext_pad")
-			fmt.Fprintf(p.w, "%s = hw.constant 0 : i%d\n", zeros, extendWidth)
+			p.w.op("%s = hw.constant 0 : i%d", zeros, extendWidth)
 			p.printIndent()
-			fmt.Fprintf(p.w, "%s = comb.concat %s, %s : i%d, %s\n",
+			p.w.op("%s = comb.concat %s, %s : i%d, %s",
 				dest,
 				zeros,
 				src,
@@ -1196,7 +2190,7 @@ func (p *processPrinter) emitConvertOperation(o *ir.ConvertOperation) {
 		}
 	default:
 		p.printIndent()
-		fmt.Fprintf(p.w, "%s = comb.extract %s from 0 : (%s) -> %s\n",
+		p.w.op("%s = comb.extract %s from 0 : (%s) -> %s",
 			dest,
 			src,
 			from,
@@ -1205,31 +2199,78 @@ func (p *processPrinter) emitConvertOperation(o *ir.ConvertOperation) {
 	}
 }
 
-func (p *processPrinter) emitPrintOperation(op *ir.PrintOperation) {
+// emitResize zero-extends or truncates the unsigned value src into dest.
+func (p *processPrinter) emitResize(dest, src string, srcWidth int, to *ir.SignalType) {
+	from := fmt.Sprintf("i%d", srcWidth)
+	destWidth := signalWidth(to)
+	p.printIndent()
+	switch {
+	case destWidth == srcWidth:
+		p.w.op("%s = comb.bitcast %s : %s -> %s", dest, src, from, typeString(to))
+	case destWidth > srcWidth:
+		zeros := p.freshValueName("zext_pad")
+		p.w.op("%s = hw.constant 0 : i%d", zeros, destWidth-srcWidth)
+		p.printIndent()
+		p.w.op("%s = comb.concat %s, %s : i%d, %s", dest, zeros, src, destWidth-srcWidth, from)
+	default:
+		p.w.op("%s = comb.extract %s from 0 : (%s) -> %s", dest, src, from, typeString(to))
+	}
+}
+
+func (p *processPrinter) emitPrintOperation(block *ir.BasicBlock, op *ir.PrintOperation) {
 	if op == nil {
 		return
 	}
 	format, operands, operandTypes := p.buildPrintfFormat(op)
 	fd := p.stdoutConstant()
-	clk := p.portRef("clk")
 
-	p.printIndent()
-	fmt.Fprintf(p.w, "sv.always posedge %s {\n", clk)
-	p.indent++
+	closeAlways := p.guardedAlways(op)
 	p.printIndent()
 	if len(operands) == 0 {
-		fmt.Fprintf(p.w, "sv.fwrite %s, %s\n", fd, strconv.Quote(format))
+		p.w.op("sv.fwrite %s, %s", fd, strconv.Quote(format))
 	} else {
-		fmt.Fprintf(p.w, "sv.fwrite %s, %s(%s) : %s\n",
+		p.w.op("sv.fwrite %s, %s(%s) : %s",
 			fd,
 			strconv.Quote(format),
 			strings.Join(operands, ", "),
 			strings.Join(operandTypes, ", "),
 		)
 	}
-	p.indent--
+	closeAlways()
+}
+
+// emitAssertOperation lowers a Go panic into a clocked check that reports the
+// Go source position on stderr and stops the simulation with $fatal.
+func (p *processPrinter) emitAssertOperation(block *ir.BasicBlock, op *ir.AssertOperation) {
+	if op == nil {
+		return
+	}
+	fd := p.stderrConstant()
+	cond := ""
+	if op.Cond != nil {
+		cond = p.valueRef(op.Cond)
+	}
+	message := "panic: " + op.Message
+	if op.Location != "" {
+		message = op.Location + ": " + message
+	}
+
+	closeAlways := p.guardedAlways(op)
+	if cond != "" {
+		p.printIndent()
+		p.w.open("sv.if %s {", cond)
+		p.indent++
+	}
 	p.printIndent()
-	fmt.Fprintln(p.w, "}")
+	p.w.op("sv.fwrite %s, %s", fd, strconv.Quote(escapePercent(message)+"\n"))
+	p.printIndent()
+	p.w.op("sv.fatal 1")
+	if cond != "" {
+		p.indent--
+		p.printIndent()
+		p.w.close()
+	}
+	closeAlways()
 }
 
 func (p *processPrinter) buildPrintfFormat(op *ir.PrintOperation) (string, []string, []string) {
@@ -1270,11 +2311,65 @@ func (p *processPrinter) stdoutConstant() string {
 	}
 	name := p.freshValueName("stdout_fd")
 	p.printIndent()
-	fmt.Fprintf(p.w, "%s = hw.constant %d : i32\n", name, 0x80000001)
+	p.w.op("%s = hw.constant %d : i32", name, 0x80000001)
 	p.stdoutFD = name
 	return name
 }
 
+func (p *processPrinter) stderrConstant() string {
+	if p.stderrFD != "" {
+		return p.stderrFD
+	}
+	name := p.freshValueName("stderr_fd")
+	p.printIndent()
+	p.w.op("%s = hw.constant %d : i32", name, 0x80000002)
+	p.stderrFD = name
+	return name
+}
+
+// enumParam emits a localparam named after the enum member a constant holds,
+// so the generated RTL reads state_Hdr rather than a bare number. Constants
+// with the same member share one localparam. It returns "" when sig is not an
+// enum member.
+func (p *processPrinter) enumParam(sig *ir.Signal) string {
+	enum := sig.Type.Enum
+	if enum == nil {
+		return ""
+	}
+	value, ok := ir.IntValue(sig.Value)
+	if !ok {
+		return ""
+	}
+	member := enum.MemberFor(value)
+	if member == "" {
+		return ""
+	}
+	name := "%" + sanitize(enum.Name+"_"+member)
+	if p.enumParams[name] {
+		return name
+	}
+	p.enumParams[name] = true
+	typeStr := typeString(sig.Type)
+	p.printIndent()
+	p.w.op("%s = sv.localparam {value = %s : %s} : %s", name, constLiteral(sig.Value), typeStr, typeStr)
+	return name
+}
+
+// constLiteral renders a signal value as an hw.constant literal. Booleans
+// become 1 or 0 and a missing value is 0.
+func constLiteral(val interface{}) string {
+	switch v := val.(type) {
+	case nil:
+		return "0"
+	case bool:
+		if v {
+			return "1"
+		}
+		return "0"
+	}
+	return fmt.Sprintf("%v", val)
+}
+
 func portDecls(ports []ir.Port) []string {
 	decls := make([]string, 0, len(ports))
 	for _, port := range ports {
@@ -1384,7 +2479,7 @@ func sanitize(name string) string {
 	return b.String()
 }
 
-func (e *emitter) recordFifo(moduleName string, ch *ir.Channel) {
+func (e *emitter) recordFifo(moduleName string, ch *ir.Channel, counted bool) {
 	if ch == nil {
 		return
 	}
@@ -1395,6 +2490,7 @@ func (e *emitter) recordFifo(moduleName string, ch *ir.Channel) {
 		moduleName: moduleName,
 		elemType:   ch.Type,
 		depth:      ch.Depth,
+		counted:    counted,
 	}
 	e.fifoDecls[moduleName] = info
 }
@@ -1412,21 +2508,37 @@ func (e *emitter) emitFifoExterns() {
 		info := e.fifoDecls[name]
 		elemType := typeString(info.elemType)
 		e.printIndent()
-		fmt.Fprintf(e.w, "hw.module @%s(in %%clk: i1, in %%rst: i1, inout %%in_data: %s, inout %%in_valid: i1, inout %%in_ready: i1, inout %%out_data: %s, inout %%out_valid: i1, inout %%out_ready: i1) {\n",
+		fmt.Fprintf(e.w, "hw.module @%s(in %%clk: i1, in %%rst: i1, inout %%in_data: %s, inout %%in_valid: i1, inout %%in_ready: i1, inout %%out_data: %s, inout %%out_valid: i1, inout %%out_ready: i1",
 			info.moduleName,
 			elemType,
 			elemType,
 		)
+		if !info.counted {
+			e.w.open(") {")
+			e.indent++
+			e.printIndent()
+			e.w.op("hw.output")
+			e.indent--
+			e.printIndent()
+			e.w.close()
+			continue
+		}
+		countType := fmt.Sprintf("i%d", ir.FIFOCountWidth(info.depth))
+		e.w.open(", out count: %s) {", countType)
 		e.indent++
 		e.printIndent()
-		fmt.Fprintln(e.w, "hw.output")
+		e.w.op("%%empty = hw.constant 0 : %s", countType)
+		e.printIndent()
+		e.w.op("hw.output %%empty : %s", countType)
 		e.indent--
 		e.printIndent()
-		fmt.Fprintln(e.w, "}")
+		e.w.close()
 	}
 }
 
-func fifoModuleName(ch *ir.Channel) string {
+// fifoModuleName names the FIFO module for ch. A FIFO whose occupancy is read
+// with len gets a _count suffix, since only it has a count output.
+func fifoModuleName(ch *ir.Channel, counted bool) string {
 	if ch == nil {
 		return "mygo_fifo_i1_d1"
 	}
@@ -1434,7 +2546,15 @@ func fifoModuleName(ch *ir.Channel) string {
 	if depth <= 0 {
 		depth = 1
 	}
-	return fmt.Sprintf("mygo_fifo_%s_d%d", sanitize(typeString(ch.Type)), depth)
+	name := fmt.Sprintf("mygo_fifo_%s_d%d", sanitize(typeString(ch.Type)), depth)
+	if counted {
+		name += "_count"
+	}
+	return name
+}
+
+func fifoCountType(ch *ir.Channel) string {
+	return fmt.Sprintf("i%d", ir.FIFOCountWidth(ch.Depth))
 }
 
 func signalWidth(t *ir.SignalType) int {
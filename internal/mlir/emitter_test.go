@@ -0,0 +1,265 @@
+package mlir
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// spawnProgram has main start one worker and wait for its value.
+const spawnProgram = `
+package main
+
+func worker(out chan<- uint32) {
+    out <- 7
+}
+
+func main() {
+    out := make(chan uint32, 1)
+    go worker(out)
+    _ = <-out
+}
+`
+
+// fsmText is the MLIR of one module, with its state constants and state
+// register resolved so tests can talk about states by number.
+type fsmText struct {
+	body   string
+	consts map[string]string
+	reg    string
+	state  string
+}
+
+var (
+	constLine = regexp.MustCompile(`(%state_const\d+) = hw.constant (\d+) : i\d+`)
+	regLine   = regexp.MustCompile(`(%state_reg\d+) = sv.reg`)
+	readLine  = regexp.MustCompile(`(%state\d+) = sv.read_inout %state_reg\d+`)
+)
+
+func moduleFSM(t *testing.T, text, module string) *fsmText {
+	t.Helper()
+	start := strings.Index(text, "hw.module @"+module+"(")
+	if start < 0 {
+		t.Fatalf("missing module %s:\n%s", module, text)
+	}
+	body := text[start:]
+	body = body[:strings.Index(body, "\n  }\n")]
+	fsm := &fsmText{body: body, consts: make(map[string]string)}
+	for _, m := range constLine.FindAllStringSubmatch(body, -1) {
+		fsm.consts[m[2]] = m[1]
+	}
+	if m := regLine.FindStringSubmatch(body); m != nil {
+		fsm.reg = m[1]
+	}
+	if m := readLine.FindStringSubmatch(body); m != nil {
+		fsm.state = m[1]
+	}
+	if fsm.reg == "" || fsm.state == "" {
+		t.Fatalf("module %s has no state register:\n%s", module, body)
+	}
+	return fsm
+}
+
+// active returns the value that is high while the FSM is in state id.
+func (f *fsmText) active(t *testing.T, id string) string {
+	t.Helper()
+	pattern := regexp.MustCompile(`(%in_state\d+) = comb.icmp eq ` + regexp.QuoteMeta(f.state) + `, ` + regexp.QuoteMeta(f.consts[id]) + ` :`)
+	m := pattern.FindStringSubmatch(f.body)
+	if m == nil {
+		t.Fatalf("no state match for state %s:\n%s", id, f.body)
+	}
+	return m[1]
+}
+
+// caseBody returns the statements of the sv.case arm for the binary literal.
+func (f *fsmText) caseBody(t *testing.T, literal string) string {
+	t.Helper()
+	start := strings.Index(f.body, "case "+literal+": {")
+	if start < 0 {
+		t.Fatalf("missing case %s:\n%s", literal, f.body)
+	}
+	arm := f.body[start:]
+	end := strings.Index(arm, "\n        }\n")
+	return arm[:end]
+}
+
+// States of a process with one block that ends in a channel operation: the
+// block is state 0, done is 1 and idle is 2.
+const (
+	blockState = "0"
+	doneState  = "1"
+	idleState  = "2"
+)
+
+func TestSpawnStartsChildFromSpawningState(t *testing.T) {
+	text := emitFromSource(t, spawnProgram)
+	top := moduleFSM(t, text, "main")
+	line := instanceLine(t, text, "worker_inst0")
+	if want := "start: " + top.active(t, blockState) + " : i1"; !strings.Contains(line, want) {
+		t.Fatalf("expected worker to start while main is in the state holding the go statement (%s):\n%s", want, line)
+	}
+	if !strings.Contains(line, "-> (done: i1)") {
+		t.Fatalf("expected worker to report done:\n%s", line)
+	}
+	worker := moduleFSM(t, text, "main__proc_worker")
+	if !strings.Contains(worker.body, "in %start: i1") || !strings.Contains(worker.body, "out done: i1") {
+		t.Fatalf("expected start and done ports:\n%s", worker.body)
+	}
+	idle := worker.caseBody(t, "b10")
+	if want := "sv.if %start {\n            sv.passign " + worker.reg + ", " + worker.consts[blockState]; !strings.Contains(idle, want) {
+		t.Fatalf("expected idle to enter the first block on start:\n%s", idle)
+	}
+}
+
+func TestProcessIdlesUntilStartAndAfterReset(t *testing.T) {
+	text := emitFromSource(t, spawnProgram)
+	worker := moduleFSM(t, text, "main__proc_worker")
+	idle := worker.consts[idleState]
+	if want := "sv.bpassign " + worker.reg + ", " + idle; !strings.Contains(worker.body, want) {
+		t.Fatalf("expected the FSM to power up idle:\n%s", worker.body)
+	}
+	if want := "sv.if %rst {\n        sv.passign " + worker.reg + ", " + idle; !strings.Contains(worker.body, want) {
+		t.Fatalf("expected reset to return the FSM to idle:\n%s", worker.body)
+	}
+	arm := worker.caseBody(t, "b10")
+	if strings.Count(arm, "sv.passign") != 1 || !strings.Contains(arm, "sv.if %start {") {
+		t.Fatalf("expected idle to leave only on start:\n%s", arm)
+	}
+	top := moduleFSM(t, text, "main")
+	if !strings.Contains(top.caseBody(t, "b10"), "sv.if %run") {
+		t.Fatalf("expected main to leave idle once reset is released:\n%s", top.body)
+	}
+}
+
+func TestDoneFollowsDoneState(t *testing.T) {
+	text := emitFromSource(t, spawnProgram)
+	for _, module := range []string{"main", "main__proc_worker"} {
+		fsm := moduleFSM(t, text, module)
+		done := fsm.active(t, doneState)
+		if !strings.Contains(fsm.body, "hw.output "+done+" : i1") {
+			t.Fatalf("expected %s to drive done from its done state %s:\n%s", module, done, fsm.body)
+		}
+		if want := "sv.passign " + fsm.reg + ", " + fsm.state + " :"; !strings.Contains(fsm.caseBody(t, "b01"), want) {
+			t.Fatalf("expected %s to hold its done state so done stays high:\n%s", module, fsm.body)
+		}
+		block := fsm.caseBody(t, "b00")
+		if want := "sv.passign " + fsm.reg + ", " + fsm.consts[doneState]; !strings.Contains(block, want) {
+			t.Fatalf("expected %s to reach done when its block returns:\n%s", module, block)
+		}
+	}
+}
+
+// lenProgram reads the occupancy of one of its two channels.
+const lenProgram = `
+package main
+
+func main() {
+    counted := make(chan uint32, 2)
+    plain := make(chan uint32, 2)
+    counted <- 1
+    plain <- 2
+    n := len(counted)
+    _ = <-plain + uint32(n)
+}
+`
+
+func TestOnlyCountedFifoExposesCount(t *testing.T) {
+	text := emitFromSource(t, lenProgram)
+	counted := regexp.MustCompile(`%chan_\w+_count = hw.instance "\w+_fifo" @mygo_fifo_i32_d2_count\(.*\) -> \(count: i2\)`)
+	if !counted.MatchString(text) {
+		t.Fatalf("expected the FIFO read with len to expose count:\n%s", text)
+	}
+	plain := regexp.MustCompile(`\n\s*hw.instance "\w+_fifo" @mygo_fifo_i32_d2\(.*\) -> \(\)`)
+	if !plain.MatchString(text) {
+		t.Fatalf("expected the other FIFO to keep its count-free port list:\n%s", text)
+	}
+	for _, want := range []string{
+		"hw.module @mygo_fifo_i32_d2(in %clk: i1, in %rst: i1, inout %in_data: i32, inout %in_valid: i1, inout %in_ready: i1, inout %out_data: i32, inout %out_valid: i1, inout %out_ready: i1) {",
+		"inout %out_ready: i1, out count: i2) {",
+	} {
+		if !strings.Contains(text, want) {
+			t.Fatalf("missing FIFO declaration %q:\n%s", want, text)
+		}
+	}
+}
+
+// nestedArgProgram has mid spawn leaf with a value it received, so mid
+// places leaf and drives its argument port, and leaf's channel handshake
+// leaves mid through ports of its own.
+const nestedArgProgram = `
+package main
+
+func leaf(out chan<- int32, v int32) {
+    out <- v
+}
+
+func mid(in <-chan int32, out chan<- int32) {
+    v := <-in
+    go leaf(out, v+1)
+}
+
+func main() {
+    in := make(chan int32, 1)
+    out := make(chan int32, 1)
+    go mid(in, out)
+    in <- 3
+    _ = <-out
+}
+`
+
+func TestSpawnArgumentsTravelThroughPorts(t *testing.T) {
+	text := emitFromSource(t, nestedArgProgram)
+	mid := regexp.MustCompile(`hw.module @main__proc_mid\(.*\) \{`).FindString(text)
+	if mid == "" || strings.Contains(mid, "arg_") {
+		t.Fatalf("expected mid to keep leaf's argument inside: %s", mid)
+	}
+	if !strings.Contains(mid, "inout %leaf_inst0_chan_out_wdata: i32") {
+		t.Fatalf("expected mid to pass leaf's channel port on: %s", mid)
+	}
+	line := instanceLine(t, text, "leaf_inst0")
+	if !regexp.MustCompile(`arg_v: %v\d+ : i32`).MatchString(line) || !strings.Contains(line, "chan_out_wdata: %leaf_inst0_chan_out_wdata") {
+		t.Fatalf("expected mid to drive leaf's arg_v and channel ports: %s", line)
+	}
+	if line := instanceLine(t, text, "mid_inst0"); !strings.Contains(line, "leaf_inst0_chan_out_wdata: %chan_t1_wdata") {
+		t.Fatalf("expected the top level to connect leaf's channel port through mid: %s", line)
+	}
+	leaf := moduleFSM(t, text, "main__proc_leaf")
+	if !strings.Contains(leaf.body, "in %arg_v: i32") {
+		t.Fatalf("leaf has no arg_v input:\n%s", leaf.body)
+	}
+	idle := leaf.caseBody(t, "b10")
+	if !regexp.MustCompile(`sv.passign %arg_reg\d+, %arg_v : i32`).MatchString(idle) {
+		t.Fatalf("leaf does not latch arg_v as it leaves idle:\n%s", idle)
+	}
+}
+
+// locationProgram sends a value it may adjust in a branch.
+const locationProgram = `
+package main
+
+func main() {
+    in := make(chan uint8, 1)
+    out := make(chan uint8, 1)
+    in <- 5
+    v := <-in
+    if v > 3 {
+        v = v - 3
+    }
+    out <- v
+    _ = <-out
+}
+`
+
+func TestOperationsCarryTheirStatementLocation(t *testing.T) {
+	text := emitFromSource(t, locationProgram)
+	for _, want := range []string{
+		`comb.icmp ugt %\w+, %\w+ : i8 loc\("main.go":9:`,
+		`comb.sub %\w+, %\w+ : i8 loc\("main.go":10:`,
+		`sv.assign %chan_t1_wdata, %\w+ : i8 loc\("main.go":12:`,
+		`sv.passign %state_reg\d+, %state_const\d+ : i\d+ loc\("main.go":12:`,
+	} {
+		if !regexp.MustCompile(want).MatchString(text) {
+			t.Errorf("no line matches %s:\n%s", want, text)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package mlir
+
+import (
+	"fmt"
+	"go/token"
+	"io"
+	"strconv"
+
+	"mygo/internal/ir"
+)
+
+// opWriter prints MLIR operations with the Go source location they were
+// built from. The printers set the location with at as they translate each
+// IR construct and print every operation through op, or through open and
+// close when it has regions: op puts the location at the end of the line,
+// and close puts the location the operation had when open was called after
+// the brace that closes its last region. Comments and the sv.case line are
+// written directly, and the regions of sv.case are opened with openCase, so
+// none of them carries a location; neither does anything printed while no
+// location is set.
+type opWriter struct {
+	w      io.Writer
+	design *ir.Design
+	loc    string
+	// regions holds, for each region still open, the location of the
+	// operation it belongs to, or "" for a case region.
+	regions []string
+	err     error
+}
+
+func newOpWriter(w io.Writer, design *ir.Design) *opWriter {
+	return &opWriter{w: w, design: design}
+}
+
+// at makes pos the location of the operations printed from now on and
+// returns the previous one for restore. An unknown pos keeps the current
+// location. The file name is relative to the main package, as in the
+// messages of assertions.
+func (ow *opWriter) at(pos token.Pos) string {
+	prev := ow.loc
+	if fset := ow.design.Fset; fset != nil && pos.IsValid() {
+		p := fset.Position(pos)
+		ow.loc = fmt.Sprintf("loc(%s:%d:%d)", strconv.Quote(ow.design.SourceName(p.Filename)), p.Line, p.Column)
+	}
+	return prev
+}
+
+// restore puts back a location returned by at.
+func (ow *opWriter) restore(loc string) {
+	ow.loc = loc
+}
+
+// op ends the line of an operation with its location.
+func (ow *opWriter) op(format string, args ...any) {
+	fmt.Fprintf(ow, format, args...)
+	ow.endLine(ow.loc)
+}
+
+// open ends the line that opens the first region of an operation.
+func (ow *opWriter) open(format string, args ...any) {
+	fmt.Fprintf(ow, format+"\n", args...)
+	ow.regions = append(ow.regions, ow.loc)
+}
+
+// openCase ends the line that opens a region of sv.case.
+func (ow *opWriter) openCase(format string, args ...any) {
+	fmt.Fprintf(ow, format+"\n", args...)
+	ow.regions = append(ow.regions, "")
+}
+
+// close prints the brace that closes the last region opened, followed by
+// the location of its operation.
+func (ow *opWriter) close() {
+	loc := ""
+	if n := len(ow.regions); n > 0 {
+		loc = ow.regions[n-1]
+		ow.regions = ow.regions[:n-1]
+	}
+	io.WriteString(ow, "}")
+	ow.endLine(loc)
+}
+
+func (ow *opWriter) endLine(loc string) {
+	if loc != "" {
+		io.WriteString(ow, " "+loc)
+	}
+	io.WriteString(ow, "\n")
+}
+
+// Write passes p through and keeps the first error for Write to return.
+func (ow *opWriter) Write(p []byte) (int, error) {
+	if ow.err != nil {
+		return 0, ow.err
+	}
+	n, err := ow.w.Write(p)
+	ow.err = err
+	return n, err
+}
@@ -0,0 +1,76 @@
+package mlir
+
+import (
+	"bytes"
+	"go/token"
+	"io"
+	"strings"
+	"testing"
+
+	"mygo/internal/ir"
+)
+
+func TestOpWriterPlacesLocations(t *testing.T) {
+	fset := token.NewFileSet()
+	file := fset.AddFile("/src/app/main.go", -1, 100)
+	file.SetLines([]int{0, 20, 40})
+
+	var out bytes.Buffer
+	ow := newOpWriter(&out, &ir.Design{Fset: fset, Root: "/src/app"})
+	ow.open("module {")
+	ow.at(file.Pos(20))
+	ow.open("  hw.module @main(in %%clk: i1) {")
+	io.WriteString(ow, "    // state machine\n")
+	prev := ow.at(file.Pos(44))
+	ow.op("    %%v0 = comb.add %%a, %%b : i8")
+	ow.restore(prev)
+	ow.open("    sv.always posedge %%clk {")
+	ow.open("      sv.if %%rst {")
+	io.WriteString(ow, "      } else {\n")
+	io.WriteString(ow, "        sv.case %state : i1\n")
+	ow.openCase("        case b0: {")
+	io.WriteString(ow, "        ")
+	ow.close()
+	io.WriteString(ow, "      ")
+	ow.close()
+	io.WriteString(ow, "    ")
+	ow.close()
+	ow.op("    hw.output")
+	io.WriteString(ow, "  ")
+	ow.close()
+	ow.restore("")
+	ow.close()
+
+	want := strings.Join([]string{
+		`module {`,
+		`  hw.module @main(in %clk: i1) {`,
+		`    // state machine`,
+		`    %v0 = comb.add %a, %b : i8 loc("main.go":3:5)`,
+		`    sv.always posedge %clk {`,
+		`      sv.if %rst {`,
+		`      } else {`,
+		`        sv.case %state : i1`,
+		`        case b0: {`,
+		`        }`,
+		`      } loc("main.go":2:1)`,
+		`    } loc("main.go":2:1)`,
+		`    hw.output loc("main.go":2:1)`,
+		`  } loc("main.go":2:1)`,
+		`}`,
+	}, "\n") + "\n"
+	if out.String() != want {
+		t.Fatalf("unexpected output:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
+
+func TestOpWriterNamesFilesOutsideRootRelatively(t *testing.T) {
+	fset := token.NewFileSet()
+	file := fset.AddFile("/src/lib/lib.go", -1, 10)
+	var out bytes.Buffer
+	ow := newOpWriter(&out, &ir.Design{Fset: fset, Root: "/src/app"})
+	ow.at(file.Pos(0))
+	ow.op("hw.output")
+	if got, want := out.String(), "hw.output loc(\"../lib/lib.go\":1:1)\n"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
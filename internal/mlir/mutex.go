@@ -0,0 +1,482 @@
+package mlir
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"mygo/internal/ir"
+)
+
+// mutexWireSet names the request and grant wire of every goroutine that
+// locks a mutex, by site name.
+type mutexWireSet struct {
+	req   map[string]string
+	grant map[string]string
+}
+
+// sharedWireSet names the value of a shared register and the write strobe
+// and data wires of every goroutine that stores into it, by site name.
+type sharedWireSet struct {
+	value string
+	we    map[string]string
+	wdata map[string]string
+}
+
+type mutexPortSet struct {
+	req   string
+	grant string
+}
+
+type sharedPortSet struct {
+	value string
+	we    string
+	wdata string
+}
+
+func mutexModuleName(policy ir.Arbitration, n int) string {
+	return fmt.Sprintf("mygo_mutex_%s_n%d", policy, n)
+}
+
+func mutexPort(mu *ir.Mutex, wire string) string {
+	return portName(ir.MutexPort(mu, wire))
+}
+
+func sharedPort(sig *ir.Signal, wire string) string {
+	return portName(ir.SharedPort(sig, wire))
+}
+
+// emitMutexes declares a request and grant wire per user of each mutex and
+// instantiates the arbiter that hands the mutex to one of them at a time.
+// Each user's req and grant nets are mapped onto its wires.
+func (e *emitter) emitMutexes(module *ir.Module, nets map[string]string) map[*ir.Mutex]*mutexWireSet {
+	wires := make(map[*ir.Mutex]*mutexWireSet)
+	names := make([]string, 0, len(module.Mutexes))
+	for name := range module.Mutexes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		mu := module.Mutexes[name]
+		if len(mu.Users) == 0 {
+			continue
+		}
+		set := &mutexWireSet{
+			req:   make(map[string]string),
+			grant: make(map[string]string),
+		}
+		moduleName := mutexModuleName(mu.Arbitration, len(mu.Users))
+		if _, ok := e.arbiterDecls[moduleName]; !ok {
+			e.arbiterDecls[moduleName] = &arbiterInfo{
+				moduleName: moduleName,
+				mutex:      true,
+				policy:     mu.Arbitration,
+				n:          len(mu.Users),
+			}
+		}
+		e.printIndent()
+		fmt.Fprintf(e.w, "// mutex %s users=%d\n", mu.Name, len(mu.Users))
+		ports := []string{"clk: %clk : i1", "rst: %rst : i1"}
+		for idx, user := range mu.Users {
+			req := fmt.Sprintf("%s%d", mutexPort(mu, "req"), idx)
+			grant := fmt.Sprintf("%s%d", mutexPort(mu, "grant"), idx)
+			set.req[user.Name()], set.grant[user.Name()] = req, grant
+			nets[user.Net(ir.MutexPort(mu, "req"))] = req
+			nets[user.Net(ir.MutexPort(mu, "grant"))] = grant
+			for _, wire := range []string{req, grant} {
+				e.printIndent()
+				e.w.op("%s = sv.wire : !hw.inout<i1>", wire)
+			}
+			ports = append(ports,
+				fmt.Sprintf("req%d: %s : !hw.inout<i1>", idx, req),
+				fmt.Sprintf("grant%d: %s : !hw.inout<i1>", idx, grant),
+			)
+		}
+		e.printIndent()
+		e.w.op("hw.instance \"%s_mutex\" @%s(%s) -> ()", sanitize(mu.Name), moduleName, strings.Join(ports, ", "))
+		wires[mu] = set
+	}
+	return wires
+}
+
+// emitSharedRegisters declares the register behind every shared variable a
+// goroutine of sites uses. Writers each drive a strobe and a data wire; the
+// mutex guarantees at most one of them writes in any cycle. The value net
+// and each writer's we and wdata nets are mapped onto the wires.
+func (e *emitter) emitSharedRegisters(sites []ir.Site, infos map[*ir.Process]*processInfo, nets map[string]string) map[*ir.Signal]*sharedWireSet {
+	var order []*ir.Signal
+	writers := make(map[*ir.Signal][]ir.Site)
+	for _, site := range sites {
+		info := infos[site.Process]
+		if info == nil {
+			continue
+		}
+		for _, sig := range info.shared {
+			if !slices.Contains(order, sig) {
+				order = append(order, sig)
+			}
+			if info.sharedWrites[sig] {
+				writers[sig] = append(writers[sig], site)
+			}
+		}
+	}
+	sort.Slice(order, func(i, j int) bool {
+		return order[i].Name < order[j].Name
+	})
+	wires := make(map[*ir.Signal]*sharedWireSet)
+	for _, sig := range order {
+		typeStr := typeString(sig.Type)
+		set := &sharedWireSet{
+			value: sharedPort(sig, ""),
+			we:    make(map[string]string),
+			wdata: make(map[string]string),
+		}
+		reg, init := sharedPort(sig, "reg"), sharedPort(sig, "init")
+		e.printIndent()
+		fmt.Fprintf(e.w, "// shared %s writers=%d\n", sig.Name, len(writers[sig]))
+		e.printIndent()
+		e.w.op("%s = hw.constant %s : %s", init, constLiteral(sig.Value), typeStr)
+		e.printIndent()
+		e.w.op("%s = sv.reg : !hw.inout<%s>", reg, typeStr)
+		e.printIndent()
+		e.w.open("sv.initial {")
+		e.indent++
+		e.printIndent()
+		e.w.op("sv.bpassign %s, %s : %s", reg, init, typeStr)
+		e.indent--
+		e.printIndent()
+		e.w.close()
+		e.printIndent()
+		e.w.op("%s = sv.read_inout %s : !hw.inout<%s>", set.value, reg, typeStr)
+		var strobes, data []string
+		nets[ir.SharedPort(sig, "")] = set.value
+		for idx, site := range writers[sig] {
+			we := fmt.Sprintf("%s%d", sharedPort(sig, "we"), idx)
+			wdata := fmt.Sprintf("%s%d", sharedPort(sig, "wdata"), idx)
+			set.we[site.Name()], set.wdata[site.Name()] = we, wdata
+			nets[site.Net(ir.SharedPort(sig, "we"))] = we
+			nets[site.Net(ir.SharedPort(sig, "wdata"))] = wdata
+			e.printIndent()
+			e.w.op("%s = sv.wire : !hw.inout<i1>", we)
+			e.printIndent()
+			e.w.op("%s = sv.wire : !hw.inout<%s>", wdata, typeStr)
+			strobes = append(strobes, e.readWire(strings.TrimPrefix(we, "%"), we, "i1"))
+			data = append(data, e.readWire(strings.TrimPrefix(wdata, "%"), wdata, typeStr))
+		}
+		e.printIndent()
+		e.w.open("sv.always posedge %s {", "%clk")
+		e.indent++
+		e.printIndent()
+		e.w.open("sv.if %s {", "%rst")
+		e.indent++
+		e.printIndent()
+		e.w.op("sv.passign %s, %s : %s", reg, init, typeStr)
+		e.indent--
+		e.printIndent()
+		fmt.Fprintln(e.w, "} else {")
+		e.indent++
+		for idx := range strobes {
+			e.printIndent()
+			e.w.open("sv.if %s {", strobes[idx])
+			e.indent++
+			e.printIndent()
+			e.w.op("sv.passign %s, %s : %s", reg, data[idx], typeStr)
+			e.indent--
+			e.printIndent()
+			e.w.close()
+		}
+		e.indent--
+		e.printIndent()
+		e.w.close()
+		e.indent--
+		e.printIndent()
+		e.w.close()
+		wires[sig] = set
+	}
+	return wires
+}
+
+// mutexPortsFromWires maps the mutexes and shared registers of the root
+// process, which lives in the top-level module, onto their wires.
+func mutexPortsFromWires(info *processInfo, mutexWires map[*ir.Mutex]*mutexWireSet, sharedWires map[*ir.Signal]*sharedWireSet) (map[*ir.Mutex]mutexPortSet, map[*ir.Signal]sharedPortSet) {
+	mutexPorts := make(map[*ir.Mutex]mutexPortSet)
+	for _, mu := range info.mutexes {
+		if set := mutexWires[mu]; set != nil {
+			mutexPorts[mu] = mutexPortSet{req: set.req[info.proc.Name], grant: set.grant[info.proc.Name]}
+		}
+	}
+	sharedPorts := make(map[*ir.Signal]sharedPortSet)
+	for _, sig := range info.shared {
+		if set := sharedWires[sig]; set != nil {
+			sharedPorts[sig] = sharedPortSet{value: set.value, we: set.we[info.proc.Name], wdata: set.wdata[info.proc.Name]}
+		}
+	}
+	return mutexPorts, sharedPorts
+}
+
+// bindMutexPorts names the ports a process module locks its mutexes and
+// reads and writes shared registers through.
+func bindMutexPorts(info *processInfo) {
+	info.mutexPorts = make(map[*ir.Mutex]mutexPortSet)
+	for _, mu := range info.mutexes {
+		info.mutexPorts[mu] = mutexPortSet{req: mutexPort(mu, "req"), grant: mutexPort(mu, "grant")}
+	}
+	info.sharedPorts = make(map[*ir.Signal]sharedPortSet)
+	for _, sig := range info.shared {
+		set := sharedPortSet{value: sharedPort(sig, "")}
+		if info.sharedWrites[sig] {
+			set.we, set.wdata = sharedPort(sig, "we"), sharedPort(sig, "wdata")
+		}
+		info.sharedPorts[sig] = set
+	}
+}
+
+// collectProcessMutexes returns the mutexes proc locks, in the order their
+// first Lock appears, and the shared registers it reads or writes, ordered by
+// name, with the ones it writes marked.
+func collectProcessMutexes(proc *ir.Process, used map[*ir.Signal]struct{}) ([]*ir.Mutex, []*ir.Signal, map[*ir.Signal]bool) {
+	var mutexes []*ir.Mutex
+	writes := make(map[*ir.Signal]bool)
+	for _, block := range proc.Blocks {
+		for _, op := range block.Ops {
+			switch o := op.(type) {
+			case *ir.LockOperation:
+				if !slices.Contains(mutexes, o.Mutex) {
+					mutexes = append(mutexes, o.Mutex)
+				}
+			case *ir.AssignOperation:
+				if o.Dest.Kind == ir.Shared {
+					writes[o.Dest] = true
+				}
+			}
+		}
+	}
+	var shared []*ir.Signal
+	for sig := range used {
+		if sig.Kind == ir.Shared {
+			shared = append(shared, sig)
+		}
+	}
+	sort.Slice(shared, func(i, j int) bool {
+		return shared[i].Name < shared[j].Name
+	})
+	return mutexes, shared, writes
+}
+
+// recordSharedStore defers a store to a shared register until the end of the
+// process so it can be driven onto the write wires. A later store in the same
+// state replaces an earlier one.
+func (p *processPrinter) recordSharedStore(op *ir.AssignOperation) bool {
+	if op.Dest.Kind != ir.Shared {
+		return false
+	}
+	for idx, prev := range p.sharedStores {
+		if prev.Dest == op.Dest && p.sameState(prev, op) {
+			p.sharedStores[idx] = op
+			return true
+		}
+	}
+	p.sharedStores = append(p.sharedStores, op)
+	return true
+}
+
+func (p *processPrinter) sameState(a, b ir.Operation) bool {
+	if p.fsm == nil {
+		return true
+	}
+	return p.fsm.opSegments[a] == p.fsm.opSegments[b]
+}
+
+// stateExit returns an i1 value that is high on the cycle control leaves the
+// state holding op: immediately, or once the state's blocking operation
+// fires.
+func (p *processPrinter) stateExit(op ir.Operation) string {
+	active := p.opActive(op)
+	if p.fsm == nil {
+		return active
+	}
+	seg := p.fsm.opSegments[op]
+	if seg == nil || seg.wait == nil || seg.fire == "" {
+		return active
+	}
+	exit := p.freshValueName("exit")
+	p.printIndent()
+	p.w.op("%s = comb.and %s, %s : i1", exit, active, seg.fire)
+	return exit
+}
+
+// emitMutexLogic drives the write wires of shared registers and the request
+// of every mutex the process locks. A stored value lands as its state exits.
+// The request rises while a Lock waits and stays up until the state holding
+// the matching Unlock exits, so the next holder only starts once the last
+// store under the mutex has landed.
+func (p *processPrinter) emitMutexLogic() {
+	for _, store := range p.sharedStores {
+		ports, ok := p.sharedPorts[store.Dest]
+		if !ok || ports.we == "" {
+			continue
+		}
+		pos := ir.OperationSource(store)
+		restore := p.at(pos)
+		exit := p.stateExit(store)
+		restore()
+		p.driveHandshake(ports.we, exit, exit, "i1", pos)
+		p.driveHandshake(ports.wdata, exit, p.valueRef(store.Value), typeString(store.Dest.Type), pos)
+	}
+	for _, mu := range p.mutexOrder {
+		ports, ok := p.mutexPorts[mu]
+		if !ok {
+			continue
+		}
+		var fires, releases, requests []string
+		for _, op := range p.locks[mu] {
+			requests = append(requests, p.opActive(op))
+			fires = append(fires, p.stateExit(op))
+		}
+		for _, op := range p.unlocks[mu] {
+			releases = append(releases, p.stateExit(op))
+		}
+		// Materialize every operand first so nothing is printed inside the
+		// register's initial and always blocks.
+		off, on := p.boolConst(false), p.boolConst(true)
+		set := ""
+		if len(fires) > 0 {
+			set = p.orValues(fires)
+		}
+		release := ""
+		if len(releases) > 0 {
+			release = p.orValues(releases)
+		}
+		regName := p.freshValueName("held_reg")
+		held := p.freshValueName("held")
+		p.printIndent()
+		p.w.op("%s = sv.reg : !hw.inout<i1>", regName)
+		p.printIndent()
+		p.w.open("sv.initial {")
+		p.indent++
+		p.printIndent()
+		p.w.op("sv.bpassign %s, %s : i1", regName, off)
+		p.indent--
+		p.printIndent()
+		p.w.close()
+		p.printIndent()
+		p.w.op("%s = sv.read_inout %s : !hw.inout<i1>", held, regName)
+		keep := held
+		if release != "" {
+			stay := p.freshValueName("stay")
+			p.printIndent()
+			p.w.op("%s = comb.xor %s, %s : i1", stay, release, on)
+			keep = p.freshValueName("keep")
+			p.printIndent()
+			p.w.op("%s = comb.and %s, %s : i1", keep, held, stay)
+		}
+		req := p.orValues(append(requests, keep))
+		p.printIndent()
+		p.w.op("sv.assign %s, %s : i1", ports.req, req)
+
+		p.printIndent()
+		p.w.open("sv.always posedge %s {", p.portRef("clk"))
+		p.indent++
+		p.printIndent()
+		p.w.open("sv.if %s {", p.portRef("rst"))
+		p.indent++
+		p.printIndent()
+		p.w.op("sv.passign %s, %s : i1", regName, off)
+		p.indent--
+		p.printIndent()
+		fmt.Fprintln(p.w, "} else {")
+		p.indent++
+		if release != "" {
+			p.printIndent()
+			p.w.open("sv.if %s {", release)
+			p.indent++
+			p.printIndent()
+			p.w.op("sv.passign %s, %s : i1", regName, off)
+			p.indent--
+			p.printIndent()
+			p.w.close()
+		}
+		if set != "" {
+			p.printIndent()
+			p.w.open("sv.if %s {", set)
+			p.indent++
+			p.printIndent()
+			p.w.op("sv.passign %s, %s : i1", regName, on)
+			p.indent--
+			p.printIndent()
+			p.w.close()
+		}
+		p.indent--
+		p.printIndent()
+		p.w.close()
+		p.indent--
+		p.printIndent()
+		p.w.close()
+	}
+}
+
+func (p *processPrinter) orValues(values []string) string {
+	if len(values) == 1 {
+		return values[0]
+	}
+	name := p.freshValueName("any")
+	p.printIndent()
+	p.w.op("%s = comb.or %s : i1", name, strings.Join(values, ", "))
+	return name
+}
+
+// emitMutexArbiterModule prints a generated mutex arbiter. While nobody holds
+// the mutex it grants one requester by policy; the holder keeps its grant
+// until it drops its request.
+func (e *emitter) emitMutexArbiterModule(info *arbiterInfo) {
+	ports := []string{"in %clk: i1", "in %rst: i1"}
+	for i := 0; i < info.n; i++ {
+		ports = append(ports, fmt.Sprintf("inout %%req%d: i1", i), fmt.Sprintf("inout %%grant%d: i1", i))
+	}
+	e.printIndent()
+	e.w.open("hw.module @%s(%s) {", info.moduleName, strings.Join(ports, ", "))
+	e.indent++
+	b := &arbiterBuilder{w: e.w, indent: e.indent}
+	b.line("%%true = hw.constant true")
+	b.line("%%false = hw.constant false")
+	reqs := make([]string, info.n)
+	ownerRegs := make([]string, info.n)
+	keeps := make([]string, info.n)
+	for i := range reqs {
+		reqs[i] = b.read(fmt.Sprintf("%%req%d", i), "i1")
+		ownerRegs[i] = b.fresh("owner_reg")
+		b.line("%s = sv.reg : !hw.inout<i1>", ownerRegs[i])
+		keeps[i] = b.and(b.read(ownerRegs[i], "i1"), reqs[i])
+	}
+	busy := b.or(keeps)
+	pick := b.and(b.not(busy), b.or(reqs))
+	picks := b.grants(reqs, info.policy, pick)
+	grants := make([]string, info.n)
+	for i := range grants {
+		grants[i] = b.fresh("grant")
+		b.line("%s = comb.mux %s, %s, %s : i1", grants[i], busy, keeps[i], picks[i])
+		b.line("sv.assign %%grant%d, %s : i1", i, grants[i])
+	}
+	b.line("sv.always posedge %%clk {")
+	b.indent++
+	b.line("sv.if %%rst {")
+	b.indent++
+	for _, reg := range ownerRegs {
+		b.line("sv.passign %s, %%false : i1", reg)
+	}
+	b.indent--
+	b.line("} else {")
+	b.indent++
+	for i, reg := range ownerRegs {
+		b.line("sv.passign %s, %s : i1", reg, grants[i])
+	}
+	b.indent--
+	b.line("}")
+	b.indent--
+	b.line("}")
+	b.line("hw.output")
+	e.indent--
+	e.printIndent()
+	e.w.close()
+}
@@ -0,0 +1,667 @@
+package mlir
+
+import (
+	"fmt"
+	"io"
+	"math/bits"
+	"sort"
+	"strings"
+
+	"mygo/internal/ir"
+)
+
+// floatUnitInfo describes a generated float32 unit. Each unit is a
+// combinational netlist followed by latency pipeline registers; the registers
+// trail the logic so synthesis retiming can spread them through it.
+type floatUnitInfo struct {
+	moduleName string
+	op         ir.FloatOp
+	ftz        bool
+	// intType is the integer side of a conversion.
+	intType *ir.SignalType
+	latency int
+}
+
+func newFloatUnitInfo(op *ir.FloatOperation, mode ir.FloatMode) *floatUnitInfo {
+	info := &floatUnitInfo{
+		op:      op.Op,
+		ftz:     mode == ir.FloatFlushToZero,
+		latency: op.Op.Latency(),
+	}
+	name := "mygo_fp_" + op.Op.String()
+	switch op.Op {
+	case ir.FloatFromInt:
+		info.intType = op.Left.Type
+		name = "mygo_fp_from_" + intTypeSuffix(op.Left.Type)
+	case ir.FloatToInt:
+		info.intType = op.Dest.Type
+		name = "mygo_fp_to_" + intTypeSuffix(op.Dest.Type)
+	}
+	if info.ftz {
+		name += "_ftz"
+	}
+	info.moduleName = name
+	return info
+}
+
+func intTypeSuffix(t *ir.SignalType) string {
+	sign := "u"
+	if t != nil && t.Signed {
+		sign = "s"
+	}
+	return fmt.Sprintf("%s%d", sign, signalWidth(t))
+}
+
+// inputWidths lists the widths of the unit's a and b inputs.
+func (u *floatUnitInfo) inputWidths() []int {
+	switch u.op {
+	case ir.FloatFromInt:
+		return []int{signalWidth(u.intType)}
+	case ir.FloatToInt:
+		return []int{32}
+	}
+	return []int{32, 32}
+}
+
+func (u *floatUnitInfo) resultWidth() int {
+	switch {
+	case u.op.IsCompare():
+		return 1
+	case u.op == ir.FloatToInt:
+		return signalWidth(u.intType)
+	}
+	return 32
+}
+
+// netlist builds the unit's logic.
+func (u *floatUnitInfo) netlist() *fpNetlist {
+	n := newFPNetlist()
+	a := n.input("a", u.inputWidths()[0])
+	var out *fpNode
+	switch u.op {
+	case ir.FloatAdd:
+		out = n.floatAdd(a, n.input("b", 32), u.ftz)
+	case ir.FloatSub:
+		b := n.input("b", 32)
+		out = n.floatAdd(a, n.xor(b, n.lit(32, 1<<31)), u.ftz)
+	case ir.FloatMul:
+		out = n.floatMul(a, n.input("b", 32), u.ftz)
+	case ir.FloatEQ:
+		out = n.floatEq(a, n.input("b", 32), u.ftz)
+	case ir.FloatNE:
+		out = n.not(n.floatEq(a, n.input("b", 32), u.ftz))
+	case ir.FloatLT:
+		out = n.floatLess(a, n.input("b", 32), u.ftz, false)
+	case ir.FloatLE:
+		out = n.floatLess(a, n.input("b", 32), u.ftz, true)
+	case ir.FloatGT:
+		b := n.input("b", 32)
+		out = n.floatLess(b, a, u.ftz, false)
+	case ir.FloatGE:
+		b := n.input("b", 32)
+		out = n.floatLess(b, a, u.ftz, true)
+	case ir.FloatFromInt:
+		out = n.intToFloat(a, u.intType.Signed, u.ftz)
+	case ir.FloatToInt:
+		out = n.floatToInt(a, signalWidth(u.intType), u.ftz)
+	}
+	n.output = out
+	return n
+}
+
+// emitFloatUnitModules prints every float32 unit used by the design.
+func (e *emitter) emitFloatUnitModules() {
+	names := make([]string, 0, len(e.floatUnits))
+	for name := range e.floatUnits {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		e.emitFloatUnitModule(e.floatUnits[name])
+	}
+}
+
+func (e *emitter) emitFloatUnitModule(info *floatUnitInfo) {
+	ports := []string{"in %clk: i1"}
+	for i, width := range info.inputWidths() {
+		ports = append(ports, fmt.Sprintf("in %%%c: i%d", 'a'+i, width))
+	}
+	resultType := fmt.Sprintf("i%d", info.resultWidth())
+	ports = append(ports, "out result: "+resultType)
+	e.printIndent()
+	e.w.open("hw.module @%s(%s) {", info.moduleName, strings.Join(ports, ", "))
+	e.indent++
+	n := info.netlist()
+	result := n.print(e.w, e.indent)
+	if info.latency > 0 {
+		e.printIndent()
+		e.w.op("%%clk_seq = seq.to_clock %%clk")
+		for i := 0; i < info.latency; i++ {
+			stage := fmt.Sprintf("%%stage%d", i)
+			e.printIndent()
+			e.w.op("%s = seq.compreg %s, %%clk_seq : %s", stage, result, resultType)
+			result = stage
+		}
+	}
+	e.printIndent()
+	e.w.op("hw.output %s : %s", result, resultType)
+	e.indent--
+	e.printIndent()
+	e.w.close()
+}
+
+// fpKind enumerates the comb operations a float netlist is built from.
+type fpKind int
+
+const (
+	fpConst fpKind = iota
+	fpInput
+	fpAdd
+	fpSub
+	fpMul
+	fpAnd
+	fpOr
+	fpXor
+	fpShl
+	fpShrU
+	fpEq
+	fpNe
+	fpUlt
+	fpSlt
+	fpMux
+	fpExtract
+	fpConcat
+)
+
+// fpNode is one value in a float netlist. Shift amounts always stay below the
+// operand width, so every node has the same meaning in comb and in Go.
+type fpNode struct {
+	kind  fpKind
+	width int
+	args  []*fpNode
+	// value holds a constant, or the low bit of an extract.
+	value uint64
+	name  string
+	id    int
+}
+
+// fpNetlist collects nodes in definition order. Constants are shared.
+type fpNetlist struct {
+	nodes  []*fpNode
+	consts map[[2]uint64]*fpNode
+	output *fpNode
+}
+
+func newFPNetlist() *fpNetlist {
+	return &fpNetlist{consts: make(map[[2]uint64]*fpNode)}
+}
+
+func (n *fpNetlist) add(node *fpNode) *fpNode {
+	node.id = len(n.nodes)
+	n.nodes = append(n.nodes, node)
+	return node
+}
+
+func (n *fpNetlist) node(kind fpKind, width int, args ...*fpNode) *fpNode {
+	return n.add(&fpNode{kind: kind, width: width, args: args})
+}
+
+func (n *fpNetlist) input(name string, width int) *fpNode {
+	return n.add(&fpNode{kind: fpInput, width: width, name: name})
+}
+
+func (n *fpNetlist) lit(width int, value uint64) *fpNode {
+	value &= widthMask(width)
+	key := [2]uint64{uint64(width), value}
+	if c, ok := n.consts[key]; ok {
+		return c
+	}
+	c := n.add(&fpNode{kind: fpConst, width: width, value: value})
+	n.consts[key] = c
+	return c
+}
+
+func (n *fpNetlist) addw(x, y *fpNode) *fpNode { return n.node(fpAdd, x.width, x, y) }
+func (n *fpNetlist) sub(x, y *fpNode) *fpNode  { return n.node(fpSub, x.width, x, y) }
+func (n *fpNetlist) mul(x, y *fpNode) *fpNode  { return n.node(fpMul, x.width, x, y) }
+func (n *fpNetlist) and(x, y *fpNode) *fpNode  { return n.node(fpAnd, x.width, x, y) }
+func (n *fpNetlist) or(x, y *fpNode) *fpNode   { return n.node(fpOr, x.width, x, y) }
+func (n *fpNetlist) xor(x, y *fpNode) *fpNode  { return n.node(fpXor, x.width, x, y) }
+func (n *fpNetlist) shl(x, y *fpNode) *fpNode  { return n.node(fpShl, x.width, x, y) }
+func (n *fpNetlist) shru(x, y *fpNode) *fpNode { return n.node(fpShrU, x.width, x, y) }
+func (n *fpNetlist) eq(x, y *fpNode) *fpNode   { return n.node(fpEq, 1, x, y) }
+func (n *fpNetlist) ne(x, y *fpNode) *fpNode   { return n.node(fpNe, 1, x, y) }
+func (n *fpNetlist) ult(x, y *fpNode) *fpNode  { return n.node(fpUlt, 1, x, y) }
+func (n *fpNetlist) slt(x, y *fpNode) *fpNode  { return n.node(fpSlt, 1, x, y) }
+
+func (n *fpNetlist) not(x *fpNode) *fpNode {
+	return n.xor(x, n.lit(x.width, widthMask(x.width)))
+}
+
+func (n *fpNetlist) mux(cond, t, f *fpNode) *fpNode {
+	return n.node(fpMux, t.width, cond, t, f)
+}
+
+func (n *fpNetlist) slice(x *fpNode, lo, width int) *fpNode {
+	if lo == 0 && width == x.width {
+		return x
+	}
+	node := n.node(fpExtract, width, x)
+	node.value = uint64(lo)
+	return node
+}
+
+func (n *fpNetlist) bit(x *fpNode, i int) *fpNode {
+	return n.slice(x, i, 1)
+}
+
+// cat concatenates its arguments, most significant first.
+func (n *fpNetlist) cat(parts ...*fpNode) *fpNode {
+	width := 0
+	for _, p := range parts {
+		width += p.width
+	}
+	return n.node(fpConcat, width, parts...)
+}
+
+func (n *fpNetlist) zext(x *fpNode, width int) *fpNode {
+	if x.width == width {
+		return x
+	}
+	return n.cat(n.lit(width-x.width, 0), x)
+}
+
+func (n *fpNetlist) sext(x *fpNode, width int) *fpNode {
+	if x.width == width {
+		return x
+	}
+	ext := width - x.width
+	ones := n.lit(ext, widthMask(ext))
+	return n.cat(n.mux(n.bit(x, x.width-1), ones, n.lit(ext, 0)), x)
+}
+
+func (n *fpNetlist) nonzero(x *fpNode) *fpNode {
+	return n.ne(x, n.lit(x.width, 0))
+}
+
+func (n *fpNetlist) isZero(x *fpNode) *fpNode {
+	return n.eq(x, n.lit(x.width, 0))
+}
+
+// minU returns the smaller of two unsigned values of equal width.
+func (n *fpNetlist) minU(x, y *fpNode) *fpNode {
+	return n.mux(n.ult(x, y), x, y)
+}
+
+// shrJam shifts x right by amt and ORs every bit shifted out into the lowest
+// bit, so rounding still sees them. x must be at most 64 bits wide.
+func (n *fpNetlist) shrJam(x, amt *fpNode) *fpNode {
+	wide := n.zext(x, 64)
+	count := n.zext(amt, 64)
+	count = n.minU(count, n.lit(64, 63))
+	shifted := n.shru(wide, count)
+	lost := n.ne(n.shl(shifted, count), wide)
+	return n.or(n.slice(shifted, 0, x.width), n.zext(lost, x.width))
+}
+
+// clz counts the leading zeros of x, whose width must be a power of two. A
+// zero input yields width-1.
+func (n *fpNetlist) clz(x *fpNode) *fpNode {
+	countWidth := 1
+	for 1<<countWidth <= x.width {
+		countWidth++
+	}
+	count := n.lit(countWidth, 0)
+	for step := x.width / 2; step >= 1; step /= 2 {
+		top := n.isZero(n.slice(x, x.width-step, step))
+		x = n.mux(top, n.shl(x, n.lit(x.width, uint64(step))), x)
+		count = n.mux(top, n.addw(count, n.lit(countWidth, uint64(step))), count)
+	}
+	return count
+}
+
+// fpParts is an unpacked float32. mant includes the hidden bit and exp is the
+// effective exponent, which is 1 for subnormals. In flush-to-zero mode a
+// subnormal has a zero mantissa.
+type fpParts struct {
+	sign, exp, mant           *fpNode
+	isNaN, isInf, isZero, mag *fpNode
+}
+
+func (n *fpNetlist) unpack(x *fpNode, ftz bool) fpParts {
+	exp := n.slice(x, 23, 8)
+	frac := n.slice(x, 0, 23)
+	expZero := n.isZero(exp)
+	expMax := n.eq(exp, n.lit(8, 0xFF))
+	fracZero := n.isZero(frac)
+	p := fpParts{
+		sign:  n.bit(x, 31),
+		exp:   n.mux(expZero, n.lit(8, 1), exp),
+		isNaN: n.and(expMax, n.not(fracZero)),
+		isInf: n.and(expMax, fracZero),
+		mant:  n.cat(n.not(expZero), frac),
+		mag:   n.slice(x, 0, 31),
+	}
+	if ftz {
+		p.mant = n.mux(expZero, n.lit(24, 0), p.mant)
+		p.mag = n.mux(expZero, n.lit(31, 0), p.mag)
+		p.isZero = expZero
+	} else {
+		p.isZero = n.and(expZero, fracZero)
+	}
+	return p
+}
+
+const (
+	fpCanonicalNaN = 0x7FC00000
+	fpInfinity     = 0x7F800000
+)
+
+// roundPack rounds a result to float32. m has the hidden bit at bit 26 and
+// guard, round and sticky bits below bit 3; exp is the biased exponent as a
+// 10-bit two's complement value. Results below the normal range are shifted
+// into a subnormal, and a rounding carry moves into the exponent field
+// because the packed word is formed by addition.
+func (n *fpNetlist) roundPack(sign, exp, m *fpNode, ftz bool) *fpNode {
+	tiny := n.slt(exp, n.lit(10, 1))
+	m = n.mux(tiny, n.shrJam(m, n.sub(n.lit(10, 1), exp)), m)
+	exp = n.mux(tiny, n.lit(10, 1), exp)
+
+	lsb := n.bit(m, 3)
+	guard := n.bit(m, 2)
+	rest := n.nonzero(n.slice(m, 0, 2))
+	up := n.and(guard, n.or(rest, lsb))
+	mant := n.addw(n.zext(n.slice(m, 3, 24), 34), n.zext(up, 34))
+	field := n.shl(n.sub(n.zext(exp, 34), n.lit(34, 1)), n.lit(34, 23))
+	packed := n.addw(field, mant)
+
+	overflow := n.not(n.ult(packed, n.lit(34, 0xFF<<23)))
+	result := n.mux(overflow, n.lit(31, fpInfinity), n.slice(packed, 0, 31))
+	if ftz {
+		subnormal := n.ult(packed, n.lit(34, 1<<23))
+		result = n.mux(subnormal, n.lit(31, 0), result)
+	}
+	return n.cat(sign, result)
+}
+
+// floatAdd adds two float32 values. The operand of larger magnitude is
+// aligned with the other one, the 27-bit sum is normalized and then rounded.
+// Cancellation only shifts the sum left by more than one bit when the
+// exponents differ by at most one, in which case no bits were lost.
+func (n *fpNetlist) floatAdd(a, b *fpNode, ftz bool) *fpNode {
+	pa := n.unpack(a, ftz)
+	pb := n.unpack(b, ftz)
+	swap := n.ult(pa.mag, pb.mag)
+	x := n.pickParts(swap, pb, pa)
+	y := n.pickParts(swap, pa, pb)
+
+	diff := n.sub(x.exp, y.exp)
+	mx := n.cat(x.mant, n.lit(3, 0))
+	my := n.shrJam(n.cat(y.mant, n.lit(3, 0)), diff)
+	subtract := n.xor(x.sign, y.sign)
+	sum := n.mux(subtract,
+		n.sub(n.zext(mx, 28), n.zext(my, 28)),
+		n.addw(n.zext(mx, 28), n.zext(my, 28)))
+
+	carry := n.bit(sum, 27)
+	carried := n.or(n.slice(sum, 1, 27), n.zext(n.bit(sum, 0), 27))
+	carriedExp := n.addw(n.zext(x.exp, 10), n.lit(10, 1))
+
+	low := n.slice(sum, 0, 27)
+	lead := n.clz(n.cat(low, n.lit(5, 0x1F)))
+	shift := n.minU(n.zext(lead, 8), n.sub(x.exp, n.lit(8, 1)))
+	normalized := n.slice(n.shl(n.zext(low, 32), n.zext(shift, 32)), 0, 27)
+	normalizedExp := n.zext(n.sub(x.exp, shift), 10)
+
+	m := n.mux(carry, carried, normalized)
+	exp := n.mux(carry, carriedExp, normalizedExp)
+	result := n.roundPack(x.sign, exp, m, ftz)
+
+	exactZero := n.isZero(sum)
+	result = n.mux(exactZero, n.cat(n.and(pa.sign, pb.sign), n.lit(31, 0)), result)
+	infSign := n.mux(pa.isInf, pa.sign, pb.sign)
+	result = n.mux(n.or(pa.isInf, pb.isInf), n.cat(infSign, n.lit(31, fpInfinity)), result)
+	nan := n.or(n.or(pa.isNaN, pb.isNaN), n.and(n.and(pa.isInf, pb.isInf), n.xor(pa.sign, pb.sign)))
+	return n.mux(nan, n.lit(32, fpCanonicalNaN), result)
+}
+
+func (n *fpNetlist) pickParts(cond *fpNode, t, f fpParts) fpParts {
+	return fpParts{
+		sign: n.mux(cond, t.sign, f.sign),
+		exp:  n.mux(cond, t.exp, f.exp),
+		mant: n.mux(cond, t.mant, f.mant),
+	}
+}
+
+// floatMul multiplies two float32 values. The 48-bit product is normalized
+// so its leading one is at bit 47, which also handles subnormal operands.
+func (n *fpNetlist) floatMul(a, b *fpNode, ftz bool) *fpNode {
+	pa := n.unpack(a, ftz)
+	pb := n.unpack(b, ftz)
+	sign := n.xor(pa.sign, pb.sign)
+
+	product := n.mul(n.zext(pa.mant, 48), n.zext(pb.mant, 48))
+	lead := n.sub(n.clz(n.zext(product, 64)), n.lit(7, 16))
+	normalized := n.shl(product, n.zext(lead, 48))
+	sticky := n.nonzero(n.slice(normalized, 0, 21))
+	m := n.or(n.slice(normalized, 21, 27), n.zext(sticky, 27))
+	// The product is 1.f * 2^(ea+eb-254-lead+1), biased by 127.
+	exp := n.sub(n.addw(n.zext(pa.exp, 10), n.zext(pb.exp, 10)), n.addw(n.zext(lead, 10), n.lit(10, 126)))
+	result := n.roundPack(sign, exp, m, ftz)
+
+	zero := n.or(pa.isZero, pb.isZero)
+	result = n.mux(zero, n.cat(sign, n.lit(31, 0)), result)
+	result = n.mux(n.or(pa.isInf, pb.isInf), n.cat(sign, n.lit(31, fpInfinity)), result)
+	nan := n.or(n.or(pa.isNaN, pb.isNaN),
+		n.or(n.and(pa.isInf, pb.isZero), n.and(pb.isInf, pa.isZero)))
+	return n.mux(nan, n.lit(32, fpCanonicalNaN), result)
+}
+
+// floatEq is false when either operand is NaN and treats +0 and -0 as equal.
+func (n *fpNetlist) floatEq(a, b *fpNode, ftz bool) *fpNode {
+	pa := n.unpack(a, ftz)
+	pb := n.unpack(b, ftz)
+	bothZero := n.and(n.isZero(pa.mag), n.isZero(pb.mag))
+	same := n.and(n.eq(pa.sign, pb.sign), n.eq(pa.mag, pb.mag))
+	ordered := n.not(n.or(pa.isNaN, pb.isNaN))
+	return n.and(ordered, n.or(same, bothZero))
+}
+
+// floatLess compares a < b, or a <= b when orEqual is set. Magnitudes order
+// like unsigned integers, so only the signs need special handling.
+func (n *fpNetlist) floatLess(a, b *fpNode, ftz, orEqual bool) *fpNode {
+	pa := n.unpack(a, ftz)
+	pb := n.unpack(b, ftz)
+	bothZero := n.and(n.isZero(pa.mag), n.isZero(pb.mag))
+	ordered := n.not(n.or(pa.isNaN, pb.isNaN))
+	magLess := n.ult(pa.mag, pb.mag)
+	magGreater := n.ult(pb.mag, pa.mag)
+	less := n.mux(n.xor(pa.sign, pb.sign),
+		pa.sign,
+		n.mux(pa.sign, magGreater, magLess))
+	less = n.and(less, n.not(bothZero))
+	if orEqual {
+		same := n.and(n.eq(pa.sign, pb.sign), n.eq(pa.mag, pb.mag))
+		less = n.or(less, n.or(same, bothZero))
+	}
+	return n.and(ordered, less)
+}
+
+// intToFloat converts an integer by normalizing its magnitude in 64 bits and
+// rounding to nearest even. Integers never produce subnormals.
+func (n *fpNetlist) intToFloat(x *fpNode, signed, ftz bool) *fpNode {
+	var wide, negative *fpNode
+	if signed {
+		wide = n.sext(x, 64)
+		negative = n.bit(x, x.width-1)
+	} else {
+		wide = n.zext(x, 64)
+		negative = n.lit(1, 0)
+	}
+	mag := n.mux(negative, n.sub(n.lit(64, 0), wide), wide)
+	lead := n.clz(mag)
+	normalized := n.shl(mag, n.zext(lead, 64))
+	sticky := n.nonzero(n.slice(normalized, 0, 37))
+	m := n.or(n.slice(normalized, 37, 27), n.zext(sticky, 27))
+	exp := n.sub(n.lit(10, 127+63), n.zext(lead, 10))
+	result := n.roundPack(negative, exp, m, ftz)
+	return n.mux(n.isZero(mag), n.lit(32, 0), result)
+}
+
+// floatToInt truncates toward zero. As in Go, the result for values outside
+// the integer's range is unspecified.
+func (n *fpNetlist) floatToInt(x *fpNode, width int, ftz bool) *fpNode {
+	p := n.unpack(x, ftz)
+	mant := n.zext(p.mant, 64)
+	// The value is mant * 2^(exp-150).
+	up := n.minU(n.sub(p.exp, n.lit(8, 150)), n.lit(8, 63))
+	down := n.minU(n.sub(n.lit(8, 150), p.exp), n.lit(8, 63))
+	large := n.not(n.ult(p.exp, n.lit(8, 150)))
+	mag := n.mux(large, n.shl(mant, n.zext(up, 64)), n.shru(mant, n.zext(down, 64)))
+	value := n.mux(p.sign, n.sub(n.lit(64, 0), mag), mag)
+	return n.slice(value, 0, width)
+}
+
+// print writes the netlist as comb operations and returns the output value.
+func (n *fpNetlist) print(w io.Writer, indent int) string {
+	names := make([]string, len(n.nodes))
+	pad := strings.Repeat("  ", indent)
+	for i, node := range n.nodes {
+		if node.kind == fpInput {
+			names[i] = "%" + node.name
+			continue
+		}
+		names[i] = fmt.Sprintf("%%n%d", i)
+		arg := func(j int) string { return names[node.args[j].id] }
+		typ := fmt.Sprintf("i%d", node.width)
+		var line string
+		switch node.kind {
+		case fpConst:
+			line = fmt.Sprintf("hw.constant %d : %s", node.value, typ)
+		case fpAdd, fpSub, fpMul, fpAnd, fpOr, fpXor, fpShl, fpShrU:
+			line = fmt.Sprintf("comb.%s %s, %s : %s", fpOpNames[node.kind], arg(0), arg(1), typ)
+		case fpEq, fpNe, fpUlt, fpSlt:
+			line = fmt.Sprintf("comb.icmp %s %s, %s : i%d", fpOpNames[node.kind], arg(0), arg(1), node.args[0].width)
+		case fpMux:
+			line = fmt.Sprintf("comb.mux %s, %s, %s : %s", arg(0), arg(1), arg(2), typ)
+		case fpExtract:
+			line = fmt.Sprintf("comb.extract %s from %d : (i%d) -> %s", arg(0), node.value, node.args[0].width, typ)
+		case fpConcat:
+			args := make([]string, len(node.args))
+			types := make([]string, len(node.args))
+			for j, a := range node.args {
+				args[j] = names[a.id]
+				types[j] = fmt.Sprintf("i%d", a.width)
+			}
+			line = fmt.Sprintf("comb.concat %s : %s", strings.Join(args, ", "), strings.Join(types, ", "))
+		}
+		fmt.Fprintf(w, "%s%s = %s\n", pad, names[i], line)
+	}
+	return names[n.output.id]
+}
+
+var fpOpNames = map[fpKind]string{
+	fpAdd:  "add",
+	fpSub:  "sub",
+	fpMul:  "mul",
+	fpAnd:  "and",
+	fpOr:   "or",
+	fpXor:  "xor",
+	fpShl:  "shl",
+	fpShrU: "shru",
+	fpEq:   "eq",
+	fpNe:   "ne",
+	fpUlt:  "ult",
+	fpSlt:  "slt",
+}
+
+func widthMask(width int) uint64 {
+	if width >= 64 {
+		return ^uint64(0)
+	}
+	return 1<<uint(width) - 1
+}
+
+// emitFloatOperation instantiates a unit for o. A unit with a latency holds
+// the process in o's state until a counter reaches it, and the result is
+// latched as the state is left, like a received value.
+func (p *processPrinter) emitFloatOperation(o *ir.FloatOperation) {
+	info := newFloatUnitInfo(o, p.floatMode)
+	if _, ok := p.floatUnits[info.moduleName]; !ok {
+		p.floatUnits[info.moduleName] = info
+	}
+	args := []string{fmt.Sprintf("clk: %s : i1", p.portRef("clk"))}
+	operands := []*ir.Signal{o.Left, o.Right}
+	for i, width := range info.inputWidths() {
+		args = append(args, fmt.Sprintf("%c: %s : i%d", 'a'+i, p.valueRef(operands[i]), width))
+	}
+	resultType := fmt.Sprintf("i%d", info.resultWidth())
+	inst := strings.TrimPrefix(p.freshValueName("fp_"+o.Op.String()), "%")
+	if info.latency == 0 {
+		p.printIndent()
+		p.w.op("%s = hw.instance \"%s\" @%s(%s) -> (result: %s)", p.bindSSA(o.Dest), inst, info.moduleName, strings.Join(args, ", "), resultType)
+		return
+	}
+	latch := &recvLatch{
+		regName: p.freshValueName("fp_reg"),
+		data:    p.freshValueName("fp_result"),
+		typeStr: resultType,
+	}
+	p.printIndent()
+	p.w.op("%s = sv.reg : !hw.inout<%s>", latch.regName, resultType)
+	p.printIndent()
+	p.w.op("%s = sv.read_inout %s : !hw.inout<%s>", p.bindSSA(o.Dest), latch.regName, resultType)
+	p.printIndent()
+	p.w.op("%s = hw.instance \"%s\" @%s(%s) -> (result: %s)", latch.data, inst, info.moduleName, strings.Join(args, ", "), resultType)
+	p.stallUntil(o, p.emitFloatWait(o, info.latency), latch)
+}
+
+// emitFloatWait counts the cycles spent in op's state and returns a value that
+// is high once latency cycles have passed. The count restarts when the state
+// is left or fires, so a loop can re-enter the same state.
+func (p *processPrinter) emitFloatWait(op ir.Operation, latency int) string {
+	typ := fmt.Sprintf("i%d", bits.Len(uint(latency)))
+	constant := func(value int) string {
+		name := p.freshValueName("fp_const")
+		p.printIndent()
+		p.w.op("%s = hw.constant %d : %s", name, value, typ)
+		return name
+	}
+	zero, one := constant(0), constant(1)
+	target := one
+	if latency > 1 {
+		target = constant(latency)
+	}
+	always := p.boolConst(true)
+	reg := p.freshValueName("fp_count_reg")
+	count := p.freshValueName("fp_count")
+	done := p.freshValueName("fp_done")
+	busy := p.freshValueName("fp_busy")
+	inc := p.freshValueName("fp_inc")
+	next := p.freshValueName("fp_next")
+	active := p.opActive(op)
+	p.printIndent()
+	p.w.op("%s = sv.reg : !hw.inout<%s>", reg, typ)
+	p.printIndent()
+	p.w.op("%s = sv.read_inout %s : !hw.inout<%s>", count, reg, typ)
+	p.printIndent()
+	p.w.op("%s = comb.icmp eq %s, %s : %s", done, count, target, typ)
+	p.printIndent()
+	p.w.op("%s = comb.xor %s, %s : i1", busy, done, always)
+	waiting := p.freshValueName("fp_wait")
+	p.printIndent()
+	p.w.op("%s = comb.and %s, %s : i1", waiting, active, busy)
+	p.printIndent()
+	p.w.op("%s = comb.add %s, %s : %s", inc, count, one, typ)
+	p.printIndent()
+	p.w.op("%s = comb.mux %s, %s, %s : %s", next, waiting, inc, zero, typ)
+	p.printIndent()
+	p.w.open("sv.always posedge %s {", p.portRef("clk"))
+	p.indent++
+	p.printIndent()
+	p.w.op("sv.passign %s, %s : %s", reg, next, typ)
+	p.indent--
+	p.printIndent()
+	p.w.close()
+	return done
+}
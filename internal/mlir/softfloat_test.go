@@ -0,0 +1,233 @@
+package mlir
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"mygo/internal/ir"
+)
+
+// eval computes the netlist's output for the given input values.
+func (n *fpNetlist) eval(inputs map[string]uint64) uint64 {
+	values := make([]uint64, len(n.nodes))
+	for i, node := range n.nodes {
+		arg := func(j int) uint64 { return values[node.args[j].id] }
+		var v uint64
+		switch node.kind {
+		case fpConst:
+			v = node.value
+		case fpInput:
+			v = inputs[node.name]
+		case fpAdd:
+			v = arg(0) + arg(1)
+		case fpSub:
+			v = arg(0) - arg(1)
+		case fpMul:
+			v = arg(0) * arg(1)
+		case fpAnd:
+			v = arg(0) & arg(1)
+		case fpOr:
+			v = arg(0) | arg(1)
+		case fpXor:
+			v = arg(0) ^ arg(1)
+		case fpShl:
+			if arg(1) < uint64(node.width) {
+				v = arg(0) << arg(1)
+			}
+		case fpShrU:
+			if arg(1) < uint64(node.width) {
+				v = arg(0) >> arg(1)
+			}
+		case fpEq:
+			v = boolBit(arg(0) == arg(1))
+		case fpNe:
+			v = boolBit(arg(0) != arg(1))
+		case fpUlt:
+			v = boolBit(arg(0) < arg(1))
+		case fpSlt:
+			width := node.args[0].width
+			v = boolBit(signExtend(arg(0), width) < signExtend(arg(1), width))
+		case fpMux:
+			v = arg(2)
+			if arg(0) != 0 {
+				v = arg(1)
+			}
+		case fpExtract:
+			v = arg(0) >> node.value
+		case fpConcat:
+			for j, a := range node.args {
+				v = v<<uint(a.width) | arg(j)
+			}
+		}
+		values[i] = v & widthMask(node.width)
+	}
+	return values[n.output.id]
+}
+
+func boolBit(b bool) uint64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func signExtend(v uint64, width int) int64 {
+	shift := 64 - width
+	return int64(v<<shift) >> shift
+}
+
+// floatSamples mixes special values, values around the subnormal and
+// overflow boundaries and random bit patterns.
+func floatSamples(count int) []uint32 {
+	samples := []uint32{
+		0, 0x80000000, 1, 0x80000001, 0x007FFFFF, 0x00800000, 0x00800001,
+		0x3F800000, 0xBF800000, 0x3F800001, 0x3FFFFFFF, 0x4B800000, 0x4B7FFFFF,
+		0x7F7FFFFF, 0xFF7FFFFF, 0x7F800000, 0xFF800000, 0x7FC00000, 0x7F800001,
+		0x34000000, 0x33800000, 0x4F000000, 0xCF000000, 0x5F000000,
+	}
+	rng := rand.New(rand.NewSource(1))
+	for len(samples) < count {
+		bits := rng.Uint32()
+		switch rng.Intn(4) {
+		case 0:
+			// Keep exponents close together so additions cancel.
+			bits = bits&0x81FFFFFF | 0x3E000000
+		case 1:
+			// Small magnitudes produce subnormal results.
+			bits &= 0x81FFFFFF
+		}
+		samples = append(samples, bits)
+	}
+	return samples
+}
+
+func sameFloat(got, want uint32) bool {
+	if math.IsNaN(float64(math.Float32frombits(want))) {
+		return math.IsNaN(float64(math.Float32frombits(got)))
+	}
+	return got == want
+}
+
+func TestFloatUnitsMatchGo(t *testing.T) {
+	samples := floatSamples(400)
+	binary := []struct {
+		op ir.FloatOp
+		fn func(a, b float32) float32
+	}{
+		{ir.FloatAdd, func(a, b float32) float32 { return a + b }},
+		{ir.FloatSub, func(a, b float32) float32 { return a - b }},
+		{ir.FloatMul, func(a, b float32) float32 { return a * b }},
+	}
+	for _, tc := range binary {
+		n := (&floatUnitInfo{op: tc.op}).netlist()
+		for _, a := range samples {
+			for _, b := range samples {
+				want := math.Float32bits(tc.fn(math.Float32frombits(a), math.Float32frombits(b)))
+				got := uint32(n.eval(map[string]uint64{"a": uint64(a), "b": uint64(b)}))
+				if !sameFloat(got, want) {
+					t.Fatalf("%s(%#08x, %#08x) = %#08x, want %#08x", tc.op, a, b, got, want)
+				}
+			}
+		}
+	}
+
+	compares := []struct {
+		op ir.FloatOp
+		fn func(a, b float32) bool
+	}{
+		{ir.FloatEQ, func(a, b float32) bool { return a == b }},
+		{ir.FloatNE, func(a, b float32) bool { return a != b }},
+		{ir.FloatLT, func(a, b float32) bool { return a < b }},
+		{ir.FloatLE, func(a, b float32) bool { return a <= b }},
+		{ir.FloatGT, func(a, b float32) bool { return a > b }},
+		{ir.FloatGE, func(a, b float32) bool { return a >= b }},
+	}
+	for _, tc := range compares {
+		n := (&floatUnitInfo{op: tc.op}).netlist()
+		for _, a := range samples {
+			for _, b := range samples {
+				want := boolBit(tc.fn(math.Float32frombits(a), math.Float32frombits(b)))
+				if got := n.eval(map[string]uint64{"a": uint64(a), "b": uint64(b)}); got != want {
+					t.Fatalf("%s(%#08x, %#08x) = %d, want %d", tc.op, a, b, got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestFloatConversionsMatchGo(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	ints := []uint64{0, 1, 2, 3, 7, 1 << 24, 1<<24 + 1, 1<<24 + 3, 1<<31 - 1, 1 << 31, 1<<32 - 1, 1<<63 - 1, 1 << 63, math.MaxUint64}
+	for i := 0; i < 2000; i++ {
+		ints = append(ints, rng.Uint64()>>uint(rng.Intn(64)))
+	}
+	for _, width := range []int{8, 16, 32, 64} {
+		for _, signed := range []bool{true, false} {
+			typ := &ir.SignalType{Width: width, Signed: signed}
+			n := (&floatUnitInfo{op: ir.FloatFromInt, intType: typ}).netlist()
+			for _, raw := range ints {
+				v := raw & widthMask(width)
+				var f float32
+				if signed {
+					f = float32(signExtend(v, width))
+				} else {
+					f = float32(v)
+				}
+				want := math.Float32bits(f)
+				if got := uint32(n.eval(map[string]uint64{"a": v})); got != want {
+					t.Fatalf("float32(%s %#x) = %#08x, want %#08x", intTypeSuffix(typ), v, got, want)
+				}
+			}
+		}
+	}
+
+	for _, width := range []int{8, 16, 32, 64} {
+		for _, signed := range []bool{true, false} {
+			typ := &ir.SignalType{Width: width, Signed: signed}
+			n := (&floatUnitInfo{op: ir.FloatToInt, intType: typ}).netlist()
+			for _, bits := range floatSamples(2000) {
+				f := math.Float32frombits(bits)
+				if math.IsNaN(float64(f)) || !fitsInt(f, width, signed) {
+					continue
+				}
+				var want uint64
+				if signed {
+					want = uint64(int64(f)) & widthMask(width)
+				} else {
+					want = uint64(f) & widthMask(width)
+				}
+				if got := n.eval(map[string]uint64{"a": uint64(bits)}); got != want {
+					t.Fatalf("%s(%g) = %#x, want %#x", intTypeSuffix(typ), f, got, want)
+				}
+			}
+		}
+	}
+}
+
+// fitsInt reports whether truncating f gives a value Go defines for the type.
+func fitsInt(f float32, width int, signed bool) bool {
+	t := math.Trunc(float64(f))
+	if signed {
+		limit := math.Ldexp(1, width-1)
+		return t >= -limit && t < limit
+	}
+	return t >= 0 && t < math.Ldexp(1, width)
+}
+
+func TestFloatFlushToZero(t *testing.T) {
+	add := (&floatUnitInfo{op: ir.FloatAdd, ftz: true}).netlist()
+	mul := (&floatUnitInfo{op: ir.FloatMul, ftz: true}).netlist()
+	tiny := uint64(0x00400000) // a subnormal
+	one := uint64(0x3F800000)
+	if got := add.eval(map[string]uint64{"a": tiny, "b": one}); got != one {
+		t.Fatalf("subnormal + 1 = %#08x, want %#08x", got, one)
+	}
+	// 2^-100 * 2^-30 underflows to a subnormal, which is flushed.
+	if got := mul.eval(map[string]uint64{"a": 0x0D800000, "b": 0x30800000}); got != 0 {
+		t.Fatalf("underflowing product = %#08x, want 0", got)
+	}
+	if got := mul.eval(map[string]uint64{"a": 0x3FC00000, "b": 0x40000000}); got != 0x40400000 {
+		t.Fatalf("1.5 * 2 = %#08x, want 0x40400000", got)
+	}
+}
@@ -0,0 +1,56 @@
+package mlir
+
+import (
+	"fmt"
+
+	"mygo/internal/ir"
+)
+
+// emitStreams ties each stream's top-level ports to the handshake wires of
+// its software endpoint. Inputs drive the wires directly; the values for the
+// output ports are returned by port name.
+func (e *emitter) emitStreams(module *ir.Module, wires map[*ir.Channel]*channelWireSet) map[string]string {
+	outputs := make(map[string]string)
+	for _, stream := range module.Streams {
+		wireSet := wires[stream.Channel]
+		if wireSet == nil {
+			continue
+		}
+		e.printIndent()
+		fmt.Fprintf(e.w, "// stream %s %s channel %s\n", stream.Name, streamDirection(stream), stream.Channel.Name)
+		port := func(wire string) string {
+			return sanitize(stream.PortName(wire))
+		}
+		elem := typeString(stream.Channel.Type)
+		if stream.Direction == ir.Input {
+			writer := wireSet.writerFor(endpointKey{site: stream.Software.Name, via: stream.Channel})
+			e.printIndent()
+			e.w.op("sv.assign %s, %%%s : %s", writer.data, port("data"), elem)
+			e.printIndent()
+			e.w.op("sv.assign %s, %%%s : i1", writer.valid, port("valid"))
+			outputs[stream.PortName("ready")] = e.readWire(port("ready"), writer.ready, "i1")
+			continue
+		}
+		reader := wireSet.readerFor(endpointKey{site: stream.Software.Name, via: stream.Channel})
+		e.printIndent()
+		e.w.op("sv.assign %s, %%%s : i1", reader.ready, port("ready"))
+		outputs[stream.PortName("data")] = e.readWire(port("data"), reader.data, elem)
+		outputs[stream.PortName("valid")] = e.readWire(port("valid"), reader.valid, "i1")
+	}
+	return outputs
+}
+
+// readWire reads an inout wire into a value named after the port it feeds.
+func (e *emitter) readWire(name, wire, typ string) string {
+	value := fmt.Sprintf("%%%s_out", name)
+	e.printIndent()
+	e.w.op("%s = sv.read_inout %s : !hw.inout<%s>", value, wire, typ)
+	return value
+}
+
+func streamDirection(stream *ir.Stream) string {
+	if stream.Direction == ir.Input {
+		return "from software over"
+	}
+	return "to software over"
+}
@@ -0,0 +1,101 @@
+package passes
+
+import "mygo/internal/ir"
+
+// Analyses caches per-process analyses between passes. Each one is computed
+// the first time a pass asks for it and kept until a pass changes the
+// process.
+type Analyses struct {
+	procs map[*ir.Process]*processAnalyses
+}
+
+type processAnalyses struct {
+	useDef   *ir.UseDef
+	dom      *ir.DomTree
+	loops    *ir.LoopNest
+	liveness *ir.Liveness
+}
+
+// NewAnalyses creates an empty analysis cache.
+func NewAnalyses() *Analyses {
+	return &Analyses{procs: make(map[*ir.Process]*processAnalyses)}
+}
+
+// analysesOrNew returns a, or a fresh cache for a pass run on its own,
+// outside a manager.
+func analysesOrNew(a *Analyses) *Analyses {
+	if a == nil {
+		return NewAnalyses()
+	}
+	return a
+}
+
+// AnalysisUser is implemented by passes that read cached analyses. The
+// manager hands them its cache before each Run.
+type AnalysisUser interface {
+	UseAnalyses(*Analyses)
+}
+
+// ChangeReporter is implemented by passes that know which processes their
+// last Run changed. The manager drops the cached analyses of just those
+// processes; after any other pass it drops them all.
+type ChangeReporter interface {
+	Changed() []*ir.Process
+}
+
+func (a *Analyses) entry(proc *ir.Process) *processAnalyses {
+	cached := a.procs[proc]
+	if cached == nil {
+		cached = &processAnalyses{}
+		a.procs[proc] = cached
+	}
+	return cached
+}
+
+// UseDef returns the def-use chains of proc.
+func (a *Analyses) UseDef(proc *ir.Process) *ir.UseDef {
+	cached := a.entry(proc)
+	if cached.useDef == nil {
+		cached.useDef = ir.ComputeUseDef(proc)
+	}
+	return cached.useDef
+}
+
+// Dominators returns the dominator tree of proc.
+func (a *Analyses) Dominators(proc *ir.Process) *ir.DomTree {
+	cached := a.entry(proc)
+	if cached.dom == nil {
+		cached.dom = ir.ComputeDominators(proc)
+	}
+	return cached.dom
+}
+
+// Loops returns the loop nest of proc.
+func (a *Analyses) Loops(proc *ir.Process) *ir.LoopNest {
+	cached := a.entry(proc)
+	if cached.loops == nil {
+		cached.loops = ir.ComputeLoops(a.Dominators(proc))
+	}
+	return cached.loops
+}
+
+// Liveness returns the live signals at the block boundaries of proc.
+func (a *Analyses) Liveness(proc *ir.Process) *ir.Liveness {
+	cached := a.entry(proc)
+	if cached.liveness == nil {
+		cached.liveness = ir.ComputeLiveness(proc)
+	}
+	return cached.liveness
+}
+
+// Invalidate drops every cached analysis of procs.
+func (a *Analyses) Invalidate(procs ...*ir.Process) {
+	for _, proc := range procs {
+		delete(a.procs, proc)
+	}
+}
+
+// InvalidateAll empties the cache.
+func (a *Analyses) InvalidateAll() {
+	clear(a.procs)
+}
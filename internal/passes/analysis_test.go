@@ -0,0 +1,85 @@
+package passes
+
+import (
+	"testing"
+
+	"mygo/internal/ir"
+)
+
+// domProbe records the dominator tree the cache hands out for the first
+// process and changes nothing.
+type domProbe struct {
+	analyses *Analyses
+	seen     []*ir.DomTree
+}
+
+func (p *domProbe) Name() string { return "dom-probe" }
+
+func (p *domProbe) UseAnalyses(a *Analyses) { p.analyses = a }
+
+func (p *domProbe) Changed() []*ir.Process { return nil }
+
+func (p *domProbe) Run(design *ir.Design) error {
+	p.seen = append(p.seen, p.analyses.Dominators(design.TopLevel.Processes[0]))
+	return nil
+}
+
+func TestManagerCachesAnalysesUntilChanged(t *testing.T) {
+	design, _ := shortCircuitProcess(nil)
+	probe := &domProbe{}
+	mgr := NewManager()
+	mgr.Add(probe)
+	mgr.Add(NewWidthInference(nil))
+	mgr.Add(probe)
+	mgr.Add(NewIfConversion())
+	mgr.Add(probe)
+	if err := mgr.Run(design); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(probe.seen) != 3 {
+		t.Fatalf("expected the probe to run 3 times, got %d", len(probe.seen))
+	}
+	if probe.seen[0] != probe.seen[1] {
+		t.Fatalf("expected width inference to keep the cached dominator tree")
+	}
+	if probe.seen[1] == probe.seen[2] {
+		t.Fatalf("expected if-conversion to invalidate the process it changed")
+	}
+	proc := design.TopLevel.Processes[0]
+	if got := len(probe.seen[2].Order()); got != len(proc.Blocks) {
+		t.Fatalf("expected the new tree to cover %d blocks, got %d", len(proc.Blocks), got)
+	}
+}
+
+func TestFoldAndDCEReadUseDefFromTheCache(t *testing.T) {
+	u8 := &ir.SignalType{Width: 8}
+	one := constSignal("const_0", u8, uint64(1))
+	sum := &ir.Signal{Name: "sum", Type: u8}
+	ops := []ir.Operation{
+		&ir.BinOperation{Op: ir.Add, Dest: sum, Left: one, Right: one},
+		&ir.PrintOperation{Segments: []ir.PrintSegment{{Value: sum, Verb: ir.PrintVerbDec}}},
+	}
+	design := buildTestDesign(ops, one, sum)
+	proc := design.TopLevel.Processes[0]
+	proc.Blocks[0].Terminator = &ir.ReturnTerminator{}
+	var _ AnalysisUser = NewConstFold()
+	var _ AnalysisUser = NewDCE()
+	mgr := NewManager()
+	mgr.Add(NewConstFold())
+	mgr.Add(NewDCE())
+	if err := mgr.Run(design); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if sum.Kind != ir.Const {
+		t.Fatalf("expected sum to fold, got kind %v", sum.Kind)
+	}
+	// Folding changed the process, so DCE computed fresh chains, and as it
+	// removed nothing they are still cached.
+	cached := mgr.Analyses().procs[proc]
+	if cached == nil || cached.useDef == nil {
+		t.Fatalf("expected DCE to leave its def-use chains in the manager's cache")
+	}
+	if defs := cached.useDef.Defs(sum); len(defs) != 0 {
+		t.Fatalf("expected the cached chains to describe the folded process, got %d defs of sum", len(defs))
+	}
+}
@@ -0,0 +1,480 @@
+package passes
+
+import (
+	"fmt"
+	"slices"
+
+	"mygo/internal/ir"
+)
+
+// ConstFold evaluates integer operations whose inputs are constants and
+// simplifies the ones that an identity such as x & 0, x | 0 or x << 0 makes
+// trivial. A folded wire becomes a constant of the same name; a wire equal
+// to one of its operands is replaced by that operand. Branches on a constant
+// become jumps, which leaves the untaken side for dead code elimination.
+//
+// Values are computed at the width and signedness of their SignalType, so
+// the pass runs after width inference. Float signals are left alone, as are
+// wires that another process reads.
+type ConstFold struct {
+	analyses *Analyses
+	changed  []*ir.Process
+}
+
+// NewConstFold constructs the pass.
+func NewConstFold() *ConstFold {
+	return &ConstFold{}
+}
+
+// Name implements the Pass interface.
+func (f *ConstFold) Name() string {
+	return "const-fold"
+}
+
+// UseAnalyses implements AnalysisUser.
+func (f *ConstFold) UseAnalyses(a *Analyses) {
+	f.analyses = a
+}
+
+// Changed implements ChangeReporter.
+func (f *ConstFold) Changed() []*ir.Process {
+	return f.changed
+}
+
+// Run folds every hardware process in the design until nothing changes.
+func (f *ConstFold) Run(design *ir.Design) error {
+	if design == nil {
+		return fmt.Errorf("const-fold requires a non-nil design")
+	}
+	f.changed = nil
+	analyses := analysesOrNew(f.analyses)
+	owners := signalOwners(design, analyses)
+	for _, module := range design.Modules {
+		if module == nil {
+			continue
+		}
+		for _, proc := range module.Processes {
+			if proc == nil || proc.Software != nil {
+				continue
+			}
+			folder := &procFolder{module: module, proc: proc, owners: owners, analyses: analyses}
+			changed := false
+			for folder.foldOnce() {
+				// The sweep read the def-use chains it just changed.
+				analyses.Invalidate(proc)
+				changed = true
+			}
+			if changed {
+				f.changed = append(f.changed, proc)
+			}
+		}
+	}
+	return nil
+}
+
+// signalOwners maps each signal the processes of design touch to the process
+// that touches it, or to nil when several do. It reads the def-use chains of
+// every process from analyses.
+func signalOwners(design *ir.Design, analyses *Analyses) map[*ir.Signal]*ir.Process {
+	owners := make(map[*ir.Signal]*ir.Process)
+	for _, module := range design.Modules {
+		if module == nil {
+			continue
+		}
+		for _, proc := range module.Processes {
+			if proc == nil {
+				continue
+			}
+			for _, sig := range analyses.UseDef(proc).Signals() {
+				if owner, ok := owners[sig]; ok && owner != proc {
+					owners[sig] = nil
+					continue
+				}
+				owners[sig] = proc
+			}
+		}
+	}
+	return owners
+}
+
+// procFolder folds the ops of one process.
+type procFolder struct {
+	module   *ir.Module
+	proc     *ir.Process
+	owners   map[*ir.Signal]*ir.Process
+	analyses *Analyses
+}
+
+// foldResult is what an op simplifies to: a constant, another signal, or
+// nothing when it stays as it is.
+type foldResult struct {
+	folded bool
+	value  uint64
+	alias  *ir.Signal
+}
+
+func constResult(value uint64) foldResult {
+	return foldResult{folded: true, value: value}
+}
+
+func aliasResult(sig *ir.Signal) foldResult {
+	return foldResult{alias: sig}
+}
+
+// foldOnce makes one sweep over the process and reports whether it changed
+// anything. Only signals with a single driver at the start of the sweep are
+// folded.
+func (pf *procFolder) foldOnce() bool {
+	ud := pf.analyses.UseDef(pf.proc)
+	changed := false
+	for _, block := range pf.proc.Blocks {
+		kept := block.Ops[:0]
+		for _, op := range block.Ops {
+			dest := ir.OperationDest(op)
+			if dest == nil || len(ud.Defs(dest)) != 1 || !pf.foldable(dest) {
+				kept = append(kept, op)
+				continue
+			}
+			res := evalOperation(op)
+			switch {
+			case res.folded:
+				dest.Kind = ir.Const
+				dest.Value = constValue(dest.Type, res.value)
+				changed = true
+				continue
+			case res.alias != nil && res.alias != dest && sameWidth(res.alias, dest):
+				if res.alias.Kind == ir.Const || res.alias.Kind == ir.Wire {
+					// Wires hold one value each, so readers can take the
+					// operand directly.
+					pf.replaceUses(dest, res.alias)
+					if pf.module.Signals[dest.Name] == dest {
+						delete(pf.module.Signals, dest.Name)
+					}
+					changed = true
+					continue
+				}
+				// A register may change before dest is read, so keep a copy.
+				if conv, ok := op.(*ir.ConvertOperation); !ok || conv.Value != res.alias {
+					op = &ir.ConvertOperation{Dest: dest, Value: res.alias}
+					changed = true
+				}
+			}
+			kept = append(kept, op)
+		}
+		block.Ops = kept
+		if foldBranch(block) {
+			changed = true
+		}
+	}
+	return changed
+}
+
+// foldable reports whether dest is a wire of known integer width that only
+// this process touches and that no result port reads.
+func (pf *procFolder) foldable(dest *ir.Signal) bool {
+	if dest.Kind != ir.Wire || pf.owners[dest] != pf.proc || slices.Contains(pf.proc.Results, dest) {
+		return false
+	}
+	_, ok := intWidth(dest)
+	return ok
+}
+
+// replaceUses makes every reader of from in the process read to instead.
+func (pf *procFolder) replaceUses(from, to *ir.Signal) {
+	for _, block := range pf.proc.Blocks {
+		for _, op := range block.Ops {
+			ir.ReplaceOperands(op, from, to)
+		}
+		if br, ok := block.Terminator.(*ir.BranchTerminator); ok && br.Cond == from {
+			br.Cond = to
+		}
+	}
+	if owner, ok := pf.owners[to]; ok && owner != pf.proc {
+		pf.owners[to] = nil
+	} else {
+		pf.owners[to] = pf.proc
+	}
+}
+
+// foldBranch turns a branch on a constant into a jump to the side it takes
+// and unlinks block from the other side.
+func foldBranch(block *ir.BasicBlock) bool {
+	br, ok := block.Terminator.(*ir.BranchTerminator)
+	if !ok {
+		return false
+	}
+	cond, ok := constBits(br.Cond)
+	if !ok {
+		return false
+	}
+	taken, other := br.True, br.False
+	if cond == 0 {
+		taken, other = other, taken
+	}
+	block.Terminator = &ir.JumpTerminator{Target: taken}
+	block.Successors = []*ir.BasicBlock{taken}
+	// A branch whose arms agree still takes the edge it names, so the
+	// target keeps its predecessor and phi incomings.
+	if other == nil || other == taken {
+		return true
+	}
+	for idx, pred := range other.Predecessors {
+		if pred == block {
+			other.Predecessors = append(other.Predecessors[:idx], other.Predecessors[idx+1:]...)
+			break
+		}
+	}
+	for _, op := range other.Ops {
+		phi, ok := op.(*ir.PhiOperation)
+		if !ok {
+			continue
+		}
+		for idx, in := range phi.Incomings {
+			if in.Block == block {
+				phi.Incomings = append(phi.Incomings[:idx], phi.Incomings[idx+1:]...)
+				break
+			}
+		}
+	}
+	return true
+}
+
+// evalOperation folds op when its inputs allow it.
+func evalOperation(op ir.Operation) foldResult {
+	switch o := op.(type) {
+	case *ir.BinOperation:
+		return evalBinary(o)
+	case *ir.CompareOperation:
+		left, lok := constBits(o.Left)
+		right, rok := constBits(o.Right)
+		if !lok || !rok || !sameWidth(o.Left, o.Right) {
+			return foldResult{}
+		}
+		width, _ := intWidth(o.Left)
+		if evalCompare(o.Predicate, left, right, width) {
+			return constResult(1)
+		}
+		return constResult(0)
+	case *ir.ConvertOperation:
+		value, ok := constBits(o.Value)
+		destWidth, dok := intWidth(o.Dest)
+		if !ok || !dok {
+			return foldResult{}
+		}
+		width, _ := intWidth(o.Value)
+		if o.Value.Type.Signed {
+			value = uint64(signExtend(value, width))
+		}
+		return constResult(value & widthMask(destWidth))
+	case *ir.NotOperation:
+		value, ok := constBits(o.Value)
+		if !ok || !sameWidth(o.Value, o.Dest) {
+			return foldResult{}
+		}
+		width, _ := intWidth(o.Dest)
+		return constResult(^value & widthMask(width))
+	case *ir.MuxOperation:
+		if cond, ok := constBits(o.Cond); ok {
+			if cond != 0 {
+				return aliasResult(o.TrueValue)
+			}
+			return aliasResult(o.FalseValue)
+		}
+		if o.TrueValue == o.FalseValue {
+			return aliasResult(o.TrueValue)
+		}
+	}
+	return foldResult{}
+}
+
+// evalBinary folds a binary op with constant operands, or one that an
+// identity reduces to a constant or to one of its operands.
+func evalBinary(o *ir.BinOperation) foldResult {
+	width, ok := intWidth(o.Dest)
+	if !ok || !sameWidth(o.Left, o.Dest) {
+		return foldResult{}
+	}
+	shift := o.Op == ir.Shl || o.Op == ir.ShrU || o.Op == ir.ShrS
+	if !shift && !sameWidth(o.Right, o.Dest) {
+		return foldResult{}
+	}
+	mask := widthMask(width)
+	left, lok := constBits(o.Left)
+	right, rok := constBits(o.Right)
+	if lok && rok {
+		return constResult(evalBinOp(o.Op, left, right, width) & mask)
+	}
+
+	if o.Left == o.Right {
+		switch o.Op {
+		case ir.And, ir.Or:
+			return aliasResult(o.Left)
+		case ir.Xor, ir.Sub:
+			return constResult(0)
+		}
+	}
+	if shift {
+		switch {
+		case rok && right == 0:
+			return aliasResult(o.Left)
+		case lok && left == 0:
+			return constResult(0)
+		}
+		return foldResult{}
+	}
+	// Every other op folds the same way whichever side is constant, except
+	// that x - 0 is x but 0 - x is not.
+	value, other := right, o.Left
+	if !rok {
+		if !lok {
+			return foldResult{}
+		}
+		value, other = left, o.Right
+	}
+	switch o.Op {
+	case ir.Add, ir.Or, ir.Xor:
+		if value == 0 {
+			return aliasResult(other)
+		}
+		if o.Op == ir.Or && value == mask {
+			return constResult(mask)
+		}
+	case ir.Sub:
+		if rok && right == 0 {
+			return aliasResult(o.Left)
+		}
+	case ir.And:
+		if value == 0 {
+			return constResult(0)
+		}
+		if value == mask {
+			return aliasResult(other)
+		}
+	case ir.Mul:
+		if value == 0 {
+			return constResult(0)
+		}
+		if value == 1 {
+			return aliasResult(other)
+		}
+	}
+	return foldResult{}
+}
+
+// evalBinOp computes op on width-bit operands. Shifts by width or more give
+// zero, or the sign for an arithmetic right shift, as comb's shifts do.
+func evalBinOp(op ir.BinOp, left, right uint64, width int) uint64 {
+	switch op {
+	case ir.Add:
+		return left + right
+	case ir.Sub:
+		return left - right
+	case ir.Mul:
+		return left * right
+	case ir.And:
+		return left & right
+	case ir.Or:
+		return left | right
+	case ir.Xor:
+		return left ^ right
+	case ir.Shl:
+		if right >= uint64(width) {
+			return 0
+		}
+		return left << right
+	case ir.ShrU:
+		if right >= uint64(width) {
+			return 0
+		}
+		return left >> right
+	case ir.ShrS:
+		if right >= uint64(width) {
+			right = uint64(width - 1)
+		}
+		return uint64(signExtend(left, width) >> right)
+	}
+	return 0
+}
+
+// evalCompare applies pred to width-bit operands. The predicate, not the
+// operand type, decides whether they are signed.
+func evalCompare(pred ir.ComparePredicate, left, right uint64, width int) bool {
+	sl, sr := signExtend(left, width), signExtend(right, width)
+	switch pred {
+	case ir.CompareEQ:
+		return left == right
+	case ir.CompareNE:
+		return left != right
+	case ir.CompareSLT:
+		return sl < sr
+	case ir.CompareSLE:
+		return sl <= sr
+	case ir.CompareSGT:
+		return sl > sr
+	case ir.CompareSGE:
+		return sl >= sr
+	case ir.CompareULT:
+		return left < right
+	case ir.CompareULE:
+		return left <= right
+	case ir.CompareUGT:
+		return left > right
+	case ir.CompareUGE:
+		return left >= right
+	}
+	return false
+}
+
+// intWidth returns the width of an integer signal of at most 64 bits.
+func intWidth(sig *ir.Signal) (int, bool) {
+	if sig == nil || sig.Type == nil || sig.Type.Float {
+		return 0, false
+	}
+	if sig.Type.Width <= 0 || sig.Type.Width > 64 {
+		return 0, false
+	}
+	return sig.Type.Width, true
+}
+
+func sameWidth(a, b *ir.Signal) bool {
+	wa, aok := intWidth(a)
+	wb, bok := intWidth(b)
+	return aok && bok && wa == wb
+}
+
+// constBits returns the bit pattern of a constant integer signal.
+func constBits(sig *ir.Signal) (uint64, bool) {
+	width, ok := intWidth(sig)
+	if !ok || sig.Kind != ir.Const {
+		return 0, false
+	}
+	value, ok := ir.IntValue(sig.Value)
+	if !ok {
+		return 0, false
+	}
+	return uint64(value) & widthMask(width), true
+}
+
+// constValue stores bits the way the builder stores a Go constant of type
+// t: a bool for one unsigned bit, otherwise an int64 or a uint64.
+func constValue(t *ir.SignalType, bits uint64) interface{} {
+	switch {
+	case t.Signed:
+		return signExtend(bits, t.Width)
+	case t.Width == 1:
+		return bits != 0
+	}
+	return bits
+}
+
+func widthMask(width int) uint64 {
+	if width >= 64 {
+		return ^uint64(0)
+	}
+	return 1<<uint(width) - 1
+}
+
+func signExtend(bits uint64, width int) int64 {
+	shift := uint(64 - width)
+	return int64(bits<<shift) >> shift
+}
@@ -0,0 +1,183 @@
+package passes
+
+import (
+	"bytes"
+	"testing"
+
+	"mygo/internal/diag"
+	"mygo/internal/ir"
+)
+
+func constSignal(name string, typ *ir.SignalType, value interface{}) *ir.Signal {
+	return &ir.Signal{Name: name, Type: typ, Kind: ir.Const, Value: value}
+}
+
+func TestConstFoldRespectsWidthAndSign(t *testing.T) {
+	s8 := &ir.SignalType{Width: 8, Signed: true}
+	u8 := &ir.SignalType{Width: 8}
+	s16 := &ir.SignalType{Width: 16, Signed: true}
+	bit := &ir.SignalType{Width: 1}
+
+	hundred := constSignal("const_0", s8, int64(100))
+	two := constSignal("const_1", s8, int64(2))
+	big := constSignal("const_2", u8, uint64(200))
+	ninety := constSignal("const_3", u8, uint64(90))
+	sum := &ir.Signal{Name: "sum", Type: s8}
+	less := &ir.Signal{Name: "less", Type: bit}
+	wide := &ir.Signal{Name: "wide", Type: s16}
+	shifted := &ir.Signal{Name: "shifted", Type: s8}
+	wrapped := &ir.Signal{Name: "wrapped", Type: u8}
+	flipped := &ir.Signal{Name: "flipped", Type: u8}
+
+	ops := []ir.Operation{
+		&ir.BinOperation{Op: ir.Add, Dest: sum, Left: hundred, Right: hundred},
+		&ir.CompareOperation{Predicate: ir.CompareSLT, Dest: less, Left: sum, Right: two},
+		&ir.ConvertOperation{Dest: wide, Value: sum},
+		&ir.BinOperation{Op: ir.ShrS, Dest: shifted, Left: sum, Right: two},
+		&ir.BinOperation{Op: ir.Add, Dest: wrapped, Left: big, Right: ninety},
+		&ir.NotOperation{Dest: flipped, Value: big},
+	}
+	design := buildTestDesign(ops, hundred, two, big, ninety, sum, less, wide, shifted, wrapped, flipped)
+	design.TopLevel.Processes[0].Blocks[0].Terminator = &ir.ReturnTerminator{}
+	if err := NewConstFold().Run(design); err != nil {
+		t.Fatalf("const-fold failed: %v", err)
+	}
+	if left := design.TopLevel.Processes[0].Blocks[0].Ops; len(left) != 0 {
+		t.Fatalf("expected every op to fold, %d left", len(left))
+	}
+	want := map[*ir.Signal]interface{}{
+		sum:     int64(-56),
+		less:    true,
+		wide:    int64(-56),
+		shifted: int64(-14),
+		wrapped: uint64(34),
+		flipped: uint64(55),
+	}
+	for sig, value := range want {
+		if sig.Kind != ir.Const || sig.Value != value {
+			t.Errorf("%s: got kind %v value %v, want const %v", sig.Name, sig.Kind, sig.Value, value)
+		}
+	}
+}
+
+func TestConstFoldSimplifiesIdentities(t *testing.T) {
+	u8 := &ir.SignalType{Width: 8}
+	bit := &ir.SignalType{Width: 1}
+	zero := constSignal("const_0", u8, uint64(0))
+	yes := constSignal("const_1", bit, true)
+	x := &ir.Signal{Name: "x", Type: u8}
+	counter := &ir.Signal{Name: "counter", Type: u8, Kind: ir.Reg}
+	other := &ir.Signal{Name: "other", Type: u8}
+	masked := &ir.Signal{Name: "masked", Type: u8}
+	ored := &ir.Signal{Name: "ored", Type: u8}
+	shifted := &ir.Signal{Name: "shifted", Type: u8}
+	picked := &ir.Signal{Name: "picked", Type: u8}
+	out := &ir.Signal{Name: "out", Type: u8, Kind: ir.Reg}
+
+	ops := []ir.Operation{
+		&ir.BinOperation{Op: ir.And, Dest: masked, Left: x, Right: zero},
+		&ir.BinOperation{Op: ir.Or, Dest: ored, Left: x, Right: zero},
+		&ir.BinOperation{Op: ir.Shl, Dest: shifted, Left: counter, Right: zero},
+		&ir.MuxOperation{Dest: picked, Cond: yes, TrueValue: ored, FalseValue: other},
+		&ir.AssignOperation{Dest: out, Value: picked},
+	}
+	design := buildTestDesign(ops, zero, yes, x, counter, other, masked, ored, shifted, picked, out)
+	design.TopLevel.Processes[0].Blocks[0].Terminator = &ir.ReturnTerminator{}
+	if err := NewConstFold().Run(design); err != nil {
+		t.Fatalf("const-fold failed: %v", err)
+	}
+	if masked.Kind != ir.Const || masked.Value != uint64(0) {
+		t.Errorf("x & 0 did not fold to 0: kind %v value %v", masked.Kind, masked.Value)
+	}
+	left := design.TopLevel.Processes[0].Blocks[0].Ops
+	if len(left) != 2 {
+		t.Fatalf("expected the shift copy and the store to remain, got %d ops", len(left))
+	}
+	if conv, ok := left[0].(*ir.ConvertOperation); !ok || conv.Dest != shifted || conv.Value != counter {
+		t.Errorf("register << 0 should become a copy, got %#v", left[0])
+	}
+	if assign, ok := left[1].(*ir.AssignOperation); !ok || assign.Value != x {
+		t.Errorf("store should read x directly, got %#v", left[1])
+	}
+	for _, name := range []string{"ored", "picked"} {
+		if design.TopLevel.Signals[name] != nil {
+			t.Errorf("replaced wire %s is still declared", name)
+		}
+	}
+}
+
+func TestConstFoldFoldsConstantBranches(t *testing.T) {
+	u8 := &ir.SignalType{Width: 8}
+	bit := &ir.SignalType{Width: 1}
+	one := constSignal("const_0", u8, uint64(1))
+	two := constSignal("const_1", u8, uint64(2))
+	cond := &ir.Signal{Name: "cond", Type: bit}
+	v := &ir.Signal{Name: "v", Type: u8}
+
+	entry := &ir.BasicBlock{Label: "entry"}
+	then := &ir.BasicBlock{Label: "if.then"}
+	done := &ir.BasicBlock{Label: "if.done"}
+	entry.Ops = []ir.Operation{&ir.CompareOperation{Predicate: ir.CompareUGT, Dest: cond, Left: one, Right: two}}
+	entry.Terminator = &ir.BranchTerminator{Cond: cond, True: then, False: done}
+	entry.Successors = []*ir.BasicBlock{then, done}
+	then.Terminator = &ir.JumpTerminator{Target: done}
+	then.Predecessors = []*ir.BasicBlock{entry}
+	then.Successors = []*ir.BasicBlock{done}
+	done.Ops = []ir.Operation{&ir.PhiOperation{Dest: v, Incomings: []ir.PhiIncoming{
+		{Block: then, Value: one},
+		{Block: entry, Value: two},
+	}}}
+	done.Terminator = &ir.ReturnTerminator{}
+	done.Predecessors = []*ir.BasicBlock{then, entry}
+
+	design := buildTestDesign(nil, one, two, cond, v)
+	design.TopLevel.Processes[0].Blocks = []*ir.BasicBlock{entry, then, done}
+	if err := NewConstFold().Run(design); err != nil {
+		t.Fatalf("const-fold failed: %v", err)
+	}
+	jump, ok := entry.Terminator.(*ir.JumpTerminator)
+	if !ok || jump.Target != done {
+		t.Fatalf("expected entry to jump to if.done, got %#v", entry.Terminator)
+	}
+	if len(entry.Successors) != 1 || len(then.Predecessors) != 0 {
+		t.Fatalf("untaken edge left behind: successors %d, then predecessors %d", len(entry.Successors), len(then.Predecessors))
+	}
+	phi := done.Ops[0].(*ir.PhiOperation)
+	if len(phi.Incomings) != 2 {
+		t.Fatalf("taken edge should keep both incomings, got %d", len(phi.Incomings))
+	}
+}
+
+func TestConstFoldKeepsEdgeOfBranchWithEqualArms(t *testing.T) {
+	u8 := &ir.SignalType{Width: 8}
+	bit := &ir.SignalType{Width: 1}
+	zero := constSignal("const_0", u8, uint64(0))
+	yes := constSignal("const_1", bit, true)
+	v := &ir.Signal{Name: "v", Type: u8}
+
+	entry := &ir.BasicBlock{Label: "entry"}
+	next := &ir.BasicBlock{Label: "next"}
+	entry.Terminator = &ir.BranchTerminator{Cond: yes, True: next, False: next}
+	entry.Successors = []*ir.BasicBlock{next, next}
+	next.Ops = []ir.Operation{&ir.PhiOperation{Dest: v, Incomings: []ir.PhiIncoming{
+		{Block: entry, Value: zero},
+	}}}
+	next.Terminator = &ir.ReturnTerminator{}
+	next.Predecessors = []*ir.BasicBlock{entry}
+
+	design := buildTestDesign(nil, zero, yes, v)
+	design.TopLevel.Processes[0].Blocks = []*ir.BasicBlock{entry, next}
+	if err := NewConstFold().Run(design); err != nil {
+		t.Fatalf("const-fold failed: %v", err)
+	}
+	if jump, ok := entry.Terminator.(*ir.JumpTerminator); !ok || jump.Target != next {
+		t.Fatalf("expected entry to jump to next, got %#v", entry.Terminator)
+	}
+	if len(entry.Successors) != 1 || len(next.Predecessors) != 1 || next.Predecessors[0] != entry {
+		t.Fatalf("taken edge unlinked: successors %d, next predecessors %v", len(entry.Successors), next.Predecessors)
+	}
+	var out bytes.Buffer
+	if err := ir.Verify(design, diag.NewReporter(&out, "text"), ir.VerifyOptions{}); err != nil {
+		t.Fatalf("malformed IR after folding: %v\n%s", err, out.String())
+	}
+}
@@ -0,0 +1,242 @@
+package passes
+
+import (
+	"fmt"
+	"slices"
+
+	"mygo/internal/ir"
+)
+
+// DCE removes what cannot affect the design's behaviour: blocks the entry
+// cannot reach, operations whose results never reach a send, print,
+// assertion, spawn, branch, shared register or result port, and the signals
+// that no operation references any more.
+//
+// A store to a register is live only while something live reads the
+// register. Stores to shared registers and component fields, and values
+// another process reads, are always kept.
+type DCE struct {
+	analyses *Analyses
+	changed  []*ir.Process
+}
+
+// NewDCE constructs the pass.
+func NewDCE() *DCE {
+	return &DCE{}
+}
+
+// Name implements the Pass interface.
+func (d *DCE) Name() string {
+	return "dce"
+}
+
+// UseAnalyses implements AnalysisUser.
+func (d *DCE) UseAnalyses(a *Analyses) {
+	d.analyses = a
+}
+
+// Changed implements ChangeReporter.
+func (d *DCE) Changed() []*ir.Process {
+	return d.changed
+}
+
+// Run cleans every hardware process, then drops the signals left unused.
+func (d *DCE) Run(design *ir.Design) error {
+	if design == nil {
+		return fmt.Errorf("dce requires a non-nil design")
+	}
+	d.changed = nil
+	analyses := analysesOrNew(d.analyses)
+	owners := signalOwners(design, analyses)
+	fields := make(map[*ir.Signal]bool)
+	for _, module := range design.Modules {
+		if module == nil {
+			continue
+		}
+		for _, comp := range module.Components {
+			for _, field := range comp.Fields {
+				fields[field] = true
+			}
+		}
+	}
+	for _, module := range design.Modules {
+		if module == nil {
+			continue
+		}
+		for _, proc := range module.Processes {
+			if proc == nil || proc.Software != nil || len(proc.Blocks) == 0 {
+				continue
+			}
+			unreachable := removeUnreachable(proc)
+			if unreachable {
+				analyses.Invalidate(proc)
+			}
+			dead := removeDeadOps(proc, analyses.UseDef(proc), owners, fields)
+			if unreachable || dead {
+				d.changed = append(d.changed, proc)
+			}
+		}
+	}
+	removeUnusedSignals(design, fields)
+	return nil
+}
+
+// removeUnreachable drops the blocks the entry block cannot reach and the
+// edges and phi incomings they leave behind.
+func removeUnreachable(proc *ir.Process) bool {
+	reached := map[*ir.BasicBlock]bool{proc.Blocks[0]: true}
+	work := []*ir.BasicBlock{proc.Blocks[0]}
+	for len(work) > 0 {
+		block := work[len(work)-1]
+		work = work[:len(work)-1]
+		for _, succ := range block.Successors {
+			if !reached[succ] {
+				reached[succ] = true
+				work = append(work, succ)
+			}
+		}
+	}
+	if len(reached) == len(proc.Blocks) {
+		return false
+	}
+	kept := proc.Blocks[:0]
+	for _, block := range proc.Blocks {
+		if !reached[block] {
+			continue
+		}
+		kept = append(kept, block)
+		preds := block.Predecessors[:0]
+		for _, pred := range block.Predecessors {
+			if reached[pred] {
+				preds = append(preds, pred)
+			}
+		}
+		block.Predecessors = preds
+		for _, op := range block.Ops {
+			phi, ok := op.(*ir.PhiOperation)
+			if !ok {
+				continue
+			}
+			incomings := phi.Incomings[:0]
+			for _, in := range phi.Incomings {
+				if reached[in.Block] {
+					incomings = append(incomings, in)
+				}
+			}
+			phi.Incomings = incomings
+		}
+	}
+	proc.Blocks = kept
+	return true
+}
+
+// removeDeadOps marks the operations that lead to an effect, starting from
+// the effects and branch conditions and walking back through the drivers ud
+// lists for each operand, and drops the rest.
+func removeDeadOps(proc *ir.Process, ud *ir.UseDef, owners map[*ir.Signal]*ir.Process, fields map[*ir.Signal]bool) bool {
+	live := make(map[ir.Operation]bool)
+	liveSignals := make(map[*ir.Signal]bool)
+	var work []*ir.Signal
+	markSignal := func(sig *ir.Signal) {
+		if sig != nil && !liveSignals[sig] {
+			liveSignals[sig] = true
+			work = append(work, sig)
+		}
+	}
+	var roots []ir.Operation
+	for _, block := range proc.Blocks {
+		for _, op := range block.Ops {
+			if hasEffect(op, proc, owners, fields) {
+				roots = append(roots, op)
+			}
+		}
+		if br, ok := block.Terminator.(*ir.BranchTerminator); ok {
+			markSignal(br.Cond)
+		}
+	}
+	markOp := func(op ir.Operation) {
+		if live[op] {
+			return
+		}
+		live[op] = true
+		for _, sig := range ir.OperationOperands(op) {
+			markSignal(sig)
+		}
+	}
+	for _, op := range roots {
+		markOp(op)
+	}
+	for len(work) > 0 {
+		sig := work[len(work)-1]
+		work = work[:len(work)-1]
+		for _, def := range ud.Defs(sig) {
+			markOp(def.Op)
+		}
+	}
+
+	changed := false
+	for _, block := range proc.Blocks {
+		kept := block.Ops[:0]
+		for _, op := range block.Ops {
+			if live[op] {
+				kept = append(kept, op)
+				continue
+			}
+			changed = true
+		}
+		block.Ops = kept
+	}
+	return changed
+}
+
+// hasEffect reports whether op matters beyond the value it drives: it talks
+// to a channel, mutex, wait group, child process or the simulator, or drives
+// a signal that outlives the process or leaves it through a result port.
+func hasEffect(op ir.Operation, proc *ir.Process, owners map[*ir.Signal]*ir.Process, fields map[*ir.Signal]bool) bool {
+	switch op.(type) {
+	case *ir.BinOperation, *ir.CompareOperation, *ir.ConvertOperation,
+		*ir.NotOperation, *ir.MuxOperation, *ir.PhiOperation,
+		*ir.FloatOperation, *ir.LenOperation, *ir.AssignOperation:
+	default:
+		return true
+	}
+	dest := ir.OperationDest(op)
+	return dest.Kind == ir.Shared || fields[dest] || owners[dest] != proc || slices.Contains(proc.Results, dest)
+}
+
+// removeUnusedSignals drops the constants, wires and registers no operation
+// or branch of the design references. Params, results, shared registers and
+// component fields stay.
+func removeUnusedSignals(design *ir.Design, fields map[*ir.Signal]bool) {
+	used := make(map[*ir.Signal]bool)
+	for _, proc := range design.Processes() {
+		for _, param := range proc.Params {
+			used[param] = true
+		}
+		for _, result := range proc.Results {
+			used[result] = true
+		}
+		for _, block := range proc.Blocks {
+			for _, op := range block.Ops {
+				used[ir.OperationDest(op)] = true
+				for _, sig := range ir.OperationOperands(op) {
+					used[sig] = true
+				}
+			}
+			if br, ok := block.Terminator.(*ir.BranchTerminator); ok {
+				used[br.Cond] = true
+			}
+		}
+	}
+	for _, module := range design.Modules {
+		if module == nil {
+			continue
+		}
+		for name, sig := range module.Signals {
+			if used[sig] || sig.Kind == ir.Shared || fields[sig] {
+				continue
+			}
+			delete(module.Signals, name)
+		}
+	}
+}
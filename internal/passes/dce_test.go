@@ -0,0 +1,102 @@
+package passes
+
+import (
+	"testing"
+
+	"mygo/internal/ir"
+)
+
+func TestDCERemovesDeadOpsAndSignals(t *testing.T) {
+	u8 := &ir.SignalType{Width: 8}
+	one := constSignal("const_0", u8, uint64(1))
+	unused := constSignal("const_1", u8, uint64(7))
+	x := &ir.Signal{Name: "x", Type: u8}
+	kept := &ir.Signal{Name: "kept", Type: u8}
+	acc := &ir.Signal{Name: "acc", Type: u8, Kind: ir.Reg}
+	scratch := &ir.Signal{Name: "scratch", Type: u8, Kind: ir.Reg}
+	dead := &ir.Signal{Name: "dead", Type: u8}
+	deader := &ir.Signal{Name: "deader", Type: u8}
+	shared := &ir.Signal{Name: "shared", Type: u8, Kind: ir.Shared}
+
+	ops := []ir.Operation{
+		&ir.BinOperation{Op: ir.Add, Dest: kept, Left: x, Right: one},
+		&ir.AssignOperation{Dest: acc, Value: kept},
+		&ir.BinOperation{Op: ir.Mul, Dest: dead, Left: x, Right: x},
+		&ir.BinOperation{Op: ir.Add, Dest: deader, Left: dead, Right: one},
+		&ir.AssignOperation{Dest: scratch, Value: deader},
+		&ir.AssignOperation{Dest: shared, Value: x},
+		&ir.PrintOperation{Segments: []ir.PrintSegment{{Value: acc}}},
+	}
+	design := buildTestDesign(ops, one, unused, x, kept, acc, scratch, dead, deader, shared)
+	design.TopLevel.Processes[0].Blocks[0].Terminator = &ir.ReturnTerminator{}
+	if err := NewDCE().Run(design); err != nil {
+		t.Fatalf("dce failed: %v", err)
+	}
+
+	var dests []string
+	for _, op := range design.TopLevel.Processes[0].Blocks[0].Ops {
+		if dest := ir.OperationDest(op); dest != nil {
+			dests = append(dests, dest.Name)
+		}
+	}
+	if got, want := len(dests), 3; got != want {
+		t.Fatalf("expected %d ops with results, got %v", want, dests)
+	}
+	for idx, name := range []string{"kept", "acc", "shared"} {
+		if dests[idx] != name {
+			t.Fatalf("expected %s to survive at %d, got %v", name, idx, dests)
+		}
+	}
+	for _, name := range []string{"const_1", "dead", "deader", "scratch"} {
+		if design.TopLevel.Signals[name] != nil {
+			t.Errorf("unused signal %s is still declared", name)
+		}
+	}
+	if design.TopLevel.Signals["const_0"] == nil {
+		t.Errorf("const_0 is still read but was removed")
+	}
+}
+
+func TestDCERemovesUnreachableBlocks(t *testing.T) {
+	u8 := &ir.SignalType{Width: 8}
+	one := constSignal("const_0", u8, uint64(1))
+	two := constSignal("const_1", u8, uint64(2))
+	v := &ir.Signal{Name: "v", Type: u8}
+
+	entry := &ir.BasicBlock{Label: "entry"}
+	orphan := &ir.BasicBlock{Label: "if.then"}
+	done := &ir.BasicBlock{Label: "if.done"}
+	entry.Terminator = &ir.JumpTerminator{Target: done}
+	entry.Successors = []*ir.BasicBlock{done}
+	orphan.Terminator = &ir.JumpTerminator{Target: done}
+	orphan.Successors = []*ir.BasicBlock{done}
+	done.Ops = []ir.Operation{
+		&ir.PhiOperation{Dest: v, Incomings: []ir.PhiIncoming{
+			{Block: orphan, Value: one},
+			{Block: entry, Value: two},
+		}},
+		&ir.PrintOperation{Segments: []ir.PrintSegment{{Value: v}}},
+	}
+	done.Terminator = &ir.ReturnTerminator{}
+	done.Predecessors = []*ir.BasicBlock{orphan, entry}
+
+	design := buildTestDesign(nil, one, two, v)
+	proc := design.TopLevel.Processes[0]
+	proc.Blocks = []*ir.BasicBlock{entry, orphan, done}
+	if err := NewDCE().Run(design); err != nil {
+		t.Fatalf("dce failed: %v", err)
+	}
+	if len(proc.Blocks) != 2 || proc.Blocks[0] != entry || proc.Blocks[1] != done {
+		t.Fatalf("expected entry and if.done to remain, got %d blocks", len(proc.Blocks))
+	}
+	if len(done.Predecessors) != 1 || done.Predecessors[0] != entry {
+		t.Fatalf("unreachable predecessor left on if.done")
+	}
+	phi := done.Ops[0].(*ir.PhiOperation)
+	if len(phi.Incomings) != 1 || phi.Incomings[0].Block != entry {
+		t.Fatalf("unreachable incoming left on phi: %v", phi.Incomings)
+	}
+	if design.TopLevel.Signals["const_0"] != nil {
+		t.Errorf("const_0 was only read from the unreachable edge but is still declared")
+	}
+}
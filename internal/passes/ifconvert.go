@@ -0,0 +1,345 @@
+package passes
+
+import (
+	"fmt"
+
+	"mygo/internal/ir"
+)
+
+// IfConversion flattens branchy but side-effect free control flow into
+// straight-line muxes. It looks for single-entry, single-exit acyclic regions
+// whose blocks only compute values, computes the predicate under which each
+// block runs, and rewrites the phis that merge the paths into mux chains. The
+// region and its exit block are then folded into the header, so nested ifs,
+// short-circuit && / || chains and one-armed ifs no longer cost FSM states.
+type IfConversion struct {
+	nextTemp int
+	changed  []*ir.Process
+}
+
+// NewIfConversion constructs the pass.
+func NewIfConversion() *IfConversion {
+	return &IfConversion{}
+}
+
+// Name implements the Pass interface.
+func (c *IfConversion) Name() string {
+	return "if-conversion"
+}
+
+// Changed implements ChangeReporter.
+func (c *IfConversion) Changed() []*ir.Process {
+	return c.changed
+}
+
+// Run converts every eligible region in the design.
+func (c *IfConversion) Run(design *ir.Design) error {
+	if design == nil {
+		return fmt.Errorf("if-conversion requires a non-nil design")
+	}
+	c.changed = nil
+	for _, module := range design.Modules {
+		if module == nil {
+			continue
+		}
+		for _, proc := range module.Processes {
+			if proc == nil || proc.Software != nil {
+				continue
+			}
+			if !c.convertOne(module, proc) {
+				continue
+			}
+			c.changed = append(c.changed, proc)
+			for c.convertOne(module, proc) {
+			}
+		}
+	}
+	return nil
+}
+
+// ifRegion is a header, the blocks between it and the exit in topological
+// order, and the exit where every path through them joins again.
+type ifRegion struct {
+	header *ir.BasicBlock
+	blocks []*ir.BasicBlock
+	exit   *ir.BasicBlock
+}
+
+// convertOne flattens the first eligible region of proc and reports whether
+// it found one.
+func (c *IfConversion) convertOne(module *ir.Module, proc *ir.Process) bool {
+	for _, header := range proc.Blocks {
+		br, ok := header.Terminator.(*ir.BranchTerminator)
+		if !ok || br.Cond == nil || br.True == br.False {
+			continue
+		}
+		for _, exit := range proc.Blocks {
+			if exit == header {
+				continue
+			}
+			if region := findIfRegion(header, exit); region != nil {
+				c.flatten(module, proc, region)
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// findIfRegion returns the region from header to exit, or nil when the blocks
+// reached from header before exit do not form an acyclic, side-effect free
+// region that only header enters and only exit leaves.
+func findIfRegion(header, exit *ir.BasicBlock) *ifRegion {
+	inside := make(map[*ir.BasicBlock]bool)
+	var order []*ir.BasicBlock
+	work := append([]*ir.BasicBlock(nil), header.Successors...)
+	for len(work) > 0 {
+		block := work[len(work)-1]
+		work = work[:len(work)-1]
+		if block == exit || inside[block] {
+			continue
+		}
+		if block == header || !convertible(block) {
+			return nil
+		}
+		inside[block] = true
+		order = append(order, block)
+		work = append(work, block.Successors...)
+	}
+	for _, block := range order {
+		for _, pred := range block.Predecessors {
+			if pred != header && !inside[pred] {
+				return nil
+			}
+		}
+	}
+	if len(exit.Predecessors) == 0 {
+		return nil
+	}
+	seen := make(map[*ir.BasicBlock]bool)
+	for _, pred := range exit.Predecessors {
+		if seen[pred] || pred != header && !inside[pred] {
+			return nil
+		}
+		seen[pred] = true
+	}
+	sorted := topoSort(order, inside)
+	if sorted == nil {
+		return nil
+	}
+	return &ifRegion{header: header, blocks: sorted, exit: exit}
+}
+
+// convertible reports whether block may run unconditionally: it must end in
+// a branch or jump and only compute values.
+func convertible(block *ir.BasicBlock) bool {
+	switch block.Terminator.(type) {
+	case *ir.JumpTerminator:
+	case *ir.BranchTerminator:
+		if block.Terminator.(*ir.BranchTerminator).Cond == nil {
+			return false
+		}
+	default:
+		return false
+	}
+	for _, op := range block.Ops {
+		switch op.(type) {
+		case *ir.BinOperation, *ir.CompareOperation, *ir.ConvertOperation,
+			*ir.NotOperation, *ir.MuxOperation, *ir.PhiOperation:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// topoSort orders the region's blocks so each follows its predecessors. It
+// returns nil when the blocks contain a cycle.
+func topoSort(blocks []*ir.BasicBlock, inside map[*ir.BasicBlock]bool) []*ir.BasicBlock {
+	pending := make(map[*ir.BasicBlock]int, len(blocks))
+	for _, block := range blocks {
+		for _, pred := range block.Predecessors {
+			if inside[pred] {
+				pending[block]++
+			}
+		}
+	}
+	var ready, sorted []*ir.BasicBlock
+	for _, block := range blocks {
+		if pending[block] == 0 {
+			ready = append(ready, block)
+		}
+	}
+	for len(ready) > 0 {
+		block := ready[0]
+		ready = ready[1:]
+		sorted = append(sorted, block)
+		for _, succ := range block.Successors {
+			if !inside[succ] {
+				continue
+			}
+			pending[succ]--
+			if pending[succ] == 0 {
+				ready = append(ready, succ)
+			}
+		}
+	}
+	if len(sorted) != len(blocks) {
+		return nil
+	}
+	return sorted
+}
+
+// edgeKey names a control-flow edge.
+type edgeKey struct {
+	from, to *ir.BasicBlock
+}
+
+// flatten folds region into its header. Every block's ops move to the header
+// in topological order; phis become muxes keyed on the predicate of the edge
+// each value arrives on. A nil predicate means the edge is always taken.
+func (c *IfConversion) flatten(module *ir.Module, proc *ir.Process, region *ifRegion) {
+	header := region.header
+	edges := make(map[edgeKey]*ir.Signal)
+	var ops []ir.Operation
+	c.addEdges(module, &ops, header, nil, edges)
+	for _, block := range region.blocks {
+		pred := c.blockPredicate(module, &ops, block, edges)
+		ops = append(ops, c.lowerPhis(module, block, edges)...)
+		ops = append(ops, block.Ops...)
+		c.addEdges(module, &ops, block, pred, edges)
+	}
+	exit := region.exit
+	ops = append(ops, c.lowerPhis(module, exit, edges)...)
+	ops = append(ops, exit.Ops...)
+	header.Ops = append(header.Ops, ops...)
+	header.Terminator = exit.Terminator
+	header.Successors = exit.Successors
+	for _, succ := range exit.Successors {
+		for idx, pred := range succ.Predecessors {
+			if pred == exit {
+				succ.Predecessors[idx] = header
+			}
+		}
+		for _, op := range succ.Ops {
+			if phi, ok := op.(*ir.PhiOperation); ok {
+				for idx := range phi.Incomings {
+					if phi.Incomings[idx].Block == exit {
+						phi.Incomings[idx].Block = header
+					}
+				}
+			}
+		}
+	}
+	removed := map[*ir.BasicBlock]bool{exit: true}
+	for _, block := range region.blocks {
+		removed[block] = true
+	}
+	kept := proc.Blocks[:0]
+	for _, block := range proc.Blocks {
+		if !removed[block] {
+			kept = append(kept, block)
+		}
+	}
+	proc.Blocks = kept
+}
+
+// addEdges records the predicate of each edge leaving block, which runs
+// under pred.
+func (c *IfConversion) addEdges(module *ir.Module, ops *[]ir.Operation, block *ir.BasicBlock, pred *ir.Signal, edges map[edgeKey]*ir.Signal) {
+	switch term := block.Terminator.(type) {
+	case *ir.JumpTerminator:
+		edges[edgeKey{block, term.Target}] = pred
+	case *ir.BranchTerminator:
+		notCond := c.temp(module, term.Cond.Type)
+		*ops = append(*ops, &ir.NotOperation{Dest: notCond, Value: term.Cond})
+		edges[edgeKey{block, term.True}] = c.and(module, ops, pred, term.Cond)
+		edges[edgeKey{block, term.False}] = c.and(module, ops, pred, notCond)
+	}
+}
+
+// blockPredicate ORs the predicates of the edges into block.
+func (c *IfConversion) blockPredicate(module *ir.Module, ops *[]ir.Operation, block *ir.BasicBlock, edges map[edgeKey]*ir.Signal) *ir.Signal {
+	var pred *ir.Signal
+	for idx, from := range block.Predecessors {
+		edge := edges[edgeKey{from, block}]
+		if edge == nil {
+			return nil
+		}
+		if idx == 0 {
+			pred = edge
+			continue
+		}
+		dest := c.temp(module, edge.Type)
+		*ops = append(*ops, &ir.BinOperation{Op: ir.Or, Dest: dest, Left: pred, Right: edge})
+		pred = dest
+	}
+	return pred
+}
+
+// lowerPhis rewrites block's phis as mux chains that pick the value of the
+// incoming edge that was taken, and leaves the other ops in block. The last
+// incoming is the fallback.
+func (c *IfConversion) lowerPhis(module *ir.Module, block *ir.BasicBlock, edges map[edgeKey]*ir.Signal) []ir.Operation {
+	var ops, rest []ir.Operation
+	for _, op := range block.Ops {
+		phi, ok := op.(*ir.PhiOperation)
+		if !ok || len(phi.Incomings) == 0 {
+			rest = append(rest, op)
+			continue
+		}
+		last := len(phi.Incomings) - 1
+		value := phi.Incomings[last].Value
+		for idx := last - 1; idx >= 0; idx-- {
+			in := phi.Incomings[idx]
+			cond := edges[edgeKey{in.Block, block}]
+			if cond == nil {
+				// Taken whenever the block runs.
+				value = in.Value
+				continue
+			}
+			dest := phi.Dest
+			if idx > 0 {
+				dest = c.temp(module, phi.Dest.Type)
+			}
+			ops = append(ops, &ir.MuxOperation{Dest: dest, Cond: cond, TrueValue: in.Value, FalseValue: value})
+			value = dest
+		}
+		if value != phi.Dest {
+			ops = append(ops, &ir.ConvertOperation{Dest: phi.Dest, Value: value})
+		}
+	}
+	block.Ops = rest
+	return ops
+}
+
+// and returns a AND b, where a nil operand is true.
+func (c *IfConversion) and(module *ir.Module, ops *[]ir.Operation, a, b *ir.Signal) *ir.Signal {
+	if a == nil {
+		return b
+	}
+	dest := c.temp(module, b.Type)
+	*ops = append(*ops, &ir.BinOperation{Op: ir.And, Dest: dest, Left: a, Right: b})
+	return dest
+}
+
+// temp adds a fresh wire of type t to module.
+func (c *IfConversion) temp(module *ir.Module, t *ir.SignalType) *ir.Signal {
+	name := fmt.Sprintf("ifc_%d", c.nextTemp)
+	for module.Signals[name] != nil {
+		c.nextTemp++
+		name = fmt.Sprintf("ifc_%d", c.nextTemp)
+	}
+	c.nextTemp++
+	typ := &ir.SignalType{Width: 1}
+	if t != nil {
+		copied := *t
+		typ = &copied
+	}
+	sig := &ir.Signal{Name: name, Type: typ, Kind: ir.Wire}
+	if module.Signals == nil {
+		module.Signals = make(map[string]*ir.Signal)
+	}
+	module.Signals[name] = sig
+	return sig
+}
@@ -0,0 +1,119 @@
+package passes
+
+import (
+	"testing"
+
+	"mygo/internal/ir"
+)
+
+// shortCircuitProcess builds the blocks go/ssa emits for
+//
+//	v := x
+//	if a && b { v = y } else if a { v = z }
+//
+// with an optional op placed in the inner block.
+func shortCircuitProcess(extra ir.Operation) (*ir.Design, *ir.Signal) {
+	bit := func(name string) *ir.Signal {
+		return &ir.Signal{Name: name, Type: &ir.SignalType{Width: 1}}
+	}
+	word := func(name string) *ir.Signal {
+		return &ir.Signal{Name: name, Type: &ir.SignalType{Width: 8}}
+	}
+	a, b := bit("a"), bit("b")
+	x, y, z, v := word("x"), word("y"), word("z"), word("v")
+
+	entry := &ir.BasicBlock{Label: "entry"}
+	rhs := &ir.BasicBlock{Label: "cond.rhs"}
+	then := &ir.BasicBlock{Label: "if.then"}
+	other := &ir.BasicBlock{Label: "if.else"}
+	done := &ir.BasicBlock{Label: "if.done"}
+	link := func(from *ir.BasicBlock, to ...*ir.BasicBlock) {
+		for _, succ := range to {
+			from.Successors = append(from.Successors, succ)
+			succ.Predecessors = append(succ.Predecessors, from)
+		}
+	}
+	entry.Terminator = &ir.BranchTerminator{Cond: a, True: rhs, False: done}
+	link(entry, rhs, done)
+	rhs.Terminator = &ir.BranchTerminator{Cond: b, True: then, False: other}
+	link(rhs, then, other)
+	then.Terminator = &ir.JumpTerminator{Target: done}
+	link(then, done)
+	other.Terminator = &ir.JumpTerminator{Target: done}
+	link(other, done)
+	if extra != nil {
+		then.Ops = append(then.Ops, extra)
+	}
+	done.Ops = []ir.Operation{&ir.PhiOperation{Dest: v, Incomings: []ir.PhiIncoming{
+		{Block: entry, Value: x},
+		{Block: then, Value: y},
+		{Block: other, Value: z},
+	}}}
+	done.Terminator = &ir.ReturnTerminator{}
+
+	design := buildTestDesign(nil, a, b, x, y, z, v)
+	design.TopLevel.Processes[0].Blocks = []*ir.BasicBlock{entry, rhs, then, other, done}
+	return design, v
+}
+
+func TestIfConversionFlattensShortCircuit(t *testing.T) {
+	design, v := shortCircuitProcess(nil)
+	if err := NewIfConversion().Run(design); err != nil {
+		t.Fatalf("if-conversion failed: %v", err)
+	}
+	blocks := design.TopLevel.Processes[0].Blocks
+	if len(blocks) != 1 {
+		t.Fatalf("expected a single block, got %d", len(blocks))
+	}
+	if _, ok := blocks[0].Terminator.(*ir.ReturnTerminator); !ok {
+		t.Fatalf("expected the exit's return on the merged block, got %T", blocks[0].Terminator)
+	}
+	var defined bool
+	for _, op := range blocks[0].Ops {
+		switch o := op.(type) {
+		case *ir.PhiOperation:
+			t.Fatalf("phi %s survived if-conversion", o.Dest.Name)
+		case *ir.MuxOperation:
+			if o.Dest == v {
+				defined = true
+			}
+		}
+	}
+	if !defined {
+		t.Fatalf("expected %s to be driven by a mux", v.Name)
+	}
+}
+
+func TestIfConversionKeepsChannelRegions(t *testing.T) {
+	ch := &ir.Channel{Name: "out", Type: &ir.SignalType{Width: 8}}
+	design, _ := shortCircuitProcess(&ir.SendOperation{Channel: ch})
+	if err := NewIfConversion().Run(design); err != nil {
+		t.Fatalf("if-conversion failed: %v", err)
+	}
+	for _, block := range design.TopLevel.Processes[0].Blocks {
+		if block.Label != "if.then" {
+			continue
+		}
+		if len(block.Ops) != 1 {
+			t.Fatalf("expected the send to stay in its own block, got %v", block.Ops)
+		}
+		return
+	}
+	t.Fatalf("block holding the send was merged away")
+}
+
+func TestIfConversionSkipsSoftwareProcesses(t *testing.T) {
+	design, _ := shortCircuitProcess(nil)
+	proc := design.TopLevel.Processes[0]
+	proc.Software = &ir.SoftwareBinding{Function: "proc"}
+	pass := NewIfConversion()
+	if err := pass.Run(design); err != nil {
+		t.Fatalf("if-conversion failed: %v", err)
+	}
+	if len(proc.Blocks) != 5 {
+		t.Fatalf("expected the software process to keep its 5 blocks, got %d", len(proc.Blocks))
+	}
+	if changed := pass.Changed(); len(changed) != 0 {
+		t.Fatalf("expected no changed processes, got %v", changed)
+	}
+}
@@ -3,6 +3,7 @@ package passes
 import (
 	"fmt"
 
+	"mygo/internal/diag"
 	"mygo/internal/ir"
 )
 
@@ -12,14 +13,22 @@ type Pass interface {
 	Run(*ir.Design) error
 }
 
-// Manager holds an ordered list of passes.
+// Manager holds an ordered list of passes and the analyses they share.
 type Manager struct {
-	passes []Pass
+	passes   []Pass
+	analyses *Analyses
+	verify   bool
+	reporter *diag.Reporter
 }
 
 // NewManager creates an empty pass manager.
 func NewManager() *Manager {
-	return &Manager{passes: make([]Pass, 0)}
+	return &Manager{passes: make([]Pass, 0), analyses: NewAnalyses()}
+}
+
+// Analyses returns the cache handed to passes that implement AnalysisUser.
+func (m *Manager) Analyses() *Analyses {
+	return m.analyses
 }
 
 // Add appends a pass to the execution list.
@@ -30,18 +39,88 @@ func (m *Manager) Add(p Pass) {
 	m.passes = append(m.passes, p)
 }
 
-// Run executes each registered pass sequentially.
+// EnableVerify makes Run check the design with ir.Verify before the first
+// pass and after every pass, reporting violations through reporter. Widths
+// must be known from width inference on.
+func (m *Manager) EnableVerify(reporter *diag.Reporter) {
+	m.verify = true
+	m.reporter = reporter
+}
+
+// Run executes each registered pass sequentially, invalidating cached
+// analyses after each one as ChangeReporter describes.
 func (m *Manager) Run(design *ir.Design) error {
 	if design == nil {
 		return fmt.Errorf("nil design provided to pass manager")
 	}
+	var opts ir.VerifyOptions
+	if m.verify {
+		if err := ir.Verify(design, m.reporter, opts); err != nil {
+			return fmt.Errorf("malformed IR before the first pass: %w", err)
+		}
+	}
 	for _, pass := range m.passes {
 		if pass == nil {
 			continue
 		}
+		if user, ok := pass.(AnalysisUser); ok {
+			user.UseAnalyses(m.analyses)
+		}
 		if err := pass.Run(design); err != nil {
 			return fmt.Errorf("pass %s failed: %w", pass.Name(), err)
 		}
+		if changes, ok := pass.(ChangeReporter); ok {
+			m.analyses.Invalidate(changes.Changed()...)
+		} else {
+			m.analyses.InvalidateAll()
+		}
+		if !m.verify {
+			continue
+		}
+		if _, ok := pass.(*WidthInference); ok {
+			opts.RequireWidths = true
+		}
+		if err := ir.Verify(design, m.reporter, opts); err != nil {
+			return fmt.Errorf("malformed IR after pass %s: %w", pass.Name(), err)
+		}
+	}
+	return nil
+}
+
+// DefaultOptions selects the optional parts of the default pipeline.
+type DefaultOptions struct {
+	// StripAssertions drops the checks lowered from panics.
+	StripAssertions bool
+	// Verify checks the IR before and after every pass.
+	Verify bool
+}
+
+// RunDefault runs the passes every compile applies: width inference,
+// if-conversion, constant folding, assertion stripping when asked, and dead
+// code elimination. Errors reported through reporter fail the run.
+func RunDefault(design *ir.Design, reporter *diag.Reporter, opts DefaultOptions) error {
+	mgr := NewManager()
+	if opts.Verify {
+		mgr.EnableVerify(reporter)
+	}
+	mgr.Add(NewWidthInference(reporter))
+	mgr.Add(NewIfConversion())
+	mgr.Add(NewConstFold())
+	if opts.StripAssertions {
+		mgr.Add(NewStripAssertions())
+	}
+	mgr.Add(NewDCE())
+	if err := mgr.Run(design); err != nil {
+		return err
+	}
+	if reporter != nil && reporter.HasErrors() {
+		return fmt.Errorf("analysis passes reported errors")
 	}
+	// Folding and if-conversion can remove what kept a process sequential,
+	// such as a loop or a second store, so classify the final processes.
+	ir.ClassifySensitivity(design)
+	// Passes can change what a process touches, and a parsed .ir file may
+	// be flat, so rebuild the module ports from the final processes.
+	ir.BuildHierarchy(design)
 	return nil
 }
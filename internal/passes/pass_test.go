@@ -0,0 +1,89 @@
+package passes
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"mygo/internal/diag"
+	"mygo/internal/ir"
+)
+
+// dropTerminators is a deliberately broken pass.
+type dropTerminators struct{}
+
+func (dropTerminators) Name() string { return "drop-terminators" }
+
+func (dropTerminators) Run(design *ir.Design) error {
+	for _, block := range design.TopLevel.Processes[0].Blocks {
+		block.Terminator = nil
+	}
+	return nil
+}
+
+func TestManagerVerifiesAfterEachPass(t *testing.T) {
+	design, _ := shortCircuitProcess(nil)
+	var out bytes.Buffer
+	mgr := NewManager()
+	mgr.EnableVerify(diag.NewReporter(&out, "text"))
+	mgr.Add(NewWidthInference(nil))
+	mgr.Add(NewIfConversion())
+	mgr.Add(dropTerminators{})
+	err := mgr.Run(design)
+	if err == nil || !strings.Contains(err.Error(), "after pass drop-terminators") {
+		t.Fatalf("expected verification to fail after drop-terminators, got %v", err)
+	}
+	if !strings.Contains(out.String(), "missing terminator") {
+		t.Fatalf("expected the violation to be reported, got:\n%s", out.String())
+	}
+}
+
+func TestManagerSkipsVerifyByDefault(t *testing.T) {
+	design, _ := shortCircuitProcess(nil)
+	mgr := NewManager()
+	mgr.Add(dropTerminators{})
+	if err := mgr.Run(design); err != nil {
+		t.Fatalf("unexpected error without verification: %v", err)
+	}
+}
+
+// spinBehindConstant is a worker that only loops on a branch folding removes.
+const spinBehindConstant = `module main
+  ports:
+    in  clk 1bu
+    in  rst 1bu
+    out done 1bu
+  signals:
+    const_0 const 1bu = false
+  process 0 main (stage=0, sequential)
+    block entry
+      go worker(stage=1)()
+      return
+  process 1 worker (stage=1, sequential)
+    block entry
+      br const_0 ? spin : exit
+    block spin (trip=?)
+      jump spin
+    block exit
+      return
+`
+
+func TestRunDefaultClassifiesFinalProcesses(t *testing.T) {
+	design, err := ir.Parse(strings.NewReader(spinBehindConstant))
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	var out bytes.Buffer
+	if err := RunDefault(design, diag.NewReporter(&out, "text"), DefaultOptions{Verify: true}); err != nil {
+		t.Fatalf("RunDefault failed: %v\n%s", err, out.String())
+	}
+	for _, proc := range design.Processes() {
+		want := ir.Combinational
+		if proc.Name == "main" {
+			want = ir.Sequential
+		}
+		if proc.Sensitivity != want {
+			t.Errorf("process %s has sensitivity %v, want %v", proc.Name, proc.Sensitivity, want)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package passes
+
+import (
+	"fmt"
+
+	"mygo/internal/ir"
+)
+
+// StripAssertions removes simulation-only assertion operations so synthesis
+// builds do not carry $fatal checks lowered from Go panics.
+type StripAssertions struct {
+	changed []*ir.Process
+}
+
+// NewStripAssertions constructs the pass.
+func NewStripAssertions() *StripAssertions {
+	return &StripAssertions{}
+}
+
+// Name implements the Pass interface.
+func (s *StripAssertions) Name() string {
+	return "strip-assertions"
+}
+
+// Changed implements ChangeReporter.
+func (s *StripAssertions) Changed() []*ir.Process {
+	return s.changed
+}
+
+// Run drops every AssertOperation in the design.
+func (s *StripAssertions) Run(design *ir.Design) error {
+	if design == nil {
+		return fmt.Errorf("strip assertions requires a non-nil design")
+	}
+	s.changed = nil
+	for _, module := range design.Modules {
+		if module == nil {
+			continue
+		}
+		for _, proc := range module.Processes {
+			if proc == nil {
+				continue
+			}
+			stripped := false
+			for _, block := range proc.Blocks {
+				kept := block.Ops[:0]
+				for _, op := range block.Ops {
+					if _, ok := op.(*ir.AssertOperation); ok {
+						stripped = true
+						continue
+					}
+					kept = append(kept, op)
+				}
+				block.Ops = kept
+			}
+			if stripped {
+				s.changed = append(s.changed, proc)
+			}
+		}
+	}
+	return nil
+}
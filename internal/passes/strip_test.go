@@ -0,0 +1,29 @@
+package passes
+
+import (
+	"testing"
+
+	"mygo/internal/ir"
+)
+
+func TestStripAssertionsRemovesAsserts(t *testing.T) {
+	cond := &ir.Signal{Name: "guard", Type: &ir.SignalType{Width: 1}}
+	src := &ir.Signal{Name: "src", Type: &ir.SignalType{Width: 8}}
+	dst := &ir.Signal{Name: "dst", Type: &ir.SignalType{Width: 8}}
+
+	design := buildTestDesign([]ir.Operation{
+		&ir.AssertOperation{Cond: cond, Message: "overflow"},
+		&ir.AssignOperation{Dest: dst, Value: src},
+	}, cond, src, dst)
+
+	if err := NewStripAssertions().Run(design); err != nil {
+		t.Fatalf("strip assertions failed: %v", err)
+	}
+	ops := design.TopLevel.Processes[0].Blocks[0].Ops
+	if len(ops) != 1 {
+		t.Fatalf("expected 1 remaining op, got %d", len(ops))
+	}
+	if _, ok := ops[0].(*ir.AssignOperation); !ok {
+		t.Fatalf("expected assignment to survive, got %T", ops[0])
+	}
+}
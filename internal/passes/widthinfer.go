@@ -28,6 +28,12 @@ func (w *WidthInference) Name() string {
 	return "width-inference"
 }
 
+// Changed implements ChangeReporter. The pass only fills in signal types,
+// which no cached analysis depends on.
+func (w *WidthInference) Changed() []*ir.Process {
+	return nil
+}
+
 // Run executes the pass over the entire design.
 func (w *WidthInference) Run(design *ir.Design) error {
 	if design == nil {
@@ -0,0 +1,30 @@
+package ssainfo
+
+import "go/types"
+
+// IsComponentPointer reports whether t points to a named struct type that is
+// modelled as a hardware component. The sync primitives are excluded because
+// they lower to dedicated constructs.
+func IsComponentPointer(t types.Type) bool {
+	ptr, ok := t.(*types.Pointer)
+	if !ok {
+		return false
+	}
+	_, _, ok = ComponentStruct(ptr.Elem())
+	return ok
+}
+
+// ComponentStruct returns the named struct type behind a component, and
+// whether t is one.
+func ComponentStruct(t types.Type) (*types.Named, *types.Struct, bool) {
+	named, ok := types.Unalias(t).(*types.Named)
+	if !ok {
+		return nil, nil, false
+	}
+	obj := named.Obj()
+	if obj == nil || obj.Pkg() == nil || obj.Pkg().Path() == "sync" {
+		return nil, nil, false
+	}
+	st, ok := named.Underlying().(*types.Struct)
+	return named, st, ok
+}
@@ -0,0 +1,41 @@
+package ssainfo
+
+import (
+	"go/constant"
+	"go/token"
+	"go/types"
+	"sort"
+)
+
+// EnumConstants returns the constants declared with the named integer type t
+// in its package, ordered by value. A type without such constants, such as a
+// plain uint8, is not an enum and yields nil.
+func EnumConstants(t types.Type) (*types.Named, []*types.Const) {
+	named, ok := types.Unalias(t).(*types.Named)
+	if !ok {
+		return nil, nil
+	}
+	basic, ok := named.Underlying().(*types.Basic)
+	if !ok || basic.Info()&types.IsInteger == 0 {
+		return nil, nil
+	}
+	obj := named.Obj()
+	if obj == nil || obj.Pkg() == nil {
+		return nil, nil
+	}
+	scope := obj.Pkg().Scope()
+	var consts []*types.Const
+	for _, name := range scope.Names() {
+		c, ok := scope.Lookup(name).(*types.Const)
+		if ok && types.Identical(c.Type(), named) {
+			consts = append(consts, c)
+		}
+	}
+	if len(consts) == 0 {
+		return nil, nil
+	}
+	sort.SliceStable(consts, func(i, j int) bool {
+		return constant.Compare(consts[i].Val(), token.LSS, consts[j].Val())
+	})
+	return named, consts
+}
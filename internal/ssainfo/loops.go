@@ -0,0 +1,419 @@
+package ssainfo
+
+import (
+	"go/constant"
+	"go/token"
+	"go/types"
+	"math"
+
+	"golang.org/x/tools/go/ssa"
+)
+
+// UnknownTripCount marks a loop whose iteration count could not be derived.
+const UnknownTripCount int64 = -1
+
+// Loop describes a natural loop in an SSA function.
+type Loop struct {
+	// Header is the block every iteration passes through; it dominates the
+	// rest of the loop.
+	Header *ssa.BasicBlock
+	// Blocks holds every block of the loop, including the header and any
+	// nested loops.
+	Blocks map[*ssa.BasicBlock]bool
+	// Latches are the blocks with a back edge to Header.
+	Latches []*ssa.BasicBlock
+	// Exits are the loop blocks with a successor outside the loop.
+	Exits []*ssa.BasicBlock
+	// TripCount is an upper bound on how many times the loop body runs, or
+	// UnknownTripCount. Early exits such as break only make the real count
+	// smaller.
+	TripCount int64
+}
+
+// Bounded reports whether a trip count was derived for the loop.
+func (l *Loop) Bounded() bool {
+	return l != nil && l.TripCount != UnknownTripCount
+}
+
+// FindLoops returns the natural loops of fn in block order, one per loop
+// header, with trip counts derived from their induction variables.
+func FindLoops(fn *ssa.Function) []*Loop {
+	if fn == nil {
+		return nil
+	}
+	byHeader := make(map[*ssa.BasicBlock]*Loop)
+	var loops []*Loop
+	for _, block := range fn.Blocks {
+		if block == nil {
+			continue
+		}
+		for _, succ := range block.Succs {
+			if succ == nil || !succ.Dominates(block) {
+				continue
+			}
+			loop, ok := byHeader[succ]
+			if !ok {
+				loop = &Loop{Header: succ, Blocks: map[*ssa.BasicBlock]bool{succ: true}}
+				byHeader[succ] = loop
+				loops = append(loops, loop)
+			}
+			loop.Latches = append(loop.Latches, block)
+			loop.addBody(block)
+		}
+	}
+	for _, loop := range loops {
+		for _, block := range fn.Blocks {
+			if !loop.Blocks[block] {
+				continue
+			}
+			for _, succ := range block.Succs {
+				if !loop.Blocks[succ] {
+					loop.Exits = append(loop.Exits, block)
+					break
+				}
+			}
+		}
+		loop.TripCount = loop.deriveTripCount()
+	}
+	return loops
+}
+
+// addBody adds latch and every block that reaches it without passing through
+// the header.
+func (l *Loop) addBody(latch *ssa.BasicBlock) {
+	work := []*ssa.BasicBlock{latch}
+	for len(work) > 0 {
+		block := work[len(work)-1]
+		work = work[:len(work)-1]
+		if l.Blocks[block] {
+			continue
+		}
+		l.Blocks[block] = true
+		work = append(work, block.Preds...)
+	}
+}
+
+// Position returns a source position inside the loop for diagnostics.
+func (l *Loop) Position() token.Pos {
+	if pos := blockPosition(l.Header); pos != token.NoPos {
+		return pos
+	}
+	for block := range l.Blocks {
+		if pos := blockPosition(block); pos != token.NoPos {
+			return pos
+		}
+	}
+	return token.NoPos
+}
+
+// deriveTripCount takes the smallest count implied by any exit test on an
+// induction variable. Only tests in the header or a latch are used, since
+// those run exactly once per iteration.
+func (l *Loop) deriveTripCount() int64 {
+	best := UnknownTripCount
+	for _, exit := range l.Exits {
+		if exit != l.Header && !l.isLatch(exit) {
+			continue
+		}
+		count, ok := l.exitTripCount(exit)
+		if !ok {
+			continue
+		}
+		if best == UnknownTripCount || count < best {
+			best = count
+		}
+	}
+	return best
+}
+
+func (l *Loop) isLatch(block *ssa.BasicBlock) bool {
+	for _, latch := range l.Latches {
+		if latch == block {
+			return true
+		}
+	}
+	return false
+}
+
+// exitTripCount solves the exit test in block for the number of body
+// executions. A test in the header runs before the body, so the count is the
+// number of passing tests; a bottom test in a latch runs after the body, so
+// the first iteration is unconditional.
+func (l *Loop) exitTripCount(block *ssa.BasicBlock) (int64, bool) {
+	branch, ok := lastInstr(block).(*ssa.If)
+	if !ok || len(block.Succs) != 2 {
+		return 0, false
+	}
+	cond, ok := branch.Cond.(*ssa.BinOp)
+	if !ok {
+		return 0, false
+	}
+	stayTrue := l.Blocks[block.Succs[0]]
+	if stayTrue == l.Blocks[block.Succs[1]] {
+		return 0, false
+	}
+	op := cond.Op
+	tested, bound := cond.X, cond.Y
+	if _, isConst := tested.(*ssa.Const); isConst {
+		tested, bound = bound, tested
+		op = swapComparison(op)
+	}
+	if !stayTrue {
+		op = negateComparison(op)
+	}
+	limit, ok := constInt(bound)
+	if !ok {
+		return 0, false
+	}
+	iv, ok := l.inductionVariable(stripConversions(tested))
+	if !ok {
+		return 0, false
+	}
+	count, ok := iv.passingTests(op, limit)
+	if !ok {
+		return 0, false
+	}
+	if l.isLatch(block) {
+		count++
+	}
+	return count, true
+}
+
+// inductionVariable describes a header phi of the form phi [init, phi+step].
+// first is the value seen by the first exit test, which is init+step when the
+// test reads the incremented value.
+type inductionVariable struct {
+	first int64
+	step  int64
+	typ   types.Type
+}
+
+func (l *Loop) inductionVariable(tested ssa.Value) (inductionVariable, bool) {
+	phi, offset := tested, int64(0)
+	if bin, ok := tested.(*ssa.BinOp); ok {
+		if p, step, ok := phiStep(bin); ok {
+			phi, offset = p, step
+		}
+	}
+	header, ok := phi.(*ssa.Phi)
+	if !ok || header.Block() != l.Header {
+		return inductionVariable{}, false
+	}
+	var (
+		init, step     int64
+		haveInit, have bool
+	)
+	for idx, edge := range header.Edges {
+		pred := l.Header.Preds[idx]
+		if !l.Blocks[pred] {
+			val, ok := constInt(edge)
+			if !ok || (haveInit && val != init) {
+				return inductionVariable{}, false
+			}
+			init, haveInit = val, true
+			continue
+		}
+		bin, ok := stripConversions(edge).(*ssa.BinOp)
+		if !ok {
+			return inductionVariable{}, false
+		}
+		p, s, ok := phiStep(bin)
+		if !ok || p != ssa.Value(header) || (have && s != step) {
+			return inductionVariable{}, false
+		}
+		step, have = s, true
+	}
+	if !haveInit || !have || (offset != 0 && offset != step) {
+		return inductionVariable{}, false
+	}
+	return inductionVariable{first: init + offset, step: step, typ: header.Type()}, true
+}
+
+// phiStep matches v+C, C+v and v-C, returning v and the signed step.
+func phiStep(bin *ssa.BinOp) (ssa.Value, int64, bool) {
+	switch bin.Op {
+	case token.ADD:
+		if c, ok := constInt(bin.Y); ok {
+			return bin.X, c, true
+		}
+		if c, ok := constInt(bin.X); ok {
+			return bin.Y, c, true
+		}
+	case token.SUB:
+		if c, ok := constInt(bin.Y); ok {
+			return bin.X, -c, true
+		}
+	}
+	return nil, 0, false
+}
+
+// passingTests counts the leading values first, first+step, ... that satisfy
+// value <op> limit. It fails when the sequence never stops or would wrap
+// around the induction variable's type before the test fails.
+func (iv inductionVariable) passingTests(op token.Token, limit int64) (int64, bool) {
+	x, s := iv.first, iv.step
+	var count int64
+	switch op {
+	case token.LSS, token.LEQ:
+		if op == token.LEQ {
+			if limit == math.MaxInt64 {
+				return 0, false
+			}
+			limit++
+		}
+		if x >= limit {
+			return 0, true
+		}
+		if s <= 0 {
+			return 0, false
+		}
+		count = (limit - x + s - 1) / s
+	case token.GTR, token.GEQ:
+		if op == token.GEQ {
+			limit--
+		}
+		if x <= limit {
+			return 0, true
+		}
+		if s >= 0 {
+			return 0, false
+		}
+		count = (x - limit - s - 1) / -s
+	case token.NEQ:
+		if x == limit {
+			return 0, true
+		}
+		if s == 0 || (limit-x)%s != 0 || (limit-x)/s < 0 {
+			return 0, false
+		}
+		count = (limit - x) / s
+	case token.EQL:
+		if x != limit {
+			return 0, true
+		}
+		if s == 0 {
+			return 0, false
+		}
+		return 1, true
+	default:
+		return 0, false
+	}
+	if !fitsType(x+count*s, iv.typ) {
+		return 0, false
+	}
+	return count, true
+}
+
+// fitsType reports whether v is representable in t without wrapping.
+func fitsType(v int64, t types.Type) bool {
+	basic, ok := t.Underlying().(*types.Basic)
+	if !ok || basic.Info()&types.IsInteger == 0 {
+		return false
+	}
+	var bits int
+	switch basic.Kind() {
+	case types.Int8, types.Uint8:
+		bits = 8
+	case types.Int16, types.Uint16:
+		bits = 16
+	case types.Int32, types.Uint32:
+		bits = 32
+	default:
+		bits = 64
+	}
+	if basic.Info()&types.IsUnsigned != 0 {
+		if v < 0 {
+			return false
+		}
+		return bits == 64 || v <= int64(1)<<bits-1
+	}
+	if bits == 64 {
+		return true
+	}
+	return v >= -(int64(1)<<(bits-1)) && v <= int64(1)<<(bits-1)-1
+}
+
+func swapComparison(op token.Token) token.Token {
+	switch op {
+	case token.LSS:
+		return token.GTR
+	case token.LEQ:
+		return token.GEQ
+	case token.GTR:
+		return token.LSS
+	case token.GEQ:
+		return token.LEQ
+	}
+	return op
+}
+
+func negateComparison(op token.Token) token.Token {
+	switch op {
+	case token.LSS:
+		return token.GEQ
+	case token.LEQ:
+		return token.GTR
+	case token.GTR:
+		return token.LEQ
+	case token.GEQ:
+		return token.LSS
+	case token.EQL:
+		return token.NEQ
+	case token.NEQ:
+		return token.EQL
+	}
+	return token.ILLEGAL
+}
+
+func stripConversions(v ssa.Value) ssa.Value {
+	for {
+		switch conv := v.(type) {
+		case *ssa.Convert:
+			v = conv.X
+		case *ssa.ChangeType:
+			v = conv.X
+		default:
+			return v
+		}
+	}
+}
+
+func constInt(v ssa.Value) (int64, bool) {
+	c, ok := v.(*ssa.Const)
+	if !ok {
+		return 0, false
+	}
+	if c.Value == nil {
+		return 0, true
+	}
+	if c.Value.Kind() != constant.Int {
+		return 0, false
+	}
+	val, exact := constant.Int64Val(c.Value)
+	if !exact || val == math.MinInt64 {
+		return 0, false
+	}
+	return val, true
+}
+
+func lastInstr(block *ssa.BasicBlock) ssa.Instruction {
+	if block == nil || len(block.Instrs) == 0 {
+		return nil
+	}
+	return block.Instrs[len(block.Instrs)-1]
+}
+
+func blockPosition(block *ssa.BasicBlock) token.Pos {
+	if block == nil {
+		return token.NoPos
+	}
+	for _, instr := range block.Instrs {
+		if instr == nil {
+			continue
+		}
+		if pos := instr.Pos(); pos != token.NoPos {
+			return pos
+		}
+	}
+	return token.NoPos
+}
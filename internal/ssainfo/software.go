@@ -0,0 +1,30 @@
+package ssainfo
+
+import (
+	"go/ast"
+	"strings"
+
+	"golang.org/x/tools/go/ssa"
+)
+
+// softwareDirective marks a function that stays in Go. The checker skips its
+// body, and goroutines started on it run natively next to the simulated
+// hardware, exchanging values over stream ports.
+const softwareDirective = "//mygo:software"
+
+// IsSoftware reports whether fn, or the function it is nested in, carries the
+// //mygo:software directive in its doc comment.
+func IsSoftware(fn *ssa.Function) bool {
+	for ; fn != nil; fn = fn.Parent() {
+		decl, ok := fn.Syntax().(*ast.FuncDecl)
+		if !ok || decl.Doc == nil {
+			continue
+		}
+		for _, comment := range decl.Doc.List {
+			if strings.TrimSpace(comment.Text) == softwareDirective {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,62 @@
+package ssainfo
+
+import (
+	"go/types"
+
+	"golang.org/x/tools/go/ssa"
+)
+
+// IsWaitGroupPointer reports whether t is *sync.WaitGroup.
+func IsWaitGroupPointer(t types.Type) bool {
+	return isSyncPointer(t, "WaitGroup")
+}
+
+// WaitGroupMethod returns the sync.WaitGroup method name called by common
+// ("Add", "Done", "Wait", ...), or "" for any other call.
+func WaitGroupMethod(common *ssa.CallCommon) string {
+	if common == nil || common.IsInvoke() {
+		return ""
+	}
+	callee := common.StaticCallee()
+	if callee == nil || callee.Signature.Recv() == nil {
+		return ""
+	}
+	if !IsWaitGroupPointer(callee.Signature.Recv().Type()) {
+		return ""
+	}
+	return callee.Name()
+}
+
+// IsMutexPointer reports whether t is *sync.Mutex.
+func IsMutexPointer(t types.Type) bool {
+	return isSyncPointer(t, "Mutex")
+}
+
+// MutexMethod returns the sync.Mutex method name called by common ("Lock",
+// "Unlock", ...), or "" for any other call.
+func MutexMethod(common *ssa.CallCommon) string {
+	if common == nil || common.IsInvoke() {
+		return ""
+	}
+	callee := common.StaticCallee()
+	if callee == nil || callee.Signature.Recv() == nil {
+		return ""
+	}
+	if !IsMutexPointer(callee.Signature.Recv().Type()) {
+		return ""
+	}
+	return callee.Name()
+}
+
+func isSyncPointer(t types.Type, name string) bool {
+	ptr, ok := t.(*types.Pointer)
+	if !ok {
+		return false
+	}
+	named, ok := ptr.Elem().(*types.Named)
+	if !ok {
+		return false
+	}
+	obj := named.Obj()
+	return obj != nil && obj.Pkg() != nil && obj.Pkg().Path() == "sync" && obj.Name() == name
+}
@@ -12,6 +12,7 @@ import (
 	"golang.org/x/tools/go/ssa/ssautil"
 
 	"mygo/internal/diag"
+	"mygo/internal/ssainfo"
 )
 
 // CheckProgram validates that the SSA program only uses the supported subset
@@ -46,10 +47,12 @@ type checker struct {
 	errCount   int
 	allowedPkg map[*ssa.Package]struct{}
 	astPkgs    []*packages.Package
+	goTargets  map[*ssa.Function]bool
 }
 
 func (c *checker) run(prog *ssa.Program) {
-	c.checkASTLoops()
+	c.goTargets = collectGoTargets(prog)
+	c.checkEnumSwitches()
 	for fn := range ssautil.AllFunctions(prog) {
 		if fn == nil || len(fn.Blocks) == 0 {
 			continue
@@ -62,7 +65,7 @@ func (c *checker) run(prog *ssa.Program) {
 				continue
 			}
 		}
-		if fn.Pkg.Pkg == nil {
+		if fn.Pkg.Pkg == nil || ssainfo.IsSoftware(fn) {
 			continue
 		}
 		c.checkFunction(fn)
@@ -70,7 +73,11 @@ func (c *checker) run(prog *ssa.Program) {
 }
 
 func (c *checker) checkFunction(fn *ssa.Function) {
+	c.checkLoops(fn)
 	loopBlocks := findLoopBlocks(fn)
+	c.checkWaitGroups(fn, loopBlocks)
+	c.checkFloats(fn)
+	c.checkSharedState(fn)
 	for _, block := range fn.Blocks {
 		if block == nil {
 			continue
@@ -90,6 +97,28 @@ func (c *checker) inspectInstruction(fn *ssa.Function, block *ssa.BasicBlock, in
 		c.checkCall(fn, inst)
 	case *ssa.MakeChan:
 		c.checkMakeChan(inst)
+	case *ssa.Alloc:
+		if ssainfo.IsComponentPointer(inst.Type()) {
+			c.checkComponentFields(inst)
+		}
+	case *ssa.IndexAddr:
+		if isChannelArrayPointer(inst.X.Type()) {
+			c.checkChannelIndex(inst.X, inst.Index, inst.Pos())
+		}
+	case *ssa.Index:
+		if isChannelArray(inst.X.Type()) {
+			c.error(inst.Pos(), "channel arrays must be local variables; pass individual elements to functions instead")
+		}
+	case *ssa.BinOp:
+		c.checkFloatBinOp(inst)
+	case *ssa.MakeInterface:
+		if isFloat32(inst.X.Type()) {
+			c.error(inst.Pos(), "float32 values cannot be printed; convert them to an integer first")
+		}
+	case *ssa.UnOp:
+		if inst.Op == token.MUL && isChannelArray(inst.Type()) {
+			c.error(inst.Pos(), "channel arrays cannot be copied; pass individual elements to functions instead")
+		}
 	case *ssa.Select:
 		c.error(inst.Pos(), "select statements are not supported; rewrite using deterministic channel handshakes")
 	case *ssa.MakeMap, *ssa.MapUpdate, *ssa.Lookup:
@@ -97,31 +126,73 @@ func (c *checker) inspectInstruction(fn *ssa.Function, block *ssa.BasicBlock, in
 	}
 }
 
-func (c *checker) checkASTLoops() {
-	if len(c.astPkgs) == 0 {
-		return
+// checkLoops requires every loop to have a derivable trip count, except
+// long-running goroutine loops that block on a channel every iteration.
+func (c *checker) checkLoops(fn *ssa.Function) {
+	for _, loop := range ssainfo.FindLoops(fn) {
+		if loop.Bounded() {
+			continue
+		}
+		pos := c.loopPosition(loop.Position())
+		switch {
+		case !c.goTargets[fn] && len(loop.Exits) == 0:
+			c.error(pos, "infinite for loops are only supported in goroutine bodies")
+		case !c.goTargets[fn]:
+			c.error(pos, "loop trip count could not be derived; compare an induction variable against a constant bound")
+		case !blocksEveryIteration(loop):
+			c.error(pos, "unbounded loop in %s never blocks; every iteration must send or receive on a channel", fn.Name())
+		}
+	}
+}
+
+// loopPosition maps a position inside a loop to the innermost enclosing for
+// or range keyword so diagnostics point at the loop statement.
+func (c *checker) loopPosition(pos token.Pos) token.Pos {
+	if pos == token.NoPos {
+		return pos
 	}
+	best := pos
 	for _, pkg := range c.astPkgs {
 		if pkg == nil {
 			continue
 		}
-		info := pkg.TypesInfo
 		for _, file := range pkg.Syntax {
-			if file == nil {
+			if file == nil || pos < file.Pos() || pos >= file.End() {
 				continue
 			}
 			ast.Inspect(file, func(n ast.Node) bool {
-				forStmt, ok := n.(*ast.ForStmt)
-				if !ok {
-					return true
+				if n == nil || pos < n.Pos() || pos >= n.End() {
+					return false
 				}
-				if !isBoundedFor(forStmt, info) {
-					c.error(forStmt.For, "for loops must have compile-time constant init, condition, and step")
+				switch n.(type) {
+				case *ast.ForStmt, *ast.RangeStmt:
+					best = n.Pos()
 				}
 				return true
 			})
 		}
 	}
+	return best
+}
+
+// collectGoTargets returns every function started by a go statement.
+func collectGoTargets(prog *ssa.Program) map[*ssa.Function]bool {
+	targets := make(map[*ssa.Function]bool)
+	for fn := range ssautil.AllFunctions(prog) {
+		if fn == nil {
+			continue
+		}
+		for _, block := range fn.Blocks {
+			for _, instr := range block.Instrs {
+				if g, ok := instr.(*ssa.Go); ok {
+					if callee := g.Call.StaticCallee(); callee != nil {
+						targets[callee] = true
+					}
+				}
+			}
+		}
+	}
+	return targets
 }
 
 func (c *checker) checkGo(current *ssa.Function, call *ssa.Go, inLoop bool) {
@@ -134,6 +205,12 @@ func (c *checker) checkGo(current *ssa.Function, call *ssa.Go, inLoop bool) {
 		return
 	}
 	callee := call.Call.StaticCallee()
+	if callee != nil && callee.Parent() != nil {
+		// The literal's loops are still checked as a goroutine body, so
+		// this is the only diagnostic a literal server loop gets.
+		c.error(call.Pos(), "function literals cannot be started with go; move the body into a named function and pass it the channels it uses")
+		return
+	}
 	fnValue, ok := call.Call.Value.(*ssa.Function)
 	if callee == nil || !ok {
 		c.error(call.Pos(), "goroutine targets must be named functions without captures")
@@ -141,7 +218,13 @@ func (c *checker) checkGo(current *ssa.Function, call *ssa.Go, inLoop bool) {
 	}
 	if callee.Object() == nil || fnValue.Object() == nil {
 		c.error(call.Pos(), "goroutine target %q is not a named function", callee.Name())
+		return
+	}
+	if ssainfo.IsSoftware(callee) {
+		c.checkSoftwareSpawn(call, callee)
+		return
 	}
+	c.checkMethodSpawn(call, callee)
 }
 
 func (c *checker) checkCall(current *ssa.Function, call *ssa.Call) {
@@ -149,23 +232,33 @@ func (c *checker) checkCall(current *ssa.Function, call *ssa.Call) {
 		c.error(call.Pos(), "interface method calls are not supported")
 		return
 	}
-	if callee := call.Call.StaticCallee(); callee != nil && callee == current {
+	callee := call.Call.StaticCallee()
+	if callee == nil {
+		return
+	}
+	if callee == current {
 		c.error(call.Pos(), "recursion is not supported; refactor %s to an iterative form", current.Name())
 	}
+	if ssainfo.IsSoftware(callee) {
+		c.error(call.Pos(), "software function %s can only be started with a go statement", callee.Name())
+		return
+	}
+	c.checkSyncCall(call, callee)
+	c.checkMethodCall(call, callee)
 }
 
 func (c *checker) checkMakeChan(mc *ssa.MakeChan) {
-	if mc.Size == nil {
-		c.error(mc.Pos(), "channels must declare a constant capacity > 0")
-		return
-	}
-	sizeConst, ok := mc.Size.(*ssa.Const)
-	if !ok {
-		c.error(mc.Pos(), "channel capacity must be a compile-time constant; got %s", describeValue(mc.Size))
-	} else if sizeConst.Value == nil {
-		c.error(mc.Pos(), "channel capacity must be a non-zero constant")
-	} else if capVal, ok := constant.Int64Val(sizeConst.Value); !ok || capVal <= 0 {
-		c.error(mc.Pos(), "channel capacity must be a positive constant; got %s", sizeConst.Value.ExactString())
+	// make(chan T) carries a constant zero size and lowers to an unbuffered
+	// rendezvous, so only non-constant or negative capacities are rejected.
+	if mc.Size != nil {
+		sizeConst, ok := mc.Size.(*ssa.Const)
+		if !ok {
+			c.error(mc.Pos(), "channel capacity must be a compile-time constant; got %s", describeValue(mc.Size))
+		} else if sizeConst.Value != nil {
+			if capVal, ok := constant.Int64Val(sizeConst.Value); !ok || capVal < 0 {
+				c.error(mc.Pos(), "channel capacity must be a non-negative constant; got %s", sizeConst.Value.ExactString())
+			}
+		}
 	}
 
 	elem := channelElem(mc.Type())
@@ -173,10 +266,32 @@ func (c *checker) checkMakeChan(mc *ssa.MakeChan) {
 		return
 	}
 	if !supportedChannelElem(elem) {
-		c.error(mc.Pos(), "channel element type %s is not supported; only integers or fixed-size arrays of integers are allowed", elem.String())
+		c.error(mc.Pos(), "channel element type %s is not supported; only integers, float32 or fixed-size arrays of them are allowed", elem.String())
 	}
 }
 
+// checkChannelIndex requires channel array elements to be selected by a
+// constant so each element resolves to a single channel.
+func (c *checker) checkChannelIndex(array, index ssa.Value, pos token.Pos) {
+	if _, ok := array.(*ssa.Alloc); !ok {
+		c.error(pos, "channel arrays must be local variables; pass individual elements to functions instead")
+		return
+	}
+	if _, ok := index.(*ssa.Const); !ok {
+		c.error(pos, "channel array index must be a compile-time constant; got %s", describeValue(index))
+	}
+}
+
+func isChannelArrayPointer(t types.Type) bool {
+	ptr, ok := t.Underlying().(*types.Pointer)
+	return ok && isChannelArray(ptr.Elem())
+}
+
+func isChannelArray(t types.Type) bool {
+	arr, ok := t.Underlying().(*types.Array)
+	return ok && channelElem(arr.Elem()) != nil
+}
+
 func (c *checker) error(pos token.Pos, format string, args ...any) {
 	c.errCount++
 	if c.reporter != nil {
@@ -208,7 +323,7 @@ func supportedChannelElem(t types.Type) bool {
 		if tt.Info()&types.IsInteger != 0 {
 			return true
 		}
-		return tt.Kind() == types.Bool
+		return tt.Kind() == types.Bool || tt.Kind() == types.Float32
 	case *types.Array:
 		return supportedChannelElem(tt.Elem())
 	default:
@@ -292,164 +407,3 @@ func hasSelfLoop(block *ssa.BasicBlock) bool {
 	}
 	return false
 }
-
-func blockPosition(block *ssa.BasicBlock) token.Pos {
-	if block == nil {
-		return token.NoPos
-	}
-	for _, instr := range block.Instrs {
-		if instr == nil {
-			continue
-		}
-		if pos := instr.Pos(); pos != token.NoPos {
-			return pos
-		}
-	}
-	return token.NoPos
-}
-
-func isBoundedFor(stmt *ast.ForStmt, info *types.Info) bool {
-	if stmt == nil || stmt.Init == nil || stmt.Cond == nil || stmt.Post == nil {
-		return false
-	}
-	iterName, _, ok := loopInitInfo(stmt.Init, info)
-	if !ok {
-		return false
-	}
-	_, direction, ok := loopConditionInfo(stmt.Cond, iterName, info)
-	if !ok {
-		return false
-	}
-	step, ok := loopStepInfo(stmt.Post, iterName, info)
-	if !ok {
-		return false
-	}
-	if direction == increasing && step <= 0 {
-		return false
-	}
-	if direction == decreasing && step >= 0 {
-		return false
-	}
-	return true
-}
-
-func loopInitInfo(stmt ast.Stmt, info *types.Info) (string, int64, bool) {
-	assign, ok := stmt.(*ast.AssignStmt)
-	if !ok || len(assign.Lhs) != 1 || len(assign.Rhs) != 1 {
-		return "", 0, false
-	}
-	ident, ok := assign.Lhs[0].(*ast.Ident)
-	if !ok || ident.Name == "_" {
-		return "", 0, false
-	}
-	val, ok := constantIntValue(info, assign.Rhs[0])
-	if !ok {
-		return "", 0, false
-	}
-	return ident.Name, val, true
-}
-
-type loopDirection int
-
-const (
-	increasing loopDirection = 1
-	decreasing loopDirection = -1
-)
-
-func loopConditionInfo(expr ast.Expr, iter string, info *types.Info) (int64, loopDirection, bool) {
-	bin, ok := expr.(*ast.BinaryExpr)
-	if !ok {
-		return 0, 0, false
-	}
-	left, ok := bin.X.(*ast.Ident)
-	if !ok || left.Name != iter {
-		return 0, 0, false
-	}
-	value, ok := constantIntValue(info, bin.Y)
-	if !ok {
-		return 0, 0, false
-	}
-	switch bin.Op {
-	case token.LSS, token.LEQ:
-		return value, increasing, true
-	case token.GTR, token.GEQ:
-		return value, decreasing, true
-	default:
-		return 0, 0, false
-	}
-}
-
-func loopStepInfo(stmt ast.Stmt, iter string, info *types.Info) (int64, bool) {
-	switch s := stmt.(type) {
-	case *ast.IncDecStmt:
-		ident, ok := s.X.(*ast.Ident)
-		if !ok || ident.Name != iter {
-			return 0, false
-		}
-		if s.Tok == token.INC {
-			return 1, true
-		}
-		if s.Tok == token.DEC {
-			return -1, true
-		}
-	case *ast.AssignStmt:
-		if len(s.Lhs) != 1 || len(s.Rhs) != 1 {
-			return 0, false
-		}
-		ident, ok := s.Lhs[0].(*ast.Ident)
-		if !ok || ident.Name != iter {
-			return 0, false
-		}
-		switch s.Tok {
-		case token.ADD_ASSIGN:
-			return extractStepValue(s.Rhs[0], info)
-		case token.SUB_ASSIGN:
-			if step, ok := extractStepValue(s.Rhs[0], info); ok {
-				return -step, true
-			}
-		case token.ASSIGN:
-			bin, ok := s.Rhs[0].(*ast.BinaryExpr)
-			if !ok {
-				return 0, false
-			}
-			left, ok := bin.X.(*ast.Ident)
-			if !ok || left.Name != iter {
-				return 0, false
-			}
-			step, ok := extractStepValue(bin.Y, info)
-			if !ok {
-				return 0, false
-			}
-			switch bin.Op {
-			case token.ADD:
-				return step, true
-			case token.SUB:
-				return -step, true
-			}
-		}
-	}
-	return 0, false
-}
-
-func extractStepValue(expr ast.Expr, info *types.Info) (int64, bool) {
-	return constantIntValue(info, expr)
-}
-
-func constantIntValue(info *types.Info, expr ast.Expr) (int64, bool) {
-	if info == nil {
-		return 0, false
-	}
-	if ident, ok := expr.(*ast.Ident); ok {
-		if obj, ok := info.ObjectOf(ident).(*types.Const); ok && obj.Val() != nil {
-			return constant.Int64Val(obj.Val())
-		}
-	}
-	tv, ok := info.Types[expr]
-	if !ok || tv.Value == nil {
-		if call, ok := expr.(*ast.CallExpr); ok && len(call.Args) == 1 {
-			return constantIntValue(info, call.Args[0])
-		}
-		return 0, false
-	}
-	return constant.Int64Val(tv.Value)
-}
@@ -13,6 +13,7 @@ import (
 
 	"mygo/internal/diag"
 	"mygo/internal/frontend"
+	"mygo/internal/ssainfo"
 )
 
 func TestValidateAllowsSimpleGoroutine(t *testing.T) {
@@ -53,8 +54,147 @@ func TestValidateRejectsChannelCapacityIssues(t *testing.T) {
 	if !strings.Contains(diagStr, "compile-time constant") {
 		t.Fatalf("expected constant capacity diagnostic, got %q", diagStr)
 	}
-	if !strings.Contains(diagStr, "positive constant") {
-		t.Fatalf("expected positive capacity diagnostic, got %q", diagStr)
+	if strings.Contains(diagStr, "main.go:9") {
+		t.Fatalf("unbuffered channel should be accepted, got %q", diagStr)
+	}
+}
+
+func TestValidateAllowsChannelArray(t *testing.T) {
+	diagStr, err := runValidation(t, "ok_channel_array")
+	if err != nil {
+		t.Fatalf("expected success, got error %v with diagnostics %s", err, diagStr)
+	}
+	if diagStr != "" {
+		t.Fatalf("expected no diagnostics, got %q", diagStr)
+	}
+}
+
+func TestValidateRejectsChannelArrayIndex(t *testing.T) {
+	diagStr, err := runValidation(t, "bad_channel_index")
+	if err == nil {
+		t.Fatalf("expected dynamic channel index to fail")
+	}
+	if !strings.Contains(diagStr, "channel array index must be a compile-time constant") {
+		t.Fatalf("expected constant index diagnostic, got %q", diagStr)
+	}
+	if !strings.Contains(diagStr, "channel arrays cannot be copied") {
+		t.Fatalf("expected array copy diagnostic, got %q", diagStr)
+	}
+}
+
+func TestValidateAllowsComponent(t *testing.T) {
+	diagStr, err := runValidation(t, "ok_component")
+	if err != nil {
+		t.Fatalf("expected success, got error %v with diagnostics %s", err, diagStr)
+	}
+	if diagStr != "" {
+		t.Fatalf("expected no diagnostics, got %q", diagStr)
+	}
+}
+
+func TestValidateRejectsComponentMisuse(t *testing.T) {
+	diagStr, err := runValidation(t, "bad_component")
+	if err == nil {
+		t.Fatalf("expected component misuse to fail")
+	}
+	for _, want := range []string{
+		"field taps of component Filter has unsupported type",
+		"goroutine method Run must have a pointer receiver",
+		"method scale has a value receiver",
+	} {
+		if !strings.Contains(diagStr, want) {
+			t.Fatalf("expected %q diagnostic, got %q", want, diagStr)
+		}
+	}
+}
+
+func TestValidateWarnsOnNonExhaustiveEnumSwitch(t *testing.T) {
+	diagStr, err := runValidation(t, "ok_enum_switch")
+	if err != nil {
+		t.Fatalf("expected success, got error %v with diagnostics %s", err, diagStr)
+	}
+	if !strings.Contains(diagStr, "switch on state is missing cases Body") {
+		t.Fatalf("expected exhaustiveness warning, got %q", diagStr)
+	}
+}
+
+func TestValidateAllowsFloat32(t *testing.T) {
+	diagStr, err := runValidation(t, "ok_float")
+	if err != nil {
+		t.Fatalf("expected success, got error %v with diagnostics %s", err, diagStr)
+	}
+	if diagStr != "" {
+		t.Fatalf("expected no diagnostics, got %q", diagStr)
+	}
+}
+
+func TestValidateRejectsUnsupportedFloats(t *testing.T) {
+	diagStr, err := runValidation(t, "bad_float")
+	if err == nil {
+		t.Fatalf("expected unsupported float use to fail")
+	}
+	for _, want := range []string{
+		"parameter a of average has type float64; only float32 is supported",
+		"float32 division is not supported",
+	} {
+		if !strings.Contains(diagStr, want) {
+			t.Fatalf("expected %q diagnostic, got %q", want, diagStr)
+		}
+	}
+}
+
+func TestValidateSkipsSoftwareGoroutines(t *testing.T) {
+	diagStr, err := runValidation(t, "ok_software")
+	if err != nil {
+		t.Fatalf("expected success, got error %v with diagnostics %s", err, diagStr)
+	}
+	if diagStr != "" {
+		t.Fatalf("expected no diagnostics, got %q", diagStr)
+	}
+}
+
+func TestValidateRejectsSoftwareMisuse(t *testing.T) {
+	diagStr, err := runValidation(t, "bad_software")
+	if err == nil {
+		t.Fatalf("expected software misuse to fail")
+	}
+	for _, want := range []string{
+		"software goroutine scale may only take channels of integers, bools or float32; parameter factor has type int32",
+		"software function reference can only be started with a go statement",
+	} {
+		if !strings.Contains(diagStr, want) {
+			t.Fatalf("expected %q diagnostic, got %q", want, diagStr)
+		}
+	}
+}
+
+func TestValidateAllowsMutexGuardedState(t *testing.T) {
+	diagStr, err := runValidation(t, "ok_mutex")
+	if err != nil {
+		t.Fatalf("expected success, got error %v with diagnostics %s", err, diagStr)
+	}
+	if diagStr != "" {
+		t.Fatalf("expected no diagnostics, got %q", diagStr)
+	}
+}
+
+func TestValidateRejectsUnguardedSharedState(t *testing.T) {
+	diagStr, err := runValidation(t, "bad_mutex")
+	if err == nil {
+		t.Fatalf("expected unguarded shared state to fail")
+	}
+	for _, want := range []string{
+		"shared variable n is accessed without holding a sync.Mutex",
+		"mu is still locked when racy returns",
+		"mu is already locked here",
+		"shared variable history has type [4]int32",
+		"shared variable hits may only be read, written or passed to a go statement",
+		"sync/atomic is not supported",
+		"(*sync.RWMutex).RLock is not supported",
+	} {
+		if !strings.Contains(diagStr, want) {
+			t.Fatalf("expected %q diagnostic, got %q", want, diagStr)
+		}
 	}
 }
 
@@ -98,6 +238,130 @@ func TestValidateRejectsRecursion(t *testing.T) {
 	}
 }
 
+func TestValidateAllowsServerLoop(t *testing.T) {
+	diagStr, err := runValidation(t, "ok_server_loop")
+	if err != nil {
+		t.Fatalf("expected success, got error %v with diagnostics %s", err, diagStr)
+	}
+	if diagStr != "" {
+		t.Fatalf("expected no diagnostics, got %q", diagStr)
+	}
+}
+
+func TestValidateRejectsBusyLoop(t *testing.T) {
+	diagStr, err := runValidation(t, "bad_busy_loop")
+	if err == nil {
+		t.Fatalf("expected busy loop to fail validation")
+	}
+	if !strings.Contains(diagStr, "never blocks") {
+		t.Fatalf("expected busy loop diagnostic, got %q", diagStr)
+	}
+}
+
+func TestValidateRejectsInfiniteLoopOutsideGoroutine(t *testing.T) {
+	diagStr, err := runValidation(t, "bad_infinite_main")
+	if err == nil {
+		t.Fatalf("expected infinite loop in main to fail validation")
+	}
+	if !strings.Contains(diagStr, "only supported in goroutine bodies") {
+		t.Fatalf("expected goroutine body diagnostic, got %q", diagStr)
+	}
+}
+
+func TestValidateRejectsGoLiteralAsLiteral(t *testing.T) {
+	diagStr, err := runValidation(t, "bad_go_literal")
+	if err == nil {
+		t.Fatalf("expected a go statement on a function literal to fail validation")
+	}
+	if !strings.Contains(diagStr, "function literals cannot be started with go") {
+		t.Fatalf("expected function literal diagnostic, got %q", diagStr)
+	}
+	if strings.Contains(diagStr, "only supported in goroutine bodies") {
+		t.Fatalf("the literal's server loop is a goroutine body, got %q", diagStr)
+	}
+}
+
+func TestValidateDerivesLoopTripCounts(t *testing.T) {
+	diagStr, err := runValidation(t, "ok_loop_shapes")
+	if err != nil {
+		t.Fatalf("expected success, got error %v with diagnostics %s", err, diagStr)
+	}
+	_, pkgs, _, _ := buildSSAProgram(t, "ok_loop_shapes")
+	fn := pkgs[0].Func("main")
+	if fn == nil {
+		t.Fatalf("expected main function")
+	}
+	var counts []int64
+	for _, loop := range ssainfo.FindLoops(fn) {
+		counts = append(counts, loop.TripCount)
+	}
+	want := []int64{8, 4, 8, 4, 4}
+	if len(counts) != len(want) {
+		t.Fatalf("expected %d loops, got trip counts %v", len(want), counts)
+	}
+	for i := range want {
+		if counts[i] != want[i] {
+			t.Fatalf("expected trip counts %v, got %v", want, counts)
+		}
+	}
+}
+
+func TestValidateRejectsUnboundedLoop(t *testing.T) {
+	diagStr, err := runValidation(t, "bad_unbounded_loop")
+	if err == nil {
+		t.Fatalf("expected unbounded loop to fail validation")
+	}
+	if !strings.Contains(diagStr, "trip count could not be derived") {
+		t.Fatalf("expected trip count diagnostic, got %q", diagStr)
+	}
+}
+
+func TestValidateAllowsWaitGroup(t *testing.T) {
+	diagStr, err := runValidation(t, "ok_waitgroup")
+	if err != nil {
+		t.Fatalf("expected success, got error %v with diagnostics %s", err, diagStr)
+	}
+	if diagStr != "" {
+		t.Fatalf("expected no diagnostics, got %q", diagStr)
+	}
+}
+
+func TestValidateRejectsWaitGroupCounts(t *testing.T) {
+	diagStr, err := runValidation(t, "bad_waitgroup_count")
+	if err == nil {
+		t.Fatalf("expected WaitGroup count violations to fail")
+	}
+	if !strings.Contains(diagStr, "Add count must be a compile-time constant") {
+		t.Fatalf("expected constant Add diagnostic, got %q", diagStr)
+	}
+	if !strings.Contains(diagStr, "adds 1 but is passed to 2 goroutine(s)") {
+		t.Fatalf("expected spawn mismatch diagnostic, got %q", diagStr)
+	}
+}
+
+func TestValidateRejectsMissingWaitGroupDone(t *testing.T) {
+	diagStr, err := runValidation(t, "bad_waitgroup_done")
+	if err == nil {
+		t.Fatalf("expected missing Done to fail validation")
+	}
+	if !strings.Contains(diagStr, "must call Done on WaitGroup wg exactly once") {
+		t.Fatalf("expected Done diagnostic, got %q", diagStr)
+	}
+}
+
+func TestValidateRejectsEarlyWaitGroupDone(t *testing.T) {
+	diagStr, err := runValidation(t, "bad_waitgroup_early_done")
+	if err == nil {
+		t.Fatalf("expected an early Done to fail validation")
+	}
+	if !strings.Contains(diagStr, "Done must be deferred or be the last statement of early") {
+		t.Fatalf("expected early Done diagnostic, got %q", diagStr)
+	}
+	if !strings.Contains(diagStr, "WaitGroup parameter wg may only be used to call Done") {
+		t.Fatalf("expected delegated WaitGroup diagnostic, got %q", diagStr)
+	}
+}
+
 func runValidation(t *testing.T, file string) (string, error) {
 	t.Helper()
 	prog, pkgs, astPkgs, fset := buildSSAProgram(t, file)
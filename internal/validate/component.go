@@ -0,0 +1,58 @@
+package validate
+
+import (
+	"go/types"
+
+	"golang.org/x/tools/go/ssa"
+
+	"mygo/internal/ssainfo"
+)
+
+// checkComponentFields requires every field of a component to fit in a
+// register: an integer, a boolean, a float32 or a fixed-size array of them.
+func (c *checker) checkComponentFields(alloc *ssa.Alloc) {
+	ptr, ok := alloc.Type().(*types.Pointer)
+	if !ok {
+		return
+	}
+	named, st, ok := ssainfo.ComponentStruct(ptr.Elem())
+	if !ok {
+		return
+	}
+	for i := 0; i < st.NumFields(); i++ {
+		field := st.Field(i)
+		if !supportedChannelElem(field.Type()) {
+			c.error(alloc.Pos(), "field %s of component %s has unsupported type %s; only integers, booleans, float32 or fixed-size arrays of them are allowed",
+				field.Name(), named.Obj().Name(), field.Type().String())
+		}
+	}
+}
+
+// checkMethodSpawn validates a go statement that starts a method. The
+// receiver must point to a local struct instance so its fields can become
+// registers of the spawned process.
+func (c *checker) checkMethodSpawn(call *ssa.Go, callee *ssa.Function) {
+	recv := callee.Signature.Recv()
+	if recv == nil || len(call.Call.Args) == 0 {
+		return
+	}
+	if !ssainfo.IsComponentPointer(recv.Type()) {
+		c.error(call.Pos(), "goroutine method %s must have a pointer receiver to a struct type", callee.Name())
+		return
+	}
+	if _, ok := call.Call.Args[0].(*ssa.Alloc); !ok {
+		c.error(call.Pos(), "receiver of goroutine method %s must be a local component; got %s", callee.Name(), describeValue(call.Call.Args[0]))
+	}
+}
+
+// checkMethodCall rejects value-receiver methods on components, which would
+// operate on a copy of the component's registers.
+func (c *checker) checkMethodCall(call *ssa.Call, callee *ssa.Function) {
+	recv := callee.Signature.Recv()
+	if recv == nil {
+		return
+	}
+	if _, _, ok := ssainfo.ComponentStruct(recv.Type()); ok {
+		c.error(call.Pos(), "method %s has a value receiver; component methods must use pointer receivers", callee.Name())
+	}
+}
@@ -0,0 +1,71 @@
+package validate
+
+import (
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/token"
+	"go/types"
+	"strings"
+
+	"mygo/internal/ssainfo"
+)
+
+// checkEnumSwitches warns about switch statements over an enum that have no
+// default clause and leave some of the enum's constants unhandled.
+func (c *checker) checkEnumSwitches() {
+	for _, pkg := range c.astPkgs {
+		if pkg == nil || pkg.TypesInfo == nil {
+			continue
+		}
+		for _, file := range pkg.Syntax {
+			ast.Inspect(file, func(n ast.Node) bool {
+				sw, ok := n.(*ast.SwitchStmt)
+				if !ok || sw.Tag == nil {
+					return true
+				}
+				named, consts := ssainfo.EnumConstants(pkg.TypesInfo.TypeOf(sw.Tag))
+				if named == nil {
+					return true
+				}
+				if missing := missingEnumCases(pkg.TypesInfo, sw, consts); len(missing) > 0 && c.reporter != nil {
+					c.reporter.Warning(sw.Pos(), fmt.Sprintf("switch on %s is missing cases %s; add them or a default clause",
+						named.Obj().Name(), strings.Join(missing, ", ")))
+				}
+				return true
+			})
+		}
+	}
+}
+
+func missingEnumCases(info *types.Info, sw *ast.SwitchStmt, consts []*types.Const) []string {
+	var covered []constant.Value
+	for _, stmt := range sw.Body.List {
+		clause, ok := stmt.(*ast.CaseClause)
+		if !ok {
+			continue
+		}
+		if clause.List == nil {
+			return nil
+		}
+		for _, expr := range clause.List {
+			if tv, ok := info.Types[expr]; ok && tv.Value != nil {
+				covered = append(covered, tv.Value)
+			}
+		}
+	}
+	var missing []string
+	for _, c := range consts {
+		found := false
+		for _, v := range covered {
+			if constant.Compare(c.Val(), token.EQL, v) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, c.Name())
+		}
+	}
+	return missing
+}
@@ -0,0 +1,58 @@
+package validate
+
+import (
+	"go/token"
+	"go/types"
+
+	"golang.org/x/tools/go/ssa"
+)
+
+// checkFloats restricts floating point to the float32 operations that have
+// generated units. float64 would need wider units than the designs warrant,
+// so it is reported once per function.
+func (c *checker) checkFloats(fn *ssa.Function) {
+	for _, param := range fn.Params {
+		if isWideFloat(param.Type()) {
+			c.error(param.Pos(), "parameter %s of %s has type %s; only float32 is supported", param.Name(), fn.Name(), param.Type().String())
+			return
+		}
+	}
+	for _, block := range fn.Blocks {
+		for _, instr := range block.Instrs {
+			value, ok := instr.(ssa.Value)
+			if !ok || !isWideFloat(value.Type()) {
+				continue
+			}
+			c.error(instr.Pos(), "%s is not supported in %s; use float32", value.Type().String(), fn.Name())
+			return
+		}
+	}
+}
+
+// checkFloatBinOp rejects float32 operations without a unit.
+func (c *checker) checkFloatBinOp(op *ssa.BinOp) {
+	if !isFloat32(op.X.Type()) {
+		return
+	}
+	switch op.Op {
+	case token.QUO:
+		c.error(op.Pos(), "float32 division is not supported; multiply by a reciprocal constant instead")
+	case token.REM:
+		c.error(op.Pos(), "float32 remainder is not supported")
+	}
+}
+
+func isFloat32(t types.Type) bool {
+	basic, ok := t.Underlying().(*types.Basic)
+	return ok && basic.Kind() == types.Float32
+}
+
+// isWideFloat reports float types other than float32, including complex
+// numbers.
+func isWideFloat(t types.Type) bool {
+	basic, ok := t.Underlying().(*types.Basic)
+	if !ok {
+		return false
+	}
+	return basic.Info()&(types.IsFloat|types.IsComplex) != 0 && basic.Kind() != types.Float32
+}
@@ -0,0 +1,45 @@
+package validate
+
+import (
+	"go/token"
+
+	"golang.org/x/tools/go/ssa"
+
+	"mygo/internal/ssainfo"
+)
+
+// blocksEveryIteration reports whether every path from the header back to
+// itself passes through a channel send or receive.
+func blocksEveryIteration(l *ssainfo.Loop) bool {
+	seen := make(map[*ssa.BasicBlock]bool)
+	work := []*ssa.BasicBlock{l.Header}
+	for len(work) > 0 {
+		block := work[len(work)-1]
+		work = work[:len(work)-1]
+		if !l.Blocks[block] || seen[block] || blocksOnChannel(block) {
+			continue
+		}
+		seen[block] = true
+		for _, succ := range block.Succs {
+			if succ == l.Header {
+				return false
+			}
+			work = append(work, succ)
+		}
+	}
+	return true
+}
+
+func blocksOnChannel(block *ssa.BasicBlock) bool {
+	for _, instr := range block.Instrs {
+		switch inst := instr.(type) {
+		case *ssa.Send:
+			return true
+		case *ssa.UnOp:
+			if inst.Op == token.ARROW {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,309 @@
+package validate
+
+import (
+	"go/token"
+	"go/types"
+	"sort"
+
+	"golang.org/x/tools/go/ssa"
+
+	"mygo/internal/ssainfo"
+)
+
+// checkSyncCall rejects the sync and sync/atomic APIs that have no hardware
+// lowering. Only WaitGroup and Mutex are modelled.
+func (c *checker) checkSyncCall(call *ssa.Call, callee *ssa.Function) {
+	if callee.Pkg == nil || callee.Pkg.Pkg == nil || callee.Synthetic != "" {
+		return
+	}
+	switch callee.Pkg.Pkg.Path() {
+	case "sync/atomic":
+		c.error(call.Pos(), "sync/atomic is not supported; guard shared variables with a sync.Mutex")
+	case "sync":
+		recv := callee.Signature.Recv()
+		switch {
+		case recv != nil && ssainfo.IsWaitGroupPointer(recv.Type()):
+		case recv != nil && ssainfo.IsMutexPointer(recv.Type()):
+			if name := callee.Name(); name != "Lock" && name != "Unlock" {
+				c.error(call.Pos(), "sync.Mutex.%s is not supported; use Lock and Unlock", name)
+			}
+		default:
+			c.error(call.Pos(), "%s is not supported; only sync.WaitGroup and sync.Mutex have a hardware lowering", callee.String())
+		}
+	}
+}
+
+// checkSharedState validates the shared variables fn touches. A shared
+// variable is a package-level variable, or a local whose address is passed
+// to a go statement; inside a goroutine it is reached through a pointer
+// parameter. Every read and write must happen while a sync.Mutex is held,
+// except in the creating function before the first goroutine starts, and
+// mutexes must be released on every path before fn returns.
+func (c *checker) checkSharedState(fn *ssa.Function) {
+	if fn.Synthetic != "" {
+		return
+	}
+	shared := c.sharedVariables(fn)
+	for v := range shared {
+		elem := v.Type().(*types.Pointer).Elem()
+		if !supportedStreamElem(elem) {
+			c.error(v.Pos(), "shared variable %s has type %s; only integers, bools and float32 can be shared between goroutines", valueName(v), elem.String())
+			delete(shared, v)
+		}
+	}
+	before := beforeFirstGo(fn)
+	deferred := deferredUnlocks(fn)
+	entry := lockedOnEntry(fn, deferred)
+	for _, block := range fn.Blocks {
+		held, ok := entry[block]
+		if !ok {
+			continue
+		}
+		held = held.clone()
+		for _, instr := range block.Instrs {
+			if call, ok := instr.(*ssa.Call); ok {
+				c.checkMutexCall(call, held)
+			}
+			c.checkSharedAccess(fn, instr, shared, held, before[instr])
+			switch instr.(type) {
+			case *ssa.RunDefers:
+				for mu := range deferred {
+					delete(held, mu)
+				}
+			case *ssa.Return:
+				for _, mu := range held.sorted() {
+					c.error(instr.Pos(), "%s is still locked when %s returns; unlock it on every path", valueName(mu), fn.Name())
+				}
+			}
+		}
+	}
+}
+
+// sharedVariables returns the addresses in fn that may be seen by more than
+// one process.
+func (c *checker) sharedVariables(fn *ssa.Function) map[ssa.Value]bool {
+	shared := make(map[ssa.Value]bool)
+	candidate := func(v ssa.Value) bool {
+		t := v.Type()
+		ptr, ok := t.(*types.Pointer)
+		if !ok || ssainfo.IsComponentPointer(t) || isChannelArrayPointer(t) {
+			return false
+		}
+		// The sync primitives are checked where they are called.
+		named, ok := ptr.Elem().(*types.Named)
+		return !ok || named.Obj().Pkg() == nil || named.Obj().Pkg().Path() != "sync"
+	}
+	if c.goTargets[fn] {
+		for _, param := range fn.Params {
+			if candidate(param) {
+				shared[param] = true
+			}
+		}
+	}
+	var operands []*ssa.Value
+	for _, block := range fn.Blocks {
+		for _, instr := range block.Instrs {
+			if g, ok := instr.(*ssa.Go); ok {
+				for _, arg := range g.Call.Args {
+					if a, ok := arg.(*ssa.Alloc); ok && candidate(a) {
+						shared[a] = true
+					}
+				}
+			}
+			for _, op := range instr.Operands(operands[:0]) {
+				if g, ok := (*op).(*ssa.Global); ok && candidate(g) {
+					shared[g] = true
+				}
+			}
+		}
+	}
+	return shared
+}
+
+func (c *checker) checkMutexCall(call *ssa.Call, held heldSet) {
+	method := ssainfo.MutexMethod(&call.Call)
+	if method == "" || len(call.Call.Args) == 0 {
+		return
+	}
+	mu := call.Call.Args[0]
+	switch mu.(type) {
+	case *ssa.Global, *ssa.Alloc, *ssa.Parameter:
+	default:
+		c.error(call.Pos(), "sync.Mutex must be a package-level variable, a local variable or a goroutine parameter")
+		return
+	}
+	switch method {
+	case "Lock":
+		if held[mu] {
+			c.error(call.Pos(), "%s is already locked here; locking it again would deadlock", valueName(mu))
+		}
+		held[mu] = true
+	case "Unlock":
+		if !held[mu] {
+			c.error(call.Pos(), "%s is unlocked here but is not locked on every path to it", valueName(mu))
+		}
+		delete(held, mu)
+	}
+}
+
+// checkSharedAccess requires instr to touch shared variables only by loading
+// or storing them, or by passing them on to a goroutine, and only while a
+// mutex is held.
+func (c *checker) checkSharedAccess(fn *ssa.Function, instr ssa.Instruction, shared map[ssa.Value]bool, held heldSet, unshared bool) {
+	var operands []*ssa.Value
+	for _, op := range instr.Operands(operands[:0]) {
+		v := *op
+		if !shared[v] {
+			continue
+		}
+		switch inst := instr.(type) {
+		case *ssa.DebugRef, *ssa.Go:
+			continue
+		case *ssa.UnOp:
+			if inst.Op != token.MUL {
+				c.error(instr.Pos(), "shared variable %s may only be read, written or passed to a go statement", valueName(v))
+				continue
+			}
+		case *ssa.Store:
+			if inst.Addr != v {
+				c.error(instr.Pos(), "the address of shared variable %s cannot be stored", valueName(v))
+				continue
+			}
+		default:
+			c.error(instr.Pos(), "shared variable %s may only be read, written or passed to a go statement", valueName(v))
+			continue
+		}
+		if len(held) > 0 || unshared && ownsVariable(fn, v) {
+			continue
+		}
+		c.error(instr.Pos(), "shared variable %s is accessed without holding a sync.Mutex; wrap the access in Lock and Unlock", valueName(v))
+	}
+}
+
+// ownsVariable reports whether v is created by fn or, for a package-level
+// variable, fn is main.
+func ownsVariable(fn *ssa.Function, v ssa.Value) bool {
+	switch v.(type) {
+	case *ssa.Alloc:
+		return v.Parent() == fn
+	case *ssa.Global:
+		return fn.Name() == "main" && fn.Parent() == nil && fn.Signature.Recv() == nil
+	}
+	return false
+}
+
+// beforeFirstGo marks the instructions of fn's entry block that run before
+// its first go statement, when no other process can see fn's variables yet.
+func beforeFirstGo(fn *ssa.Function) map[ssa.Instruction]bool {
+	before := make(map[ssa.Instruction]bool)
+	if len(fn.Blocks) == 0 {
+		return before
+	}
+	for _, instr := range fn.Blocks[0].Instrs {
+		if _, ok := instr.(*ssa.Go); ok {
+			break
+		}
+		before[instr] = true
+	}
+	return before
+}
+
+// deferredUnlocks returns the mutexes fn unlocks with a defer statement.
+func deferredUnlocks(fn *ssa.Function) map[ssa.Value]bool {
+	deferred := make(map[ssa.Value]bool)
+	for _, block := range fn.Blocks {
+		for _, instr := range block.Instrs {
+			if d, ok := instr.(*ssa.Defer); ok && ssainfo.MutexMethod(&d.Call) == "Unlock" {
+				deferred[d.Call.Args[0]] = true
+			}
+		}
+	}
+	return deferred
+}
+
+// heldSet is the set of mutexes held at a program point.
+type heldSet map[ssa.Value]bool
+
+func (h heldSet) clone() heldSet {
+	out := make(heldSet, len(h))
+	for mu := range h {
+		out[mu] = true
+	}
+	return out
+}
+
+func (h heldSet) sorted() []ssa.Value {
+	out := make([]ssa.Value, 0, len(h))
+	for mu := range h {
+		out = append(out, mu)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return valueName(out[i]) < valueName(out[j])
+	})
+	return out
+}
+
+// lockedOnEntry computes the mutexes held on every path into each reachable
+// block of fn. Predecessors not yet visited are skipped, so the sets only
+// shrink as the iteration proceeds.
+func lockedOnEntry(fn *ssa.Function, deferred map[ssa.Value]bool) map[*ssa.BasicBlock]heldSet {
+	entry := make(map[*ssa.BasicBlock]heldSet)
+	exit := make(map[*ssa.BasicBlock]heldSet)
+	for changed := true; changed; {
+		changed = false
+		for _, block := range fn.Blocks {
+			var in heldSet
+			if block.Index == 0 {
+				in = heldSet{}
+			}
+			for _, pred := range block.Preds {
+				out, ok := exit[pred]
+				switch {
+				case !ok:
+				case in == nil:
+					in = out.clone()
+				default:
+					for mu := range in {
+						if !out[mu] {
+							delete(in, mu)
+						}
+					}
+				}
+			}
+			if in == nil {
+				continue
+			}
+			if old, ok := entry[block]; ok && len(old) == len(in) {
+				continue
+			}
+			entry[block] = in
+			changed = true
+			out := in.clone()
+			for _, instr := range block.Instrs {
+				switch inst := instr.(type) {
+				case *ssa.Call:
+					switch ssainfo.MutexMethod(&inst.Call) {
+					case "Lock":
+						out[inst.Call.Args[0]] = true
+					case "Unlock":
+						delete(out, inst.Call.Args[0])
+					}
+				case *ssa.RunDefers:
+					for mu := range deferred {
+						delete(out, mu)
+					}
+				}
+			}
+			exit[block] = out
+		}
+	}
+	return entry
+}
+
+// valueName names a variable as the source spells it.
+func valueName(v ssa.Value) string {
+	if a, ok := v.(*ssa.Alloc); ok && a.Comment != "" {
+		return a.Comment
+	}
+	return v.Name()
+}
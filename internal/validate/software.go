@@ -0,0 +1,34 @@
+package validate
+
+import (
+	"go/types"
+
+	"golang.org/x/tools/go/ssa"
+)
+
+// checkSoftwareSpawn requires a software goroutine to be a plain function
+// whose parameters are all channels the co-simulation bridge can carry.
+func (c *checker) checkSoftwareSpawn(call *ssa.Go, callee *ssa.Function) {
+	if callee.Signature.Recv() != nil {
+		c.error(call.Pos(), "software goroutine %s must be a plain function, not a method", callee.Name())
+		return
+	}
+	for _, param := range callee.Params {
+		elem := channelElem(param.Type())
+		if elem == nil || !supportedStreamElem(elem) {
+			c.error(call.Pos(), "software goroutine %s may only take channels of integers, bools or float32; parameter %s has type %s",
+				callee.Name(), param.Name(), param.Type().String())
+			return
+		}
+	}
+}
+
+// supportedStreamElem reports whether values of t fit a stream port, which
+// carries at most 64 bits as a plain integer.
+func supportedStreamElem(t types.Type) bool {
+	basic, ok := t.Underlying().(*types.Basic)
+	if !ok {
+		return false
+	}
+	return basic.Info()&(types.IsInteger|types.IsBoolean) != 0 || basic.Kind() == types.Float32
+}
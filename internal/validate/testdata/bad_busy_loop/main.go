@@ -0,0 +1,18 @@
+package main
+
+func spin(in <-chan uint32, out chan<- uint32) {
+	var count uint32
+	for {
+		count++
+		if count == 8 {
+			out <- count
+		}
+	}
+}
+
+func main() {
+	in := make(chan uint32, 1)
+	out := make(chan uint32, 1)
+	go spin(in, out)
+	_ = <-out
+}
@@ -0,0 +1,14 @@
+package main
+
+func drain(lanes [2]chan uint32) {
+	<-lanes[0]
+}
+
+func main() {
+	var lanes [2]chan uint32
+	for i := 0; i < 2; i++ {
+		lanes[i] = make(chan uint32, 1)
+	}
+	go drain(lanes)
+	lanes[0] <- 1
+}
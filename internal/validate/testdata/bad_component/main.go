@@ -0,0 +1,38 @@
+package main
+
+type Filter struct {
+	taps []int32
+}
+
+func (f Filter) Run(in <-chan int32) {
+	for i := 0; i < 4; i++ {
+		<-in
+	}
+}
+
+type Gain struct {
+	k int32
+}
+
+func (g Gain) scale(v int32) int32 {
+	return v * g.k
+}
+
+func (g *Gain) Run(in <-chan int32, out chan<- int32) {
+	for i := 0; i < 4; i++ {
+		out <- g.scale(<-in)
+	}
+}
+
+func main() {
+	in := make(chan int32, 1)
+	out := make(chan int32, 1)
+	f := &Filter{}
+	go f.Run(in)
+	g := &Gain{k: 3}
+	go g.Run(in, out)
+	for i := int32(0); i < 4; i++ {
+		in <- i
+		<-out
+	}
+}
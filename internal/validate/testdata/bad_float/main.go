@@ -0,0 +1,14 @@
+package main
+
+func sink(v int32) {}
+
+func average(a, b float64) int32 {
+	return int32((a + b) / 2)
+}
+
+func main() {
+	x := float32(3)
+	y := x / 2
+	sink(average(1, 2))
+	sink(int32(y))
+}
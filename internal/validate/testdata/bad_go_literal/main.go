@@ -0,0 +1,14 @@
+package main
+
+func main() {
+	in := make(chan uint32, 1)
+	out := make(chan uint32, 1)
+	go func() {
+		for {
+			v := <-in
+			out <- v + 1
+		}
+	}()
+	in <- 1
+	_ = <-out
+}
@@ -0,0 +1,9 @@
+package main
+
+func main() {
+	ch := make(chan uint32, 1)
+	for {
+		ch <- 1
+		<-ch
+	}
+}
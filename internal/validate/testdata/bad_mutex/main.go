@@ -0,0 +1,45 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	hits    int32
+	history [4]int32
+	rw      sync.RWMutex
+)
+
+func racy(n *int32, mu *sync.Mutex, wg *sync.WaitGroup) {
+	defer wg.Done()
+	*n = *n + 1
+	mu.Lock()
+	if *n > 2 {
+		return
+	}
+	mu.Unlock()
+}
+
+func greedy(mu *sync.Mutex, wg *sync.WaitGroup) {
+	defer wg.Done()
+	mu.Lock()
+	mu.Lock()
+	hits++
+	mu.Unlock()
+	mu.Unlock()
+}
+
+func main() {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var count int32
+	wg.Add(2)
+	go racy(&count, &mu, &wg)
+	go greedy(&mu, &wg)
+	wg.Wait()
+	history[0] = 1
+	atomic.AddInt32(&hits, 1)
+	rw.RLock()
+	rw.RUnlock()
+}
@@ -0,0 +1,19 @@
+package main
+
+//mygo:software
+func scale(in <-chan int32, factor int32) {
+	for v := range in {
+		_ = v * factor
+	}
+}
+
+//mygo:software
+func reference(v int32) int32 {
+	return v * 3
+}
+
+func main() {
+	ch := make(chan int32)
+	go scale(ch, 3)
+	ch <- reference(2)
+}
@@ -0,0 +1,13 @@
+package main
+
+func sink(v uint32) {}
+
+func drain(limit uint32) {
+	for i := uint32(0); i < limit; i++ {
+		sink(i)
+	}
+}
+
+func main() {
+	drain(4)
+}
@@ -0,0 +1,18 @@
+package main
+
+import "sync"
+
+var extra = 3
+
+func worker(wg *sync.WaitGroup) {
+	wg.Done()
+}
+
+func main() {
+	var wg sync.WaitGroup
+	wg.Add(1)
+	wg.Add(extra)
+	go worker(&wg)
+	go worker(&wg)
+	wg.Wait()
+}
@@ -0,0 +1,16 @@
+package main
+
+import "sync"
+
+func sink(v uint32) {}
+
+func worker(wg *sync.WaitGroup) {
+	sink(1)
+}
+
+func main() {
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go worker(&wg)
+	wg.Wait()
+}
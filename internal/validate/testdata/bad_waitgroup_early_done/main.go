@@ -0,0 +1,28 @@
+package main
+
+import "sync"
+
+func release(wg *sync.WaitGroup) {
+	wg.Done()
+}
+
+func early(wg *sync.WaitGroup, out chan<- uint32) {
+	wg.Done()
+	out <- 1
+}
+
+func delegated(wg *sync.WaitGroup, out chan<- uint32) {
+	out <- 2
+	release(wg)
+}
+
+func main() {
+	var wg sync.WaitGroup
+	out := make(chan uint32, 2)
+	wg.Add(2)
+	go early(&wg, out)
+	go delegated(&wg, out)
+	wg.Wait()
+	<-out
+	<-out
+}
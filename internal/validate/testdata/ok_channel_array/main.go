@@ -0,0 +1,20 @@
+package main
+
+func sink(v uint32) {}
+
+func worker(in <-chan uint32, out chan<- uint32) {
+	v := <-in
+	out <- v + 1
+}
+
+func main() {
+	var lanes [2]chan uint32
+	lanes[0] = make(chan uint32, 1)
+	lanes[1] = make(chan uint32, 1)
+	outs := [2]chan uint32{make(chan uint32, 1), make(chan uint32, 1)}
+	go worker(lanes[0], outs[0])
+	go worker(lanes[1], outs[1])
+	lanes[0] <- 1
+	lanes[1] <- 2
+	sink(<-outs[0] + <-outs[1])
+}
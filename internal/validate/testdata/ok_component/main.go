@@ -0,0 +1,33 @@
+package main
+
+type Counter struct {
+	n     uint32
+	limit uint32
+	wrap  bool
+}
+
+func (c *Counter) bump(v uint32) {
+	c.n += v
+	if c.n > c.limit {
+		c.n = 0
+		c.wrap = true
+	}
+}
+
+func (c *Counter) Run(in <-chan uint32, out chan<- uint32) {
+	for i := 0; i < 4; i++ {
+		c.bump(<-in)
+		out <- c.n
+	}
+}
+
+func main() {
+	in := make(chan uint32, 1)
+	out := make(chan uint32, 1)
+	c := &Counter{limit: 9}
+	go c.Run(in, out)
+	for i := uint32(0); i < 4; i++ {
+		in <- i
+		<-out
+	}
+}
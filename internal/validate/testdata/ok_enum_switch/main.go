@@ -0,0 +1,38 @@
+package main
+
+type state uint8
+
+const (
+	Idle state = iota
+	Hdr
+	Body
+)
+
+func parser(in <-chan uint8, out chan<- uint8) {
+	st := Idle
+	for {
+		b := <-in
+		switch st {
+		case Idle:
+			if b == 0xAA {
+				st = Hdr
+			}
+		case Hdr:
+			st = Body
+		}
+		if st == Body {
+			out <- b
+			st = Idle
+		}
+	}
+}
+
+func main() {
+	in := make(chan uint8, 2)
+	out := make(chan uint8, 2)
+	go parser(in, out)
+	in <- 0xAA
+	in <- 1
+	in <- 7
+	<-out
+}
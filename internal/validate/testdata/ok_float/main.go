@@ -0,0 +1,23 @@
+package main
+
+func scale(in <-chan float32, out chan<- int32) {
+	gain := float32(1.5)
+	for i := 0; i < 4; i++ {
+		v := <-in
+		y := v*gain - 0.25
+		if y < 0 {
+			y = -y
+		}
+		out <- int32(y)
+	}
+}
+
+func main() {
+	in := make(chan float32, 1)
+	out := make(chan int32, 1)
+	go scale(in, out)
+	for i := int32(0); i < 4; i++ {
+		in <- float32(i)
+		<-out
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+const size = 8
+
+type count uint8
+
+func sink(v uint32) {}
+
+func main() {
+	var arr [4]uint32
+	for i := range size {
+		sink(uint32(i))
+	}
+	for i := range arr {
+		arr[i] = uint32(i)
+	}
+	for i := int32(size - 1); i >= 0; i-- {
+		sink(uint32(i))
+	}
+	for i := count(0); i < count(size); i += 2 {
+		if i == 4 {
+			break
+		}
+		sink(uint32(i))
+	}
+	for _, v := range arr {
+		sink(v)
+	}
+}
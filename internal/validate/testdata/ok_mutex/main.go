@@ -0,0 +1,36 @@
+package main
+
+import "sync"
+
+var (
+	mu    sync.Mutex
+	total int32 = 7
+)
+
+func worker(id int32, n *int32, lock *sync.Mutex, wg *sync.WaitGroup) {
+	defer wg.Done()
+	for i := int32(0); i < 4; i++ {
+		lock.Lock()
+		*n = *n + id
+		lock.Unlock()
+		mu.Lock()
+		total += id
+		mu.Unlock()
+	}
+}
+
+func main() {
+	var wg sync.WaitGroup
+	var m sync.Mutex
+	var count int32
+	wg.Add(2)
+	go worker(1, &count, &m, &wg)
+	go worker(2, &count, &m, &wg)
+	wg.Wait()
+	m.Lock()
+	println(count)
+	m.Unlock()
+	mu.Lock()
+	defer mu.Unlock()
+	println(total)
+}
@@ -0,0 +1,16 @@
+package main
+
+func stage(in <-chan uint32, out chan<- uint32) {
+	for {
+		v := <-in
+		out <- v + 1
+	}
+}
+
+func main() {
+	in := make(chan uint32, 1)
+	out := make(chan uint32, 1)
+	go stage(in, out)
+	in <- 1
+	_ = <-out
+}
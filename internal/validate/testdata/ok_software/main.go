@@ -0,0 +1,41 @@
+package main
+
+// stimulus feeds the scaler from a small generator. It stays in Go, so it
+// may use constructs the hardware subset rejects.
+//
+//mygo:software
+func stimulus(out chan<- int32) {
+	seed := uint32(1)
+	for {
+		seed = seed*1664525 + 1013904223
+		out <- int32(seed >> 25)
+	}
+}
+
+// checker counts distinct results from the hardware.
+//
+//mygo:software
+func checker(in <-chan int32, done chan<- bool) {
+	seen := map[int32]int{}
+	for i := 0; i < 8; i++ {
+		seen[<-in]++
+	}
+	done <- len(seen) > 0
+}
+
+func scale(in <-chan int32, out chan<- int32) {
+	for {
+		v := <-in
+		out <- v * 3
+	}
+}
+
+func main() {
+	raw := make(chan int32)
+	scaled := make(chan int32, 2)
+	done := make(chan bool)
+	go stimulus(raw)
+	go scale(raw, scaled)
+	go checker(scaled, done)
+	<-done
+}
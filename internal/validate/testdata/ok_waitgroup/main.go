@@ -0,0 +1,19 @@
+package main
+
+import "sync"
+
+func worker(id uint32, wg *sync.WaitGroup, out chan<- uint32) {
+	defer wg.Done()
+	out <- id
+}
+
+func main() {
+	var wg sync.WaitGroup
+	out := make(chan uint32, 2)
+	wg.Add(2)
+	go worker(1, &wg, out)
+	go worker(2, &wg, out)
+	wg.Wait()
+	<-out
+	<-out
+}
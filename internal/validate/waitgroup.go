@@ -0,0 +1,144 @@
+package validate
+
+import (
+	"go/constant"
+	"slices"
+
+	"golang.org/x/tools/go/ssa"
+
+	"mygo/internal/ssainfo"
+)
+
+// checkWaitGroups validates every sync.WaitGroup use in fn. A group must be a
+// local variable whose constant Add total matches the goroutines it is passed
+// to, and each of those goroutines must call Done exactly once.
+func (c *checker) checkWaitGroups(fn *ssa.Function, loopBlocks map[*ssa.BasicBlock]bool) {
+	for _, block := range fn.Blocks {
+		for _, instr := range block.Instrs {
+			var common *ssa.CallCommon
+			switch inst := instr.(type) {
+			case *ssa.Call:
+				common = &inst.Call
+			case *ssa.Defer:
+				common = &inst.Call
+			case *ssa.Alloc:
+				if ssainfo.IsWaitGroupPointer(inst.Type()) {
+					c.checkWaitGroupOwner(fn, inst, loopBlocks)
+				}
+				continue
+			default:
+				continue
+			}
+			method := ssainfo.WaitGroupMethod(common)
+			if method == "" || len(common.Args) == 0 {
+				continue
+			}
+			switch recv := common.Args[0].(type) {
+			case *ssa.Alloc:
+				// Checked with its owner.
+			case *ssa.Parameter:
+				if method != "Done" {
+					c.error(instr.Pos(), "goroutines may only call Done on a WaitGroup they receive; %s must stay in the creating function", method)
+				}
+			default:
+				c.error(instr.Pos(), "WaitGroup %s must be a local variable of the spawning function", describeValue(recv))
+			}
+		}
+	}
+	for _, param := range fn.Params {
+		if ssainfo.IsWaitGroupPointer(param.Type()) {
+			c.checkWaitGroupParam(fn, param, loopBlocks)
+		}
+	}
+}
+
+func (c *checker) checkWaitGroupOwner(fn *ssa.Function, wg *ssa.Alloc, loopBlocks map[*ssa.BasicBlock]bool) {
+	var added, spawned int64
+	for _, ref := range *wg.Referrers() {
+		switch inst := ref.(type) {
+		case *ssa.DebugRef:
+		case *ssa.Call:
+			switch ssainfo.WaitGroupMethod(&inst.Call) {
+			case "Add":
+				if loopBlocks[inst.Block()] {
+					c.error(inst.Pos(), "WaitGroup.Add must not be called inside a loop")
+					continue
+				}
+				delta, ok := inst.Call.Args[1].(*ssa.Const)
+				if !ok || delta.Value == nil || delta.Value.Kind() != constant.Int {
+					c.error(inst.Pos(), "WaitGroup.Add count must be a compile-time constant")
+					continue
+				}
+				n, _ := constant.Int64Val(delta.Value)
+				added += n
+			case "Wait":
+			default:
+				c.error(inst.Pos(), "WaitGroup %s only supports Add and Wait in the creating function", wg.Comment)
+			}
+		case *ssa.Go:
+			spawned++
+		default:
+			c.error(ref.Pos(), "WaitGroup %s may only be used by Add, Wait, or passed to a go statement", wg.Comment)
+		}
+	}
+	if added != spawned {
+		c.error(wg.Pos(), "WaitGroup %s adds %d but is passed to %d goroutine(s); Add counts must match the spawns", wg.Comment, added, spawned)
+	}
+}
+
+// checkWaitGroupParam requires a goroutine to call Done on the group it
+// receives exactly once, either deferred or as its last statement. The
+// barrier releases on the members' done outputs, so a Done followed by more
+// work would release Wait before the work it guards has happened.
+func (c *checker) checkWaitGroupParam(fn *ssa.Function, param *ssa.Parameter, loopBlocks map[*ssa.BasicBlock]bool) {
+	done := 0
+	for _, ref := range *param.Referrers() {
+		var common *ssa.CallCommon
+		deferred := false
+		switch inst := ref.(type) {
+		case *ssa.DebugRef:
+			continue
+		case *ssa.Call:
+			common = &inst.Call
+		case *ssa.Defer:
+			common = &inst.Call
+			deferred = true
+		}
+		method := ssainfo.WaitGroupMethod(common)
+		if method == "" {
+			c.error(ref.Pos(), "WaitGroup parameter %s may only be used to call Done", param.Name())
+			continue
+		}
+		if method != "Done" {
+			// Reported by checkWaitGroups.
+			continue
+		}
+		if loopBlocks[ref.Block()] {
+			c.error(ref.Pos(), "WaitGroup.Done must not be called inside a loop")
+		}
+		if !deferred && !endsFunction(ref) {
+			c.error(ref.Pos(), "WaitGroup.Done must be deferred or be the last statement of %s; Wait is released only when the goroutine returns", fn.Name())
+		}
+		done++
+	}
+	if done != 1 {
+		c.error(param.Pos(), "goroutine %s must call Done on WaitGroup %s exactly once; found %d", fn.Name(), param.Name(), done)
+	}
+}
+
+// endsFunction reports whether instr is followed only by the return of its
+// block.
+func endsFunction(instr ssa.Instruction) bool {
+	instrs := instr.Block().Instrs
+	after := instrs[slices.Index(instrs, instr)+1:]
+	for _, next := range after {
+		switch next.(type) {
+		case *ssa.DebugRef, *ssa.RunDefers:
+		case *ssa.Return:
+			return true
+		default:
+			return false
+		}
+	}
+	return false
+}
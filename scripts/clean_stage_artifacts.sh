@@ -1,5 +1,5 @@
 #!/usr/bin/env bash
-# Remove generated stage artifacts (ssa/ir/mlir/sv and *_fifos.sv).
+# Remove generated stage artifacts (ssa/ir/mlir and *_fifos.sv).
 # Usage: ./scripts/clean_stage_artifacts.sh [case ...]
 # When no cases are provided, cleans all under tests/stages.
 
@@ -18,7 +18,6 @@ clean_case() {
 		-name 'main.ssa' -o \
 		-name 'main.ir' -o \
 		-name 'main.mlir' -o \
-		-name 'main.sv' -o \
 		-name '*_fifos.sv' \
 	\) -print -delete
 }
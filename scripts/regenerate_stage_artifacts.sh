@@ -1,7 +1,9 @@
 #!/usr/bin/env bash
-# Regenerate textual artifacts (SSA/IR/MLIR/SV) for stage workloads.
+# Regenerate textual artifacts (SSA/IR/MLIR and FIFO sources) for stage workloads.
 # Usage: ./scripts/regenerate_stage_artifacts.sh [case ...]
 # When no cases are provided it discovers all tests/stages/*/main.go.
+# The Verilog circt-opt exports is not tracked: it changes with the CIRCT
+# release, so only the FIFO sources the backend writes next to it are kept.
 
 set -euo pipefail
 
@@ -9,7 +11,7 @@ ROOT="$(cd "$(dirname "$0")/.." && pwd)"
 GOCACHE="${GOCACHE:-${ROOT}/.gocache}"
 FIFO_SRC="${FIFO_SRC:-${ROOT}/internal/backend/templates/simple_fifo.sv}"
 LOWER_OPTS="${LOWER_OPTS:-locationInfoStyle=none,omitVersionComment}"
-EMITS="${EMITS:-ssa ir mlir sv}"
+EMITS="${EMITS:-ssa ir mlir fifos}"
 
 mkdir -p "${GOCACHE}"
 export GOCACHE
@@ -51,13 +53,22 @@ run_case() {
 			mlir)
 				go run ./cmd/mygo compile -emit=mlir -o "${dir}/main.mlir" "${src}"
 				;;
-			sv|verilog)
-			go run ./cmd/mygo compile \
-				-emit=verilog \
-				--circt-lowering-options="${LOWER_OPTS}" \
-				${extra:+"${extra[@]}"} \
-				-o "${dir}/main.sv" \
-				"${src}"
+			fifos)
+				if [[ ${#extra[@]} -eq 0 ]]; then
+					continue
+				fi
+				local tmp
+				tmp="$(mktemp -d)"
+				go run ./cmd/mygo compile \
+					-emit=verilog \
+					--circt-lowering-options="${LOWER_OPTS}" \
+					"${extra[@]}" \
+					-o "${tmp}/main.sv" \
+					"${src}"
+				if [[ -f "${tmp}/main_fifos.sv" ]]; then
+					cp "${tmp}/main_fifos.sv" "${dir}/main_fifos.sv"
+				fi
+				rm -rf "${tmp}"
 				;;
 			*)
 				echo "unknown emit ${kind}, skipping" >&2
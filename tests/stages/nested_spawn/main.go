@@ -0,0 +1,31 @@
+package main
+
+import "fmt"
+
+func leaf(k uint32, in <-chan uint32, out chan<- uint32) {
+	v := <-in
+	out <- v * k
+}
+
+func mid(k uint32, in <-chan uint32, out chan<- uint32) {
+	tmp := make(chan uint32, 1)
+	go leaf(k, in, tmp)
+	v := <-tmp
+	out <- v + 1
+}
+
+func main() {
+	a := make(chan uint32, 1)
+	b := make(chan uint32, 1)
+	c := make(chan uint32, 1)
+	d := make(chan uint32, 1)
+
+	go mid(2, a, b)
+	go mid(3, c, d)
+
+	a <- 5
+	c <- 7
+	x := <-b
+	y := <-d
+	fmt.Printf("results %d %d\n", x, y)
+}
@@ -15,27 +15,29 @@ module mygo_fifo #(
   inout  wire                   in_ready,
   inout  wire [WIDTH-1:0]       out_data,
   inout  wire                   out_valid,
-  inout  wire                   out_ready
+  inout  wire                   out_ready,
+  output wire [COUNT_BITS-1:0]  count
 );
   reg [WIDTH-1:0] mem [0:DEPTH-1];
   reg [ADDR_BITS-1:0] wptr;
   reg [ADDR_BITS-1:0] rptr;
-  reg [COUNT_BITS-1:0] count;
+  reg [COUNT_BITS-1:0] level;
 
-  wire ready_int = (count < COUNT_BITS'(DEPTH));
-  wire valid_int = (count != 0);
+  wire ready_int = (level < COUNT_BITS'(DEPTH));
+  wire valid_int = (level != 0);
   wire push = in_valid & ready_int;
   wire pop  = valid_int & out_ready;
 
   assign in_ready  = ready_int;
   assign out_valid = valid_int;
   assign out_data  = mem[rptr];
+  assign count     = level;
 
   always @(posedge clk) begin
     if (rst) begin
       wptr  <= {ADDR_BITS{1'b0}};
       rptr  <= {ADDR_BITS{1'b0}};
-      count <= {COUNT_BITS{1'b0}};
+      level <= {COUNT_BITS{1'b0}};
     end else begin
       if (push) begin
         mem[wptr] <= in_data;
@@ -57,9 +59,9 @@ module mygo_fifo #(
         end
       end
       case ({push, pop})
-        2'b10: count <= count + 1'b1;
-        2'b01: count <= count - 1'b1;
-        default: count <= count;
+        2'b10: level <= level + 1'b1;
+        2'b01: level <= level - 1'b1;
+        default: level <= level;
       endcase
     end
   end
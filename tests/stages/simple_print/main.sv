@@ -1,9 +0,0 @@
-module main(
-  input clk,
-        rst
-);
-
-  always @(posedge clk)
-    $fwrite(32'h80000001, "x=%d\n", 32'h2A);
-endmodule
-
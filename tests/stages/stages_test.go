@@ -10,13 +10,12 @@ import (
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
-)
 
-const (
-	compareLoweringOptions = "locationInfoStyle=none,omitVersionComment"
-	workloadsRoot          = "tests/stages"
+	"mygo/internal/ir"
 )
 
+const workloadsRoot = "tests/stages"
+
 type harness struct {
 	repoRoot string
 	fifoLib  string
@@ -42,6 +41,7 @@ var testCases = []testCase{
 	{Name: "pipeline1", Group: "pipelines", NeedsFIFO: true, SimCycles: 10},
 	{Name: "pipeline2", Group: "pipelines", NeedsFIFO: true, SimCycles: 12},
 	{Name: "router_csp", Group: "channels", NeedsFIFO: true, SimCycles: 16},
+	{Name: "nested_spawn", Group: "channels", NeedsFIFO: true, SimCycles: 12},
 }
 
 var (
@@ -50,21 +50,21 @@ var (
 	compareGoldens     = goldensEnabled()
 )
 
-func TestMLIRGeneration(t *testing.T) {
+func TestIRGeneration(t *testing.T) {
 	runStageTests(t, func(t *testing.T, h harness, tc testCase) {
 		dir := filepath.Join(workloadsRoot, tc.Name)
 		source := filepath.Join(dir, "main.go")
-		mlirGolden := filepath.Join(dir, "main.mlir.golden")
-		maybeVerifyMLIR(t, h.repoRoot, source, mlirGolden)
+		irGolden := filepath.Join(dir, "main.ir")
+		maybeVerifyIR(t, h.repoRoot, source, irGolden)
 	})
 }
 
-func TestVerilogGeneration(t *testing.T) {
+func TestMLIRGeneration(t *testing.T) {
 	runStageTests(t, func(t *testing.T, h harness, tc testCase) {
 		dir := filepath.Join(workloadsRoot, tc.Name)
 		source := filepath.Join(dir, "main.go")
-		verilogGolden := filepath.Join(dir, "main.sv.golden")
-		maybeVerifyVerilog(t, h.repoRoot, source, verilogGolden, h.fifoLib, tc.NeedsFIFO)
+		mlirGolden := filepath.Join(dir, "main.mlir.golden")
+		maybeVerifyMLIR(t, h.repoRoot, source, mlirGolden)
 	})
 }
 
@@ -146,6 +146,71 @@ func TestSimulationVerilogOutWritesArtifacts(t *testing.T) {
 	}
 }
 
+// TestNestedSpawnOverLocalChannel compiles a goroutine that makes a channel
+// and spawns a child on it, started by two go statements. The function gets
+// one module, placed twice, that holds the channel and its FIFO, and the IR
+// verifies after every pass.
+func TestNestedSpawnOverLocalChannel(t *testing.T) {
+	h := newHarness(t)
+	tc := getTestCase(t, "nested_spawn")
+	source := filepath.Join(workloadsRoot, tc.Name, "main.go")
+	output := filepath.Join(t.TempDir(), "main.mlir")
+	runGoCommand(t, h.repoRoot, "run", "./cmd/mygo", "compile", "-emit=mlir", "--verify-ir", "-o", output, source)
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatalf("read %s: %v", output, err)
+	}
+	mlir := string(data)
+	if got := strings.Count(mlir, "hw.module @main__proc_mid("); got != 1 {
+		t.Fatalf("want one module for mid, got %d:\n%s", got, mlir)
+	}
+	if strings.Contains(mlir, "@main__proc_mid_1") {
+		t.Fatalf("mid was emitted twice:\n%s", mlir)
+	}
+	if got := strings.Count(mlir, "@main__proc_mid(clk:"); got != 2 {
+		t.Fatalf("want two instances of mid, got %d:\n%s", got, mlir)
+	}
+	_, mid, _ := strings.Cut(mlir, "hw.module @main__proc_mid(")
+	ports, body, _ := strings.Cut(mid, ") {")
+	body, _, _ = strings.Cut(body, "\n  }")
+	if strings.Contains(ports, "chan_t0_1_") {
+		t.Fatalf("the channel mid makes became a port of its module: %s", ports)
+	}
+	if !strings.Contains(body, `hw.instance "t0_1_fifo"`) {
+		t.Fatalf("the channel mid makes has no FIFO in its module:\n%s", body)
+	}
+}
+
+// TestIRArtifactsRoundTrip checks that every checked-in main.ir still parses
+// and prints back unchanged, so the artifacts follow the current IR syntax.
+func TestIRArtifactsRoundTrip(t *testing.T) {
+	h := newHarness(t)
+	paths, err := filepath.Glob(filepath.Join(h.repoRoot, workloadsRoot, "*", "main.ir"))
+	if err != nil {
+		t.Fatalf("glob IR artifacts: %v", err)
+	}
+	if len(paths) == 0 {
+		t.Fatalf("no IR artifacts under %s", workloadsRoot)
+	}
+	for _, path := range paths {
+		t.Run(filepath.Base(filepath.Dir(path)), func(t *testing.T) {
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("read %s: %v", path, err)
+			}
+			design, err := ir.Parse(bytes.NewReader(want))
+			if err != nil {
+				t.Fatalf("parse %s: %v", path, err)
+			}
+			var got bytes.Buffer
+			ir.Dump(design, &got)
+			if diff := cmp.Diff(string(want), got.String()); diff != "" {
+				t.Fatalf("%s does not round-trip (-file +dump):\n%s", path, diff)
+			}
+		})
+	}
+}
+
 func runStageTests(t *testing.T, fn func(*testing.T, harness, testCase)) {
 	t.Helper()
 	h := newHarness(t)
@@ -189,45 +254,35 @@ func newHarness(t *testing.T) harness {
 	return harness{repoRoot: repoRoot, fifoLib: fifoLib}
 }
 
-func maybeVerifyMLIR(t *testing.T, repoRoot, source, golden string) {
+// maybeVerifyIR compares the IR left after the default passes with the
+// checked-in main.ir, so a pass that stops folding or removing code shows up
+// as a diff.
+func maybeVerifyIR(t *testing.T, repoRoot, source, golden string) {
 	t.Helper()
 	if !compareGoldens {
-		t.Logf("skipping MLIR golden for %s: MYGO_COMPARE_GOLDENS not enabled", source)
+		t.Logf("skipping IR golden for %s: MYGO_COMPARE_GOLDENS not enabled", source)
 		return
 	}
 	if !fileExists(t, filepath.Join(repoRoot, golden)) {
 		return
 	}
-	output := filepath.Join(t.TempDir(), "main.mlir")
-	args := []string{"run", "./cmd/mygo", "compile", "-emit=mlir", "-o", output, source}
+	output := filepath.Join(t.TempDir(), "main.ir")
+	args := []string{"run", "./cmd/mygo", "compile", "-emit=ir", "-o", output, source}
 	runGoCommand(t, repoRoot, args...)
 	compareTextFiles(t, filepath.Join(repoRoot, golden), output)
 }
 
-func maybeVerifyVerilog(t *testing.T, repoRoot, source, golden, fifoLib string, needsFIFO bool) {
+func maybeVerifyMLIR(t *testing.T, repoRoot, source, golden string) {
 	t.Helper()
 	if !compareGoldens {
-		t.Logf("skipping Verilog golden for %s: MYGO_COMPARE_GOLDENS not enabled", source)
+		t.Logf("skipping MLIR golden for %s: MYGO_COMPARE_GOLDENS not enabled", source)
 		return
 	}
 	if !fileExists(t, filepath.Join(repoRoot, golden)) {
 		return
 	}
-	if !circtOptAvailable {
-		t.Logf("skipping verilog check for %s: circt-opt not on PATH", source)
-		return
-	}
-	output := filepath.Join(t.TempDir(), "main.sv")
-	args := []string{
-		"run", "./cmd/mygo", "compile",
-		"-emit=verilog",
-		"--circt-lowering-options", compareLoweringOptions,
-		"-o", output,
-	}
-	if needsFIFO {
-		args = append(args, "--fifo-src", fifoLib)
-	}
-	args = append(args, source)
+	output := filepath.Join(t.TempDir(), "main.mlir")
+	args := []string{"run", "./cmd/mygo", "compile", "-emit=mlir", "-o", output, source}
 	runGoCommand(t, repoRoot, args...)
 	compareTextFiles(t, filepath.Join(repoRoot, golden), output)
 }